@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRegistry decodes Avro messages in the Confluent wire format (a zero
+// magic byte, a 4-byte schema id, then the Avro binary body), fetching each
+// writer schema from a Confluent Schema Registry the first time it's seen
+type schemaRegistry struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	schemas map[uint32]*avroSchema
+}
+
+func newSchemaRegistry(url string) *schemaRegistry {
+	return &schemaRegistry{
+		url:     strings.TrimRight(url, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		schemas: map[uint32]*avroSchema{},
+	}
+}
+
+// schema returns the writer schema registered under id
+func (r *schemaRegistry) schema(id uint32) (*avroSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.schemas[id]; ok {
+		return s, nil
+	}
+
+	resp, err := r.client.Get(fmt.Sprintf("%s/schemas/ids/%d", r.url, id))
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching schema %d: registry returned %s", id, resp.Status)
+	}
+	var body struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("reading schema %d: %w", id, err)
+	}
+	if body.SchemaType != "" && body.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("schema %d is %s, not Avro", id, body.SchemaType)
+	}
+
+	s, err := parseAvroSchema([]byte(body.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema %d: %w", id, err)
+	}
+	r.schemas[id] = s
+	return s, nil
+}
+
+// decodeEvent decodes a Debezium envelope written with the Avro converter
+func (r *schemaRegistry) decodeEvent(value []byte) (DebeziumEvent, error) {
+	if len(value) < 5 || value[0] != 0 {
+		return DebeziumEvent{}, fmt.Errorf("decoding event: not in the Confluent Avro wire format")
+	}
+	schema, err := r.schema(binary.BigEndian.Uint32(value[1:5]))
+	if err != nil {
+		return DebeziumEvent{}, err
+	}
+	decoded, err := (&avroReader{buf: value[5:]}).read(schema)
+	if err != nil {
+		return DebeziumEvent{}, fmt.Errorf("decoding event: %w", err)
+	}
+	envelope, ok := decoded.(map[string]any)
+	if !ok {
+		return DebeziumEvent{}, fmt.Errorf("decoding event: expected a record, got %T", decoded)
+	}
+	return eventFromAvro(envelope)
+}
+
+// eventFromAvro fills a DebeziumEvent from a decoded Avro envelope, which has
+// the same fields as the JSON converter's payload
+func eventFromAvro(envelope map[string]any) (DebeziumEvent, error) {
+	var event DebeziumEvent
+	op, _ := envelope["op"].(string)
+	if op == "" {
+		return event, fmt.Errorf("message is not a Debezium change event (no 'op')")
+	}
+	event.Payload.Op = op
+	switch ts := envelope["ts_ms"].(type) {
+	case int64:
+		event.Payload.TsMs = ts
+	case int32:
+		event.Payload.TsMs = int64(ts)
+	}
+	if source, ok := envelope["source"].(map[string]any); ok {
+		event.Payload.Source.DB, _ = source["db"].(string)
+		event.Payload.Source.Table, _ = source["table"].(string)
+		switch ts := source["ts_ms"].(type) {
+		case int64:
+			event.Payload.Source.TsMs = ts
+		case int32:
+			event.Payload.Source.TsMs = int64(ts)
+		}
+	}
+	event.Payload.Before, _ = envelope["before"].(map[string]any)
+	event.Payload.After, _ = envelope["after"].(map[string]any)
+	return event, nil
+}
+
+// avroSchema is one node of a parsed Avro schema
+type avroSchema struct {
+	typ     string // null, boolean, int, ..., record, enum, array, map, fixed or union
+	name    string // full name, for named types
+	logical string
+	scale   int // decimal
+	// connect is the Kafka Connect logical type Debezium names in
+	// "connect.name", converted as the JSON converter's schema would be
+	connect  connectSchema
+	size     int // fixed
+	fields   []avroField
+	symbols  []string      // enum
+	items    *avroSchema   // array items and map values
+	branches []*avroSchema // union
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseAvroSchema parses a schema in Avro's JSON form
+func parseAvroSchema(data []byte) (*avroSchema, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	p := avroSchemaParser{named: map[string]*avroSchema{}}
+	return p.parse(v, "")
+}
+
+// avroSchemaParser tracks named types so later references to them resolve
+type avroSchemaParser struct {
+	named map[string]*avroSchema
+}
+
+func (p *avroSchemaParser) parse(v any, namespace string) (*avroSchema, error) {
+	switch v := v.(type) {
+	case string:
+		if avroPrimitives[v] {
+			return &avroSchema{typ: v}, nil
+		}
+		if s, ok := p.named[fullName(v, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := p.named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+
+	case []any:
+		union := &avroSchema{typ: "union"}
+		for _, branch := range v {
+			s, err := p.parse(branch, namespace)
+			if err != nil {
+				return nil, err
+			}
+			union.branches = append(union.branches, s)
+		}
+		return union, nil
+
+	case map[string]any:
+		return p.parseComplex(v, namespace)
+
+	default:
+		return nil, fmt.Errorf("unexpected schema %v", v)
+	}
+}
+
+func (p *avroSchemaParser) parseComplex(m map[string]any, namespace string) (*avroSchema, error) {
+	typ, ok := m["type"].(string)
+	if !ok {
+		// {"type": {...}} wraps another schema
+		return p.parse(m["type"], namespace)
+	}
+	logical, _ := m["logicalType"].(string)
+	connect := connectType(m)
+
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		name, _ := m["name"].(string)
+		if ns, ok := m["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		s := &avroSchema{typ: typ, name: fullName(name, namespace), logical: logical, connect: connect}
+		if i := strings.LastIndex(s.name, "."); i >= 0 {
+			namespace = s.name[:i]
+		}
+		// Registered first, so a record can refer to itself
+		p.named[s.name] = s
+
+		switch typ {
+		case "enum":
+			symbols, _ := m["symbols"].([]any)
+			for _, sym := range symbols {
+				name, _ := sym.(string)
+				s.symbols = append(s.symbols, name)
+			}
+		case "fixed":
+			size, _ := m["size"].(float64)
+			s.size = int(size)
+			scale, _ := m["scale"].(float64)
+			s.scale = int(scale)
+		default:
+			s.typ = "record"
+			fields, _ := m["fields"].([]any)
+			for _, f := range fields {
+				fm, _ := f.(map[string]any)
+				name, _ := fm["name"].(string)
+				fs, err := p.parse(fm["type"], namespace)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", s.name, name, err)
+				}
+				s.fields = append(s.fields, avroField{name: name, schema: fs})
+			}
+		}
+		return s, nil
+
+	case "array":
+		items, err := p.parse(m["items"], namespace)
+		return &avroSchema{typ: typ, items: items}, err
+
+	case "map":
+		values, err := p.parse(m["values"], namespace)
+		return &avroSchema{typ: typ, items: values}, err
+
+	default:
+		s, err := p.parse(typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if logical == "" && connect.Name == "" {
+			return s, nil
+		}
+		scale, _ := m["scale"].(float64)
+		return &avroSchema{typ: s.typ, logical: logical, scale: int(scale), connect: connect}, nil
+	}
+}
+
+// connectType reads the Kafka Connect type the Avro converter records
+// alongside the Avro one, e.g. "connect.name": "io.debezium.time.Date" on an
+// int; Debezium's temporal types carry no Avro logicalType of their own
+func connectType(m map[string]any) connectSchema {
+	name, _ := m["connect.name"].(string)
+	c := connectSchema{Name: name}
+	if params, ok := m["connect.parameters"].(map[string]any); ok {
+		c.Parameters = make(map[string]string, len(params))
+		for k, v := range params {
+			c.Parameters[k], _ = v.(string)
+		}
+	}
+	return c
+}
+
+// fullName qualifies name with namespace unless it already is
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// avroReader decodes Avro binary data. Unions decode to the chosen branch's
+// value. Debezium's Kafka Connect types go through convertConnectValue, so
+// they come out as they would from the JSON converter, and Avro logical types
+// to the same forms: decimals to exact json.Numbers, dates to YYYY-MM-DD,
+// timestamps to RFC 3339 strings in UTC and times of day to HH:MM:SS strings.
+type avroReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *avroReader) read(s *avroSchema) (any, error) {
+	v, err := r.readType(s)
+	if err != nil || v == nil {
+		return v, err
+	}
+	if s.connect.Name != "" {
+		// A struct was converted field by field as it was read
+		if v, err = convertConnectValue(s.connect, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.connect.Name, err)
+		}
+	}
+	if s.logical == "" {
+		return v, nil
+	}
+	return avroLogical(s, v)
+}
+
+func (r *avroReader) readType(s *avroSchema) (any, error) {
+	switch s.typ {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int":
+		n, err := r.long()
+		return int32(n), err
+	case "long":
+		return r.long()
+	case "float":
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case "double":
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes":
+		b, err := r.bytes()
+		return append([]byte(nil), b...), err
+	case "string":
+		b, err := r.bytes()
+		return string(b), err
+	case "fixed":
+		b, err := r.next(s.size)
+		return append([]byte(nil), b...), err
+
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.symbols) {
+			return nil, fmt.Errorf("%s: enum index %d out of range", s.name, i)
+		}
+		return s.symbols[i], nil
+
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.branches) {
+			return nil, fmt.Errorf("union index %d out of range", i)
+		}
+		return r.read(s.branches[i])
+
+	case "record":
+		record := make(map[string]any, len(s.fields))
+		for _, f := range s.fields {
+			v, err := r.read(f.schema)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.name, f.name, err)
+			}
+			record[f.name] = v
+		}
+		return record, nil
+
+	case "array":
+		items := []any{}
+		err := r.blocks(func() error {
+			v, err := r.read(s.items)
+			items = append(items, v)
+			return err
+		})
+		return items, err
+
+	case "map":
+		m := map[string]any{}
+		err := r.blocks(func() error {
+			k, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			v, err := r.read(s.items)
+			m[string(k)] = v
+			return err
+		})
+		return m, err
+
+	default:
+		return nil, fmt.Errorf("unsupported type %q", s.typ)
+	}
+}
+
+// blocks reads the blocks of an array or map, calling item for each entry
+func (r *avroReader) blocks(item func() error) error {
+	for {
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if n < 0 {
+			// A negative count is followed by the block's size in bytes
+			n = -n
+			if _, err := r.long(); err != nil {
+				return err
+			}
+		}
+		for ; n > 0; n-- {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// long reads a zig-zag varint
+func (r *avroReader) long() (int64, error) {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.next(1)
+		if err != nil {
+			return 0, err
+		}
+		u |= uint64(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			return int64(u>>1) ^ -int64(u&1), nil
+		}
+	}
+	return 0, fmt.Errorf("varint overflows a long")
+}
+
+func (r *avroReader) bytes() ([]byte, error) {
+	n, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("negative length %d", n)
+	}
+	return r.next(int(n))
+}
+
+func (r *avroReader) next(n int) ([]byte, error) {
+	if n > len(r.buf)-r.pos {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// avroLogical converts a logical type's underlying value; unknown logical
+// types keep it unchanged, as the spec requires
+func avroLogical(s *avroSchema, v any) (any, error) {
+	switch s.logical {
+	case "decimal":
+		b, ok := v.([]byte)
+		if !ok {
+			return v, nil
+		}
+		return decimalNumber(b, s.scale), nil
+	case "date":
+		if days, ok := v.(int32); ok {
+			return time.Unix(int64(days)*86400, 0).UTC().Format(time.DateOnly), nil
+		}
+	case "time-millis":
+		if ms, ok := v.(int32); ok {
+			return time.UnixMilli(int64(ms)).UTC().Format("15:04:05.000"), nil
+		}
+	case "time-micros":
+		if us, ok := v.(int64); ok {
+			return time.UnixMicro(us).UTC().Format("15:04:05.000000"), nil
+		}
+	case "timestamp-millis", "local-timestamp-millis":
+		if ms, ok := v.(int64); ok {
+			return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), nil
+		}
+	case "timestamp-micros", "local-timestamp-micros":
+		if us, ok := v.(int64); ok {
+			return time.UnixMicro(us).UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return v, nil
+}
+
+// decimalNumber renders a big-endian two's-complement unscaled value as an
+// exact decimal, so it reaches XTDB as a JSON number without float rounding
+func decimalNumber(b []byte, scale int) json.Number {
+	unscaled := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b))*8))
+	}
+	if scale <= 0 {
+		return json.Number(unscaled.String())
+	}
+	rat := new(big.Rat).SetFrac(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	return json.Number(rat.FloatString(scale))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// customersSchema is the shape of the value schema Debezium's Avro converter
+// registers for a Postgres table
+const customersSchema = `{
+  "type": "record", "name": "Envelope", "namespace": "dbserver1.inventory.customers",
+  "fields": [
+    {"name": "before", "type": ["null", {
+      "type": "record", "name": "Value",
+      "fields": [
+        {"name": "id", "type": "int"},
+        {"name": "name", "type": "string"},
+        {"name": "balance", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+        {"name": "born", "type": {"type": "int", "logicalType": "date"}},
+        {"name": "updated", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+        {"name": "nickname", "type": ["null", "string"], "default": null},
+        {"name": "signup", "type": {"type": "int", "connect.version": 1, "connect.name": "io.debezium.time.Date"}},
+        {"name": "seen", "type": {"type": "long", "connect.version": 1, "connect.name": "io.debezium.time.MicroTimestamp"}},
+        {"name": "credit", "type": {"type": "bytes", "connect.name": "org.apache.kafka.connect.data.Decimal",
+          "connect.parameters": {"scale": "1"}}}
+      ]}], "default": null},
+    {"name": "after", "type": ["null", "Value"], "default": null},
+    {"name": "source", "type": {
+      "type": "record", "name": "Source", "namespace": "io.debezium.connector.postgresql",
+      "fields": [{"name": "db", "type": "string"}, {"name": "table", "type": "string"}]}},
+    {"name": "op", "type": "string"},
+    {"name": "ts_ms", "type": ["null", "long"], "default": null}
+  ]
+}`
+
+// avroLong encodes n as a zig-zag varint
+func avroLong(n int64) []byte {
+	u := uint64(n<<1) ^ uint64(n>>63)
+	var b []byte
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+func avroString(s string) []byte {
+	return append(avroLong(int64(len(s))), s...)
+}
+
+// cannedCustomerInsert is a create event for customer 42 under schema id 7
+func cannedCustomerInsert() []byte {
+	msg := []byte{0, 0, 0, 0, 7}                     // magic byte, schema id
+	msg = append(msg, avroLong(0)...)                // before: null
+	msg = append(msg, avroLong(1)...)                // after: Value
+	msg = append(msg, avroLong(42)...)               // id
+	msg = append(msg, avroString("Alice")...)        // name
+	msg = append(msg, avroLong(2)...)                // balance: 2 bytes,
+	msg = append(msg, 0xfb, 0x2e)                    // -1234 unscaled
+	msg = append(msg, avroLong(10971)...)            // born: 2000-01-15
+	msg = append(msg, avroLong(1704067200123456)...) // updated
+	msg = append(msg, avroLong(1)...)                // nickname: string
+	msg = append(msg, avroString("Al")...)           // "Al"
+	msg = append(msg, avroLong(19723)...)            // signup: 2024-01-01
+	msg = append(msg, avroLong(1704067200123456)...) // seen
+	msg = append(msg, avroLong(1)...)                // credit: 1 byte,
+	msg = append(msg, 0x7b)                          // 123 unscaled
+	msg = append(msg, avroString("inventory")...)    // source.db
+	msg = append(msg, avroString("customers")...)    // source.table
+	msg = append(msg, avroString("c")...)            // op
+	msg = append(msg, avroLong(1)...)                // ts_ms: long
+	msg = append(msg, avroLong(1704067200000)...)    // 2024-01-01
+	return msg
+}
+
+// fakeRegistry serves schemas by id the way Confluent Schema Registry does,
+// counting requests
+func fakeRegistry(t *testing.T, schemas map[int]string) (*httptest.Server, *int) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var id int
+		if _, err := fmt.Sscanf(r.URL.Path, "/schemas/ids/%d", &id); err != nil || schemas[id] == "" {
+			http.Error(w, `{"error_code": 40403, "message": "Schema not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": schemas[id]})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestAvroDecodeEvent(t *testing.T) {
+	srv, requests := fakeRegistry(t, map[int]string{7: customersSchema})
+	registry := newSchemaRegistry(srv.URL)
+
+	event, err := registry.decodeEvent(cannedCustomerInsert())
+	if err != nil {
+		t.Fatalf("decodeEvent failed: %v", err)
+	}
+
+	p := event.Payload
+	if p.Op != "c" || p.TsMs != 1704067200000 || p.Source.DB != "inventory" || p.Source.Table != "customers" || p.Before != nil {
+		t.Errorf("Unexpected envelope: %+v", p)
+	}
+	want := map[string]any{
+		"id":       int32(42),
+		"name":     "Alice",
+		"balance":  json.Number("-12.34"),
+		"born":     "2000-01-15",
+		"updated":  "2024-01-01T00:00:00.123456Z",
+		"nickname": "Al",
+		// Debezium's own types, named only by connect.name, convert as the
+		// JSON converter's schema would have them (see connect.go)
+		"signup": "2024-01-01",
+		"seen":   "2024-01-01T00:00:00.123456Z",
+		"credit": json.Number("12.3"),
+	}
+	for k, v := range want {
+		if p.After[k] != v {
+			t.Errorf("after.%s = %T %v, want %T %v", k, p.After[k], p.After[k], v, v)
+		}
+	}
+
+	// The record sent to XTDB keeps the decimal exact
+	_, record, err := EventToRecord(event)
+	if err != nil {
+		t.Fatalf("EventToRecord failed: %v", err)
+	}
+	data, _ := json.Marshal(record)
+	if !strings.Contains(string(data), `"balance":-12.34`) || !strings.Contains(string(data), `"_id":42`) {
+		t.Errorf("Unexpected record JSON: %s", data)
+	}
+
+	// The schema is fetched once per id
+	if _, err := registry.decodeEvent(cannedCustomerInsert()); err != nil {
+		t.Fatalf("Second decodeEvent failed: %v", err)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected the schema fetched once, got %d requests", *requests)
+	}
+}
+
+func TestAvroDecodeEventErrors(t *testing.T) {
+	srv, _ := fakeRegistry(t, map[int]string{7: customersSchema})
+	registry := newSchemaRegistry(srv.URL)
+
+	msg := cannedCustomerInsert()
+	if _, err := registry.decodeEvent(append([]byte{'{'}, msg[1:]...)); err == nil {
+		t.Error("Expected a JSON message to be rejected")
+	}
+	if _, err := registry.decodeEvent(append([]byte{0, 0, 0, 0, 8}, msg[5:]...)); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected an unknown schema id to fail, got %v", err)
+	}
+	if _, err := registry.decodeEvent(msg[:20]); err == nil {
+		t.Error("Expected a truncated message to fail")
+	}
+}
+
+func TestAvroReaderBlocks(t *testing.T) {
+	schema, err := parseAvroSchema([]byte(`{"type": "record", "name": "R", "fields": [
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "attrs", "type": {"type": "map", "values": "long"}},
+		{"name": "tier", "type": {"type": "enum", "name": "Tier", "symbols": ["FREE", "PRO"]}}]}`))
+	if err != nil {
+		t.Fatalf("parseAvroSchema failed: %v", err)
+	}
+
+	var data []byte
+	data = append(data, avroLong(-2)...) // a block of 2, with its byte size
+	data = append(data, avroLong(4)...)
+	data = append(data, avroString("a")...)
+	data = append(data, avroString("b")...)
+	data = append(data, avroLong(0)...)
+	data = append(data, avroLong(1)...)
+	data = append(data, avroString("x")...)
+	data = append(data, avroLong(-3)...)
+	data = append(data, avroLong(0)...)
+	data = append(data, avroLong(1)...) // PRO
+
+	got, err := (&avroReader{buf: data}).read(schema)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if fmt.Sprint(got) != "map[attrs:map[x:-3] tags:[a b] tier:PRO]" {
+		t.Errorf("Unexpected record: %v", got)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// batchLinger is how long a partly filled batch, or a source transaction
+// whose END marker hasn't come, waits for another event before it's written
+// anyway (unless --flush-interval says otherwise), so a quiet Kafka topic or
+// stdin pipe doesn't hold writes back
+const batchLinger = time.Second
+
+func (l *loader) flushInterval() time.Duration {
+	if l.cfg.FlushInterval > 0 {
+		return l.cfg.FlushInterval
+	}
+	return batchLinger
+}
+
+// batchEntry is an event waiting to be written, numbered as runSource numbers
+// them
+type batchEntry struct {
+	offset int64
+	stmt   statement
+	write  bool          // false for events with nothing to write, e.g. skipped outbox rows
+	event  DebeziumEvent // as read, for --dead-letter
+}
+
+// batchError reports which statement of a batch the server rejected
+type batchError struct {
+	index int
+	err   error
+}
+
+func (e *batchError) Error() string { return fmt.Sprintf("statement %d: %v", e.index, e.err) }
+func (e *batchError) Unwrap() error { return e.err }
+
+// runBatched is runSource for --batch-size > 1. Consecutive events for the
+// same table are written as one transaction, pipelined in a single round
+// trip, and committed to the source once it has committed. Events keep their
+// order, so an _id's update never lands before the insert it follows. The
+// events of a source transaction make up one batch whatever their number and
+// tables.
+func runBatched(ctx context.Context, src EventSource, l *loader) error {
+	var batch []batchEntry
+	var table, txID string
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// Don't abandon a write half-way through when asked to stop
+		if err := l.commitBatch(context.WithoutCancel(ctx), src, batch); err != nil {
+			return err
+		}
+		if txID != "" {
+			l.stats["transactions"]++
+		}
+		batch, table, txID = batch[:0], "", ""
+		return nil
+	}
+
+	for offset := int64(0); ; {
+		nextCtx, cancel := ctx, context.CancelFunc(func() {})
+		if len(batch) > 0 {
+			nextCtx, cancel = context.WithTimeout(ctx, l.flushInterval())
+		}
+		event, ok, err := src.Next(nextCtx)
+		lingered := nextCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		var de *decodeError
+		if errors.As(err, &de) && l.dead != nil {
+			// Dead-lettered, then committed with the batch it falls in
+			l.current = offset
+			l.events++
+			if err := l.reject(offset, nil, de.message, de.err); err != nil {
+				return errors.Join(err, flush())
+			}
+			batch = append(batch, batchEntry{offset: offset})
+			offset++
+			continue
+		}
+		if err != nil {
+			if flushErr := flush(); flushErr != nil {
+				return flushErr
+			}
+			return &eventError{offset, err}
+		}
+		if !ok {
+			if lingered && txID != "" {
+				l.stats["transactions_unfinished"]++
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			if lingered {
+				continue
+			}
+			return nil
+		}
+		l.current = offset
+		l.events++
+
+		stmt, write, err := l.prepare(event)
+		if err != nil {
+			if l.dead == nil {
+				// Everything before this event is fine, so write it first
+				// and leave this one as the place to resume from
+				if flushErr := flush(); flushErr != nil {
+					return flushErr
+				}
+				return &eventError{offset, err}
+			}
+			if err := l.reject(offset, &event, nil, err); err != nil {
+				return errors.Join(err, flush())
+			}
+		}
+		// A source transaction is written whole, whatever its size and tables
+		id := l.txID(event)
+		if len(batch) > 0 && id != txID {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if id == "" && write && table != "" && stmt.table != table {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if write && table == "" {
+			table = stmt.table
+		}
+		batch, txID = append(batch, batchEntry{offset: offset, stmt: stmt, write: write, event: event}), id
+		offset++
+
+		if (id == "" && len(batch) >= l.cfg.BatchSize) || endsTx(event, id) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// commitBatch writes a batch and then commits its events to the source
+func (l *loader) commitBatch(ctx context.Context, src EventSource, batch []batchEntry) error {
+	if err := l.writeBatch(ctx, batch); err != nil {
+		return err
+	}
+	last := batch[len(batch)-1].offset
+	if err := src.Commit(ctx, last); err != nil {
+		return &eventError{last, fmt.Errorf("committing: %w", err)}
+	}
+	return nil
+}
+
+// writeBatch writes a batch's statements in one transaction. If the server
+// rejects one, the whole batch is rolled back and the error names the event
+// that failed and the one to resume from. With --dead-letter, the failed
+// event is set aside instead and the rest of the batch written again.
+func (l *loader) writeBatch(ctx context.Context, batch []batchEntry) error {
+	if l.cfg.Dedup {
+		var err error
+		if batch, err = l.dedup(ctx, batch); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var positions []int
+		var stmts []statement
+		for i, e := range batch {
+			if e.write {
+				positions = append(positions, i)
+				stmts = append(stmts, e.stmt)
+			}
+		}
+		if len(stmts) == 0 {
+			return nil
+		}
+
+		var tags []pgconn.CommandTag
+		err := l.latency.Time("batch", func() (err error) {
+			tags, err = l.sendBatch(ctx, stmts)
+			return err
+		})
+		if err == nil {
+			for i, stmt := range stmts {
+				fmt.Fprintln(stdout, stmt)
+				l.count(stmt, tags[i])
+			}
+			return nil
+		}
+
+		first, last := batch[0].offset, batch[len(batch)-1].offset
+		var be *batchError
+		if !errors.As(err, &be) {
+			return fmt.Errorf("events %d-%d: %w (rolled back; resume from event %d)", first, last, err, first)
+		}
+		failed := batch[positions[be.index]]
+		cause := fmt.Errorf("%s: %w", failed.stmt.kind, be.err)
+		if l.dead == nil {
+			return &eventError{failed.offset, fmt.Errorf("%w (events %d-%d were rolled back; resume from event %d)",
+				cause, first, last, first)}
+		}
+		if err := l.reject(failed.offset, &failed.event, nil, cause); err != nil {
+			return err
+		}
+		batch = slices.Clone(batch)
+		batch[positions[be.index]].write = false
+	}
+}
+
+// execBatch sends stmts between BEGIN and COMMIT as a single pipelined
+// batch, returning each statement's command tag. A failure is a
+// *batchError when it's down to one statement.
+func (l *loader) execBatch(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+	b := &pgconn.Batch{}
+	b.ExecParams("BEGIN", nil, nil, nil, nil)
+	for _, s := range stmts {
+		b.ExecParams(s.sql, s.params, s.oids, s.formats(), nil)
+	}
+	b.ExecParams("COMMIT", nil, nil, nil, nil)
+
+	results, err := l.conn.PgConn().ExecBatch(ctx, b).ReadAll()
+	if err == nil {
+		tags := make([]pgconn.CommandTag, len(stmts))
+		for i := range stmts {
+			tags[i] = results[i+1].CommandTag
+		}
+		return tags, nil
+	}
+
+	// The transaction is aborted; end it so the connection can be used again
+	l.conn.PgConn().Exec(ctx, "ROLLBACK").ReadAll()
+
+	// Results come back in order up to the one that failed
+	done := 0
+	for _, r := range results {
+		if r.Err != nil {
+			err = r.Err
+			break
+		}
+		done++
+	}
+	if done >= 1 && done <= len(stmts) {
+		return nil, &batchError{index: done - 1, err: err}
+	}
+	return nil, err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/segmentio/kafka-go"
+)
+
+// recordBatches replaces l's batch writer with one that records each batch's
+// statements and fails the statement at failAt (counted across batches)
+func recordBatches(l *loader, failAt int) *[][]statement {
+	var batches [][]statement
+	sent := 0
+	l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+		if failAt >= sent && failAt < sent+len(stmts) {
+			return nil, &batchError{index: failAt - sent, err: errors.New("boom")}
+		}
+		sent += len(stmts)
+		batches = append(batches, stmts)
+		tags := make([]pgconn.CommandTag, len(stmts))
+		for i, s := range stmts {
+			tags[i] = pgconn.NewCommandTag(strings.ToUpper(s.kind) + " 0 1")
+		}
+		return tags, nil
+	}
+	return &batches
+}
+
+// batchEvents is five users changes, an accounts insert, then two more users
+// changes
+func batchEvents() []DebeziumEvent {
+	ts := int64(1704067200000)
+	return []DebeziumEvent{
+		newEvent("c", "users", ts, nil, map[string]any{"id": 1}),
+		newEvent("u", "users", ts+1, nil, map[string]any{"id": 1, "name": "a"}),
+		newEvent("c", "users", ts+2, nil, map[string]any{"id": 2}),
+		newEvent("d", "users", ts+3, map[string]any{"id": 1}, nil),
+		newEvent("u", "users", ts+4, nil, map[string]any{"id": 2, "name": "b"}),
+		newEvent("c", "accounts", ts+5, nil, map[string]any{"id": 1}),
+		newEvent("c", "users", ts+6, nil, map[string]any{"id": 3}),
+		newEvent("u", "users", ts+7, nil, map[string]any{"id": 3, "name": "c"}),
+	}
+}
+
+func TestRunBatched(t *testing.T) {
+	src := &mockSource{events: batchEvents()}
+	l := newLoader(Config{BatchSize: 3}, nil)
+	batches := recordBatches(l, -1)
+
+	if err := runSource(context.Background(), src, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	// Full batches of 3, and a flush whenever the table changes
+	var got []string
+	for _, batch := range *batches {
+		var kinds []string
+		for _, s := range batch {
+			kinds = append(kinds, fmt.Sprintf("%s:%s:%v", s.table, s.kind, s.id))
+		}
+		got = append(got, strings.Join(kinds, " "))
+	}
+	want := []string{
+		"users:insert:1 users:update:1 users:insert:2",
+		"users:delete:1 users:update:2",
+		"accounts:insert:1",
+		"users:insert:3 users:update:3",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected batches:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if fmt.Sprint(src.committed) != "[2 4 5 7]" {
+		t.Errorf("Expected each batch's last offset committed, got %v", src.committed)
+	}
+	if l.stats["inserts"] != 4 || l.stats["updates"] != 3 || l.stats["deletes"] != 1 {
+		t.Errorf("Unexpected stats: %v", l.stats)
+	}
+	if n := l.latency.Summary()["batch"].Count; n != 4 {
+		t.Errorf("Expected 4 batches timed, got %d", n)
+	}
+}
+
+func TestRunBatchedReportsFailedEvent(t *testing.T) {
+	src := &mockSource{events: batchEvents()}
+	l := newLoader(Config{BatchSize: 3}, nil)
+	// The second batch's update is statement 4 overall, event 4
+	recordBatches(l, 4)
+
+	err := runSource(context.Background(), src, l)
+	if err == nil || !strings.HasPrefix(err.Error(), "event 4: update: boom") ||
+		!strings.Contains(err.Error(), "resume from event 3") {
+		t.Fatalf("Expected event 4 to fail and resume from event 3, got %v", err)
+	}
+	if fmt.Sprint(src.committed) != "[2]" {
+		t.Errorf("Expected only the first batch committed, got %v", src.committed)
+	}
+	if l.stats["inserts"] != 2 || l.stats["updates"] != 1 || l.stats["deletes"] != 0 {
+		t.Errorf("Expected only the first batch counted, got %v", l.stats)
+	}
+}
+
+func TestRunBatchedWritesBeforeRejectedEvent(t *testing.T) {
+	ts := int64(1704067200000)
+	src := &mockSource{events: []DebeziumEvent{
+		newEvent("c", "users", ts, nil, map[string]any{"id": 1}),
+		newEvent("c", "users", 1704067200, nil, map[string]any{"id": 2}), // seconds, not millis
+	}}
+	l := newLoader(Config{BatchSize: 10, ValidTime: validTimeGuard{Policy: "reject"}}, nil)
+	batches := recordBatches(l, -1)
+
+	err := runSource(context.Background(), src, l)
+	if err == nil || !strings.HasPrefix(err.Error(), "event 1:") {
+		t.Fatalf("Expected event 1 to fail, got %v", err)
+	}
+	if len(*batches) != 1 || fmt.Sprint(src.committed) != "[0]" {
+		t.Errorf("Expected event 0 written and committed first, got %d batches and %v committed", len(*batches), src.committed)
+	}
+}
+
+func TestKafkaSourceHoldsTombstonesWithPendingEvents(t *testing.T) {
+	event := func(offset int64, op string) kafka.Message {
+		value := fmt.Sprintf(`{"op": %q, "ts_ms": 1704067200000, "source": {"table": "users"}, "before": {"id": 1}, "after": {"id": 1}}`, op)
+		return kafka.Message{Offset: offset, Value: []byte(value)}
+	}
+	reader := &fakeKafkaReader{
+		cancel:   func() {},
+		messages: []kafka.Message{event(0, "c"), event(1, "d"), {Offset: 2}, event(3, "c")},
+	}
+	src := newKafkaSource(reader, map[string]int{})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, ok, err := src.Next(ctx); !ok || err != nil {
+			t.Fatalf("Next %d: ok=%v err=%v", i, ok, err)
+		}
+	}
+	// The tombstone came after events 0 and 1, which are still pending
+	if len(reader.committed) != 0 {
+		t.Fatalf("Expected nothing committed while events are pending, got %v", reader.committed)
+	}
+
+	if err := src.Commit(ctx, 1); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if fmt.Sprint(reader.committed) != "[0 1 2]" {
+		t.Errorf("Expected the tombstone committed with the delete before it, got %v", reader.committed)
+	}
+	if err := src.Commit(ctx, 2); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if fmt.Sprint(reader.committed) != "[0 1 2 3]" {
+		t.Errorf("Expected offset 3 committed last, got %v", reader.committed)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// checkpointSource wraps a file or stdin source with --checkpoint-file. After
+// each commit it records the index of the last event written, and on the
+// next run it skips events up to that index, so a run that failed part way
+// through resumes where it stopped rather than replaying from the top.
+//
+// Indexes in the checkpoint count every event in the input; the loader only
+// sees the events after the checkpoint, numbered from 0 as usual.
+type checkpointSource struct {
+	EventSource
+	path    string
+	resume  int64 // index of the first event to apply
+	skipped int64 // events skipped so far, all before resume
+	stats   map[string]int
+}
+
+// newCheckpointSource wraps src, reading where to resume from path. A missing
+// checkpoint file means starting from the first event.
+func newCheckpointSource(src EventSource, path string, stats map[string]int) (*checkpointSource, error) {
+	last, err := readCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	return &checkpointSource{EventSource: src, path: path, resume: last + 1, stats: stats}, nil
+}
+
+func (s *checkpointSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	for s.skipped < s.resume {
+		// An event that didn't decode was dealt with (dead-lettered) by the
+		// run that wrote the checkpoint
+		_, ok, err := s.EventSource.Next(ctx)
+		var de *decodeError
+		if err != nil && !errors.As(err, &de) || err == nil && !ok {
+			return DebeziumEvent{}, false, err
+		}
+		s.skipped++
+		s.stats["skipped_checkpoint"]++
+	}
+	return s.EventSource.Next(ctx)
+}
+
+// Commit commits to the wrapped source, then moves the checkpoint past offset
+func (s *checkpointSource) Commit(ctx context.Context, offset int64) error {
+	index := s.skipped + offset
+	if err := s.EventSource.Commit(ctx, index); err != nil {
+		return err
+	}
+	if err := writeCheckpoint(s.path, index); err != nil {
+		return err
+	}
+	s.stats["applied"] = int(offset) + 1
+	return nil
+}
+
+// readCheckpoint returns the index of the last event a previous run wrote,
+// or -1 if there's no checkpoint yet
+func readCheckpoint(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || last < 0 {
+		return 0, fmt.Errorf("checkpoint %s: expected an event index, got %q", path, strings.TrimSpace(string(data)))
+	}
+	return last, nil
+}
+
+// writeCheckpoint replaces the checkpoint with index. It writes a temporary
+// file next to it and renames it into place, so a crash leaves either the
+// old checkpoint or the new one, never a torn write.
+func writeCheckpoint(path string, index int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	if _, err := fmt.Fprintln(tmp, index); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
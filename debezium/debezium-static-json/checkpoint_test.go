@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loader.checkpoint")
+
+	// First run: the second batch's update (event 4) fails, so only the
+	// first batch, events 0-2, gets written
+	l := newLoader(Config{BatchSize: 3, CheckpointFile: path}, nil)
+	recordBatches(l, 4)
+	src, err := newCheckpointSource(&mockSource{events: batchEvents()}, path, l.stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runSource(context.Background(), src, l); err == nil {
+		t.Fatal("Expected the first run to fail at event 4")
+	}
+	if last, err := readCheckpoint(path); err != nil || last != 2 {
+		t.Fatalf("Expected checkpoint at event 2, got %d, %v", last, err)
+	}
+
+	// Second run over the same input picks up at event 3
+	l = newLoader(Config{BatchSize: 3, CheckpointFile: path}, nil)
+	batches := recordBatches(l, -1)
+	inner := &mockSource{events: batchEvents()}
+	src, err = newCheckpointSource(inner, path, l.stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runSource(context.Background(), src, l); err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+
+	if got := batchSummary(*batches); !strings.HasPrefix(got, "users:delete:1") {
+		t.Errorf("Expected the resumed run to start with event 3's delete, got %s", got)
+	}
+	if fmt.Sprint(inner.committed) != "[4 5 7]" {
+		t.Errorf("Expected input indexes [4 5 7] committed, got %v", inner.committed)
+	}
+	if l.stats["skipped_checkpoint"] != 3 || l.stats["applied"] != 5 {
+		t.Errorf("Expected 3 skipped and 5 applied, got %v", l.stats)
+	}
+	if last, err := readCheckpoint(path); err != nil || last != 7 {
+		t.Errorf("Expected checkpoint at event 7, got %d, %v", last, err)
+	}
+}
+
+func TestCheckpointFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "loader.checkpoint")
+
+	if last, err := readCheckpoint(path); err != nil || last != -1 {
+		t.Errorf("Expected a missing checkpoint to start from the top, got %d, %v", last, err)
+	}
+
+	for _, index := range []int64{0, 41, 4212} {
+		if err := writeCheckpoint(path, index); err != nil {
+			t.Fatalf("writeCheckpoint failed: %v", err)
+		}
+		if last, err := readCheckpoint(path); err != nil || last != index {
+			t.Errorf("Expected %d read back, got %d, %v", index, last, err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the checkpoint left behind, got %v", entries)
+	}
+
+	os.WriteFile(path, []byte("garbage\n"), 0o644)
+	if _, err := readCheckpoint(path); err == nil {
+		t.Error("Expected a corrupt checkpoint to be rejected rather than ignored")
+	}
+}
+
+func TestParseConfigCheckpointWithKafka(t *testing.T) {
+	_, err := parseConfig([]string{"--kafka-brokers", "localhost:9092", "--kafka-topic", "t", "--checkpoint-file", "cp"})
+	if err == nil {
+		t.Error("Expected --checkpoint-file to be rejected with Kafka")
+	}
+}
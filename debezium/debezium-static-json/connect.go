@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// connectSchema is the Kafka Connect schema the JSON converter sends
+// alongside each payload when schemas.enable is on. Name carries the
+// logical type of fields whose raw encoding loses their meaning, such as a
+// DATE sent as days since the epoch.
+type connectSchema struct {
+	Type       string            `json:"type"`
+	Name       string            `json:"name,omitempty"`
+	Field      string            `json:"field,omitempty"`
+	Optional   bool              `json:"optional,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Fields     []connectSchema   `json:"fields,omitempty"`
+}
+
+// field returns the schema of the named field of a struct schema
+func (s *connectSchema) field(name string) *connectSchema {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Fields {
+		if s.Fields[i].Field == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// applyConnectSchema converts the logical-type fields of the event's before
+// and after images, as described by its schema, to values XTDB can store
+// as what they are: dates and timestamps to ISO-8601 strings and decimals to
+// exact numbers. Events without a schema are returned unchanged; the
+// original images are never modified.
+func applyConnectSchema(event DebeziumEvent) (DebeziumEvent, error) {
+	if event.Schema == nil {
+		return event, nil
+	}
+	var err error
+	if event.Payload.Before, err = convertConnectRow(event.Schema.field("before"), event.Payload.Before); err != nil {
+		return event, fmt.Errorf("before: %w", err)
+	}
+	if event.Payload.After, err = convertConnectRow(event.Schema.field("after"), event.Payload.After); err != nil {
+		return event, fmt.Errorf("after: %w", err)
+	}
+	return event, nil
+}
+
+// convertConnectRow returns a copy of row with its logical-type fields
+// converted
+func convertConnectRow(schema *connectSchema, row map[string]any) (map[string]any, error) {
+	if schema == nil || row == nil {
+		return row, nil
+	}
+	converted := make(map[string]any, len(row))
+	for k, v := range row {
+		converted[k] = v
+	}
+	for _, f := range schema.Fields {
+		v, ok := row[f.Field]
+		if !ok || v == nil {
+			continue
+		}
+		c, err := convertConnectValue(f, v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s (%s): %w", f.Field, f.Name, err)
+		}
+		converted[f.Field] = c
+	}
+	return converted, nil
+}
+
+// convertConnectValue converts a single value of the logical type named by
+// its schema. Values that aren't in the expected raw form are left as they
+// are, so an event that was already converted passes through.
+func convertConnectValue(f connectSchema, v any) (any, error) {
+	switch f.Name {
+	case "io.debezium.time.Date":
+		if days, ok := connectInt(v); ok {
+			return time.Unix(0, 0).UTC().AddDate(0, 0, int(days)).Format(time.DateOnly), nil
+		}
+	case "io.debezium.time.Timestamp":
+		if ms, ok := connectInt(v); ok {
+			return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), nil
+		}
+	case "io.debezium.time.MicroTimestamp":
+		if us, ok := connectInt(v); ok {
+			return time.UnixMicro(us).UTC().Format(time.RFC3339Nano), nil
+		}
+	case "io.debezium.time.ZonedTimestamp":
+		// Already ISO-8601 with its offset; check it parses
+		if s, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return nil, err
+			}
+		}
+	case "org.apache.kafka.connect.data.Decimal":
+		// Base64 from the JSON converter, raw bytes from the Avro one
+		var b []byte
+		switch raw := v.(type) {
+		case string:
+			var err error
+			if b, err = base64.StdEncoding.DecodeString(raw); err != nil {
+				return nil, fmt.Errorf("decoding unscaled value: %w", err)
+			}
+		case []byte:
+			b = raw
+		default:
+			return v, nil
+		}
+		scale, err := strconv.Atoi(f.Parameters["scale"])
+		if err != nil {
+			return nil, fmt.Errorf("bad scale %q", f.Parameters["scale"])
+		}
+		return decimalNumber(b, scale), nil
+	}
+
+	if m, ok := v.(map[string]any); ok && f.Type == "struct" {
+		return convertConnectRow(&f, m)
+	}
+	return v, nil
+}
+
+// connectInt reads a whole JSON number, or an Avro int or long
+func connectInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	f, ok := v.(float64)
+	if !ok || f != float64(int64(f)) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// temporalTypes maps the --temporal-col type names to the Connect logical
+// types whose raw encoding they describe
+var temporalTypes = map[string]string{
+	"date":            "io.debezium.time.Date",
+	"timestamp":       "io.debezium.time.Timestamp",
+	"micro-timestamp": "io.debezium.time.MicroTimestamp",
+}
+
+// temporalHints gives the logical type of columns in messages that carry no
+// schema, set with repeated --temporal-col flags: "orders.created_at=timestamp"
+// for epoch milliseconds, "=micro-timestamp" for microseconds and "=date" for
+// days since the epoch. It maps source table names to column types.
+type temporalHints map[string]map[string]string
+
+func (h temporalHints) String() string {
+	var specs []string
+	for table, cols := range h {
+		for col, typ := range cols {
+			specs = append(specs, table+"."+col+"="+typ)
+		}
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, " ")
+}
+
+func (h temporalHints) Set(s string) error {
+	column, typ, ok := strings.Cut(s, "=")
+	// Split at the last dot, as a source table may be schema-qualified
+	dot := strings.LastIndex(column, ".")
+	if !ok || dot <= 0 || dot == len(column)-1 {
+		return fmt.Errorf("expected table.column=type, got %q", s)
+	}
+	typ = strings.TrimSpace(typ)
+	if _, ok := temporalTypes[typ]; !ok {
+		return fmt.Errorf("unknown temporal type %q in %q (want date, timestamp or micro-timestamp)", typ, s)
+	}
+	table, col := strings.TrimSpace(column[:dot]), strings.TrimSpace(column[dot+1:])
+	if h[table] == nil {
+		h[table] = map[string]string{}
+	}
+	h[table][col] = typ
+	return nil
+}
+
+// applyTemporalHints converts the hinted columns of the event's before and
+// after images, for messages whose schema doesn't say what they hold. Like
+// applyConnectSchema it leaves values that aren't in the raw form alone and
+// never modifies the original images.
+func applyTemporalHints(event DebeziumEvent, hints temporalHints) (DebeziumEvent, error) {
+	cols := hints[event.Payload.Source.Table]
+	if len(cols) == 0 {
+		return event, nil
+	}
+	var err error
+	if event.Payload.Before, err = convertLogicalTypes(event.Payload.Before, cols); err != nil {
+		return event, fmt.Errorf("before: %w", err)
+	}
+	if event.Payload.After, err = convertLogicalTypes(event.Payload.After, cols); err != nil {
+		return event, fmt.Errorf("after: %w", err)
+	}
+	return event, nil
+}
+
+// convertLogicalTypes returns a copy of record with the columns named in
+// hints converted from the raw encoding of their type (date, timestamp or
+// micro-timestamp), as if the message's schema had described them
+func convertLogicalTypes(record map[string]any, hints map[string]string) (map[string]any, error) {
+	schema := connectSchema{Type: "struct"}
+	for col, typ := range hints {
+		schema.Fields = append(schema.Fields, connectSchema{Type: "int64", Name: temporalTypes[typ], Field: col})
+	}
+	return convertConnectRow(&schema, record)
+}
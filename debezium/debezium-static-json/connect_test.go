@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestApplyConnectSchema(t *testing.T) {
+	events, err := loadEvents("cdc/logical-types-events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+	if len(events) != 3 || events[0].Schema == nil {
+		t.Fatalf("Expected 3 events with schemas, got %d", len(events))
+	}
+
+	created, err := applyConnectSchema(events[0])
+	if err != nil {
+		t.Fatalf("applyConnectSchema failed: %v", err)
+	}
+	want := map[string]any{
+		"id":         float64(1),
+		"order_date": "2020-10-10",
+		"created_at": "2020-10-10T12:00:00.123456Z",
+		"amount":     json.Number("123.45"),
+		"status":     "placed",
+		"shipped_at": nil,
+	}
+	for k, v := range want {
+		if created.Payload.After[k] != v {
+			t.Errorf("after.%s = %T %v, want %T %v", k, created.Payload.After[k], created.Payload.After[k], v, v)
+		}
+	}
+	if events[0].Payload.After["order_date"] != float64(18545) {
+		t.Errorf("Expected the original event untouched, got %v", events[0].Payload.After["order_date"])
+	}
+
+	// Converting twice changes nothing
+	again, err := applyConnectSchema(created)
+	if err != nil || again.Payload.After["amount"] != json.Number("123.45") || again.Payload.After["order_date"] != "2020-10-10" {
+		t.Errorf("Expected a converted event to pass through, got %v, %v", again.Payload.After, err)
+	}
+
+	updated, err := applyConnectSchema(events[1])
+	if err != nil {
+		t.Fatalf("applyConnectSchema failed: %v", err)
+	}
+	if updated.Payload.Before["amount"] != json.Number("123.45") || updated.Payload.After["amount"] != json.Number("-12.34") ||
+		updated.Payload.After["shipped_at"] != "2020-10-12T09:30:00+02:00" {
+		t.Errorf("Unexpected update images: before %v, after %v", updated.Payload.Before, updated.Payload.After)
+	}
+
+	// The record sent to XTDB carries the converted values
+	_, record, err := EventToRecord(updated)
+	if err != nil {
+		t.Fatalf("EventToRecord failed: %v", err)
+	}
+	data, _ := json.Marshal(record)
+	if !strings.Contains(string(data), `"amount":-12.34`) || !strings.Contains(string(data), `"order_date":"2020-10-10"`) {
+		t.Errorf("Unexpected record JSON: %s", data)
+	}
+
+	// Malformed values name the field
+	bad := events[0]
+	bad.Payload.After = map[string]any{"id": float64(1), "amount": "not base64!"}
+	if _, err := applyConnectSchema(bad); err == nil || !strings.Contains(err.Error(), "field amount") {
+		t.Errorf("Expected a bad decimal to fail naming the field, got %v", err)
+	}
+
+	// Without a schema the event is left alone
+	plain := newEvent("c", "orders", 1602331200000, nil, map[string]any{"id": 1, "order_date": 18545})
+	if got, err := applyConnectSchema(plain); err != nil || got.Payload.After["order_date"] != 18545 {
+		t.Errorf("Expected a schemaless event unchanged, got %v, %v", got.Payload.After, err)
+	}
+}
+
+func TestConvertLogicalTypes(t *testing.T) {
+	record := map[string]any{
+		"id":         float64(1),
+		"created_at": float64(1704067200123),
+		"seen_at":    float64(1704067200123456),
+		"born":       float64(18545),
+		"visits":     float64(3),
+		"updated_at": "2024-01-01T00:00:00Z",
+	}
+	hints := map[string]string{
+		"created_at": "timestamp",
+		"seen_at":    "micro-timestamp",
+		"born":       "date",
+		"updated_at": "timestamp",
+	}
+	got, err := convertLogicalTypes(record, hints)
+	if err != nil {
+		t.Fatalf("convertLogicalTypes failed: %v", err)
+	}
+	want := map[string]any{
+		"id":         float64(1),
+		"created_at": "2024-01-01T00:00:00.123Z",
+		"seen_at":    "2024-01-01T00:00:00.123456Z",
+		"born":       "2020-10-10",
+		"visits":     float64(3),
+		"updated_at": "2024-01-01T00:00:00Z", // already converted
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %T %v, want %T %v", k, got[k], got[k], v, v)
+		}
+	}
+	if record["created_at"] != float64(1704067200123) {
+		t.Errorf("Expected the original record untouched, got %v", record["created_at"])
+	}
+}
+
+func TestParseConfigTemporalCols(t *testing.T) {
+	cfg, err := parseConfig([]string{"--temporal-col", "orders.created_at=timestamp", "--temporal-col", "inventory.orders.shipped=date"})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if got := cfg.TemporalCols.String(); got != "inventory.orders.shipped=date orders.created_at=timestamp" {
+		t.Errorf("Unexpected hints: %s", got)
+	}
+	for _, bad := range []string{"created_at=timestamp", "orders.created_at", "orders.=date", "orders.created_at=datetime"} {
+		if _, err := parseConfig([]string{"--temporal-col", bad}); err == nil {
+			t.Errorf("Expected --temporal-col %s to be rejected", bad)
+		}
+	}
+
+	// Only the hinted table's columns are converted, before loading
+	l := newLoader(cfg, nil)
+	for _, tc := range []struct {
+		table string
+		want  string
+	}{{"orders", `"created_at":"2024-01-01T00:00:00Z"`}, {"users", `"created_at":1704067200000`}} {
+		event := newEvent("c", tc.table, 1704067200000, nil, map[string]any{"id": float64(1), "created_at": float64(1704067200000)})
+		stmt, ok, err := l.prepare(event)
+		if err != nil || !ok {
+			t.Fatalf("prepare failed: %v", err)
+		}
+		if !strings.Contains(string(stmt.params[0]), tc.want) {
+			t.Errorf("%s: expected %s in %s", tc.table, tc.want, stmt.params[0])
+		}
+	}
+}
+
+func TestLogicalTypesIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	events, err := loadEvents("cdc/logical-types-events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+	table := getCleanTable()
+	for i := range events {
+		events[i].Payload.Source.Table = table
+	}
+
+	// Create and update; leave out the delete so the row is still current
+	l := newLoader(Config{}, conn)
+	if err := runSource(ctx, &mockSource{events: events[:2]}, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	var orderDate, createdAt, amount string
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT order_date, created_at, CAST(amount AS VARCHAR) FROM %s WHERE _id = 1", table)).
+		Scan(&orderDate, &createdAt, &amount)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if orderDate != "2020-10-10" || createdAt != "2020-10-10T12:00:00.123456Z" || amount != "-12.34" {
+		t.Errorf("Expected (2020-10-10, 2020-10-10T12:00:00.123456Z, -12.34), got (%s, %s, %s)", orderDate, createdAt, amount)
+	}
+}
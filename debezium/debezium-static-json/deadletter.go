@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// deadLetters is the --dead-letter file. Events that fail to decode, to
+// convert or to write are appended to it, one JSON line each, and the run
+// goes on without them, unless more than --max-failures have failed. Workers
+// share it, so it's safe for concurrent use.
+type deadLetters struct {
+	path string
+	max  int // -1 for no limit
+
+	mu     sync.Mutex
+	f      *os.File
+	count  int
+	events []eventIssue // this run's, for the run report
+}
+
+// deadLetter is a line of the dead-letter file. Event is the event as read,
+// or Raw the message if it isn't JSON at all.
+type deadLetter struct {
+	Index int64           `json:"index"`
+	Table string          `json:"table,omitempty"`
+	Error string          `json:"error"`
+	Event json.RawMessage `json:"event,omitempty"`
+	Raw   string          `json:"raw,omitempty"`
+}
+
+// openDeadLetters opens path for appending, so failures from earlier runs
+// are kept
+func openDeadLetters(path string, max int) (*deadLetters, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening dead-letter file: %w", err)
+	}
+	return &deadLetters{path: path, max: max, f: f}, nil
+}
+
+// add appends a failed event, the message as read when it couldn't be
+// decoded. It returns an error once more than max events have failed, if
+// max isn't -1.
+func (d *deadLetters) add(index int64, table string, message []byte, cause error) error {
+	line := deadLetter{Index: index, Table: table, Error: cause.Error()}
+	if json.Valid(message) {
+		line.Event = message
+	} else {
+		line.Raw = string(message)
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("writing dead letter: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing dead letter: %w", err)
+	}
+	d.count++
+	d.events = append(d.events, eventIssue{Index: &index, Table: table, Error: line.Error})
+	if d.max >= 0 && d.count > d.max {
+		return fmt.Errorf("%w (%d events failed, more than --max-failures=%d; see %s)", cause, d.count, d.max, d.path)
+	}
+	return nil
+}
+
+// failures is how many events have been dead-lettered
+func (d *deadLetters) failures() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+// failed lists the events dead-lettered so far, in the order they failed
+func (d *deadLetters) failed() []eventIssue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]eventIssue{}, d.events...)
+}
+
+func (d *deadLetters) Close() error { return d.f.Close() }
+
+// reject handles an event that failed: with --dead-letter it's written there
+// and the run carries on (nil), otherwise the failure stops the run. event
+// is the event as read, or nil with message when it couldn't be decoded.
+func (l *loader) reject(index int64, event *DebeziumEvent, message []byte, cause error) error {
+	// A lost connection isn't the event's fault, and every event after it
+	// would fail the same way
+	if l.dead == nil || l.conn != nil && l.conn.IsClosed() {
+		return &eventError{index, cause}
+	}
+	table := ""
+	if event != nil {
+		table = event.Payload.Source.Table
+		var err error
+		if message, err = json.Marshal(event); err != nil {
+			return &eventError{index, cause}
+		}
+	}
+	if err := l.dead.add(index, table, message, cause); err != nil {
+		return &eventError{index, err}
+	}
+	fmt.Fprintf(stdout, "  Event %d failed, written to %s: %v\n", index, l.dead.path, cause)
+	return nil
+}
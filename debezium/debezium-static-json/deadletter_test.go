@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// deadLetterInput has three events that can't be loaded among good ones:
+// line 1 isn't JSON, line 2 has no id and line 4 is rejected by the server
+const deadLetterInput = `{"payload": {"op": "c", "ts_ms": 1704067200000, "source": {"table": "users"}, "after": {"id": 1}}}
+not json
+{"payload": {"op": "c", "ts_ms": 1704067200001, "source": {"table": "users"}, "after": {"email": "x@example.com"}}}
+{"payload": {"op": "c", "ts_ms": 1704067200002, "source": {"table": "users"}, "after": {"id": 2}}}
+{"payload": {"op": "u", "ts_ms": 1704067200003, "source": {"table": "users"}, "after": {"id": 2, "name": "b"}}}
+{"payload": {"op": "c", "ts_ms": 1704067200004, "source": {"table": "users"}, "after": {"id": 3}}}
+`
+
+func runDeadLetter(t *testing.T, maxFailures int) (*loader, *mockCommits, []deadLetter, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "failed.jsonl")
+	dead, err := openDeadLetters(path, maxFailures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+
+	l := newLoader(Config{BatchSize: 10}, nil)
+	l.dead = dead
+	batches := recordBatches(l, -1)
+	// The server rejects the third statement, event 4's update, once
+	send, rejected := l.sendBatch, false
+	l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+		if !rejected && len(stmts) > 2 {
+			rejected = true
+			return nil, &batchError{index: 2, err: errors.New("boom")}
+		}
+		return send(ctx, stmts)
+	}
+	src := &mockCommits{EventSource: newLineSource(strings.NewReader(deadLetterInput)), batches: batches}
+	runErr := runSource(context.Background(), src, l)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []deadLetter
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var dl deadLetter
+		if err := json.Unmarshal([]byte(line), &dl); err != nil {
+			t.Fatalf("Dead-letter line %q isn't JSON: %v", line, err)
+		}
+		lines = append(lines, dl)
+	}
+	return l, src, lines, runErr
+}
+
+// mockCommits records the offsets committed to a real source
+type mockCommits struct {
+	EventSource
+	batches   *[][]statement
+	committed []int64
+}
+
+func (s *mockCommits) Commit(ctx context.Context, offset int64) error {
+	s.committed = append(s.committed, offset)
+	return nil
+}
+
+func TestDeadLetter(t *testing.T) {
+	l, src, lines, err := runDeadLetter(t, 3)
+	if err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	var got []string
+	for _, dl := range lines {
+		got = append(got, fmt.Sprintf("%d %s: %s", dl.Index, dl.Table, dl.Error))
+	}
+	want := []string{
+		"1 : line 2: decoding event: invalid character 'o' in literal null (expecting 'u')",
+		"2 users: insert: record missing 'id' field",
+		"4 users: update: boom",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected dead letters:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if lines[0].Raw != "not json" || lines[0].Event != nil {
+		t.Errorf("Expected the raw message of line 2, got %+v", lines[0])
+	}
+	var event DebeziumEvent
+	if err := json.Unmarshal(lines[2].Event, &event); err != nil || event.Payload.After["name"] != "b" {
+		t.Errorf("Expected the failed update as read, got %s (%v)", lines[2].Event, err)
+	}
+
+	// The rest of the batch is written again without the failed update
+	var written []string
+	for _, batch := range *src.batches {
+		for _, s := range batch {
+			written = append(written, fmt.Sprintf("%s:%v", s.kind, s.id))
+		}
+	}
+	if fmt.Sprint(written) != "[insert:1 insert:2 insert:3]" {
+		t.Errorf("Unexpected writes: %v", written)
+	}
+	if fmt.Sprint(src.committed) != "[5]" {
+		t.Errorf("Expected every event committed, got %v", src.committed)
+	}
+	if l.events != 6 || l.dead.failures() != 3 {
+		t.Errorf("Expected 6 events with 3 failed, got %d and %d", l.events, l.dead.failures())
+	}
+
+	// The run report lists each failed event, not just how many
+	report := l.report(nil)
+	var listed []string
+	for _, e := range report.DeadLetter.Failed {
+		listed = append(listed, fmt.Sprintf("%d %s: %s", *e.Index, e.Table, e.Error))
+	}
+	if report.DeadLetter.Events != 3 || strings.Join(listed, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected dead letters in the report: %d, %v", report.DeadLetter.Events, listed)
+	}
+}
+
+func TestDeadLetterMaxFailures(t *testing.T) {
+	_, src, lines, err := runDeadLetter(t, 2)
+	if err == nil || !strings.HasPrefix(err.Error(), "event 4: update: boom") ||
+		!strings.Contains(err.Error(), "more than --max-failures=2") {
+		t.Fatalf("Expected the third failure to stop the run, got %v", err)
+	}
+	if len(lines) != 3 {
+		t.Errorf("Expected the third failure written too, got %d lines", len(lines))
+	}
+	if len(src.committed) != 0 {
+		t.Errorf("Expected nothing committed, got %v", src.committed)
+	}
+}
+
+func TestDeadLetterNoLimit(t *testing.T) {
+	l, src, lines, err := runDeadLetter(t, -1)
+	if err != nil {
+		t.Fatalf("Expected --dead-letter alone to carry on past every failure, got %v", err)
+	}
+	if len(lines) != 3 {
+		t.Errorf("Expected 3 dead letters, got %d", len(lines))
+	}
+	var written []string
+	for _, batch := range *src.batches {
+		for _, s := range batch {
+			written = append(written, fmt.Sprintf("%s:%v", s.kind, s.id))
+		}
+	}
+	if fmt.Sprint(written) != "[insert:1 insert:2 insert:3]" {
+		t.Errorf("Expected every good event loaded, got %v", written)
+	}
+	if fmt.Sprint(src.committed) != "[5]" {
+		t.Errorf("Expected every event committed, got %v", src.committed)
+	}
+	if err := l.deadLetterError(); err == nil || !strings.HasPrefix(err.Error(), "3 events failed") {
+		t.Errorf("Expected the failures to fail the run at the end, got %v", err)
+	}
+}
+
+func TestDeadLetterLimitKeepsFlushError(t *testing.T) {
+	dead, err := openDeadLetters(filepath.Join(t.TempDir(), "failed.jsonl"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+
+	// The first failure stops the run, and writing the event before it fails too
+	l := newLoader(Config{BatchSize: 10}, nil)
+	l.dead = dead
+	l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+		return nil, errors.New("flush boom")
+	}
+	src := &mockCommits{EventSource: newLineSource(strings.NewReader(deadLetterInput))}
+	err = runSource(context.Background(), src, l)
+	if err == nil || !strings.Contains(err.Error(), "more than --max-failures=0") || !strings.Contains(err.Error(), "flush boom") {
+		t.Errorf("Expected both the failure and the flush error, got %v", err)
+	}
+}
+
+func TestParseConfigDeadLetter(t *testing.T) {
+	cfg, err := parseConfig([]string{"--dead-letter", "failed.jsonl", "--max-failures", "10"})
+	if err != nil || cfg.DeadLetter != "failed.jsonl" || cfg.MaxFailures != 10 {
+		t.Errorf("Unexpected config %+v, %v", cfg, err)
+	}
+	if _, err := parseConfig([]string{"--max-failures", "10"}); err == nil {
+		t.Error("Expected --max-failures without --dead-letter to be rejected")
+	}
+	cfg, err = parseConfig([]string{"--dead-letter", "failed.jsonl"})
+	if err != nil || cfg.MaxFailures != -1 {
+		t.Errorf("Expected no failure limit by default, got %d, %v", cfg.MaxFailures, err)
+	}
+	if _, err := parseConfig([]string{"--dead-letter", "failed.jsonl", "--max-failures", "-2"}); err == nil {
+		t.Error("Expected a --max-failures below -1 to be rejected")
+	}
+}
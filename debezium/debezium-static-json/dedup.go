@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TimestamptzOID is PostgreSQL's timestamp with time zone type OID
+const TimestamptzOID = 1184
+
+// With --dedup, an insert or update whose version (the same _id valid from
+// the same _valid_from, to the millisecond) is already in XTDB with the same
+// content is skipped, so replaying a file after a failure doesn't write every
+// event again. XTDB would keep the valid-time history the same either way,
+// but each replayed write adds a system-time version and counts as loaded. A
+// second change within the same millisecond, or an event corrected without
+// changing its timestamp, differs in content and is still written.
+
+// dedup returns batch with the writes whose version already exists turned
+// into events with nothing to write
+func (l *loader) dedup(ctx context.Context, batch []batchEntry) ([]batchEntry, error) {
+	deduped := make([]batchEntry, len(batch))
+	for i, e := range batch {
+		deduped[i] = e
+		if !e.write {
+			continue
+		}
+		exists, err := l.loaded(ctx, e.stmt)
+		if err != nil {
+			return nil, &eventError{e.offset, err}
+		}
+		deduped[i].write = !exists
+	}
+	return deduped, nil
+}
+
+// loaded reports whether stmt's version is already in XTDB, counting it if so
+func (l *loader) loaded(ctx context.Context, stmt statement) (bool, error) {
+	if stmt.validFrom == "" {
+		return false, nil // a delete, or XTDB picks the valid time
+	}
+	exists, err := l.versionExists(ctx, stmt)
+	if err != nil {
+		return false, fmt.Errorf("checking for an existing version: %w", err)
+	}
+	if exists {
+		l.stats["deduplicated"]++
+	}
+	return exists, nil
+}
+
+// queryVersionExists looks for a version of stmt's _id valid from its
+// _valid_from holding what stmt writes: every field equal and, for a whole
+// record (an insert), no other field set. The _id and _valid_from are bound
+// as parameters, and each field is compared with the record's own JSON, so
+// XTDB reads the values exactly as the write would.
+func (l *loader) queryVersionExists(ctx context.Context, stmt statement) (bool, error) {
+	sql, params, oids, fields, ok := versionQuery(stmt)
+	if !ok {
+		return false, nil
+	}
+	result := l.conn.PgConn().ExecParams(ctx, sql, params, oids, nil, nil).Read()
+	if result.Err != nil {
+		return false, result.Err
+	}
+	for _, row := range result.Rows {
+		if len(row) == 0 || (string(row[0]) != "t" && string(row[0]) != "true") {
+			continue
+		}
+		if !strings.HasPrefix(stmt.sql, "PATCH") {
+			// A whole record replaces the version, so it mustn't have
+			// fields the record lacks. SELECT * pads the columns of other
+			// versions with NULL.
+			set := 0
+			for _, v := range row[1:] {
+				if v != nil {
+					set++
+				}
+			}
+			if set != fields {
+				continue
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// versionQuery builds queryVersionExists' query: the first column says
+// whether the version holds stmt's values, and the rest are the version's
+// columns. fields is the number of non-null fields stmt writes, _id
+// included. It reports false for a record whose field names can't be
+// written into SQL, which is then always written.
+func versionQuery(stmt statement) (sql string, params [][]byte, oids []uint32, fields int, ok bool) {
+	if len(stmt.params) != 1 {
+		return "", nil, nil, 0, false
+	}
+	record, ok := paramRecord(stmt.params[0], stmt.oids[0])
+	if !ok {
+		return "", nil, nil, 0, false
+	}
+	id, oid, err := idParam(stmt.id)
+	if err != nil {
+		return "", nil, nil, 0, false
+	}
+
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	conds := []string{"TRUE"}
+	for _, k := range keys {
+		if k == "_valid_from" {
+			continue
+		}
+		if !tableNamePattern.MatchString(k) {
+			return "", nil, nil, 0, false
+		}
+		if record[k] == nil {
+			conds = append(conds, fmt.Sprintf("%s IS NULL", k))
+			continue
+		}
+		fields++
+		if k != "_id" {
+			conds = append(conds, fmt.Sprintf("%s = ($3).%s", k, k))
+		}
+	}
+	sql = fmt.Sprintf("SELECT %s AS same, * FROM %s FOR ALL VALID_TIME WHERE _id = $1 AND _valid_from = $2",
+		strings.Join(conds, " AND "), stmt.table)
+	return sql,
+		[][]byte{id, []byte(stmt.validFrom), stmt.params[0]},
+		[]uint32{oid, TimestamptzOID, stmt.oids[0]},
+		fields, true
+}
+
+// paramRecord reads back the record a statement sends, JSON or transit
+// (see recordParam), far enough to tell its fields and which are null
+func paramRecord(param []byte, oid uint32) (map[string]any, bool) {
+	if oid != TransitOID {
+		dec := json.NewDecoder(bytes.NewReader(param))
+		dec.UseNumber()
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			return nil, false
+		}
+		return record, true
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(param, &items); err != nil || len(items)%2 != 1 {
+		return nil, false
+	}
+	record := make(map[string]any, len(items)/2)
+	for i := 1; i < len(items); i += 2 {
+		var key string
+		if err := json.Unmarshal(items[i], &key); err != nil || !strings.HasPrefix(key, "~:") {
+			return nil, false
+		}
+		var value any = items[i+1]
+		if string(items[i+1]) == "null" {
+			value = nil
+		}
+		record[key[2:]] = value
+	}
+	return record, true
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestDedupReplay(t *testing.T) {
+	events := []DebeziumEvent{
+		newEvent("c", "users", 1704067200000, nil, map[string]any{"id": 1, "email": "alice@example.com"}),
+		newEvent("u", "users", 1704153600000, nil, map[string]any{"id": 1, "email": "alice@new.example.com"}),
+	}
+
+	// Versions "written" so far, as versionExists would find them
+	versions := map[string]bool{}
+	l := newLoader(Config{BatchSize: 10, Dedup: true}, nil)
+	batches := recordBatches(l, -1)
+	l.versionExists = func(ctx context.Context, stmt statement) (bool, error) {
+		return versions[fmt.Sprintf("%s/%v/%s", stmt.table, stmt.id, stmt.validFrom)], nil
+	}
+
+	for pass := 1; pass <= 2; pass++ {
+		before := len(*batches)
+		if err := runSource(context.Background(), &mockSource{events: events}, l); err != nil {
+			t.Fatalf("pass %d: runSource failed: %v", pass, err)
+		}
+		for _, batch := range (*batches)[before:] {
+			for _, stmt := range batch {
+				versions[fmt.Sprintf("%s/%v/%s", stmt.table, stmt.id, stmt.validFrom)] = true
+			}
+		}
+	}
+
+	if got := batchSummary(*batches); got != "users:insert:1 users:update:1" {
+		t.Errorf("Expected only the first pass written, got %s", got)
+	}
+	if len(versions) != 2 || l.stats["deduplicated"] != 2 {
+		t.Errorf("Expected 2 versions and 2 events deduplicated, got %v and %v", versions, l.stats)
+	}
+}
+
+func TestDedupIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+	events := []DebeziumEvent{
+		newEvent("c", table, 1704067200000, nil, map[string]any{"id": 1, "email": "alice@example.com"}),
+		newEvent("u", table, 1704153600000, nil, map[string]any{"id": 1, "email": "alice@new.example.com"}),
+	}
+
+	// Every version ever written, including those a replay superseded
+	versions := func() int64 {
+		var n int64
+		err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR ALL SYSTEM_TIME FOR ALL VALID_TIME", table)).Scan(&n)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return n
+	}
+
+	l := newLoader(Config{Dedup: true, ValidTime: validTimeGuard{Policy: "reject"}}, conn)
+	var counts []int64
+	for pass := 1; pass <= 2; pass++ {
+		for i, event := range events {
+			if err := l.apply(ctx, event); err != nil {
+				t.Fatalf("pass %d, event %d: %v", pass, i, err)
+			}
+		}
+		counts = append(counts, versions())
+	}
+	if counts[0] == 0 || counts[1] != counts[0] {
+		t.Errorf("Expected the replay to add no versions, got %v", counts)
+	}
+	if l.stats["deduplicated"] != 2 || l.stats["inserts"] != 1 || l.stats["updates"] != 1 {
+		t.Errorf("Unexpected stats: %v", l.stats)
+	}
+
+	// A corrected event keeps its timestamp but not its content
+	corrected := newEvent("u", table, 1704153600000, nil, map[string]any{"id": 1, "email": "alice@fixed.example.com"})
+	if err := l.apply(ctx, corrected); err != nil {
+		t.Fatalf("Corrected event: %v", err)
+	}
+	var email string
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT email FROM %s WHERE _id = 1", table)).Scan(&email); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if email != "alice@fixed.example.com" || l.stats["deduplicated"] != 2 {
+		t.Errorf("Expected the correction written, got %s and %v", email, l.stats)
+	}
+}
+
+func TestVersionQuery(t *testing.T) {
+	// Two changes within a second keep their milliseconds apart
+	event := newEvent("u", "users", 1704067200250, nil, map[string]any{"id": 1, "email": "a@example.com", "phone": nil})
+	stmt, err := insertStatement(event, "update", defaultKeyFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.validFrom != "2024-01-01T00:00:00.25Z" {
+		t.Errorf("Expected _valid_from to the millisecond, got %s", stmt.validFrom)
+	}
+
+	sql, params, oids, fields, ok := versionQuery(stmt)
+	want := "SELECT TRUE AND email = ($3).email AND phone IS NULL AS same, * FROM users FOR ALL VALID_TIME WHERE _id = $1 AND _valid_from = $2"
+	if !ok || sql != want {
+		t.Errorf("Unexpected query %q, want %q", sql, want)
+	}
+	if fields != 2 || len(params) != 3 || string(params[2]) != string(stmt.params[0]) || oids[2] != JSONOID {
+		t.Errorf("Expected the record bound as $3 with 2 fields set, got %d fields, %v", fields, oids)
+	}
+
+	odd := newEvent("c", "users", 1704067200000, nil, map[string]any{"id": 1, "first name": "Al"})
+	stmt, err = insertStatement(odd, "insert", defaultKeyFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, ok := versionQuery(stmt); ok {
+		t.Error("Expected a field name that isn't an identifier to skip the check")
+	}
+}
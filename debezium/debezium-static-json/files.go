@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileSource streams the events of one or more files in turn: a single
+// file, every event file in a directory or the files a glob pattern
+// matches, in lexical order. Each file is either a JSON array or
+// newline-delimited JSON, whichever its first character says. Files ending
+// in .gz are decompressed as they're read, and only one file is open at a
+// time.
+type fileSource struct {
+	paths []string // still to read
+	files int
+	cur   EventSource
+	path  string
+	stats map[string]int // for the blank lines of newline-delimited files
+}
+
+// eventFileSuffixes are the files a directory is searched for
+var eventFileSuffixes = []string{".json", ".ndjson", ".jsonl"}
+
+func newFileSource(path string) (*fileSource, error) {
+	paths, err := eventFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSource{paths: paths, files: len(paths), stats: map[string]int{}}, nil
+}
+
+// eventFiles lists the files path stands for
+func eventFiles(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		paths, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no files match %s", path)
+		}
+		return paths, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path) // sorted by name
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		for _, suffix := range eventFileSuffixes {
+			if e.Type().IsRegular() && strings.HasSuffix(name, suffix) {
+				paths = append(paths, filepath.Join(path, e.Name()))
+				break
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .json, .ndjson or .jsonl files (gzipped or not) in %s", path)
+	}
+	return paths, nil
+}
+
+// openEventFile opens an event file, decompressing it if it ends in .gz
+func (s *fileSource) openEventFile(path string) (EventSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	closeFile := f.Close
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: decompressing: %w", path, err)
+		}
+		r = zr
+		closeFile = func() error {
+			zr.Close()
+			return f.Close()
+		}
+	}
+
+	br := bufio.NewReader(r)
+	if !isLineDelimited(br) {
+		src := newArraySource(br)
+		src.close = closeFile
+		return src, nil
+	}
+	src := newLineSource(br)
+	src.close, src.stats = closeFile, s.stats
+	return src, nil
+}
+
+// isLineDelimited peeks at the first character that isn't whitespace: a
+// JSON array starts with '[', and anything else is taken to be one event
+// per line (an empty file included)
+func isLineDelimited(br *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		peeked, err := br.Peek(n)
+		if err != nil {
+			return true
+		}
+		switch peeked[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return peeked[n-1] != '['
+	}
+}
+
+func (s *fileSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	for ctx.Err() == nil {
+		if s.cur == nil {
+			if len(s.paths) == 0 {
+				return DebeziumEvent{}, false, nil
+			}
+			src, err := s.openEventFile(s.paths[0])
+			if err != nil {
+				return DebeziumEvent{}, false, err
+			}
+			s.cur, s.path, s.paths = src, s.paths[0], s.paths[1:]
+		}
+
+		event, ok, err := s.cur.Next(ctx)
+		if err != nil {
+			return event, false, s.inFile(err)
+		}
+		if ok || ctx.Err() != nil {
+			return event, ok, nil
+		}
+		if err := s.cur.Close(); err != nil {
+			return DebeziumEvent{}, false, fmt.Errorf("%s: %w", s.path, err)
+		}
+		s.cur = nil
+	}
+	return DebeziumEvent{}, false, nil
+}
+
+// inFile names the file an error came from when there's more than one,
+// keeping decode errors as they are so --dead-letter still catches them
+func (s *fileSource) inFile(err error) error {
+	if s.files == 1 {
+		return err
+	}
+	if de, ok := err.(*decodeError); ok {
+		return &decodeError{de.message, fmt.Errorf("%s: %w", s.path, de.err)}
+	}
+	return fmt.Errorf("%s: %w", s.path, err)
+}
+
+func (s *fileSource) Commit(ctx context.Context, offset int64) error { return nil }
+
+func (s *fileSource) Close() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.Close()
+}
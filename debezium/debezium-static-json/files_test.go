@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cdc/archive is cdc/events.json split into events-001.json and two gzipped
+// files
+func TestFileSourceArchive(t *testing.T) {
+	want, err := loadEvents("cdc/events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := func(events []DebeziumEvent) string {
+		var ops []string
+		for _, e := range events {
+			ops = append(ops, fmt.Sprintf("%s:%s:%d", e.Payload.Source.Table, e.Payload.Op, e.Payload.TsMs))
+		}
+		return strings.Join(ops, " ")
+	}
+
+	for _, path := range []string{"cdc/archive", "cdc/archive/", "cdc/archive/events-*.json*"} {
+		got, err := loadEvents(path)
+		if err != nil {
+			t.Errorf("loadEvents(%q) failed: %v", path, err)
+			continue
+		}
+		if summary(got) != summary(want) {
+			t.Errorf("loadEvents(%q) = %s\nwant %s", path, summary(got), summary(want))
+		}
+	}
+
+	gzipped, err := loadEvents("cdc/archive/events-002.json.gz")
+	if err != nil || summary(gzipped) != summary(want[8:16]) {
+		t.Errorf("Expected events 8-15 from the gzipped file, got %s, %v", summary(gzipped), err)
+	}
+	gzipped, err = loadEvents("cdc/archive/*.gz")
+	if err != nil || summary(gzipped) != summary(want[8:]) {
+		t.Errorf("Expected events 8-21 from the gzipped files, got %s, %v", summary(gzipped), err)
+	}
+}
+
+func TestFileSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		var err error
+		if strings.HasSuffix(name, ".gz") {
+			var f *os.File
+			if f, err = os.Create(filepath.Join(dir, name)); err == nil {
+				zw := gzip.NewWriter(f)
+				zw.Write([]byte(data))
+				zw.Close()
+				err = f.Close()
+			}
+		} else {
+			err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := newFileSource(dir); err == nil || !strings.Contains(err.Error(), "no .json, .ndjson or .jsonl files") {
+		t.Errorf("Expected an empty directory to be rejected, got %v", err)
+	}
+	if _, err := newFileSource(filepath.Join(dir, "*.json")); err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("Expected a glob matching nothing to be rejected, got %v", err)
+	}
+
+	write("a.json", `[{"payload": {"op": "c"}}]`)
+	write("b.json.gz", `[{"payload": {"op": "u"}}, {"payload": {"op": 7}}]`)
+	write("notes.txt", "not events")
+
+	src, err := newFileSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	var ops []string
+	for {
+		event, ok, err := src.Next(context.Background())
+		if err != nil {
+			var de *decodeError
+			if !errors.As(err, &de) || !strings.HasPrefix(err.Error(), filepath.Join(dir, "b.json.gz")+": element 1") {
+				t.Errorf("Expected a decode error naming b.json.gz, got %v", err)
+			}
+			break
+		}
+		if !ok {
+			t.Fatal("Expected a decode error before the end of input")
+		}
+		ops = append(ops, event.Payload.Op)
+	}
+	if fmt.Sprint(ops) != "[c u]" {
+		t.Errorf("Expected ops [c u] across both files, got %v", ops)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "c.json.gz"), []byte("not gzip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadEvents(filepath.Join(dir, "c.json.gz")); err == nil || !strings.Contains(err.Error(), "c.json.gz: decompressing") {
+		t.Errorf("Expected a bad gzip file to be reported, got %v", err)
+	}
+}
+
+func TestFileSourceNDJSON(t *testing.T) {
+	// A row with a text column well past bufio.Scanner's 64 KB default
+	big := strings.Repeat("x", 200*1024)
+	input := "\n" + `{"payload": {"op": "c", "ts_ms": 1704067200000, "source": {"table": "users"}, "after": {"id": 1}}}` + "\n" +
+		`{"payload": {"op": "c", "ts_ms": 1704067200001, "source": {"table": "users"}, "after": {"id": 2, "bio": "` + big + `"}}}` + "\n" +
+		"\n" +
+		`{"payload": {"op": "d", "ts_ms": 1704067200002, "source": {"table": "users"}, "before": {"id": 1}}}` + "\n" +
+		"null\n" +
+		`{"schema": null, "payload": null}` + "\n"
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "events.ndjson")
+	if err := os.WriteFile(plain, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(input))
+	zw.Close()
+	gzipped := filepath.Join(dir, "events.jsonl.gz")
+	if err := os.WriteFile(gzipped, []byte(buf.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{plain, gzipped} {
+		src, err := newFileSource(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := newLoader(Config{BatchSize: 10}, nil)
+		src.stats = l.stats
+		batches := recordBatches(l, -1)
+		if err := runSource(context.Background(), src, l); err != nil {
+			t.Fatalf("%s: runSource failed: %v", path, err)
+		}
+		src.Close()
+
+		var got []string
+		for _, batch := range *batches {
+			for _, s := range batch {
+				got = append(got, fmt.Sprintf("%s:%v", s.kind, s.id))
+			}
+		}
+		if fmt.Sprint(got) != "[insert:1 insert:2 delete:1]" {
+			t.Errorf("%s: unexpected writes %v", path, got)
+		}
+		if l.stats["tombstones"] != 2 || l.stats["blank_lines"] != 2 {
+			t.Errorf("%s: expected 2 tombstones and 2 blank lines counted, got %v", path, l.stats)
+		}
+	}
+
+	// Both files, one after the other, from the directory
+	events, err := loadEvents(dir)
+	if err != nil || len(events) != 10 {
+		t.Errorf("Expected 10 events from the directory, got %d, %v", len(events), err)
+	}
+}
+
+func TestIsLineDelimited(t *testing.T) {
+	cases := map[string]bool{
+		"[{}]":         false,
+		"\n\t  [\n{}]": false,
+		"{}\n{}":       true,
+		"\n\nnull\n":   true,
+		"":             true,
+		"   ":          true,
+	}
+	for input, want := range cases {
+		if got := isLineDelimited(bufio.NewReader(strings.NewReader(input))); got != want {
+			t.Errorf("isLineDelimited(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaReader is the part of *kafka.Reader the consumer loop needs, so tests
+// can script messages without a broker
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+func newKafkaReader(cfg Config) *kafka.Reader {
+	// A consumer group gives us partition assignment and rebalancing; on a
+	// rebalance, uncommitted messages are redelivered to the new owner.
+	rc := kafka.ReaderConfig{
+		Brokers:        strings.Split(cfg.KafkaBrokers, ","),
+		GroupID:        cfg.KafkaGroup,
+		CommitInterval: 0, // commit synchronously
+	}
+	// Several topics share the group's partition assignment; each partition
+	// is still delivered in order, which is all per-_id ordering needs, as
+	// Debezium keys messages by primary key
+	topics := splitTopics(cfg.KafkaTopic)
+	if len(topics) == 1 {
+		rc.Topic = topics[0]
+	} else {
+		rc.GroupTopics = topics
+	}
+	return kafka.NewReader(rc)
+}
+
+// splitTopics reads --kafka-topic's comma-separated list, dropping blanks
+func splitTopics(s string) []string {
+	var topics []string
+	for _, topic := range strings.Split(s, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// kafkaSource reads events from a consumer group. A message's offset is
+// committed only once its event has been written to XTDB, so a crash
+// replays every event delivered since the last commit: with --batch-size,
+// up to a whole batch, some of it perhaps already written. That's harmless,
+// as XTDB upserts by _id.
+type kafkaSource struct {
+	reader  kafkaReader
+	stats   map[string]int
+	pending []pendingMessage // delivered but not yet committed, in order
+	next    int64            // EventSource offset of the next event returned
+	decode  func(value []byte) (DebeziumEvent, error)
+
+	// tombstoneDeletes turns tombstones into deletes (--tombstone-deletes)
+	tombstoneDeletes bool
+}
+
+// pendingMessage is a delivered message awaiting commit: an event, or a
+// tombstone that arrived while earlier events were still being written
+type pendingMessage struct {
+	msg   kafka.Message
+	event bool
+}
+
+func newKafkaSource(r kafkaReader, stats map[string]int) *kafkaSource {
+	return &kafkaSource{reader: r, stats: stats, decode: decodeEvent}
+}
+
+func (s *kafkaSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	for {
+		msg, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return DebeziumEvent{}, false, nil // shutting down
+			}
+			return DebeziumEvent{}, false, fmt.Errorf("fetching message: %w", err)
+		}
+
+		if msg.Value == nil && s.tombstoneDeletes && len(msg.Key) > 0 {
+			s.pending = append(s.pending, pendingMessage{msg: msg, event: true})
+			s.next++
+			event, err := keyDeleteEvent(msg)
+			if err != nil {
+				return event, false, &decodeError{msg.Key, fmt.Errorf("message %s/%d@%d: %w", msg.Topic, msg.Partition, msg.Offset, err)}
+			}
+			return event, true, nil
+		}
+		if msg.Value == nil {
+			// Tombstone following a delete, only meaningful for log compaction.
+			// Committing it would also commit every earlier message, so
+			// while events are still pending (batched) it waits for them.
+			s.stats["tombstones"]++
+			if len(s.pending) > 0 {
+				s.pending = append(s.pending, pendingMessage{msg: msg})
+				continue
+			}
+			if err := s.commit(context.WithoutCancel(ctx), msg); err != nil {
+				return DebeziumEvent{}, false, err
+			}
+			continue
+		}
+
+		// A message that doesn't decode is still an event, committed once
+		// it has been dealt with (dead-lettered)
+		s.pending = append(s.pending, pendingMessage{msg: msg, event: true})
+		s.next++
+		event, err := s.decode(msg.Value)
+		if err != nil {
+			return event, false, &decodeError{msg.Value, fmt.Errorf("message %s/%d@%d: %w", msg.Topic, msg.Partition, msg.Offset, err)}
+		}
+		return event, true, nil
+	}
+}
+
+func (s *kafkaSource) Commit(ctx context.Context, offset int64) error {
+	events := 0
+	for _, p := range s.pending {
+		if p.event {
+			events++
+		}
+	}
+	// pending holds events next-events .. next-1
+	n := int(offset - (s.next - int64(events)) + 1)
+	if n <= 0 {
+		return nil
+	}
+
+	// Take the first n events, and any tombstones that followed them
+	var msgs []kafka.Message
+	i := 0
+	for ; i < len(s.pending) && (n > 0 || !s.pending[i].event); i++ {
+		if s.pending[i].event {
+			n--
+		}
+		msgs = append(msgs, s.pending[i].msg)
+	}
+	if err := s.commit(ctx, msgs...); err != nil {
+		return err
+	}
+	s.pending = s.pending[i:]
+	return nil
+}
+
+func (s *kafkaSource) commit(ctx context.Context, msgs ...kafka.Message) error {
+	commitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := s.reader.CommitMessages(commitCtx, msgs...); err != nil {
+		return fmt.Errorf("committing offset %d: %w", msgs[len(msgs)-1].Offset, err)
+	}
+	return nil
+}
+
+func (s *kafkaSource) Close() error { return s.reader.Close() }
+
+// decodeEvent accepts both the JSON converter's schema envelope
+// ({"schema": ..., "payload": {...}}) and schemaless messages where the value
+// is the payload itself, and rows flattened by ExtractNewRecordState in
+// either (see unwrappedEvent). The MongoDB connector's images, strings of
+// extended JSON that don't decode as objects, are parsed on a second try, as
+// is a delete without a before image, which it may send with only a filter.
+func decodeEvent(value []byte) (DebeziumEvent, error) {
+	event, err := decodeEnvelope(value)
+	if err == nil && (event.Payload.Op != "d" || event.Payload.Before != nil) {
+		return event, nil
+	}
+	stripped, images, ok, mongoErr := splitMongoImages(value)
+	if mongoErr != nil {
+		return event, fmt.Errorf("decoding MongoDB event: %w", mongoErr)
+	}
+	if !ok {
+		return event, err // which may be a delete without a before image
+	}
+	if event, err = decodeEnvelope(stripped); err != nil {
+		return event, err
+	}
+	return images.apply(event), nil
+}
+
+func decodeEnvelope(value []byte) (DebeziumEvent, error) {
+	var event DebeziumEvent
+	err := json.Unmarshal(value, &event)
+	if err == nil && isTombstoneValue(value) {
+		event.tombstone = true
+		return event, nil
+	}
+	if err == nil && (event.Payload.Op != "" || isTxMarker(event)) {
+		return event, nil
+	}
+	// A flattened row's columns may not fit the envelope's fields (a numeric
+	// id in a transaction marker's), so look for one before failing
+	if row, schema, ok := unwrappedRow(value); ok {
+		return unwrappedEvent(row, schema)
+	}
+	if err != nil {
+		return event, fmt.Errorf("decoding event: %w", err)
+	}
+
+	if err := json.Unmarshal(value, &event.Payload); err != nil {
+		return event, fmt.Errorf("decoding event payload: %w", err)
+	}
+	if event.Payload.Op == "" && !isTxMarker(event) {
+		return event, fmt.Errorf("message is not a Debezium change event (no 'op')")
+	}
+	return event, nil
+}
+
+// isTombstoneValue reports whether a message value is a tombstone that made
+// it into the stream as text: the JSON converter writes a null value as
+// "null" with schemas.enable=false and as {"schema":null,"payload":null}
+// with it. Either decodes to an empty event (see isTombstone).
+func isTombstoneValue(value []byte) bool {
+	value = bytes.TrimSpace(value)
+	if string(value) == "null" {
+		return true
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return false
+	}
+	payload, ok := envelope["payload"]
+	return ok && string(bytes.TrimSpace(payload)) == "null"
+}
+
+// isTombstone reports whether event is a tombstone, with nothing to write:
+// the delete before it already ended the document's validity. An event
+// that merely lacks an op isn't one, and is reported as such.
+func isTombstone(event DebeziumEvent) bool {
+	return event.tombstone
+}
+
+// keyDeleteEvent turns a tombstone into a delete of the document its key
+// names (--tombstone-deletes). The key holds the row's primary key columns,
+// with or without the JSON converter's schema envelope; the table is the
+// last part of the topic name, as Debezium names topics prefix.schema.table;
+// and the valid time is the message's timestamp.
+func keyDeleteEvent(msg kafka.Message) (DebeziumEvent, error) {
+	var event DebeziumEvent
+	var key map[string]any
+	if err := json.Unmarshal(msg.Key, &key); err != nil {
+		return event, fmt.Errorf("decoding tombstone key: %w", err)
+	}
+	if payload, ok := key["payload"].(map[string]any); ok {
+		if _, enveloped := key["schema"]; enveloped {
+			key = payload
+		}
+	}
+	if len(key) == 0 {
+		return event, fmt.Errorf("tombstone key names no columns")
+	}
+
+	event.Payload.Op = "d"
+	event.Payload.Before = key
+	event.Payload.Source.Table = msg.Topic[strings.LastIndex(msg.Topic, ".")+1:]
+	if msg.Time.IsZero() {
+		event.noTsMs = true
+	} else {
+		event.Payload.TsMs = msg.Time.UnixMilli()
+	}
+	return event, nil
+}
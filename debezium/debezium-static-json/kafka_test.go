@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeKafkaReader replays scripted messages then blocks until cancelled
+type fakeKafkaReader struct {
+	messages  []kafka.Message
+	committed []int64
+	cancel    context.CancelFunc
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.messages) == 0 {
+		r.cancel()
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := r.messages[0]
+	r.messages = r.messages[1:]
+	return msg, nil
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error { return nil }
+
+func TestDecodeKafkaEvent(t *testing.T) {
+	enveloped := `{"schema": {"type": "struct"}, "payload": {"op": "c", "ts_ms": 1, "source": {"table": "users"}, "after": {"id": 1}}}`
+	schemaless := `{"op": "u", "ts_ms": 2, "source": {"table": "users"}, "after": {"id": 1}}`
+
+	event, err := decodeEvent([]byte(enveloped))
+	if err != nil || event.Payload.Op != "c" || event.Payload.Source.Table != "users" {
+		t.Errorf("Enveloped message decoded to %+v, %v", event.Payload, err)
+	}
+
+	event, err = decodeEvent([]byte(schemaless))
+	if err != nil || event.Payload.Op != "u" || event.Payload.TsMs != 2 {
+		t.Errorf("Schemaless message decoded to %+v, %v", event.Payload, err)
+	}
+
+	if _, err := decodeEvent([]byte(`{"hello": "world"}`)); err == nil {
+		t.Error("Expected error for a non-Debezium message")
+	}
+}
+
+func TestKafkaReaderTopics(t *testing.T) {
+	cfg, err := parseConfig([]string{"--kafka-brokers", "localhost:9092", "--topics", "db.inventory.users, db.inventory.orders", "--kafka-group", "loader"})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+
+	r := newKafkaReader(cfg)
+	defer r.Close()
+	rc := r.Config()
+	if rc.Topic != "" || fmt.Sprint(rc.GroupTopics) != "[db.inventory.users db.inventory.orders]" || rc.GroupID != "loader" {
+		t.Errorf("Expected both topics consumed by group loader, got topic %q, group topics %v, group %q", rc.Topic, rc.GroupTopics, rc.GroupID)
+	}
+
+	cfg.KafkaTopic = "db.inventory.users"
+	single := newKafkaReader(cfg)
+	defer single.Close()
+	if single.Config().Topic != "db.inventory.users" || len(single.Config().GroupTopics) != 0 {
+		t.Errorf("Expected a single topic to be set as Topic, got %+v", single.Config())
+	}
+
+	for _, topics := range []string{",", " , ", ""} {
+		if _, err := parseConfig([]string{"--kafka-brokers", "localhost:9092", "--topics", topics}); err == nil {
+			t.Errorf("Expected --topics %q to be rejected", topics)
+		}
+	}
+}
+
+func TestConsumeKafka(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	message := func(offset int64, value string) kafka.Message {
+		msg := kafka.Message{Topic: "dbserver1.accounts." + table, Partition: 0, Offset: offset}
+		if value != "" {
+			msg.Value = []byte(value)
+		}
+		return msg
+	}
+
+	reader := &fakeKafkaReader{
+		cancel: cancel,
+		messages: []kafka.Message{
+			message(0, fmt.Sprintf(`{"payload": {"op": "c", "ts_ms": 1704067200000, "source": {"table": %q}, "after": {"id": 1, "name": "Alice"}}}`, table)),
+			message(1, fmt.Sprintf(`{"payload": {"op": "c", "ts_ms": 1704067260000, "source": {"table": %q}, "after": {"id": 2, "name": "Bob"}}}`, table)),
+			message(2, fmt.Sprintf(`{"payload": {"op": "d", "ts_ms": 1704067320000, "source": {"table": %q}, "before": {"id": 2}}}`, table)),
+			message(3, ""), // tombstone
+		},
+	}
+
+	l := newLoader(Config{KafkaBrokers: "fake", KafkaTopic: "fake"}, conn)
+	if err := runSource(ctx, newKafkaSource(reader, l.stats), l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	if fmt.Sprint(reader.committed) != "[0 1 2 3]" {
+		t.Errorf("Expected offsets [0 1 2 3] committed, got %v", reader.committed)
+	}
+	if l.stats["inserts"] != 2 || l.stats["deletes"] != 1 || l.stats["tombstones"] != 1 {
+		t.Errorf("Unexpected stats: %v", l.stats)
+	}
+
+	var count int64
+	if err := conn.QueryRow(context.Background(), fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 current row, got %d", count)
+	}
+}
+
+func TestConsumeKafkaCommitsAfterWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var messages []kafka.Message
+	for i := int64(0); i < 4; i++ {
+		messages = append(messages, kafka.Message{Topic: "dbserver1.accounts.users", Offset: i, Value: []byte(fmt.Sprintf(
+			`{"payload": {"op": "c", "ts_ms": %d, "source": {"table": "users"}, "after": {"id": %d}}}`, 1704067200000+i, i))})
+	}
+	reader := &fakeKafkaReader{cancel: cancel, messages: messages}
+
+	// The second batch fails, so only the first batch's offsets are
+	// committed and the rest are redelivered to the next consumer
+	l := newLoader(Config{KafkaBrokers: "fake", KafkaTopic: "fake", BatchSize: 2}, nil)
+	batches := recordBatches(l, 2)
+	err := runSource(ctx, newKafkaSource(reader, l.stats), l)
+	if err == nil || !strings.Contains(err.Error(), "event 2") {
+		t.Fatalf("Expected event 2 to fail, got %v", err)
+	}
+	if fmt.Sprint(reader.committed) != "[0 1]" || len(*batches) != 1 {
+		t.Errorf("Expected only offsets [0 1] committed, got %v after %d batches", reader.committed, len(*batches))
+	}
+}
+
+func TestConsumeKafkaTombstoneDeletes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	at := time.UnixMilli(1704067260000)
+	topic := "dbserver1.accounts.users"
+	reader := &fakeKafkaReader{
+		cancel: cancel,
+		messages: []kafka.Message{
+			{Topic: topic, Offset: 0, Value: []byte(`{"payload": {"op": "c", "ts_ms": 1704067200000, "source": {"table": "users"}, "after": {"id": 1}}}`)},
+			{Topic: topic, Offset: 1, Time: at, Key: []byte(`{"id": 1}`)},
+			{Topic: topic, Offset: 2, Time: at, Key: []byte(`{"schema": {"type": "struct"}, "payload": {"id": 2}}`)},
+			{Topic: topic, Offset: 3}, // no key, nothing to delete
+		},
+	}
+
+	l := newLoader(Config{KafkaBrokers: "fake", KafkaTopic: "fake", BatchSize: 10}, nil)
+	batches := recordBatches(l, -1)
+	src := newKafkaSource(reader, l.stats)
+	src.tombstoneDeletes = true
+	if err := runSource(ctx, src, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+	if got := batchSummary(*batches); got != "users:insert:1 users:delete:1 users:delete:2" {
+		t.Errorf("Expected tombstones turned into deletes, got %s", got)
+	}
+	if fmt.Sprint(reader.committed) != "[0 1 2 3]" || l.stats["tombstones"] != 1 {
+		t.Errorf("Expected all offsets committed and the keyless tombstone counted, got %v and %v", reader.committed, l.stats)
+	}
+
+	if _, err := keyDeleteEvent(kafka.Message{Topic: topic, Key: []byte(`"1"`)}); err == nil {
+		t.Error("Expected a key that isn't a JSON object rejected")
+	}
+}
+
+func TestParseConfigSource(t *testing.T) {
+	cfg, err := parseConfig([]string{"--source", "kafka", "--brokers", "localhost:9092", "--topic", "dbserver1.accounts.users"})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if cfg.KafkaBrokers != "localhost:9092" || cfg.KafkaTopic != "dbserver1.accounts.users" {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+	for _, args := range [][]string{
+		{"--source", "kafka"},
+		{"--source", "file", "--brokers", "localhost:9092", "--topic", "t"},
+		{"--source", "s3"},
+		{"--tombstone-deletes", "events.json"},
+		{"--source", "kafka", "--brokers", "localhost:9092", "--topic", "t", "--format", "avro", "--tombstone-deletes"},
+	} {
+		if _, err := parseConfig(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultKeyFields is the primary key of tables --key-field doesn't name
+var defaultKeyFields = []string{"id"}
+
+// keyFields maps source table names to their primary-key columns, set with
+// repeated --key-field flags: "order_id" for every table, or
+// "orders=tenant_id,order_id" for one. The "" entry is the default.
+type keyFields map[string][]string
+
+func (k keyFields) String() string {
+	var specs []string
+	for table, cols := range k {
+		spec := strings.Join(cols, ",")
+		if table != "" {
+			spec = table + "=" + spec
+		}
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, " ")
+}
+
+func (k keyFields) Set(s string) error {
+	table, cols, ok := strings.Cut(s, "=")
+	if !ok {
+		table, cols = "", s
+	}
+	var fields []string
+	for _, col := range strings.Split(cols, ",") {
+		col = strings.TrimSpace(col)
+		if col == "" {
+			return fmt.Errorf("empty key column in %q", s)
+		}
+		fields = append(fields, col)
+	}
+	k[strings.TrimSpace(table)] = fields
+	return nil
+}
+
+// forTable returns the key columns of a source table
+func (k keyFields) forTable(table string) []string {
+	if cols, ok := k.configured(table); ok {
+		return cols
+	}
+	return defaultKeyFields
+}
+
+// forEvent is forTable for the event's table, except that MongoDB documents
+// are keyed by their _id unless --key-field says otherwise
+func (k keyFields) forEvent(event DebeziumEvent) []string {
+	if _, ok := k.configured(event.Payload.Source.Table); event.mongo && !ok {
+		return mongoKeyFields
+	}
+	return k.forTable(event.Payload.Source.Table)
+}
+
+// configured returns the key columns --key-field gives a table, if any
+func (k keyFields) configured(table string) ([]string, bool) {
+	if cols, ok := k[table]; ok {
+		return cols, true
+	}
+	cols, ok := k[""]
+	return cols, ok
+}
+
+// compositeKeySeparator joins the parts of a composite key
+const compositeKeySeparator = "|"
+
+// recordID derives a row's XTDB _id from its key columns. A single key's
+// value is used as it is. A composite key becomes a string of its parts, in
+// the configured order, joined with "|" ("acme|42"); a "|" or "\" inside a
+// part is escaped with "\", so different keys never share an _id.
+func recordID(row map[string]any, keys []string) (any, error) {
+	if len(keys) == 1 {
+		id, ok := row[keys[0]]
+		if !ok || id == nil {
+			return nil, fmt.Errorf("record missing '%s' field", keys[0])
+		}
+		return id, nil
+	}
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		v, ok := row[key]
+		if !ok || v == nil {
+			return nil, fmt.Errorf("record missing key field '%s'", key)
+		}
+		text, _, err := idParam(v)
+		if err != nil {
+			return nil, fmt.Errorf("key field '%s': %w", key, err)
+		}
+		parts[i] = keyPartEscaper.Replace(string(text))
+	}
+	return strings.Join(parts, compositeKeySeparator), nil
+}
+
+// xtdbID is recordID translated by the event's --rekey strategy, if any
+func (e DebeziumEvent) xtdbID(row map[string]any, keys []string) (any, error) {
+	id, err := recordID(row, keys)
+	if err != nil || e.rekey == nil {
+		return id, err
+	}
+	return e.rekey.rekey(id)
+}
+
+var keyPartEscaper = strings.NewReplacer(`\`, `\\`, compositeKeySeparator, `\`+compositeKeySeparator)
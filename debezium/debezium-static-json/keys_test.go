@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigKeyFields(t *testing.T) {
+	cfg, err := parseConfig([]string{"--key-field", "order_id", "--key-field", "lines=tenant_id, order_id,line_no"})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if got := fmt.Sprint(cfg.KeyFields.forTable("orders")); got != "[order_id]" {
+		t.Errorf("Expected the default key order_id, got %s", got)
+	}
+	if got := fmt.Sprint(cfg.KeyFields.forTable("lines")); got != "[tenant_id order_id line_no]" {
+		t.Errorf("Expected lines' composite key, got %s", got)
+	}
+	if got := fmt.Sprint(keyFields{}.forTable("users")); got != "[id]" {
+		t.Errorf("Expected id without flags, got %s", got)
+	}
+	if _, err := parseConfig([]string{"--key-field", "orders=tenant_id,"}); err == nil {
+		t.Error("Expected an empty key column to be rejected")
+	}
+}
+
+func TestRecordID(t *testing.T) {
+	row := map[string]any{"order_id": float64(42), "tenant_id": "acme", "note": "a|b\\c"}
+	cases := []struct {
+		keys []string
+		want any
+	}{
+		{[]string{"order_id"}, float64(42)},
+		{[]string{"tenant_id", "order_id"}, "acme|42"},
+		{[]string{"order_id", "tenant_id"}, "42|acme"},
+		{[]string{"tenant_id", "note"}, `acme|a\|b\\c`},
+	}
+	for _, c := range cases {
+		if got, err := recordID(row, c.keys); err != nil || got != c.want {
+			t.Errorf("recordID(%v) = %#v, %v, want %#v", c.keys, got, err, c.want)
+		}
+	}
+
+	// Escaping keeps keys that would join the same apart
+	a, _ := recordID(map[string]any{"x": "a|b", "y": "c"}, []string{"x", "y"})
+	b, _ := recordID(map[string]any{"x": "a", "y": "b|c"}, []string{"x", "y"})
+	if a == b {
+		t.Errorf("Expected distinct ids, both %v", a)
+	}
+
+	if _, err := recordID(row, []string{"id"}); err == nil || err.Error() != "record missing 'id' field" {
+		t.Errorf("Expected a missing id reported, got %v", err)
+	}
+	if _, err := recordID(row, []string{"tenant_id", "line_no"}); err == nil || !strings.Contains(err.Error(), "line_no") {
+		t.Errorf("Expected the missing key part named, got %v", err)
+	}
+}
+
+func TestKeyFieldStatements(t *testing.T) {
+	keys := keyFields{}
+	keys.Set("order_id")
+	keys.Set("lines=tenant_id,order_id")
+	l := newLoader(Config{KeyFields: keys}, nil)
+	ts := int64(1704067200000)
+
+	order := map[string]any{"order_id": float64(7), "status": "placed"}
+	line := map[string]any{"tenant_id": "acme", "order_id": float64(7), "qty": float64(2)}
+	cases := []struct {
+		event  DebeziumEvent
+		id     any
+		fields string
+	}{
+		{newEvent("c", "orders", ts, nil, order), float64(7), `{"_id":7,"_valid_from":"2024-01-01T00:00:00Z","status":"placed"}`},
+		{newEvent("c", "lines", ts, nil, line), "acme|7", `{"_id":"acme|7","_valid_from":"2024-01-01T00:00:00Z","order_id":7,"qty":2,"tenant_id":"acme"}`},
+	}
+	for _, c := range cases {
+		stmt, ok, err := l.prepare(c.event)
+		if err != nil || !ok {
+			t.Fatalf("prepare failed: %v", err)
+		}
+		if stmt.id != c.id || string(stmt.params[0]) != c.fields {
+			t.Errorf("Expected _id %v and record %s, got %v and %s", c.id, c.fields, stmt.id, stmt.params[0])
+		}
+	}
+
+	// Deletes target the _id the insert wrote
+	for _, c := range []struct {
+		event DebeziumEvent
+		param string
+		oid   uint32
+	}{
+		{newEvent("d", "orders", ts, order, nil), "7", Int8OID},
+		{newEvent("d", "lines", ts, line, nil), "acme|7", TextOID},
+	} {
+		stmt, _, err := l.prepare(c.event)
+		if err != nil || string(stmt.params[0]) != c.param || stmt.oids[0] != c.oid {
+			t.Errorf("Expected delete of %s (OID %d), got %q %v, %v", c.param, c.oid, stmt.params, stmt.oids, err)
+		}
+	}
+
+	// Other tables fall back to the default key, order_id, not id
+	if _, _, err := l.prepare(newEvent("c", "users", ts, nil, map[string]any{"id": 1})); err == nil {
+		t.Error("Expected users without order_id to be rejected")
+	}
+}
+
+func TestKeyFieldIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	orders, lines := getCleanTable(), getCleanTable()
+	keys := keyFields{}
+	keys.Set(orders + "=order_id")
+	keys.Set(lines + "=tenant_id,order_id")
+	ts := int64(1704067200000)
+
+	src := &mockSource{events: []DebeziumEvent{
+		newEvent("c", orders, ts, nil, map[string]any{"order_id": 1, "status": "placed"}),
+		newEvent("c", orders, ts, nil, map[string]any{"order_id": 2, "status": "placed"}),
+		newEvent("d", orders, ts+1000, map[string]any{"order_id": 2, "status": "placed"}, nil),
+		newEvent("c", lines, ts, nil, map[string]any{"tenant_id": "acme", "order_id": 1, "qty": 2}),
+		newEvent("c", lines, ts, nil, map[string]any{"tenant_id": "globex", "order_id": 1, "qty": 5}),
+		newEvent("u", lines, ts+1000, nil, map[string]any{"tenant_id": "acme", "order_id": 1, "qty": 3}),
+		newEvent("d", lines, ts+2000, map[string]any{"tenant_id": "globex", "order_id": 1, "qty": 5}, nil),
+	}}
+	if err := runSource(ctx, src, newLoader(Config{KeyFields: keys}, conn)); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id, status FROM %s", orders))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id int64
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		ids = append(ids, fmt.Sprint(id))
+	}
+	if rows.Err() != nil || fmt.Sprint(ids) != "[1]" {
+		t.Errorf("Expected only order 1 left, got %v, %v", ids, rows.Err())
+	}
+
+	var id, tenant string
+	var qty int64
+	var count int
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT _id, tenant_id, qty, COUNT(*) OVER () FROM %s", lines)).Scan(&id, &tenant, &qty, &count)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if id != "acme|1" || tenant != "acme" || qty != 3 || count != 1 {
+		t.Errorf("Expected only acme|1 with qty 3 left, got %s %s %d (%d rows)", id, tenant, qty, count)
+	}
+}
+
+func TestInsertDeleteRecordKeys(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	keys := []string{"tenant_id", "order_id"}
+	ts := int64(1704067200000)
+	row := map[string]any{"tenant_id": "acme", "order_id": 9, "qty": 1}
+
+	if _, err := insertRecord(ctx, conn, newEvent("c", table, ts, nil, row), keys); err != nil {
+		t.Fatalf("insertRecord failed: %v", err)
+	}
+	tag, err := deleteRecord(ctx, conn, newEvent("d", table, ts+1000, row, nil), keys)
+	if err != nil {
+		t.Fatalf("deleteRecord failed: %v", err)
+	}
+	if tag.RowsAffected() != 1 {
+		t.Errorf("Expected the delete to find acme|9, got %s", tag)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyReservoir is how many samples of each kind LatencyRecorder keeps
+// for percentiles; 8 bytes each, so 32KiB a kind however long the run
+const latencyReservoir = 4096
+
+// LatencyRecorder times statements by kind (insert, update, delete) so the
+// summary can show which dominates a run. Counts, totals and maxima are
+// exact; percentiles come from a fixed-size uniform sample of each kind
+// (reservoir sampling), so they're exact up to latencyReservoir statements
+// and estimates after. Safe for concurrent use.
+type LatencyRecorder struct {
+	mu    sync.Mutex
+	kinds map[string]*latencySamples
+	now   func() time.Time
+	rand  *rand.Rand
+}
+
+// latencySamples is one kind's running totals and reservoir
+type latencySamples struct {
+	count   int
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{
+		kinds: map[string]*latencySamples{},
+		now:   time.Now,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Time runs fn and records how long it took under kind, whether or not it
+// failed
+func (r *LatencyRecorder) Time(kind string, fn func() error) error {
+	start := r.now()
+	err := fn()
+	r.Record(kind, r.now().Sub(start))
+	return err
+}
+
+// Record adds one sample under kind. Once the reservoir is full the n-th
+// sample replaces a random one with probability latencyReservoir/n, which
+// keeps the reservoir a uniform sample of everything recorded.
+func (r *LatencyRecorder) Record(kind string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := r.kinds[kind]
+	if k == nil {
+		k = &latencySamples{}
+		r.kinds[kind] = k
+	}
+	k.count++
+	k.total += d
+	if d > k.max {
+		k.max = d
+	}
+	if len(k.samples) < latencyReservoir {
+		k.samples = append(k.samples, d)
+	} else if i := r.rand.Intn(k.count); i < latencyReservoir {
+		k.samples[i] = d
+	}
+}
+
+// LatencySummary is the distribution of one kind of statement's latency
+type LatencySummary struct {
+	Count int
+	Total time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Summary computes each kind's percentiles (nearest rank, over the
+// reservoir) and exact count, total and maximum
+func (r *LatencyRecorder) Summary() map[string]LatencySummary {
+	r.mu.Lock()
+	summary := make(map[string]LatencySummary, len(r.kinds))
+	sorted := make(map[string][]time.Duration, len(r.kinds))
+	for kind, k := range r.kinds {
+		summary[kind] = LatencySummary{Count: k.count, Total: k.total, Max: k.max}
+		sorted[kind] = append([]time.Duration(nil), k.samples...)
+	}
+	r.mu.Unlock()
+
+	for kind, samples := range sorted {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		s := summary[kind]
+		s.P50 = percentile(samples, 50)
+		s.P95 = percentile(samples, 95)
+		s.P99 = percentile(samples, 99)
+		summary[kind] = s
+	}
+	return summary
+}
+
+// percentile is the nearest-rank p-th percentile of sorted, which must not be
+// empty
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WriteTo prints the summary as a table, kinds in name order
+func (r *LatencyRecorder) WriteTo(w io.Writer) (int64, error) {
+	summary := r.Summary()
+	kinds := make([]string, 0, len(summary))
+	for kind := range summary {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var written int64
+	for _, kind := range kinds {
+		s := summary[kind]
+		n, err := fmt.Fprintf(w, "  %-7s n=%-6d p50=%-10v p95=%-10v p99=%-10v max=%v\n",
+			kind, s.Count, s.P50, s.P95, s.P99, s.Max)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ServeHTTP serves the summary in the Prometheus text format, as a summary
+// metric per statement kind
+func (r *LatencyRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	summary := r.Summary()
+	kinds := make([]string, 0, len(summary))
+	for kind := range summary {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP debezium_loader_statement_seconds Latency of statements sent to XTDB")
+	fmt.Fprintln(w, "# TYPE debezium_loader_statement_seconds summary")
+	for _, kind := range kinds {
+		s := summary[kind]
+		for _, q := range []struct {
+			quantile string
+			d        time.Duration
+		}{{"0.5", s.P50}, {"0.95", s.P95}, {"0.99", s.P99}, {"1", s.Max}} {
+			fmt.Fprintf(w, "debezium_loader_statement_seconds{op=%q,quantile=%q} %g\n", kind, q.quantile, q.d.Seconds())
+		}
+		fmt.Fprintf(w, "debezium_loader_statement_seconds_sum{op=%q} %g\n", kind, s.Total.Seconds())
+		fmt.Fprintf(w, "debezium_loader_statement_seconds_count{op=%q} %d\n", kind, s.Count)
+	}
+}
+
+// serveMetrics serves latency on addr's /metrics until the returned stop
+// function is called
+func serveMetrics(addr string, latency *LatencyRecorder) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listener: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", latency)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	fmt.Fprintf(stdout, "Serving metrics on http://%s/metrics\n", ln.Addr())
+	return func() { srv.Close() }, nil
+}
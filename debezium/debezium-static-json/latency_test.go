@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyRecorder(t *testing.T) {
+	r := NewLatencyRecorder()
+
+	// A fake clock that each execution advances by its planned duration
+	var now time.Time
+	r.now = func() time.Time { return now }
+	execute := func(d time.Duration) func() error {
+		return func() error { now = now.Add(d); return nil }
+	}
+
+	// Inserts take 1ms..100ms, shuffled; deletes are one slow statement
+	for _, i := range []int{37, 100, 1, 50, 99, 95, 2} {
+		r.Time("insert", execute(time.Duration(i)*time.Millisecond))
+	}
+	for i := 3; i <= 98; i++ {
+		if i != 37 && i != 50 && i != 95 {
+			r.Time("insert", execute(time.Duration(i)*time.Millisecond))
+		}
+	}
+	boom := errors.New("boom")
+	err := r.Time("delete", func() error { now = now.Add(2 * time.Second); return boom })
+	if err != boom {
+		t.Errorf("Expected Time to return fn's error, got %v", err)
+	}
+
+	summary := r.Summary()
+	want := LatencySummary{
+		Count: 100,
+		Total: 5050 * time.Millisecond,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+	}
+	if summary["insert"] != want {
+		t.Errorf("insert summary = %+v, want %+v", summary["insert"], want)
+	}
+	if d := summary["delete"]; d.Count != 1 || d.P50 != 2*time.Second || d.P99 != 2*time.Second || d.Max != 2*time.Second {
+		t.Errorf("Expected a failed delete to be timed too, got %+v", d)
+	}
+
+	var out strings.Builder
+	r.WriteTo(&out)
+	if !strings.HasPrefix(out.String(), "  delete ") || !strings.Contains(out.String(), "p95=95ms") {
+		t.Errorf("Unexpected summary table:\n%s", out.String())
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`debezium_loader_statement_seconds{op="insert",quantile="0.95"} 0.095`,
+		`debezium_loader_statement_seconds{op="insert",quantile="1"} 0.1`,
+		`debezium_loader_statement_seconds_count{op="insert"} 100`,
+		`debezium_loader_statement_seconds_count{op="delete"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestPercentileSmallSamples(t *testing.T) {
+	one := []time.Duration{7}
+	if percentile(one, 50) != 7 || percentile(one, 99) != 7 {
+		t.Error("Expected every percentile of one sample to be that sample")
+	}
+	four := []time.Duration{1, 2, 3, 4}
+	if percentile(four, 50) != 2 || percentile(four, 95) != 4 {
+		t.Errorf("Expected nearest-rank p50=2 and p95=4, got %v and %v", percentile(four, 50), percentile(four, 95))
+	}
+}
+
+// However many statements a run sends, each kind keeps latencyReservoir
+// samples; count, total and maximum stay exact
+func TestLatencyRecorderBounded(t *testing.T) {
+	r := NewLatencyRecorder()
+	const n = 10 * latencyReservoir
+	for i := 1; i <= n; i++ {
+		r.Record("insert", time.Duration(i)*time.Microsecond)
+	}
+	if got := len(r.kinds["insert"].samples); got != latencyReservoir {
+		t.Errorf("Expected %d samples kept, got %d", latencyReservoir, got)
+	}
+
+	s := r.Summary()["insert"]
+	if s.Count != n || s.Max != n*time.Microsecond || s.Total != time.Duration(n*(n+1)/2)*time.Microsecond {
+		t.Errorf("Expected exact count, total and max, got %+v", s)
+	}
+	// A uniform sample of 1..n puts the median near n/2
+	if mid := time.Duration(n/2) * time.Microsecond; s.P50 < mid*8/10 || s.P50 > mid*12/10 {
+		t.Errorf("Expected p50 near %v, got %v", mid, s.P50)
+	}
+}
@@ -3,219 +3,1035 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"math"
 	"os"
+	"os/signal"
+	"reflect"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-const JSONOID = 114 // PostgreSQL JSON type OID
+const (
+	JSONOID = 114  // PostgreSQL JSON type OID
+	Int8OID = 20   // PostgreSQL bigint type OID
+	TextOID = 25   // PostgreSQL text type OID
+	UUIDOID = 2950 // PostgreSQL uuid type OID
+)
 
 // DebeziumEvent represents a CDC event in Debezium format
 type DebeziumEvent struct {
+	// Schema is present when the connector's JSON converter has
+	// schemas.enable=true; it types the before/after fields
+	Schema  *connectSchema `json:"schema,omitempty"`
 	Payload struct {
-		Op     string                 `json:"op"`    // c=create, u=update, d=delete, r=read
-		TsMs   int64                  `json:"ts_ms"` // Timestamp in milliseconds
+		Op     string `json:"op"`    // c=create, u=update, d=delete, r=read
+		TsMs   int64  `json:"ts_ms"` // Timestamp in milliseconds
 		Source struct {
-			DB    string `json:"db"`
-			Table string `json:"table"`
+			DB         string `json:"db"`
+			Schema     string `json:"schema,omitempty"` // e.g. public, from Postgres and SQL Server connectors
+			Table      string `json:"table"`
+			Collection string `json:"collection,omitempty"` // the MongoDB connector's table
+			TsMs       int64  `json:"ts_ms"`                // when the change was committed in the source database
 		} `json:"source"`
 		Before map[string]any `json:"before"`
 		After  map[string]any `json:"after"`
+
+		// Transaction is set with provide.transaction.metadata=true
+		Transaction *sourceTransaction `json:"transaction,omitempty"`
+
+		// Status (BEGIN or END), ID and EventCount are set instead of the
+		// fields above on transaction boundary markers
+		Status     string `json:"status,omitempty"`
+		ID         string `json:"id,omitempty"`
+		EventCount int64  `json:"event_count,omitempty"`
 	} `json:"payload"`
+
+	// noValidTime writes the event without a valid time, so XTDB uses the
+	// transaction's (--valid-from=none)
+	noValidTime bool
+
+	// noTsMs marks an unwrapped row without __ts_ms, whose TsMs of 0 isn't
+	// a time it happened, so --valid-from skips ts_ms for it
+	noTsMs bool
+
+	// tombstone marks a null value, which follows a delete and has nothing
+	// to write
+	tombstone bool
+
+	// mongo marks an event from the MongoDB connector, whose documents are
+	// keyed by their own _id
+	mongo bool
+
+	// rekey translates the event's id into the _id written (--rekey)
+	rekey rekeyer
+}
+
+// Config holds the loader's command-line options
+type Config struct {
+	EventsFile  string
+	OutboxTable string // route events from this table as a transactional outbox
+	UpdateMode  string // replace (whole after image) or patch (changed fields only)
+
+	TablePrefix     string       // prepended to every XTDB table name, e.g. "cdc_"
+	NormalizeTables bool         // lower-case table names and map '-', '.' and ' ' to '_'
+	Renames         tableRenames // XTDB table names for particular source tables
+
+	KeyFields keyFields // primary-key columns by source table; "id" by default
+	Rekey     rekeyer   // translates source ids into XTDB _ids; nil keeps them
+
+	TemporalCols temporalHints // logical types of columns in messages without a schema
+
+	KafkaBrokers string // comma-separated; consume from Kafka instead of EventsFile
+	KafkaTopic   string // comma-separated topics, consumed by one group
+	KafkaGroup   string
+
+	Format         string // json or avro (Kafka only)
+	SchemaRegistry string // Confluent Schema Registry URL, for --format=avro
+
+	// TombstoneDeletes deletes the document a Kafka tombstone's key names,
+	// for topics whose deletes arrive only as tombstones
+	TombstoneDeletes bool
+
+	ValidTime validTimeGuard
+	ValidFrom []string // where _valid_from comes from, in order of preference: ts_ms, source.ts_ms or none
+
+	SSLCert     string // client certificate for mutual TLS
+	SSLKey      string
+	SSLRootCert string // CA to verify XTDB's server certificate
+
+	MetricsAddr string // serve statement latency on http://<addr>/metrics
+
+	BatchSize     int           // events per pipelined transaction; 1 writes each event on its own
+	FlushInterval time.Duration // how long a partly filled batch waits for more events
+	Workers       int           // connections writing in parallel, each entity's events kept on one
+
+	PerEventCommit bool // ignore source transaction metadata and commit each event on its own
+
+	Dedup bool // skip inserts and updates whose version (_id, _valid_from and content) is already loaded
+
+	CheckpointFile string // records the last event written, to resume a file or stdin run from
+
+	Report     string // text (the default) or json
+	ReportFile string // write the JSON report here rather than to stdout
+
+	DeadLetter  string // append events that fail here, as JSON lines, up to MaxFailures
+	MaxFailures int    // with DeadLetter, how many events may fail before the run stops; -1 for no limit
 }
 
 func main() {
-	if err := run(); err != nil {
+	cfg, err := parseConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err := run(cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	ctx := context.Background()
+func parseConfig(args []string) (Config, error) {
+	cfg := Config{KeyFields: keyFields{}, TemporalCols: temporalHints{}, Renames: tableRenames{}}
+
+	fs := flag.NewFlagSet("debezium-ingest", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: debezium-ingest [flags] [events.json | -]\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cfg.OutboxTable, "outbox-table", "",
+		"treat events from this source table as outbox rows (aggregate_type, aggregate_id, payload)")
+	fs.StringVar(&cfg.UpdateMode, "update-mode", "replace",
+		"how updates are written: replace (the whole after image) or patch (only the fields that changed)")
+	fs.StringVar(&cfg.TablePrefix, "table-prefix", "", "prefix for XTDB table names, e.g. cdc_ to load users into cdc_users")
+	fs.BoolVar(&cfg.NormalizeTables, "normalize-table-names", true,
+		"lower-case source table names and turn dashes, dots and spaces into underscores")
+	fs.Var(cfg.Renames, "rename",
+		"from=to loads source table from (or schema.from) into XTDB table to, instead of the prefixed name; repeatable")
+	fs.Var(cfg.KeyFields, "key-field",
+		"primary-key column(s) that become _id: col[,col] for every table or table=col[,col] for one; repeatable (default id)")
+	rekey := fs.String("rekey", "",
+		"translate source ids into XTDB _ids: uuid-v5-from-id (with --rekey-namespace) or lookup (with --rekey-file)")
+	rekeyNamespace := fs.String("rekey-namespace", "", "namespace UUID for --rekey=uuid-v5-from-id")
+	rekeyFile := fs.String("rekey-file", "", "CSV of source_id,xtdb_id rows for --rekey=lookup; a source_id,xtdb_id header row is skipped")
+	fs.Var(cfg.TemporalCols, "temporal-col",
+		"table.col=type for a column of events without a schema holding a date (epoch days), timestamp (epoch millis) or micro-timestamp; repeatable")
+	fs.StringVar(&cfg.KafkaBrokers, "kafka-brokers", "",
+		"comma-separated Kafka brokers; consume events from --kafka-topic instead of a file")
+	fs.StringVar(&cfg.KafkaBrokers, "brokers", "", "alias for --kafka-brokers")
+	fs.StringVar(&cfg.KafkaTopic, "kafka-topic", "", "comma-separated Kafka topics carrying Debezium JSON messages")
+	fs.StringVar(&cfg.KafkaTopic, "topics", "", "alias for --kafka-topic")
+	fs.StringVar(&cfg.KafkaTopic, "topic", "", "alias for --kafka-topic")
+	source := fs.String("source", "",
+		"where events come from: file (a JSON array, or - for newline-delimited stdin) or kafka; defaults to kafka with --kafka-brokers, otherwise file")
+	fs.StringVar(&cfg.KafkaGroup, "kafka-group", "xtdb-debezium-loader",
+		"Kafka consumer group; offsets are committed once events are written, so a crash replays whatever was uncommitted (up to a whole --batch-size batch)")
+	fs.StringVar(&cfg.Format, "format", "json",
+		"Kafka message format: json, or avro (Confluent wire format, needs --schema-registry)")
+	fs.StringVar(&cfg.SchemaRegistry, "schema-registry", "", "Confluent Schema Registry URL for --format=avro")
+	fs.BoolVar(&cfg.TombstoneDeletes, "tombstone-deletes", false,
+		"treat a Kafka tombstone as a delete of the document its JSON key names, for topics flattened by ExtractNewRecordState with delete.handling.mode=drop, where the tombstone is all that's left of a delete")
+
+	var minValid, maxValid string
+	fs.StringVar(&minValid, "valid-from-min", "", "earliest acceptable _valid_from, RFC3339 (default 1900-01-01)")
+	fs.StringVar(&maxValid, "valid-from-max", "", "latest acceptable _valid_from, RFC3339 (default now+1d)")
+	fs.StringVar(&cfg.ValidTime.Policy, "valid-time-policy", "reject",
+		"what to do with out-of-range or unit-mistake timestamps: reject, clamp or warn")
+	validFrom := fs.String("valid-from", "ts_ms",
+		"where _valid_from comes from: ts_ms (connector processing time), source.ts_ms (source commit time) or none (XTDB's transaction time); comma-separate fallbacks, e.g. source.ts_ms,ts_ms")
+	fs.DurationVar(&cfg.ValidTime.MaxSkew, "max-clock-skew", 0,
+		"warn about and clamp to now any valid time further than this ahead of the local clock, e.g. 5m (default off)")
+
+	fs.StringVar(&cfg.SSLCert, "sslcert", "", "client certificate (PEM) for mutual TLS to XTDB")
+	fs.StringVar(&cfg.SSLKey, "sslkey", "", "client private key (PEM), required with --sslcert")
+	fs.StringVar(&cfg.SSLRootCert, "sslrootcert", "", "CA certificate (PEM) used to verify XTDB's server certificate")
+
+	fs.IntVar(&cfg.BatchSize, "batch-size", 1,
+		"write up to this many consecutive events for a table as one pipelined transaction")
+	fs.DurationVar(&cfg.FlushInterval, "flush-interval", batchLinger,
+		"write a partly filled batch, or a source transaction whose END marker hasn't arrived, once no event has arrived for this long")
+	fs.IntVar(&cfg.Workers, "workers", 1,
+		"write with this many connections in parallel; events for the same table and _id stay in order on one")
+	fs.BoolVar(&cfg.Dedup, "dedup", false,
+		"skip inserts and updates whose _id, _valid_from and content are already loaded, so replaying input doesn't write it again")
+	fs.BoolVar(&cfg.PerEventCommit, "per-event-commit", false,
+		"ignore Debezium transaction metadata and write each event in its own transaction")
+	fs.StringVar(&cfg.CheckpointFile, "checkpoint-file", "",
+		"record the last event written here after each commit, and skip events up to it on the next run")
+	fs.StringVar(&cfg.Report, "report", "text",
+		"end-of-run summary: text, or json for a machine-readable report with per-table counts, skipped and failed events (on stdout, with progress moved to stderr)")
+	fs.StringVar(&cfg.ReportFile, "report-file", "", "write the JSON report to this file instead of stdout (implies --report=json)")
+	fs.StringVar(&cfg.DeadLetter, "dead-letter", "",
+		"append events that fail to decode, convert or write to this JSON-lines file and carry on; the run still exits non-zero if any failed")
+	fs.IntVar(&cfg.MaxFailures, "max-failures", -1,
+		"with --dead-letter, stop with an error once more than this many events have failed (default -1: no limit)")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", "",
+		"serve statement latency percentiles in Prometheus format on this address, e.g. :9100")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	var err error
+	if cfg.ValidTime.Min, err = parseBound(minValid); err != nil {
+		return cfg, fmt.Errorf("--valid-from-min: %w", err)
+	}
+	if cfg.ValidTime.Max, err = parseBound(maxValid); err != nil {
+		return cfg, fmt.Errorf("--valid-from-max: %w", err)
+	}
+	if cfg.ValidFrom, err = parseValidFrom(*validFrom); err != nil {
+		return cfg, fmt.Errorf("--valid-from: %w", err)
+	}
+	if cfg.ValidTime.MaxSkew < 0 {
+		return cfg, fmt.Errorf("--max-clock-skew must not be negative, got %s", cfg.ValidTime.MaxSkew)
+	}
+	if !validTimePolicies[cfg.ValidTime.Policy] {
+		return cfg, fmt.Errorf("--valid-time-policy must be reject, clamp or warn, got %q", cfg.ValidTime.Policy)
+	}
+
+	if (cfg.SSLCert == "") != (cfg.SSLKey == "") {
+		return cfg, fmt.Errorf("--sslcert and --sslkey must be given together")
+	}
+
+	if cfg.UpdateMode != "replace" && cfg.UpdateMode != "patch" {
+		return cfg, fmt.Errorf("--update-mode must be replace or patch, got %q", cfg.UpdateMode)
+	}
+
+	if cfg.TablePrefix != "" {
+		if _, err := sanitizeTableName("t", cfg.TablePrefix, false); err != nil {
+			return cfg, fmt.Errorf("--table-prefix %q must be letters, digits and underscores", cfg.TablePrefix)
+		}
+	}
+
+	if *rekey != "" {
+		if cfg.Rekey, err = newRekeyer(*rekey, *rekeyNamespace, *rekeyFile); err != nil {
+			return cfg, err
+		}
+	} else if *rekeyNamespace != "" || *rekeyFile != "" {
+		return cfg, fmt.Errorf("--rekey-namespace and --rekey-file require --rekey")
+	}
+
+	if cfg.ReportFile != "" {
+		cfg.Report = "json"
+	}
+	if cfg.Report != "text" && cfg.Report != "json" {
+		return cfg, fmt.Errorf("--report must be text or json, got %q", cfg.Report)
+	}
+
+	if cfg.MaxFailures < -1 {
+		return cfg, fmt.Errorf("--max-failures must be at least 0, or -1 for no limit, got %d", cfg.MaxFailures)
+	}
+	if cfg.MaxFailures >= 0 && cfg.DeadLetter == "" {
+		return cfg, fmt.Errorf("--max-failures requires --dead-letter")
+	}
+
+	if cfg.BatchSize < 1 {
+		return cfg, fmt.Errorf("--batch-size must be at least 1, got %d", cfg.BatchSize)
+	}
+	if cfg.FlushInterval <= 0 {
+		return cfg, fmt.Errorf("--flush-interval must be positive, got %s", cfg.FlushInterval)
+	}
+	if cfg.Workers < 1 {
+		return cfg, fmt.Errorf("--workers must be at least 1, got %d", cfg.Workers)
+	}
+
+	switch *source {
+	case "":
+	case "file":
+		if cfg.KafkaBrokers != "" {
+			return cfg, fmt.Errorf("--source=file can't be used with --kafka-brokers")
+		}
+	case "kafka":
+		if cfg.KafkaBrokers == "" {
+			return cfg, fmt.Errorf("--source=kafka requires --kafka-brokers")
+		}
+	default:
+		return cfg, fmt.Errorf("--source must be file or kafka, got %q", *source)
+	}
+	if cfg.KafkaBrokers != "" {
+		topics := splitTopics(cfg.KafkaTopic)
+		if len(topics) == 0 {
+			return cfg, fmt.Errorf("--kafka-brokers requires --kafka-topic with at least one topic, got %q", cfg.KafkaTopic)
+		}
+		cfg.KafkaTopic = strings.Join(topics, ",")
+	}
+	if cfg.KafkaBrokers != "" && cfg.CheckpointFile != "" {
+		// The group's committed offsets already are the checkpoint
+		return cfg, fmt.Errorf("--checkpoint-file is for file and stdin input; Kafka resumes from --kafka-group's offsets")
+	}
+
+	if cfg.TombstoneDeletes && (cfg.KafkaBrokers == "" || cfg.Format != "json") {
+		return cfg, fmt.Errorf("--tombstone-deletes is for Kafka topics with JSON keys (--kafka-brokers, --format=json)")
+	}
+
+	switch cfg.Format {
+	case "json":
+	case "avro":
+		if cfg.KafkaBrokers == "" || cfg.SchemaRegistry == "" {
+			return cfg, fmt.Errorf("--format=avro requires --kafka-brokers and --schema-registry")
+		}
+	default:
+		return cfg, fmt.Errorf("--format must be json or avro, got %q", cfg.Format)
+	}
 
 	// Read CDC events file
-	eventsFile := "cdc/events.json"
-	if len(os.Args) > 1 {
-		eventsFile = os.Args[1]
+	cfg.EventsFile = "cdc/events.json"
+	if fs.NArg() > 0 {
+		cfg.EventsFile = fs.Arg(0)
 	}
 
-	events, err := loadEvents(eventsFile)
-	if err != nil {
-		return fmt.Errorf("loading events: %w", err)
+	return cfg, nil
+}
+
+func run(cfg Config) error {
+	if cfg.Report == "json" && cfg.ReportFile == "" {
+		stdout = os.Stderr
 	}
 
-	fmt.Printf("Loaded %d CDC events from %s\n", len(events), eventsFile)
+	// Stop consuming on Ctrl-C; events already being written are finished first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Connect to XTDB
-	host := os.Getenv("XTDB_HOST")
-	if host == "" {
-		host = "xtdb"
+	pgxCfg, err := connConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("configuring connection: %w", err)
 	}
-	connStr := fmt.Sprintf("postgres://xtdb:xtdb@%s:5432/xtdb", host)
-
-	conn, err := pgx.Connect(ctx, connStr)
+	conn, err := pgx.ConnectConfig(ctx, pgxCfg)
 	if err != nil {
 		return fmt.Errorf("connecting to XTDB: %w", err)
 	}
-	defer conn.Close(ctx)
+	defer conn.Close(context.Background())
 
-	fmt.Println("Connected to XTDB")
+	fmt.Fprintln(stdout, "Connected to XTDB")
 
-	// Process events
-	stats := map[string]int{"inserts": 0, "updates": 0, "deletes": 0}
-	tables := map[string]bool{}
+	l := newLoader(cfg, conn)
+	l.connect = func(ctx context.Context) (*pgx.Conn, error) {
+		return pgx.ConnectConfig(ctx, pgxCfg.Copy())
+	}
 
-	for i, event := range events {
-		op := event.Payload.Op
-		table := event.Payload.Source.Table
-		tables[table] = true
+	if cfg.DeadLetter != "" {
+		if l.dead, err = openDeadLetters(cfg.DeadLetter, cfg.MaxFailures); err != nil {
+			return err
+		}
+		defer l.dead.Close()
+	}
 
-		switch op {
-		case "c", "r": // create or read (snapshot)
-			if err := insertRecord(ctx, conn, event); err != nil {
-				return fmt.Errorf("event %d: insert: %w", i, err)
-			}
-			stats["inserts"]++
+	if cfg.MetricsAddr != "" {
+		stopMetrics, err := serveMetrics(cfg.MetricsAddr, l.latency)
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+	}
 
-		case "u": // update
-			if err := insertRecord(ctx, conn, event); err != nil {
-				return fmt.Errorf("event %d: update: %w", i, err)
-			}
-			stats["updates"]++
+	src, err := openSource(cfg, l)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
 
-		case "d": // delete
-			if err := deleteRecord(ctx, conn, event); err != nil {
-				return fmt.Errorf("event %d: delete: %w", i, err)
-			}
-			stats["deletes"]++
+	if cfg.CheckpointFile != "" {
+		cp, err := newCheckpointSource(src, cfg.CheckpointFile, l.stats)
+		if err != nil {
+			return err
+		}
+		if cp.resume > 0 {
+			fmt.Fprintf(stdout, "Resuming after event %d (from %s)\n", cp.resume-1, cfg.CheckpointFile)
+		}
+		src = cp
+	}
 
-		default:
-			fmt.Printf("Warning: unknown operation %q in event %d\n", op, i)
+	err = runSource(ctx, src, l)
+	if cfg.Report == "json" {
+		// CI wants the report most when the run failed
+		if reportErr := l.writeReport(err); err == nil {
+			err = reportErr
+		}
+		if err != nil {
+			return err
+		}
+		return l.deadLetterError()
+	}
+	if err != nil {
+		return err
+	}
+
+	l.printSummary()
+	return l.deadLetterError()
+}
+
+// deadLetterError fails a run that carried on past dead-lettered events, so
+// it still exits non-zero
+func (l *loader) deadLetterError() error {
+	if l.dead == nil || l.dead.failures() == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d events failed (written to %s)", l.dead.failures(), l.dead.path)
+}
+
+// openSource picks the event source the flags ask for
+func openSource(cfg Config, l *loader) (EventSource, error) {
+	switch {
+	case cfg.KafkaBrokers != "":
+		fmt.Fprintf(stdout, "Consuming %s from %s (group %s)\n", cfg.KafkaTopic, cfg.KafkaBrokers, cfg.KafkaGroup)
+		src := newKafkaSource(newKafkaReader(cfg), l.stats)
+		src.tombstoneDeletes = cfg.TombstoneDeletes
+		if cfg.Format == "avro" {
+			src.decode = newSchemaRegistry(cfg.SchemaRegistry).decodeEvent
 		}
+		return src, nil
+
+	case cfg.EventsFile == "-":
+		fmt.Fprintln(stdout, "Reading newline-delimited events from stdin")
+		return newStreamSource(newLineSource(os.Stdin), l.stats), nil
+
+	default:
+		src, err := newFileSource(cfg.EventsFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading events: %w", err)
+		}
+		src.stats = l.stats
+		if src.files > 1 {
+			fmt.Fprintf(stdout, "Streaming CDC events from %d files in %s\n", src.files, cfg.EventsFile)
+		} else {
+			fmt.Fprintf(stdout, "Streaming CDC events from %s\n", cfg.EventsFile)
+		}
+		return src, nil
+	}
+}
+
+// loader applies Debezium events to XTDB and keeps running totals
+type loader struct {
+	cfg     Config
+	conn    *pgx.Conn
+	stats   map[string]int
+	tables  map[string]bool
+	latency *LatencyRecorder
+
+	// For the run report
+	started     time.Time
+	current     int64 // the event being applied, numbered as runSource numbers them
+	events      int
+	tableCounts map[string]*tableCounts
+	firstEvent  time.Time
+	lastEvent   time.Time
+	skipped     []eventIssue
+
+	// connect opens another connection like conn, for --workers
+	connect func(ctx context.Context) (*pgx.Conn, error)
+
+	// sendBatch writes a batch of statements in one transaction; tests
+	// replace it to run without a server
+	sendBatch func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error)
+	// versionExists looks for the version a statement writes, for --dedup;
+	// tests replace it too
+	versionExists func(ctx context.Context, stmt statement) (bool, error)
+
+	// dead is the --dead-letter file, shared by workers; nil stops the run
+	// at the first failure
+	dead *deadLetters
+}
+
+func newLoader(cfg Config, conn *pgx.Conn) *loader {
+	l := &loader{
+		cfg:     cfg,
+		conn:    conn,
+		stats:   map[string]int{"inserts": 0, "updates": 0, "deletes": 0},
+		tables:  map[string]bool{},
+		latency: NewLatencyRecorder(),
+
+		started:     time.Now(),
+		tableCounts: map[string]*tableCounts{},
 	}
+	l.sendBatch = l.execBatch
+	l.versionExists = l.queryVersionExists
+	return l
+}
 
-	// Print summary
-	fmt.Println("\n--- Ingestion Complete ---")
-	fmt.Printf("Tables: %v\n", sortedKeys(tables))
-	fmt.Printf("Inserts: %d\n", stats["inserts"])
-	fmt.Printf("Updates: %d\n", stats["updates"])
-	fmt.Printf("Deletes: %d\n", stats["deletes"])
+// apply writes a single event to XTDB
+func (l *loader) apply(ctx context.Context, event DebeziumEvent) error {
+	stmt, ok, err := l.prepare(event)
+	if err != nil || !ok {
+		return err
+	}
+	if l.cfg.Dedup {
+		if loaded, err := l.loaded(ctx, stmt); err != nil || loaded {
+			return err
+		}
+	}
 
+	var tag pgconn.CommandTag
+	err = l.latency.Time(stmt.kind, func() (err error) {
+		tag, err = stmt.exec(ctx, l.conn)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", stmt.kind, err)
+	}
+	fmt.Fprintln(stdout, stmt)
+	l.count(stmt, tag)
 	return nil
 }
 
+// prepare builds the statement that writes event, or returns false for an
+// event with nothing to write
+func (l *loader) prepare(event DebeziumEvent) (statement, bool, error) {
+	if isTxMarker(event) {
+		return statement{}, false, nil
+	}
+	if isTombstone(event) {
+		l.stats["tombstones"]++
+		return statement{}, false, nil
+	}
+
+	event, err := applyConnectSchema(event)
+	if err != nil {
+		return statement{}, false, err
+	}
+	if event, err = applyTemporalHints(event, l.cfg.TemporalCols); err != nil {
+		return statement{}, false, err
+	}
+
+	// Outbox documents are keyed by their aggregate_id, as "id"
+	keys := defaultKeyFields
+	if l.cfg.OutboxTable != "" && event.Payload.Source.Table == l.cfg.OutboxTable {
+		routed, ok, err := outboxEvent(event)
+		if err != nil {
+			return statement{}, false, fmt.Errorf("outbox: %w", err)
+		}
+		if !ok {
+			l.stats["outbox_skipped"]++
+			l.skip(event.Payload.Source.Table, "outbox row with no after image")
+			return statement{}, false, nil
+		}
+		event = routed
+	} else {
+		keys = l.cfg.KeyFields.forEvent(event)
+	}
+
+	table, err := l.resolveTable(event)
+	if err != nil {
+		return statement{}, false, err
+	}
+	event.Payload.Source.Table = table
+	op := event.Payload.Op
+	l.tables[table] = true
+
+	source, ms, ok, err := validFromSource(event, l.cfg.ValidFrom)
+	if err != nil {
+		return statement{}, false, err
+	}
+	if ok {
+		validFrom, err := l.cfg.ValidTime.check(time.UnixMilli(ms).UTC())
+		if err != nil {
+			return statement{}, false, fmt.Errorf("%s %d: %w", source, ms, err)
+		}
+		event.Payload.TsMs = validFrom.UnixMilli()
+		if l.firstEvent.IsZero() {
+			l.firstEvent = validFrom
+		}
+		l.lastEvent = validFrom
+	} else {
+		event.noValidTime = true
+	}
+
+	event.rekey = l.cfg.Rekey
+	var stmt statement
+	switch op {
+	case "c", "r": // create or read (snapshot)
+		stmt, err = insertStatement(event, "insert", keys)
+	case "u": // update
+		if l.cfg.UpdateMode != "patch" {
+			stmt, err = insertStatement(event, "update", keys)
+			break
+		}
+		var changed bool
+		stmt, changed, err = patchStatement(event, keys)
+		if err == nil && !changed {
+			l.stats["updates_unchanged"]++
+			l.skip(table, "update changed no fields")
+			return statement{}, false, nil
+		}
+	case "d": // delete
+		stmt, err = deleteStatement(event, keys)
+	case "":
+		fmt.Fprintf(stdout, "Warning: event for table %q has no operation\n", table)
+		l.skip(table, "no operation")
+		return statement{}, false, nil
+	default:
+		fmt.Fprintf(stdout, "Warning: unknown operation %q for table %q\n", op, table)
+		l.skip(table, fmt.Sprintf("unknown operation %q", op))
+		return statement{}, false, nil
+	}
+	if err != nil {
+		return statement{}, false, fmt.Errorf("%s: %w", stmt.kind, err)
+	}
+	return stmt, true, nil
+}
+
+// count adds a written statement to the running totals
+func (l *loader) count(stmt statement, tag pgconn.CommandTag) {
+	l.stats[stmt.kind+"s"]++
+	counts := l.tableCounts[stmt.table]
+	if counts == nil {
+		counts = &tableCounts{}
+		l.tableCounts[stmt.table] = counts
+	}
+	switch stmt.kind {
+	case "insert":
+		counts.Inserts++
+	case "update":
+		counts.Updates++
+	case "delete":
+		counts.Deletes++
+	}
+	l.stats["rows_affected"] += int(tag.RowsAffected())
+}
+
+func (l *loader) printSummary() {
+	fmt.Fprintln(stdout, "\n--- Ingestion Complete ---")
+	fmt.Fprintf(stdout, "Tables: %v\n", sortedKeys(l.tables))
+	fmt.Fprintf(stdout, "Inserts: %d\n", l.stats["inserts"])
+	fmt.Fprintf(stdout, "Updates: %d\n", l.stats["updates"])
+	fmt.Fprintf(stdout, "Deletes: %d\n", l.stats["deletes"])
+	fmt.Fprintf(stdout, "Rows affected (server-reported): %d\n", l.stats["rows_affected"])
+	if l.cfg.UpdateMode == "patch" {
+		fmt.Fprintf(stdout, "Updates with no changed fields: %d\n", l.stats["updates_unchanged"])
+	}
+	if l.cfg.OutboxTable != "" {
+		fmt.Fprintf(stdout, "Outbox rows skipped: %d\n", l.stats["outbox_skipped"])
+	}
+	if l.cfg.CheckpointFile != "" {
+		fmt.Fprintf(stdout, "Events applied: %d\n", l.stats["applied"])
+		fmt.Fprintf(stdout, "Events skipped (checkpoint): %d\n", l.stats["skipped_checkpoint"])
+	}
+	if l.stats["transactions"] > 0 {
+		fmt.Fprintf(stdout, "Source transactions: %d\n", l.stats["transactions"])
+	}
+	if l.stats["transactions_unfinished"] > 0 {
+		fmt.Fprintf(stdout, "Source transactions written before their END marker: %d\n", l.stats["transactions_unfinished"])
+	}
+	if l.cfg.Dedup {
+		fmt.Fprintf(stdout, "Already loaded (--dedup): %d\n", l.stats["deduplicated"])
+	}
+	if l.dead != nil {
+		fmt.Fprintf(stdout, "Events failed: %d (written to %s)\n", l.dead.failures(), l.dead.path)
+	}
+	if l.cfg.KafkaBrokers != "" || l.stats["tombstones"] > 0 {
+		fmt.Fprintf(stdout, "Tombstones skipped: %d\n", l.stats["tombstones"])
+	}
+	if l.stats["blank_lines"] > 0 {
+		fmt.Fprintf(stdout, "Blank lines skipped: %d\n", l.stats["blank_lines"])
+	}
+	if len(l.latency.Summary()) > 0 {
+		fmt.Fprintln(stdout, "Statement latency:")
+		l.latency.WriteTo(stdout)
+	}
+}
+
+func connString() string {
+	host := os.Getenv("XTDB_HOST")
+	if host == "" {
+		host = "xtdb"
+	}
+	return fmt.Sprintf("postgres://xtdb:xtdb@%s:5432/xtdb", host)
+}
+
+// loadEvents reads a whole JSON array of events, for tests and small files;
+// the loader itself streams them with newFileSource
 func loadEvents(filename string) ([]DebeziumEvent, error) {
-	data, err := os.ReadFile(filename)
+	src, err := newFileSource(filename)
 	if err != nil {
 		return nil, err
 	}
+	defer src.Close()
 
 	var events []DebeziumEvent
-	if err := json.Unmarshal(data, &events); err != nil {
-		return nil, err
+	for {
+		event, ok, err := src.Next(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return events, nil
+		}
+		events = append(events, event)
 	}
+}
+
+// EventToRecord converts a create/update/read event into its target table
+// and the XTDB record to insert, keyed by its "id" field
+func EventToRecord(event DebeziumEvent) (string, map[string]any, error) {
+	return eventToRecord(event, defaultKeyFields)
+}
 
-	return events, nil
+// RecordToEvent goes the other way, for debugging and for building fixtures
+// from real data: it rebuilds an approximate create event from an XTDB
+// record, with _id back as "id", _valid_from (an RFC3339 string or, as
+// queried, a time.Time) as ts_ms and everything else as the after image.
+// Any source database, before image or sub-second ts_ms is lost.
+func RecordToEvent(table string, record map[string]interface{}) DebeziumEvent {
+	var event DebeziumEvent
+	event.Payload.Op = "c"
+	event.Payload.Source.Table = table
+	event.Payload.After = make(map[string]any, len(record))
+
+	for k, v := range record {
+		switch k {
+		case "_id":
+			event.Payload.After["id"] = v
+		case "_valid_from":
+			switch vf := v.(type) {
+			case time.Time:
+				event.Payload.TsMs = vf.UnixMilli()
+			case string:
+				if t, err := time.Parse(time.RFC3339, vf); err == nil {
+					event.Payload.TsMs = t.UnixMilli()
+				}
+			}
+		case "_valid_to", "_system_from", "_system_to":
+			// Bookkeeping a temporal query adds, not part of the row
+		default:
+			event.Payload.After[k] = v
+		}
+	}
+	return event
 }
 
-func insertRecord(ctx context.Context, conn *pgx.Conn, event DebeziumEvent) error {
+// eventToRecord is EventToRecord for a table whose primary key is keys (see
+// recordID). A single key column is written only as _id; the columns of a
+// composite key, or of one translated by --rekey, are kept as fields too.
+func eventToRecord(event DebeziumEvent, keys []string) (string, map[string]any, error) {
 	table := event.Payload.Source.Table
+	if err := checkTableName(table); err != nil {
+		return "", nil, err
+	}
 	record := event.Payload.After
 	if record == nil {
-		return fmt.Errorf("insert/update event has nil 'after' field")
+		return "", nil, fmt.Errorf("insert/update event has nil 'after' field")
 	}
 
-	// Extract ID
-	id, ok := record["id"]
-	if !ok {
-		return fmt.Errorf("record missing 'id' field")
+	id, err := event.xtdbID(record, keys)
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Convert ts_ms to timestamp for _valid_from
-	validFrom := time.UnixMilli(event.Payload.TsMs).UTC()
-
-	// Build record map for XTDB
-	recordMap := map[string]any{
-		"_id":         id,
-		"_valid_from": validFrom.Format(time.RFC3339),
+	// Build record map for XTDB, valid from ts_ms
+	recordMap := map[string]any{"_id": id}
+	if !event.noValidTime {
+		recordMap["_valid_from"] = time.UnixMilli(event.Payload.TsMs).UTC().Format(validFromLayout)
 	}
 
-	// Copy all fields except 'id' (we use _id)
+	// Copy all fields except a single key (we use _id)
 	for k, v := range record {
-		if k != "id" {
+		if len(keys) != 1 || k != keys[0] || event.rekey != nil {
 			recordMap[k] = v
 		}
 	}
 
-	// Serialize to JSON
-	recordJSON, err := json.Marshal(recordMap)
+	return table, recordMap, nil
+}
+
+// validFromLayout writes valid times to the millisecond, as ts_ms has them,
+// leaving out a fraction of zero
+const validFromLayout = "2006-01-02T15:04:05.999Z07:00"
+
+// statement is the write a single event turns into
+type statement struct {
+	kind   string // insert, update or delete
+	table  string
+	sql    string
+	params [][]byte
+	oids   []uint32
+	id     any
+	fields int // for inserts and patches, the fields written besides _id and _valid_from
+
+	validFrom string // for inserts and patches, the _valid_from written; empty when XTDB picks it
+}
+
+// insertStatement writes the event's after image with INSERT ... RECORDS,
+// sending the record with an explicit OID (see recordParam)
+func insertStatement(event DebeziumEvent, kind string, keys []string) (statement, error) {
+	table, recordMap, err := eventToRecord(event, keys)
 	if err != nil {
-		return fmt.Errorf("marshaling record: %w", err)
+		return statement{kind: kind}, err
 	}
 
-	// Use ExecParams with explicit JSON OID (114) to send the record
-	sql := fmt.Sprintf("INSERT INTO %s RECORDS $1", table)
-	pgconn := conn.PgConn()
+	recordParam, oid, err := recordParam(recordMap)
+	if err != nil {
+		return statement{kind: kind}, err
+	}
+	fields := len(recordMap) - 1 // besides _id
+	validFrom, ok := recordMap["_valid_from"].(string)
+	if ok {
+		fields--
+	}
 
-	result := pgconn.ExecParams(ctx, sql,
-		[][]byte{recordJSON}, // parameter values
-		[]uint32{JSONOID},    // parameter OIDs - OID 114 for JSON
-		[]int16{0},           // parameter formats (0 = text)
-		[]int16{0})           // result formats (0 = text)
+	return statement{
+		kind:      kind,
+		table:     table,
+		sql:       fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+		params:    [][]byte{recordParam},
+		oids:      []uint32{oid},
+		id:        recordMap["_id"],
+		fields:    fields,
+		validFrom: validFrom,
+	}, nil
+}
 
-	_, err = result.Close()
+// recordParam encodes a record for RECORDS $1: as JSON (OID 114), or as
+// transit (OID 16384) when its _id is a UUID, which JSON would send as text
+func recordParam(record map[string]any) ([]byte, uint32, error) {
+	if _, ok := record["_id"].(uuid.UUID); ok {
+		data, err := transitRecord(record)
+		if err != nil {
+			return nil, 0, fmt.Errorf("encoding record: %w", err)
+		}
+		return data, TransitOID, nil
+	}
+	data, err := json.Marshal(record)
 	if err != nil {
-		return fmt.Errorf("executing insert for %s: %w", table, err)
+		return nil, 0, fmt.Errorf("marshaling record: %w", err)
 	}
+	return data, JSONOID, nil
+}
 
-	fmt.Printf("  [%s] INSERT id=%v (%d fields)\n", table, id, len(recordMap)-2)
-	return nil
+// patchStatement writes only the fields an update changed, with PATCH, so
+// fields the after image doesn't mention keep their current values. Without a
+// before image (Postgres sends one only with REPLICA IDENTITY FULL) every
+// field counts as changed. It reports false if nothing changed.
+func patchStatement(event DebeziumEvent, keys []string) (statement, bool, error) {
+	table, recordMap, err := eventToRecord(event, keys)
+	if err != nil {
+		return statement{kind: "update"}, false, err
+	}
+	validFrom, _ := recordMap["_valid_from"].(string)
+	delete(recordMap, "_valid_from")
+
+	// Key fields stay, so a composite or rekeyed record keeps its key
+	before := event.Payload.Before
+	changed := 0
+	for k, v := range event.Payload.After {
+		if k == "_id" || slices.Contains(keys, k) {
+			continue
+		}
+		if old, ok := before[k]; ok && reflect.DeepEqual(old, v) {
+			delete(recordMap, k)
+			continue
+		}
+		changed++
+	}
+	if before != nil && changed == 0 {
+		return statement{kind: "update"}, false, nil
+	}
+
+	recordParam, oid, err := recordParam(recordMap)
+	if err != nil {
+		return statement{kind: "update"}, false, err
+	}
+
+	sql := fmt.Sprintf("PATCH INTO %s RECORDS $1", table)
+	if validFrom != "" {
+		sql = fmt.Sprintf("PATCH INTO %s FOR VALID_TIME FROM TIMESTAMP '%s' RECORDS $1", table, validFrom)
+	}
+	return statement{
+		kind:      "update",
+		table:     table,
+		sql:       sql,
+		params:    [][]byte{recordParam},
+		oids:      []uint32{oid},
+		id:        recordMap["_id"],
+		fields:    len(recordMap) - 1,
+		validFrom: validFrom,
+	}, true, nil
 }
 
-func deleteRecord(ctx context.Context, conn *pgx.Conn, event DebeziumEvent) error {
+// deleteStatement ends the validity of the event's before image, keyed by
+// keys as the insert was
+func deleteStatement(event DebeziumEvent, keys []string) (statement, error) {
 	table := event.Payload.Source.Table
+	if err := checkTableName(table); err != nil {
+		return statement{kind: "delete"}, err
+	}
 	record := event.Payload.Before
 	if record == nil {
-		return fmt.Errorf("delete event has nil 'before' field")
+		return statement{kind: "delete"}, fmt.Errorf("delete event has nil 'before' field")
+	}
+
+	id, err := event.xtdbID(record, keys)
+	if err != nil {
+		return statement{kind: "delete"}, err
 	}
 
-	id, ok := record["id"]
-	if !ok {
-		return fmt.Errorf("record missing 'id' field")
+	param, oid, err := idParam(id)
+	if err != nil {
+		return statement{kind: "delete"}, err
 	}
 
-	// Convert ts_ms to timestamp for _valid_from
-	validFrom := time.UnixMilli(event.Payload.TsMs).UTC()
+	// The id is bound as $1 so quotes in it can't break out of the statement.
+	// Without a valid time XTDB ends it at the transaction's.
+	sql := fmt.Sprintf("DELETE FROM %s WHERE _id = $1", table)
+	if !event.noValidTime {
+		validFrom := time.UnixMilli(event.Payload.TsMs).UTC()
+		sql = fmt.Sprintf("DELETE FROM %s FOR PORTION OF VALID_TIME FROM TIMESTAMP '%s' TO NULL WHERE _id = $1",
+			table, validFrom.Format(validFromLayout))
+	}
 
-	// XTDB delete with valid time - use simple DELETE with the timestamp embedded
-	sql := fmt.Sprintf("DELETE FROM %s FOR PORTION OF VALID_TIME FROM TIMESTAMP '%s' TO NULL WHERE _id = %v",
-		table, validFrom.Format(time.RFC3339), formatID(id))
+	return statement{
+		kind:   "delete",
+		table:  table,
+		sql:    sql,
+		params: [][]byte{param},
+		oids:   []uint32{oid},
+		id:     id,
+	}, nil
+}
 
-	pgconn := conn.PgConn()
-	result := pgconn.ExecParams(ctx, sql,
-		nil, nil, nil, nil)
+// exec runs the statement with ExecParams, returning the server's command tag
+func (s statement) exec(ctx context.Context, conn *pgx.Conn) (pgconn.CommandTag, error) {
+	result := conn.PgConn().ExecParams(ctx, s.sql,
+		s.params,    // parameter values
+		s.oids,      // parameter OIDs - JSON for records, text or bigint for ids
+		s.formats(), // parameter formats (0 = text)
+		nil)         // result formats (text)
 
-	_, err := result.Close()
+	tag, err := result.Close()
 	if err != nil {
-		return fmt.Errorf("executing delete for %s: %w", table, err)
+		verb := strings.ToLower(strings.Fields(s.sql)[0])
+		return tag, fmt.Errorf("executing %s for %s: %w", verb, s.table, err)
 	}
+	return tag, nil
+}
 
-	fmt.Printf("  [%s] DELETE id=%v\n", table, id)
-	return nil
+// formats sends every parameter as text
+func (s statement) formats() []int16 {
+	return make([]int16, len(s.params))
+}
+
+// String is the progress line printed once the statement is written
+func (s statement) String() string {
+	verb := strings.Fields(s.sql)[0]
+	if s.kind == "delete" {
+		return fmt.Sprintf("  [%s] %s id=%v", s.table, verb, s.id)
+	}
+	return fmt.Sprintf("  [%s] %s id=%v (%d fields)", s.table, verb, s.id, s.fields)
 }
 
-func formatID(id any) string {
+// insertRecord writes the event's after image keyed by keys (see recordID)
+// and its rekey strategy, returning the server's command tag
+func insertRecord(ctx context.Context, conn *pgx.Conn, event DebeziumEvent, keys []string) (pgconn.CommandTag, error) {
+	stmt, err := insertStatement(event, "insert", keys)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := stmt.exec(ctx, conn)
+	if err != nil {
+		return tag, err
+	}
+	fmt.Fprintln(stdout, stmt)
+	return tag, nil
+}
+
+// deleteRecord ends the validity of the event's before image, keyed by keys
+// as insertRecord keyed it, returning the server's command tag
+func deleteRecord(ctx context.Context, conn *pgx.Conn, event DebeziumEvent, keys []string) (pgconn.CommandTag, error) {
+	stmt, err := deleteStatement(event, keys)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := stmt.exec(ctx, conn)
+	if err != nil {
+		return tag, err
+	}
+	fmt.Fprintln(stdout, stmt)
+	return tag, nil
+}
+
+// idParam encodes a record id as a text-format parameter: strings (UUIDs
+// included, which the JSON converter emits as strings) as text, whole
+// numbers as bigint and a --rekey UUID as uuid, matching the _id the insert
+// wrote
+func idParam(id any) ([]byte, uint32, error) {
 	switch v := id.(type) {
 	case string:
-		return fmt.Sprintf("'%s'", v)
+		return []byte(v), TextOID, nil
 	case float64:
-		return fmt.Sprintf("%d", int64(v))
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return nil, 0, fmt.Errorf("record id %v is not a whole number", v)
+		}
+		// -MinInt64 is 2^63, exactly representable, so this catches every
+		// whole float64 that int64(v) would overflow on
+		if v < math.MinInt64 || v >= -math.MinInt64 {
+			return nil, 0, fmt.Errorf("record id %v is out of range for bigint", v)
+		}
+		return strconv.AppendInt(nil, int64(v), 10), Int8OID, nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil, 0, fmt.Errorf("record id %s is not a whole number", v)
+		}
+		return strconv.AppendInt(nil, n, 10), Int8OID, nil
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), Int8OID, nil
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10), Int8OID, nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), Int8OID, nil
+	case uuid.UUID:
+		return []byte(v.String()), UUIDOID, nil
 	default:
-		return fmt.Sprintf("%v", v)
+		return nil, 0, fmt.Errorf("unsupported record id type %T", id)
 	}
 }
 
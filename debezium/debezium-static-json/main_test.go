@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var tableCounter int
+
+func getConn(t *testing.T) *pgx.Conn {
+	conn, err := pgx.Connect(context.Background(), connString())
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	return conn
+}
+
+func getCleanTable() string {
+	tableCounter++
+	return fmt.Sprintf("cdc_test_%d_%d", time.Now().Unix(), tableCounter)
+}
+
+// newEvent builds a Debezium event for tests
+func newEvent(op, table string, tsMs int64, before, after map[string]any) DebeziumEvent {
+	var event DebeziumEvent
+	event.Payload.Op = op
+	event.Payload.TsMs = tsMs
+	event.Payload.Source.DB = "test"
+	event.Payload.Source.Table = table
+	event.Payload.Before = before
+	event.Payload.After = after
+	return event
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig([]string{"--outbox-table", "outbox", "cdc/outbox-events.json"})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if cfg.EventsFile != "cdc/outbox-events.json" || cfg.OutboxTable != "outbox" {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	cfg, err = parseConfig(nil)
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if cfg.EventsFile != "cdc/events.json" {
+		t.Errorf("Expected default events file, got %q", cfg.EventsFile)
+	}
+}
+
+func TestLoadEventsFixture(t *testing.T) {
+	events, err := loadEvents("cdc/events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+	if len(events) != 22 {
+		t.Errorf("Expected 22 events, got %d", len(events))
+	}
+}
+
+func TestRecordToEventRoundTrip(t *testing.T) {
+	events, err := loadEvents("cdc/events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+	for i, event := range events {
+		if event.Payload.Op == "d" {
+			continue
+		}
+		table, record, err := EventToRecord(event)
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		back := RecordToEvent(table, record)
+		if back.Payload.Op != "c" || back.Payload.Source.Table != event.Payload.Source.Table ||
+			back.Payload.TsMs != event.Payload.TsMs || !reflect.DeepEqual(back.Payload.After, event.Payload.After) {
+			t.Errorf("event %d: round trip gave %+v, want %+v", i, back.Payload, event.Payload)
+		}
+	}
+
+	// As queried back, with _valid_from a time and temporal columns added
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	back := RecordToEvent("users", map[string]interface{}{
+		"_id": int64(7), "_valid_from": at, "_valid_to": nil, "name": "Grace",
+	})
+	if back.Payload.TsMs != at.UnixMilli() || !reflect.DeepEqual(back.Payload.After, map[string]any{"id": int64(7), "name": "Grace"}) {
+		t.Errorf("Unexpected event from a queried record: %+v", back.Payload)
+	}
+}
+
+func TestPatchStatement(t *testing.T) {
+	before := map[string]any{"id": 1, "name": "Alice", "email": "a@old.example", "tier": "pro"}
+	after := map[string]any{"id": 1, "name": "Alice", "email": "a@new.example", "tier": "pro"}
+
+	stmt, changed, err := patchStatement(newEvent("u", "users", 1704067200000, before, after), defaultKeyFields)
+	if err != nil || !changed {
+		t.Fatalf("patchStatement = %v, %v", changed, err)
+	}
+	if stmt.sql != "PATCH INTO users FOR VALID_TIME FROM TIMESTAMP '2024-01-01T00:00:00Z' RECORDS $1" {
+		t.Errorf("Unexpected SQL: %s", stmt.sql)
+	}
+	if string(stmt.params[0]) != `{"_id":1,"email":"a@new.example"}` || stmt.fields != 1 {
+		t.Errorf("Expected only the changed email patched, got %s (%d fields)", stmt.params[0], stmt.fields)
+	}
+	if stmt.String() != "  [users] PATCH id=1 (1 fields)" {
+		t.Errorf("Unexpected progress line %q", stmt.String())
+	}
+
+	if _, changed, err := patchStatement(newEvent("u", "users", 1704067200000, before, before), defaultKeyFields); err != nil || changed {
+		t.Errorf("Expected an update that changes nothing to be skipped, got %v, %v", changed, err)
+	}
+
+	// Without a before image every field is patched
+	stmt, changed, err = patchStatement(newEvent("u", "users", 1704067200000, nil, after), defaultKeyFields)
+	if err != nil || !changed || stmt.fields != 3 {
+		t.Errorf("Expected all 3 fields patched without a before image, got %d, %v, %v", stmt.fields, changed, err)
+	}
+
+	// Keyed on another field, an unchanged id column is left out like any other
+	before = map[string]any{"code": "A1", "id": 7, "name": "Alice"}
+	after = map[string]any{"code": "A1", "id": 7, "name": "Alicia"}
+	stmt, changed, err = patchStatement(newEvent("u", "users", 1704067200000, before, after), []string{"code"})
+	if err != nil || !changed || string(stmt.params[0]) != `{"_id":"A1","name":"Alicia"}` {
+		t.Errorf("Expected only the changed name patched, got %s, %v, %v", stmt.params, changed, err)
+	}
+
+	// A composite key's fields are kept, and don't count as changes
+	keys := []string{"order_id", "line"}
+	before = map[string]any{"order_id": 1, "line": 2, "qty": 3}
+	if _, changed, err := patchStatement(newEvent("u", "lines", 1704067200000, before, before), keys); err != nil || changed {
+		t.Errorf("Expected an unchanged composite-keyed row to be skipped, got %v, %v", changed, err)
+	}
+	after = map[string]any{"order_id": 1, "line": 2, "qty": 4}
+	stmt, changed, err = patchStatement(newEvent("u", "lines", 1704067200000, before, after), keys)
+	if err != nil || !changed || stmt.fields != 3 {
+		t.Errorf("Expected the key fields and qty patched, got %s, %v, %v", stmt.params, changed, err)
+	}
+}
+
+func TestPatchUpdateMode(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	l := newLoader(Config{UpdateMode: "patch"}, conn)
+	src := &mockSource{events: []DebeziumEvent{
+		newEvent("c", table, 1704067200000, nil, map[string]any{"id": 1, "name": "Alice", "email": "a@old.example"}),
+		// The update only mentions the fields the connector captured
+		newEvent("u", table, 1704067260000, map[string]any{"id": 1, "email": "a@old.example"}, map[string]any{"id": 1, "email": "a@new.example"}),
+	}}
+	if err := runSource(ctx, src, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	var name, email string
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT name, email FROM %s WHERE _id = 1", table)).Scan(&name, &email); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if name != "Alice" || email != "a@new.example" {
+		t.Errorf("Expected (Alice, a@new.example), got (%s, %s)", name, email)
+	}
+}
+
+func TestDeleteStatement(t *testing.T) {
+	cases := []struct {
+		id    any
+		param string
+		oid   uint32
+	}{
+		{"O'Brien", "O'Brien", TextOID},
+		{"'; DROP TABLE users; --", "'; DROP TABLE users; --", TextOID},
+		{"6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6", "6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6", TextOID},
+		{float64(42), "42", Int8OID}, // JSON numbers
+		{int32(7), "7", Int8OID},     // Avro ints
+		{json.Number("9007199254740993"), "9007199254740993", Int8OID},
+	}
+	for _, c := range cases {
+		stmt, err := deleteStatement(newEvent("d", "users", 1704067200000, map[string]any{"id": c.id}, nil), defaultKeyFields)
+		if err != nil {
+			t.Errorf("deleteStatement(%v) failed: %v", c.id, err)
+			continue
+		}
+		if stmt.sql != "DELETE FROM users FOR PORTION OF VALID_TIME FROM TIMESTAMP '2024-01-01T00:00:00Z' TO NULL WHERE _id = $1" {
+			t.Errorf("Unexpected SQL for %v: %s", c.id, stmt.sql)
+		}
+		if len(stmt.params) != 1 || string(stmt.params[0]) != c.param || stmt.oids[0] != c.oid {
+			t.Errorf("id %v: got params %q oids %v, want %q (OID %d)", c.id, stmt.params, stmt.oids, c.param, c.oid)
+		}
+	}
+
+	if _, err := deleteStatement(newEvent("d", "users", 1704067200000, map[string]any{"id": 1.5}, nil), defaultKeyFields); err == nil {
+		t.Error("Expected a fractional id to be rejected")
+	}
+	for _, id := range []float64{1e19, math.Pow(2, 63), -1e19, math.NaN()} {
+		if _, err := deleteStatement(newEvent("d", "users", 1704067200000, map[string]any{"id": id}, nil), defaultKeyFields); err == nil {
+			t.Errorf("Expected id %v, which doesn't fit a bigint, to be rejected", id)
+		}
+	}
+	stmt, err := deleteStatement(newEvent("d", "users", 1704067200000, map[string]any{"id": -math.Pow(2, 63)}, nil), defaultKeyFields)
+	if err != nil || string(stmt.params[0]) != "-9223372036854775808" {
+		t.Errorf("Expected the smallest bigint id accepted, got %q, %v", stmt.params, err)
+	}
+	for _, table := range []string{"users; DROP TABLE users", "users WHERE true --", ""} {
+		if _, err := deleteStatement(newEvent("d", table, 1704067200000, map[string]any{"id": 1}, nil), defaultKeyFields); err == nil {
+			t.Errorf("Expected table %q to be rejected", table)
+		}
+	}
+}
+
+func TestDeleteRecordQuotedID(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	ts := int64(1704067200000)
+	for _, id := range []string{"o'brien", "o", "brien"} {
+		if _, err := insertRecord(ctx, conn, newEvent("c", table, ts, nil, map[string]any{"id": id}), defaultKeyFields); err != nil {
+			t.Fatalf("insertRecord(%q) failed: %v", id, err)
+		}
+	}
+
+	tag, err := deleteRecord(ctx, conn, newEvent("d", table, ts+1000, map[string]any{"id": "o'brien"}, nil), defaultKeyFields)
+	if err != nil {
+		t.Fatalf("deleteRecord failed: %v", err)
+	}
+	if tag.RowsAffected() != 1 {
+		t.Errorf("Expected exactly o'brien deleted, got %s", tag)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	left, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil || fmt.Sprint(left) != "[brien o]" {
+		t.Errorf("Expected brien and o left, got %v, %v", left, err)
+	}
+}
+
+func TestDeleteTargetsID(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	ids := []any{"O'Brien", "O'Brien2", float64(42), float64(43),
+		"6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6", "0b6f8a4e-2d1c-4e3f-9a8b-7c6d5e4f3a2b"}
+	var events []DebeziumEvent
+	for _, id := range ids {
+		events = append(events, newEvent("c", table, 1704067200000, nil, map[string]any{"id": id, "name": fmt.Sprint(id)}))
+	}
+	// Delete the first of each pair
+	for _, id := range []any{ids[0], ids[2], ids[4]} {
+		events = append(events, newEvent("d", table, 1704067260000, map[string]any{"id": id}, nil))
+	}
+
+	l := newLoader(Config{}, conn)
+	if err := runSource(ctx, &mockSource{events: events}, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT name FROM %s ORDER BY name", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatalf("Reading rows failed: %v", err)
+	}
+	want := []string{"0b6f8a4e-2d1c-4e3f-9a8b-7c6d5e4f3a2b", "43", "O'Brien2"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v left, got %v", want, names)
+	}
+}
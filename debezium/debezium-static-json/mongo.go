@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// mongoKeyFields is the key of MongoDB documents, which carry their own _id
+var mongoKeyFields = []string{"_id"}
+
+// mongoImages are the documents Debezium's MongoDB connector sends as
+// strings of extended JSON rather than objects: the before and after images
+// and, from older connectors, a delete's filter
+type mongoImages struct {
+	before, after, filter map[string]any
+}
+
+// splitMongoImages takes the string images out of a message, with or
+// without a schema envelope, returning the message with them set to null
+// and the documents they hold. It returns false if the message has none.
+func splitMongoImages(value []byte) ([]byte, *mongoImages, bool, error) {
+	var outer map[string]json.RawMessage
+	if err := json.Unmarshal(value, &outer); err != nil {
+		return nil, nil, false, nil
+	}
+	payload := outer
+	if raw, ok := outer["payload"]; ok {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, nil, false, nil
+		}
+	}
+
+	images := &mongoImages{}
+	found := false
+	for field, doc := range map[string]*map[string]any{"before": &images.before, "after": &images.after, "filter": &images.filter} {
+		raw := bytes.TrimSpace(payload[field])
+		if len(raw) == 0 || raw[0] != '"' {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, nil, false, fmt.Errorf("%s: %w", field, err)
+		}
+		parsed, err := parseMongoDocument(s)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%s: %w", field, err)
+		}
+		*doc = parsed
+		payload[field] = json.RawMessage("null")
+		found = true
+	}
+	if !found {
+		return nil, nil, false, nil
+	}
+
+	var err error
+	if _, ok := outer["payload"]; ok {
+		if outer["payload"], err = json.Marshal(payload); err != nil {
+			return nil, nil, false, err
+		}
+	} else {
+		outer = payload
+	}
+	stripped, err := json.Marshal(outer)
+	return stripped, images, true, err
+}
+
+// apply puts the documents into the event decoded without them, which is
+// loaded into a table named after its collection. A delete with only a
+// filter (connectors before 2.x, without pre-images) deletes the document
+// the filter names.
+func (m *mongoImages) apply(event DebeziumEvent) DebeziumEvent {
+	event.Payload.Before, event.Payload.After = m.before, m.after
+	if event.Payload.Before == nil && event.Payload.Op == "d" {
+		event.Payload.Before = m.filter
+	}
+	if event.Payload.Source.Table == "" {
+		event.Payload.Source.Table = event.Payload.Source.Collection
+	}
+	event.mongo = true
+	return event
+}
+
+// parseMongoDocument parses a document of MongoDB extended JSON, in its
+// canonical or relaxed form, into plain values
+func parseMongoDocument(s string) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing extended JSON: %w", err)
+	}
+	converted, err := convertExtendedJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	return converted.(map[string]any), nil
+}
+
+// convertExtendedJSON replaces the wrapped forms of extended JSON with the
+// values they stand for: $oid with its hex string, $numberLong, $numberInt,
+// $numberDouble and $numberDecimal with exact numbers and $date with an
+// ISO-8601 UTC string. Other wrappers, such as $binary, are left as they are.
+func convertExtendedJSON(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 1 {
+			for k, inner := range v {
+				if converted, ok, err := convertExtendedValue(k, inner); ok || err != nil {
+					return converted, err
+				}
+			}
+		}
+		out := make(map[string]any, len(v))
+		for k, inner := range v {
+			c, err := convertExtendedJSON(inner)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = c
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, inner := range v {
+			c, err := convertExtendedJSON(inner)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// convertExtendedValue converts the value of a single-key wrapper object, or
+// returns false if key isn't one it knows
+func convertExtendedValue(key string, v any) (any, bool, error) {
+	switch key {
+	case "$oid":
+		s, ok := v.(string)
+		return s, ok, nil
+	case "$numberLong", "$numberInt", "$numberDouble", "$numberDecimal":
+		s, ok := v.(string)
+		if !ok {
+			return nil, false, nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			// NaN and Infinity have no JSON number
+			return s, true, nil
+		}
+		return json.Number(s), true, nil
+	case "$date":
+		switch d := v.(type) {
+		case string: // relaxed: ISO-8601
+			t, err := time.Parse(time.RFC3339Nano, d)
+			if err != nil {
+				return nil, true, fmt.Errorf("$date: %w", err)
+			}
+			return t.UTC().Format(time.RFC3339Nano), true, nil
+		case json.Number: // relaxed, before 1970 or after 9999: epoch millis
+			ms, err := d.Int64()
+			if err != nil {
+				return nil, true, fmt.Errorf("$date: %w", err)
+			}
+			return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), true, nil
+		case map[string]any: // canonical: {"$numberLong": "<millis>"}
+			s, ok := d["$numberLong"].(string)
+			ms, err := strconv.ParseInt(s, 10, 64)
+			if !ok || err != nil {
+				return nil, true, fmt.Errorf("$date: expected {\"$numberLong\": millis}, got %v", d)
+			}
+			return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), true, nil
+		}
+	}
+	return nil, false, nil
+}
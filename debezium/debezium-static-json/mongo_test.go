@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMongoEvents(t *testing.T) {
+	events, err := loadEvents("cdc/mongodb-events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	l := newLoader(Config{}, nil)
+	var stmts []statement
+	for i, event := range events {
+		stmt, ok, err := l.prepare(event)
+		if err != nil || !ok {
+			t.Fatalf("Event %d: prepare failed: %v", i, err)
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	// Keyed by the ObjectId's hex string, in a table named after the collection
+	for i, stmt := range stmts {
+		if stmt.table != "customers" || stmt.id != "65a1b2c3d4e5f60718293a4b" {
+			t.Errorf("Event %d: expected customers/65a1b2c3d4e5f60718293a4b, got %s/%v", i, stmt.table, stmt.id)
+		}
+	}
+	if stmts[2].kind != "delete" {
+		t.Errorf("Expected the filter to delete the document, got %s", stmts[2].kind)
+	}
+
+	record := string(stmts[1].params[0])
+	for _, want := range []string{
+		`"_id":"65a1b2c3d4e5f60718293a4b"`,
+		`"visits":9007199254740994`, // exact, past float64's whole numbers
+		`"joined":"2024-01-01T00:00:00.123Z"`,
+		`"last_seen":"2024-01-02T00:00:00Z"`,
+		`"balance":12.30`,
+		`"tags":["new"]`,
+	} {
+		if !strings.Contains(record, want) {
+			t.Errorf("Expected %s in %s", want, record)
+		}
+	}
+
+	// With a schema envelope, and --key-field still wins
+	event, err := decodeEvent([]byte(`{"schema": {"type": "struct"}, "payload": {"op": "c", "ts_ms": 1704067200000,
+		"source": {"collection": "orders"}, "after": "{\"_id\": {\"$numberLong\": \"7\"}, \"order_no\": \"A-1\", \"lines\": [{\"qty\": {\"$numberInt\": \"2\"}}]}"}}`))
+	if err != nil {
+		t.Fatalf("decodeEvent failed: %v", err)
+	}
+	keys := keyFields{}
+	keys.Set("orders=order_no")
+	if got := keys.forEvent(event); len(got) != 1 || got[0] != "order_no" {
+		t.Errorf("Expected --key-field to override _id, got %v", got)
+	}
+	stmt, err := insertStatement(event, "insert", keyFields{}.forEvent(event))
+	if err != nil {
+		t.Fatalf("insertStatement failed: %v", err)
+	}
+	if fmt.Sprint(stmt.id) != "7" || stmt.table != "orders" {
+		t.Errorf("Expected orders/7, got %s/%v", stmt.table, stmt.id)
+	}
+	if !strings.Contains(string(stmt.params[0]), `"lines":[{"qty":2}]`) {
+		t.Errorf("Expected nested extended JSON converted, got %s", stmt.params[0])
+	}
+
+	if _, err := decodeEvent([]byte(`{"payload": {"op": "c", "after": "{not json"}}`)); err == nil {
+		t.Error("Expected a malformed document to be rejected")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	camelBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	nonIdentChars = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+// outboxEvent rewrites a transactional-outbox row into an event for the
+// aggregate it describes: the target table comes from aggregate_type, the
+// document from the JSON payload and its id from aggregate_id. The outbox
+// row's own surrogate key is dropped.
+//
+// Outbox rows are usually deleted straight after being written, so deletes
+// (and anything else without an 'after' image) are skipped with ok=false.
+func outboxEvent(event DebeziumEvent) (DebeziumEvent, bool, error) {
+	row := event.Payload.After
+	if event.Payload.Op == "d" || row == nil {
+		return DebeziumEvent{}, false, nil
+	}
+
+	aggregateType, ok := row["aggregate_type"].(string)
+	if !ok || aggregateType == "" {
+		return DebeziumEvent{}, false, fmt.Errorf("outbox row missing 'aggregate_type'")
+	}
+	aggregateID, ok := row["aggregate_id"]
+	if !ok || aggregateID == nil {
+		return DebeziumEvent{}, false, fmt.Errorf("outbox row missing 'aggregate_id'")
+	}
+
+	var doc map[string]any
+	switch payload := row["payload"].(type) {
+	case string:
+		if err := json.Unmarshal([]byte(payload), &doc); err != nil {
+			return DebeziumEvent{}, false, fmt.Errorf("parsing outbox payload: %w", err)
+		}
+	case map[string]any:
+		doc = payload
+	default:
+		return DebeziumEvent{}, false, fmt.Errorf("outbox payload must be a JSON string or object, got %T", payload)
+	}
+	if doc == nil {
+		return DebeziumEvent{}, false, fmt.Errorf("outbox payload is null")
+	}
+
+	table, err := outboxTableName(aggregateType)
+	if err != nil {
+		return DebeziumEvent{}, false, err
+	}
+	doc["id"] = aggregateID
+
+	routed := event
+	routed.Payload.Op = "c"
+	routed.Payload.Source.Table = table
+	routed.Payload.Before = nil
+	routed.Payload.After = doc
+	return routed, true, nil
+}
+
+// outboxTableName turns an aggregate type like "PurchaseOrder" or
+// "order-line" into a table name ("purchase_order", "order_line"), and
+// rejects one that still isn't a plain identifier, such as "2024" or "--"
+func outboxTableName(aggregateType string) (string, error) {
+	name := camelBoundary.ReplaceAllString(aggregateType, "${1}_${2}")
+	name = nonIdentChars.ReplaceAllString(strings.ToLower(name), "_")
+	name = strings.Trim(name, "_")
+	if err := checkTableName(name); err != nil {
+		return "", fmt.Errorf("outbox aggregate_type %q: %w", aggregateType, err)
+	}
+	return name, nil
+}
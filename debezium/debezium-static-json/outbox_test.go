@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOutboxEventRouting(t *testing.T) {
+	events, err := loadEvents("cdc/outbox-events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+
+	var routed []DebeziumEvent
+	for i, event := range events {
+		r, ok, err := outboxEvent(event)
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if ok {
+			routed = append(routed, r)
+		}
+	}
+
+	if len(routed) != 3 {
+		t.Fatalf("Expected 3 routed events (delete skipped), got %d", len(routed))
+	}
+
+	table, record, err := EventToRecord(routed[0])
+	if err != nil {
+		t.Fatalf("EventToRecord failed: %v", err)
+	}
+	if table != "purchase_order" {
+		t.Errorf("Expected table purchase_order, got %q", table)
+	}
+	if record["_id"] != "order-1001" {
+		t.Errorf("Expected _id=order-1001, got %v", record["_id"])
+	}
+	if _, ok := record["aggregate_type"]; ok {
+		t.Error("Outbox columns should not leak into the document")
+	}
+	shipping, ok := record["shipping"].(map[string]any)
+	if !ok || shipping["city"] != "London" {
+		t.Errorf("Expected nested shipping.city=London, got %v", record["shipping"])
+	}
+
+	if table, _, _ := EventToRecord(routed[1]); table != "customer" {
+		t.Errorf("Expected table customer, got %q", table)
+	}
+
+	bad := newEvent("c", "outbox", 0, nil, map[string]any{
+		"aggregate_type": "Order", "aggregate_id": "x", "payload": "{not json",
+	})
+	if _, _, err := outboxEvent(bad); err == nil {
+		t.Error("Expected error for malformed payload")
+	}
+}
+
+func TestOutboxTableName(t *testing.T) {
+	cases := map[string]string{
+		"PurchaseOrder": "purchase_order",
+		"order-line":    "order_line",
+		"customer":      "customer",
+		"Invoice v2":    "invoice_v2",
+	}
+	for in, want := range cases {
+		if got, err := outboxTableName(in); err != nil || got != want {
+			t.Errorf("outboxTableName(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"--", "2024", strings.Repeat("a", 64)} {
+		if got, err := outboxTableName(in); err == nil {
+			t.Errorf("Expected outboxTableName(%q) rejected, got %q", in, got)
+		}
+	}
+}
+
+func TestOutboxIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	orders := getCleanTable()
+	customers := getCleanTable()
+
+	events := []DebeziumEvent{
+		newEvent("c", "outbox", 1704067200000, nil, map[string]any{
+			"id": "evt-1", "aggregate_type": orders, "aggregate_id": "order-1",
+			"payload": `{"customer": "alice", "lines": [{"sku": "widget", "qty": 2}], "shipping": {"city": "London"}}`,
+		}),
+		newEvent("d", "outbox", 1704067201000, map[string]any{"id": "evt-1"}, nil),
+		newEvent("c", "outbox", 1704067260000, nil, map[string]any{
+			"id": "evt-2", "aggregate_type": customers, "aggregate_id": "alice",
+			"payload": `{"name": "Alice", "address": {"postcode": "N1"}}`,
+		}),
+	}
+
+	for i, event := range events {
+		routed, ok, err := outboxEvent(event)
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if !ok {
+			continue
+		}
+		if _, err := insertRecord(ctx, conn, routed, defaultKeyFields); err != nil {
+			t.Fatalf("event %d: insert: %v", i, err)
+		}
+	}
+
+	var city string
+	var qty int64
+	err := conn.QueryRow(ctx, fmt.Sprintf(
+		"SELECT (shipping).city, (lines[1]).qty FROM %s WHERE _id = 'order-1'", orders)).Scan(&city, &qty)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if city != "London" || qty != 2 {
+		t.Errorf("Expected (London, 2), got (%s, %d)", city, qty)
+	}
+
+	var postcode string
+	err = conn.QueryRow(ctx, fmt.Sprintf(
+		"SELECT (address).postcode FROM %s WHERE _id = 'alice'", customers)).Scan(&postcode)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if postcode != "N1" {
+		t.Errorf("Expected postcode N1, got %s", postcode)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// rekeyer translates a source row's id (see recordID) into the _id written
+// to XTDB, set with --rekey. Inserts, updates and deletes all go through it,
+// so a delete ends the document its insert wrote.
+type rekeyer interface {
+	rekey(id any) (any, error)
+}
+
+// newRekeyer builds the --rekey strategy: uuid-v5-from-id, namespaced by
+// namespace, or lookup, reading file
+func newRekeyer(strategy, namespace, file string) (rekeyer, error) {
+	switch strategy {
+	case "uuid-v5-from-id":
+		if namespace == "" {
+			return nil, fmt.Errorf("--rekey=uuid-v5-from-id requires --rekey-namespace")
+		}
+		ns, err := parseUUID(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("--rekey-namespace: %w", err)
+		}
+		return uuidV5Rekey{ns}, nil
+	case "lookup":
+		if file == "" {
+			return nil, fmt.Errorf("--rekey=lookup requires --rekey-file")
+		}
+		return loadRekeyFile(file)
+	default:
+		return nil, fmt.Errorf("--rekey must be uuid-v5-from-id or lookup, got %q", strategy)
+	}
+}
+
+// uuidV5Rekey replaces each id with the name-based (version 5) UUID of its
+// text in a namespace, so the same id always gets the same UUID: 42 and
+// "42" alike become uuidv5(namespace, "42"). The _id is a uuid.UUID, which
+// the record is sent as transit to keep (see transitRecord), so XTDB
+// stores a UUID rather than its text.
+type uuidV5Rekey struct {
+	namespace uuid.UUID
+}
+
+func (r uuidV5Rekey) rekey(id any) (any, error) {
+	text, _, err := idParam(id)
+	if err != nil {
+		return nil, err
+	}
+	return uuid.NewSHA1(r.namespace, text), nil
+}
+
+// parseUUID reads a UUID in its canonical 36-character form only
+func parseUUID(s string) (uuid.UUID, error) {
+	u, err := uuid.Parse(s)
+	if err != nil || len(s) != 36 {
+		return uuid.UUID{}, fmt.Errorf("%q is not a UUID", s)
+	}
+	return u, nil
+}
+
+// lookupRekey maps source ids to the _ids given in a CSV file of
+// source_id,xtdb_id rows; the _ids are written as text. A first row of
+// exactly "source_id,xtdb_id" is a header and skipped; there's no other
+// header handling, so any other first row is a mapping. An id the file
+// doesn't list fails the event.
+type lookupRekey struct {
+	path string
+	ids  map[string]string
+}
+
+func loadRekeyFile(path string) (*lookupRekey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening --rekey-file: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	lookup := &lookupRekey{path: path, ids: map[string]string{}}
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return lookup, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading --rekey-file: %w", err)
+		}
+		if line, _ := r.FieldPos(0); line == 1 && row[0] == "source_id" && row[1] == "xtdb_id" {
+			continue
+		}
+		if _, dup := lookup.ids[row[0]]; dup {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("reading --rekey-file: line %d: id %q is mapped twice", line, row[0])
+		}
+		lookup.ids[row[0]] = row[1]
+	}
+}
+
+func (r *lookupRekey) rekey(id any) (any, error) {
+	text, _, err := idParam(id)
+	if err != nil {
+		return nil, err
+	}
+	newID, ok := r.ids[string(text)]
+	if !ok {
+		return nil, fmt.Errorf("id %s is not in --rekey-file %s", text, r.path)
+	}
+	return newID, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// dnsNamespace is RFC 4122's namespace for domain names
+const dnsNamespace = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func TestUUIDv5(t *testing.T) {
+	ns, err := parseUUID(dnsNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The value Python's uuid.uuid5(uuid.NAMESPACE_DNS, "python.org") gives
+	got, err := uuidV5Rekey{ns}.rekey("python.org")
+	if err != nil || got != uuid.MustParse("886313e1-3b8a-5372-9b90-0c9aee199e5d") {
+		t.Errorf("Unexpected UUID %v (%T), %v", got, got, err)
+	}
+
+	for _, bad := range []string{"", "6ba7b810", "6ba7b810-9dad-11d1-80b4-00c04fd430cz", "6ba7b8109dad11d180b400c04fd430c8"} {
+		if _, err := parseUUID(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRekeyInsertAndDelete(t *testing.T) {
+	r, err := newRekeyer("uuid-v5-from-id", dnsNamespace, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLoader(Config{KeyFields: keyFields{}, Rekey: r}, nil)
+	ts := int64(1704067200000)
+
+	insert, _, err := l.prepare(newEvent("c", "users", ts, nil, map[string]any{"id": 42, "name": "a"}))
+	if err != nil {
+		t.Fatalf("prepare insert failed: %v", err)
+	}
+	// A float, as ids arrive from JSON
+	del, _, err := l.prepare(newEvent("d", "users", ts+1, map[string]any{"id": 42.0}, nil))
+	if err != nil {
+		t.Fatalf("prepare delete failed: %v", err)
+	}
+
+	ns, _ := parseUUID(dnsNamespace)
+	want := uuid.NewSHA1(ns, []byte("42"))
+	if insert.id != want || del.id != want || string(del.params[0]) != want.String() || del.oids[0] != UUIDOID {
+		t.Errorf("Expected both to use %s, got insert %v and delete %v (%s)", want, insert.id, del.id, del.params[0])
+	}
+	// Sent as transit, so the _id is stored as a UUID rather than text
+	if insert.oids[0] != TransitOID ||
+		!strings.Contains(string(insert.params[0]), `"~:_id","~u`+want.String()+`"`) ||
+		!strings.Contains(string(insert.params[0]), `"~:_valid_from","~t2024-01-01T00:00:00Z"`) ||
+		!strings.Contains(string(insert.params[0]), `"~:id",42`) {
+		t.Errorf("Expected a transit record keeping the source id as a field, got %s", insert.params[0])
+	}
+	if _, _, _, fields, ok := versionQuery(insert); !ok || fields != 3 {
+		t.Errorf("Expected --dedup to read the transit record's 3 fields, got %d, %v", fields, ok)
+	}
+
+	// Without --rekey the source id is the _id
+	l = newLoader(Config{KeyFields: keyFields{}}, nil)
+	if stmt, _, err := l.prepare(newEvent("c", "users", ts, nil, map[string]any{"id": 42})); err != nil || stmt.id != 42 {
+		t.Errorf("Expected _id 42, got %v, %v", stmt.id, err)
+	}
+}
+
+func TestRekeyLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.csv")
+	if err := os.WriteFile(path, []byte("1,a1b2\n2, c3d4\nacme|7,e5f6\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRekeyer("lookup", "", path)
+	if err != nil {
+		t.Fatalf("loading lookup failed: %v", err)
+	}
+	var got []string
+	for _, id := range []any{1.0, 2, "acme|7"} {
+		newID, err := r.rekey(id)
+		got = append(got, fmt.Sprintf("%v %v", newID, err))
+	}
+	if strings.Join(got, " ") != "a1b2 <nil> c3d4 <nil> e5f6 <nil>" {
+		t.Errorf("Unexpected ids: %v", got)
+	}
+	if _, err := r.rekey(3); err == nil || !strings.Contains(err.Error(), "id 3 is not in --rekey-file") {
+		t.Errorf("Expected an unmapped id to fail, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("1,a\n1,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newRekeyer("lookup", "", path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected a duplicate id to be rejected, got %v", err)
+	}
+
+	// A source_id,xtdb_id header is skipped
+	if err := os.WriteFile(path, []byte("source_id,xtdb_id\n1,a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err = newRekeyer("lookup", "", path)
+	if err != nil {
+		t.Fatalf("loading lookup with a header failed: %v", err)
+	}
+	if _, err := r.rekey("source_id"); err == nil {
+		t.Error("Expected the header not to be read as a mapping")
+	}
+	if id, err := r.rekey(1); err != nil || id != "a" {
+		t.Errorf("Expected 1 -> a, got %v, %v", id, err)
+	}
+}
+
+func TestParseConfigRekey(t *testing.T) {
+	cfg, err := parseConfig([]string{"--rekey", "uuid-v5-from-id", "--rekey-namespace", dnsNamespace})
+	if err != nil || cfg.Rekey == nil {
+		t.Errorf("Expected a rekeyer, got %v, %v", cfg.Rekey, err)
+	}
+	for _, args := range [][]string{
+		{"--rekey", "uuid-v5-from-id"},
+		{"--rekey", "uuid-v5-from-id", "--rekey-namespace", "users"},
+		{"--rekey", "lookup"},
+		{"--rekey", "hash"},
+		{"--rekey-namespace", dnsNamespace},
+	} {
+		if _, err := parseConfig(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestRekeyIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	r, err := newRekeyer("uuid-v5-from-id", dnsNamespace, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := getCleanTable()
+	ts := int64(1704067200000)
+	keys := defaultKeyFields
+
+	for id := 1; id <= 2; id++ {
+		event := newEvent("c", table, ts, nil, map[string]any{"id": id, "name": fmt.Sprint("user", id)})
+		event.rekey = r
+		if _, err := insertRecord(ctx, conn, event, keys); err != nil {
+			t.Fatalf("insertRecord failed: %v", err)
+		}
+	}
+	event := newEvent("d", table, ts+1000, map[string]any{"id": 1}, nil)
+	event.rekey = r
+	tag, err := deleteRecord(ctx, conn, event, keys)
+	if err != nil {
+		t.Fatalf("deleteRecord failed: %v", err)
+	}
+	if tag.RowsAffected() != 1 {
+		t.Errorf("Expected the delete to find user 1's UUID, got %s", tag)
+	}
+
+	// Scanned as a uuid, which an _id stored as text wouldn't scan into
+	var id [16]byte
+	var sourceID int64
+	var count int
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT _id, id, COUNT(*) OVER () FROM %s", table)).Scan(&id, &sourceID, &count)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	ns, _ := parseUUID(dnsNamespace)
+	if uuid.UUID(id) != uuid.NewSHA1(ns, []byte("2")) || sourceID != 2 || count != 1 {
+		t.Errorf("Expected only user 2 left under its UUID, got %s (id %d, %d rows)", uuid.UUID(id), sourceID, count)
+	}
+}
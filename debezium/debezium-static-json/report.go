@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// stdout is where progress and the text summary go: standard output, or
+// standard error while --report=json writes the report there, so the report
+// can be piped on as it is
+var stdout io.Writer = os.Stdout
+
+// eventError is a failure tied to one event, numbered as runSource numbers
+// them, so the run report can say which event stopped the load
+type eventError struct {
+	index int64
+	err   error
+}
+
+func (e *eventError) Error() string { return fmt.Sprintf("event %d: %v", e.index, e.err) }
+func (e *eventError) Unwrap() error { return e.err }
+
+// eventIssue is an event the run skipped or failed on
+type eventIssue struct {
+	Index *int64 `json:"index,omitempty"` // absent when a failure isn't down to one event
+	Table string `json:"table,omitempty"`
+	Error string `json:"error"`
+}
+
+// tableCounts is what the run wrote to one XTDB table
+type tableCounts struct {
+	Inserts int `json:"inserts"`
+	Updates int `json:"updates"`
+	Deletes int `json:"deletes"`
+}
+
+// runReport is the --report=json summary of a run, for CI to check
+type runReport struct {
+	Tables          map[string]*tableCounts `json:"tables"`
+	Events          int                     `json:"events"`
+	RowsAffected    int                     `json:"rows_affected"`
+	FirstEventTime  *time.Time              `json:"first_event_time,omitempty"`
+	LastEventTime   *time.Time              `json:"last_event_time,omitempty"`
+	ElapsedSeconds  float64                 `json:"elapsed_seconds"`
+	EventsPerSecond float64                 `json:"events_per_second"`
+	Transactions    int                     `json:"transactions,omitempty"`
+	// Unfinished counts source transactions written before their END
+	// marker arrived, after --flush-interval without another event
+	Unfinished int               `json:"transactions_unfinished,omitempty"`
+	Skipped    []eventIssue      `json:"skipped"`
+	Failed     *eventIssue       `json:"failed,omitempty"`
+	DeadLetter *deadLetterReport `json:"dead_letter,omitempty"`
+}
+
+// deadLetterReport is the events that went to the --dead-letter file
+type deadLetterReport struct {
+	Path   string       `json:"path"`
+	Events int          `json:"events"`
+	Failed []eventIssue `json:"failed"`
+}
+
+// skip records an event the loader chose not to write, for the run report
+func (l *loader) skip(table, reason string) {
+	index := l.current
+	l.skipped = append(l.skipped, eventIssue{Index: &index, Table: table, Error: reason})
+}
+
+// report summarizes the run so far; runErr is what stopped it, if anything
+func (l *loader) report(runErr error) runReport {
+	elapsed := time.Since(l.started)
+	r := runReport{
+		Tables:         l.tableCounts,
+		Events:         l.events,
+		RowsAffected:   l.stats["rows_affected"],
+		ElapsedSeconds: elapsed.Seconds(),
+		Transactions:   l.stats["transactions"],
+		Unfinished:     l.stats["transactions_unfinished"],
+		Skipped:        l.skipped,
+	}
+	if r.Skipped == nil {
+		r.Skipped = []eventIssue{}
+	}
+	if !l.firstEvent.IsZero() {
+		first, last := l.firstEvent, l.lastEvent
+		r.FirstEventTime, r.LastEventTime = &first, &last
+	}
+	if elapsed > 0 {
+		r.EventsPerSecond = float64(l.events) / elapsed.Seconds()
+	}
+	if l.dead != nil {
+		r.DeadLetter = &deadLetterReport{Path: l.dead.path, Events: l.dead.failures(), Failed: l.dead.failed()}
+	}
+	if runErr != nil {
+		r.Failed = &eventIssue{Error: runErr.Error()}
+		var ee *eventError
+		if errors.As(runErr, &ee) {
+			r.Failed.Index = &ee.index
+		}
+	}
+	return r
+}
+
+// writeReport writes the JSON run report to --report-file, or stdout
+func (l *loader) writeReport(runErr error) error {
+	var w io.Writer = os.Stdout
+	if l.cfg.ReportFile != "" {
+		f, err := os.Create(l.cfg.ReportFile)
+		if err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(l.report(runErr)); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
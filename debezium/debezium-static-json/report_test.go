@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	cfg, err := parseConfig([]string{"--batch-size", "50", "--report-file", path})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if cfg.Report != "json" {
+		t.Errorf("Expected --report-file to imply --report=json, got %q", cfg.Report)
+	}
+
+	src, err := newFileSource("cdc/events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	l := newLoader(cfg, nil)
+	recordBatches(l, -1)
+	if err := l.writeReport(runSource(context.Background(), src, l)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Report isn't valid JSON: %v\n%s", err, data)
+	}
+
+	// cdc/events.json: users 5c/3u/1d, profiles 4c/2u, sessions 5c/1u/1d
+	want := map[string]tableCounts{
+		"users":    {Inserts: 5, Updates: 3, Deletes: 1},
+		"profiles": {Inserts: 4, Updates: 2},
+		"sessions": {Inserts: 5, Updates: 1, Deletes: 1},
+	}
+	if len(report.Tables) != len(want) {
+		t.Errorf("Expected tables %v, got %v", want, report.Tables)
+	}
+	for table, counts := range want {
+		if got := report.Tables[table]; got == nil || *got != counts {
+			t.Errorf("%s: expected %+v, got %+v", table, counts, got)
+		}
+	}
+	if report.Events != 22 || report.Failed != nil || len(report.Skipped) != 0 {
+		t.Errorf("Expected 22 events, none skipped or failed, got %d, %v, %v", report.Events, report.Skipped, report.Failed)
+	}
+	if report.FirstEventTime == nil || !report.FirstEventTime.Equal(time.UnixMilli(1704067200000)) ||
+		report.LastEventTime == nil || !report.LastEventTime.Equal(time.UnixMilli(1704326520000)) {
+		t.Errorf("Unexpected event time range %v - %v", report.FirstEventTime, report.LastEventTime)
+	}
+}
+
+func TestRunReportSkippedAndFailed(t *testing.T) {
+	ts := int64(1704067200000)
+	src := &mockSource{events: []DebeziumEvent{
+		newEvent("c", "users", ts, nil, map[string]any{"id": 1, "name": "a"}),
+		newEvent("u", "users", ts+1, map[string]any{"id": 1, "name": "a"}, map[string]any{"id": 1, "name": "a"}),
+		newEvent("t", "users", ts+2, nil, nil),
+		newEvent("c", "users", ts+3, nil, map[string]any{"name": "no id"}),
+	}}
+	l := newLoader(Config{BatchSize: 10, UpdateMode: "patch"}, nil)
+	recordBatches(l, -1)
+
+	report := l.report(runSource(context.Background(), src, l))
+	if len(report.Skipped) != 2 || *report.Skipped[0].Index != 1 || *report.Skipped[1].Index != 2 ||
+		!strings.Contains(report.Skipped[1].Error, `unknown operation "t"`) {
+		t.Errorf("Expected events 1 and 2 skipped, got %+v", report.Skipped)
+	}
+	if report.Failed == nil || report.Failed.Index == nil || *report.Failed.Index != 3 ||
+		!strings.Contains(report.Failed.Error, "missing 'id'") {
+		t.Errorf("Expected event 3 reported as failed, got %+v", report.Failed)
+	}
+	if report.Tables["users"] == nil || report.Tables["users"].Inserts != 1 {
+		t.Errorf("Expected event 0 written before the failure, got %+v", report.Tables)
+	}
+}
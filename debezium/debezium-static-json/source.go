@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EventSource supplies Debezium events to the loader, whatever they're read
+// from. Events are numbered from 0 in the order Next returns them; once an
+// event has been written to XTDB the loader passes its number to Commit, so
+// sources that can resume (Kafka) know what's safe to acknowledge.
+type EventSource interface {
+	// Next returns the next event, or false once the source is exhausted or
+	// ctx is cancelled
+	Next(ctx context.Context) (DebeziumEvent, bool, error)
+	// Commit acknowledges every event up to and including offset
+	Commit(ctx context.Context, offset int64) error
+	Close() error
+}
+
+// runSource applies events from src until it's exhausted, committing each
+// one after it's written (or each batch, with --batch-size). Events of one
+// source transaction (see txID) are held back until its END marker, or the
+// first event outside it, and then written in a single XTDB transaction, so
+// readers never see part of it. END markers come from a topic of their own,
+// so a transaction still held after --flush-interval without another event
+// is written as it stands rather than waiting out a quiet spell.
+func runSource(ctx context.Context, src EventSource, l *loader) error {
+	if l.cfg.Workers > 1 {
+		return runWorkers(ctx, src, l)
+	}
+	if l.cfg.BatchSize > 1 {
+		return runBatched(ctx, src, l)
+	}
+	var tx []batchEntry
+	var txID string
+
+	// Don't abandon a write half-way through when asked to stop
+	writeCtx := context.WithoutCancel(ctx)
+	flush := func() error {
+		if len(tx) == 0 {
+			return nil
+		}
+		if err := l.commitBatch(writeCtx, src, tx); err != nil {
+			return err
+		}
+		l.stats["transactions"]++
+		tx, txID = tx[:0], ""
+		return nil
+	}
+
+	for offset := int64(0); ; offset++ {
+		event, ok, err := l.nextEvent(ctx, src, len(tx) > 0)
+		for err == nil && !ok && ctx.Err() == nil && len(tx) > 0 {
+			// Timed out waiting for the transaction's END marker
+			l.stats["transactions_unfinished"]++
+			if err := flush(); err != nil {
+				return err
+			}
+			event, ok, err = src.Next(ctx)
+		}
+		var de *decodeError
+		if errors.As(err, &de) && l.dead != nil {
+			l.current = offset
+			l.events++
+			if err := l.reject(offset, nil, de.message, de.err); err != nil {
+				return errors.Join(err, flush())
+			}
+			if txID != "" {
+				// Committed with the rest of its transaction
+				tx = append(tx, batchEntry{offset: offset})
+				continue
+			}
+			if err := src.Commit(writeCtx, offset); err != nil {
+				return &eventError{offset, fmt.Errorf("committing: %w", err)}
+			}
+			continue
+		}
+		if err != nil {
+			if flushErr := flush(); flushErr != nil {
+				return flushErr
+			}
+			return &eventError{offset, err}
+		}
+		if !ok {
+			return flush()
+		}
+		l.current = offset
+		l.events++
+
+		id := l.txID(event)
+		if txID != "" && id != txID {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if id != "" {
+			stmt, write, err := l.prepare(event)
+			if err != nil {
+				if l.dead == nil {
+					if flushErr := flush(); flushErr != nil {
+						return flushErr
+					}
+					return &eventError{offset, err}
+				}
+				if err := l.reject(offset, &event, nil, err); err != nil {
+					return errors.Join(err, flush())
+				}
+			}
+			tx, txID = append(tx, batchEntry{offset: offset, stmt: stmt, write: write, event: event}), id
+			if endsTx(event, id) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := l.apply(writeCtx, event); err != nil {
+			if err := l.reject(offset, &event, nil, err); err != nil {
+				return err
+			}
+		}
+		if err := src.Commit(writeCtx, offset); err != nil {
+			return &eventError{offset, fmt.Errorf("committing: %w", err)}
+		}
+	}
+}
+
+// decodeError is an event a source read but couldn't decode. The source has
+// moved past it, so with --dead-letter and a --max-failures above the
+// failures so far, the run can carry on.
+type decodeError struct {
+	message []byte
+	err     error
+}
+
+func (e *decodeError) Error() string { return e.err.Error() }
+func (e *decodeError) Unwrap() error { return e.err }
+
+// arraySource streams events from a JSON array, such as cdc/events.json,
+// decoding one element at a time so the file never has to fit in memory
+type arraySource struct {
+	close   func() error
+	dec     *json.Decoder
+	started bool
+	index   int
+}
+
+func newArraySource(r io.Reader) *arraySource {
+	return &arraySource{close: func() error { return nil }, dec: json.NewDecoder(r)}
+}
+
+func (s *arraySource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	if ctx.Err() != nil {
+		return DebeziumEvent{}, false, nil
+	}
+	if !s.started {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return DebeziumEvent{}, false, fmt.Errorf("reading array start: %w", err)
+		}
+		if tok != json.Delim('[') {
+			return DebeziumEvent{}, false, fmt.Errorf("expected a JSON array of events, got %v", tok)
+		}
+		s.started = true
+	}
+
+	if !s.dec.More() {
+		if _, err := s.dec.Token(); err != nil {
+			return DebeziumEvent{}, false, fmt.Errorf("reading array end after element %d (byte %d): %w",
+				s.index, s.dec.InputOffset(), err)
+		}
+		if _, err := s.dec.Token(); err != io.EOF {
+			return DebeziumEvent{}, false, fmt.Errorf("unexpected data after the array at byte %d", s.dec.InputOffset())
+		}
+		return DebeziumEvent{}, false, nil
+	}
+
+	offset := s.dec.InputOffset()
+	var value json.RawMessage
+	if err := s.dec.Decode(&value); err != nil {
+		return DebeziumEvent{}, false, fmt.Errorf("element %d (byte %d): %w", s.index, offset, err)
+	}
+	s.index++
+	event, err := decodeEvent(value)
+	if err != nil {
+		return event, false, &decodeError{value, fmt.Errorf("element %d (byte %d): %w", s.index-1, offset, err)}
+	}
+	return event, true, nil
+}
+
+func (s *arraySource) Commit(ctx context.Context, offset int64) error { return nil }
+
+func (s *arraySource) Close() error { return s.close() }
+
+// lineSource reads newline-delimited JSON events, as written by
+// kafka-console-consumer, kcat or Kafka Connect's file sink; blank lines are
+// skipped and counted in stats["blank_lines"]
+type lineSource struct {
+	close   func() error
+	scanner *bufio.Scanner
+	line    int
+	stats   map[string]int
+}
+
+// maxLineSize bounds a single event; rows with large text columns are well
+// past bufio.Scanner's 64 KB default
+const maxLineSize = 16 * 1024 * 1024
+
+func newLineSource(r io.Reader) *lineSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &lineSource{close: func() error { return nil }, scanner: scanner, stats: map[string]int{}}
+}
+
+func (s *lineSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	for ctx.Err() == nil && s.scanner.Scan() {
+		s.line++
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			s.stats["blank_lines"]++
+			continue
+		}
+		event, err := decodeEvent(line)
+		if err != nil {
+			return event, false, &decodeError{bytes.Clone(line), fmt.Errorf("line %d: %w", s.line, err)}
+		}
+		return event, true, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return DebeziumEvent{}, false, fmt.Errorf("line %d: %w", s.line+1, err)
+	}
+	return DebeziumEvent{}, false, nil
+}
+
+func (s *lineSource) Commit(ctx context.Context, offset int64) error { return nil }
+
+func (s *lineSource) Close() error { return s.close() }
+
+// nextEvent is src.Next, waiting at most --flush-interval while events are
+// held back
+func (l *loader) nextEvent(ctx context.Context, src EventSource, holding bool) (DebeziumEvent, bool, error) {
+	if !holding {
+		return src.Next(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.flushInterval())
+	defer cancel()
+	return src.Next(ctx)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// mockSource serves scripted events and records what the loader commits
+type mockSource struct {
+	events    []DebeziumEvent
+	next      int
+	committed []int64
+	closed    bool
+}
+
+func (s *mockSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	if s.next >= len(s.events) {
+		return DebeziumEvent{}, false, nil
+	}
+	s.next++
+	return s.events[s.next-1], true, nil
+}
+
+func (s *mockSource) Commit(ctx context.Context, offset int64) error {
+	s.committed = append(s.committed, offset)
+	return nil
+}
+
+func (s *mockSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestRunSourceStopsBeforeCommittingFailedEvent(t *testing.T) {
+	outboxDelete := newEvent("d", "outbox", 1704067200000, map[string]any{"id": "x"}, nil)
+	secondsNotMillis := newEvent("c", "users", 1704067200, nil, map[string]any{"id": 1})
+	neverReached := newEvent("c", "users", 1704067200000, nil, map[string]any{"id": 2})
+
+	src := &mockSource{events: []DebeziumEvent{outboxDelete, secondsNotMillis, neverReached}}
+	// Neither the skipped outbox row nor the rejected timestamp touch the database
+	l := newLoader(Config{OutboxTable: "outbox", ValidTime: validTimeGuard{Policy: "reject"}}, nil)
+
+	err := runSource(context.Background(), src, l)
+	if err == nil || !strings.HasPrefix(err.Error(), "event 1:") {
+		t.Fatalf("Expected event 1 to fail, got %v", err)
+	}
+	if fmt.Sprint(src.committed) != "[0]" {
+		t.Errorf("Expected only event 0 committed, got %v", src.committed)
+	}
+	if src.next != 2 {
+		t.Errorf("Expected loader to stop after event 1, read %d events", src.next)
+	}
+}
+
+func TestLineSource(t *testing.T) {
+	input := `{"payload": {"op": "c", "ts_ms": 1, "source": {"table": "users"}, "after": {"id": 1}}}
+
+{"op": "d", "ts_ms": 2, "source": {"table": "users"}, "before": {"id": 1}}
+not json
+`
+	src := newLineSource(strings.NewReader(input))
+	ctx := context.Background()
+
+	var ops []string
+	for {
+		event, ok, err := src.Next(ctx)
+		if err != nil {
+			if !strings.Contains(err.Error(), "line 4") {
+				t.Errorf("Expected error on line 4, got %v", err)
+			}
+			break
+		}
+		if !ok {
+			t.Fatal("Expected a decode error before the end of input")
+		}
+		ops = append(ops, event.Payload.Op)
+	}
+	if fmt.Sprint(ops) != "[c d]" {
+		t.Errorf("Expected ops [c d], got %v", ops)
+	}
+}
+
+func TestArraySource(t *testing.T) {
+	ctx := context.Background()
+	drain := func(input string) ([]string, error) {
+		src := newArraySource(strings.NewReader(input))
+		var ops []string
+		for {
+			event, ok, err := src.Next(ctx)
+			if err != nil || !ok {
+				return ops, err
+			}
+			ops = append(ops, event.Payload.Op)
+		}
+	}
+
+	ops, err := drain(`[{"payload": {"op": "c"}}, {"payload": {"op": "u"}}, {"payload": {"op": "d"}}]`)
+	if err != nil || fmt.Sprint(ops) != "[c u d]" {
+		t.Errorf("Expected ops [c u d], got %v, %v", ops, err)
+	}
+
+	ops, err = drain(`[{"payload": {"op": "c"}}, {"payload": {"op": 7}}]`)
+	if err == nil || !strings.Contains(err.Error(), "element 1 (byte 25)") || fmt.Sprint(ops) != "[c]" {
+		t.Errorf("Expected an error for element 1 after [c], got %v, %v", ops, err)
+	}
+
+	if _, err := drain(`{"payload": {}}`); err == nil {
+		t.Error("Expected an error for input that isn't an array")
+	}
+	if _, err := drain(`[{"payload": {"op": "c"}}`); err == nil || !strings.Contains(err.Error(), "element 1 (byte 25): unexpected end") {
+		t.Errorf("Expected a truncated array to be reported, got %v", err)
+	}
+	for _, input := range []string{`[{"payload": {"op": "c"}}] [{"payload": {"op": "d"}}]`, `[] x`} {
+		if _, err := drain(input); err == nil || !strings.Contains(err.Error(), "unexpected data after the array") {
+			t.Errorf("Expected data after the array in %q to be reported, got %v", input, err)
+		}
+	}
+	if ops, err := drain("[{\"payload\": {\"op\": \"c\"}}]\n\n"); err != nil || fmt.Sprint(ops) != "[c]" {
+		t.Errorf("Expected trailing whitespace allowed, got %v, %v", ops, err)
+	}
+}
+
+func TestRunSourceMock(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	src := &mockSource{events: []DebeziumEvent{
+		newEvent("c", table, 1704067200000, nil, map[string]any{"id": 1, "name": "Alice"}),
+		newEvent("c", table, 1704067260000, nil, map[string]any{"id": 2, "name": "Bob"}),
+		newEvent("u", table, 1704067320000, nil, map[string]any{"id": 1, "name": "Alice Smith"}),
+		newEvent("d", table, 1704067380000, map[string]any{"id": 2}, nil),
+	}}
+
+	l := newLoader(Config{ValidTime: validTimeGuard{Policy: "reject"}}, conn)
+	if err := runSource(context.Background(), src, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	if fmt.Sprint(src.committed) != "[0 1 2 3]" {
+		t.Errorf("Expected every event committed in order, got %v", src.committed)
+	}
+	if l.stats["inserts"] != 2 || l.stats["updates"] != 1 || l.stats["deletes"] != 1 {
+		t.Errorf("Unexpected stats: %v", l.stats)
+	}
+	if l.stats["rows_affected"] < 3 {
+		t.Errorf("Expected the server to report a row per insert and update, got %v", l.stats)
+	}
+
+	rows, err := conn.Query(context.Background(), fmt.Sprintf("SELECT _id, name FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%d=%s", id, name))
+	}
+	if fmt.Sprint(got) != "[1=Alice Smith]" {
+		t.Errorf("Expected only the updated Alice to remain, got %v", got)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	create := `{"payload": {"op": "c", "ts_ms": 1704067200000, "source": {"table": "users"}, "after": {"id": 1}}}`
+	del := `{"payload": {"op": "d", "ts_ms": 1704067260000, "source": {"table": "users"}, "before": {"id": 1}}}`
+	sources := map[string]EventSource{
+		"array": newArraySource(strings.NewReader(
+			"[" + create + "," + del + `, null, {"schema": null, "payload": null}]`)),
+		"lines": newLineSource(strings.NewReader(
+			create + "\n" + del + "\nnull\n" + `{"schema": null, "payload": null}` + "\n")),
+	}
+	for name, src := range sources {
+		l := newLoader(Config{BatchSize: 10}, nil)
+		batches := recordBatches(l, -1)
+		if err := runSource(context.Background(), src, l); err != nil {
+			t.Fatalf("%s: runSource failed: %v", name, err)
+		}
+		if got := batchSummary(*batches); got != "users:insert:1 users:delete:1" {
+			t.Errorf("%s: expected one insert and one delete, got %s", name, got)
+		}
+		if l.stats["tombstones"] != 2 || len(l.skipped) != 0 {
+			t.Errorf("%s: expected 2 tombstones skipped quietly, got %v and %v", name, l.stats, l.skipped)
+		}
+	}
+
+	if _, err := decodeEvent([]byte(`{"payload": {"id": 1}}`)); err == nil {
+		t.Error("Expected a payload without an op still rejected")
+	}
+
+	// An event with no op that got this far isn't a tombstone, and says so
+	l := newLoader(Config{}, nil)
+	if _, ok, err := l.prepare(newEvent("", "users", 1704067200000, nil, map[string]any{"id": 1})); ok || err != nil {
+		t.Errorf("Expected an event without an op skipped, got %v, %v", ok, err)
+	}
+	if l.stats["tombstones"] != 0 || len(l.skipped) != 1 {
+		t.Errorf("Expected the event reported as skipped, not a tombstone, got %v and %v", l.stats, l.skipped)
+	}
+}
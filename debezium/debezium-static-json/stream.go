@@ -0,0 +1,57 @@
+package main
+
+import "context"
+
+// streamSource reads an input that may never end, such as stdin piped from
+// kcat, in the background. A read from a pipe can't be cancelled, so without
+// it a quiet pipe would hold a partly filled batch back and Ctrl-C would wait
+// for the next line. Next instead returns as soon as ctx is done, and the
+// event still being read is handed over by the following call.
+type streamSource struct {
+	src     EventSource
+	pending chan streamed // the read in flight, if any
+	stats   map[string]int
+	counted map[string]int // src's stats, only touched between reads
+}
+
+type streamed struct {
+	event DebeziumEvent
+	ok    bool
+	err   error
+}
+
+// newStreamSource reads src in the background, adding the blank lines it
+// skips to stats
+func newStreamSource(src *lineSource, stats map[string]int) *streamSource {
+	counted := map[string]int{}
+	src.stats = counted
+	return &streamSource{src: src, stats: stats, counted: counted}
+}
+
+func (s *streamSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	if s.pending == nil {
+		next := make(chan streamed, 1)
+		go func() {
+			event, ok, err := s.src.Next(context.Background())
+			next <- streamed{event, ok, err}
+		}()
+		s.pending = next
+	}
+	select {
+	case <-ctx.Done():
+		return DebeziumEvent{}, false, nil
+	case r := <-s.pending:
+		s.pending = nil
+		for k, n := range s.counted {
+			s.stats[k] += n
+			delete(s.counted, k)
+		}
+		return r.event, r.ok, r.err
+	}
+}
+
+func (s *streamSource) Commit(ctx context.Context, offset int64) error {
+	return s.src.Commit(ctx, offset)
+}
+
+func (s *streamSource) Close() error { return s.src.Close() }
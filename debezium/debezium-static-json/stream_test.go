@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// stdin piped from kcat never reaches EOF, so batches are written as events
+// stop arriving and Ctrl-C stops the run without waiting for another line
+func TestStreamSourcePipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	l := newLoader(Config{BatchSize: 10, FlushInterval: 20 * time.Millisecond}, nil)
+	batches := recordBatches(l, -1)
+	send := l.sendBatch
+	flushed := make(chan int, 10)
+	l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+		tags, err := send(ctx, stmts)
+		flushed <- len(stmts)
+		return tags, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- runSource(ctx, newStreamSource(newLineSource(pr), l.stats), l) }()
+
+	for id := 1; id <= 2; id++ {
+		fmt.Fprintf(pw, "\n"+`{"payload": {"op": "c", "ts_ms": 1704067200000, "source": {"table": "users"}, "after": {"id": %d}}}`+"\n", id)
+	}
+	select {
+	case n := <-flushed:
+		if n != 2 {
+			t.Errorf("Expected both events in one batch, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the partly filled batch to be written while the pipe is open")
+	}
+
+	// As on SIGINT, with nothing more arriving on the pipe
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected a clean stop, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected cancelling to stop the run while a read is blocked")
+	}
+
+	if len(*batches) != 1 || l.events != 2 || l.stats["blank_lines"] != 2 {
+		t.Errorf("Expected 2 events in 1 batch and 2 blank lines, got %d batches, %d events, %v", len(*batches), l.events, l.stats)
+	}
+}
+
+func TestParseConfigFlushInterval(t *testing.T) {
+	cfg, err := parseConfig([]string{"--batch-size", "100", "--flush-interval", "250ms", "-"})
+	if err != nil || cfg.FlushInterval != 250*time.Millisecond || cfg.EventsFile != "-" {
+		t.Errorf("Unexpected config %+v, %v", cfg, err)
+	}
+	if cfg, _ := parseConfig(nil); cfg.FlushInterval != batchLinger {
+		t.Errorf("Expected --flush-interval to default to %s, got %s", batchLinger, cfg.FlushInterval)
+	}
+	if _, err := parseConfig([]string{"--flush-interval", "0s"}); err == nil {
+		t.Error("Expected a zero --flush-interval to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// tableNamePattern is deliberately narrower than what XTDB accepts: an
+	// unquoted identifier of at most 63 characters
+	tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+	// tableSeparators are the characters normalization turns into '_'
+	tableSeparators = strings.NewReplacer("-", "_", ".", "_", " ", "_")
+)
+
+// sanitizeTableName turns a source table name into the XTDB table its
+// events are written to. With normalize, it's lower-cased and dashes, dots
+// and spaces become underscores ("Order-Lines" -> "order_lines"); then
+// prefix is prepended. Anything that still isn't a plain identifier is
+// rejected rather than spliced into SQL.
+func sanitizeTableName(name, prefix string, normalize bool) (string, error) {
+	table := name
+	if normalize {
+		table = tableSeparators.Replace(strings.ToLower(table))
+	}
+	table = prefix + table
+	if name == "" || !tableNamePattern.MatchString(table) {
+		return "", fmt.Errorf("invalid table name %q (as %q): want letters, digits and underscores, at most 63 characters", name, table)
+	}
+	return table, nil
+}
+
+// checkTableName rejects a table name that isn't a plain identifier, for
+// statements built without resolveTable, e.g. by insertRecord and deleteRecord
+func checkTableName(table string) error {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("invalid table name %q: want letters, digits and underscores, at most 63 characters", table)
+	}
+	return nil
+}
+
+// resolveTable returns the XTDB table an event is written to: the --rename
+// target of its source table, looked up as schema.table and then as table,
+// or else the source table sanitized and prefixed
+func (l *loader) resolveTable(event DebeziumEvent) (string, error) {
+	source := event.Payload.Source
+	if source.Schema != "" {
+		if to, ok := l.cfg.Renames[source.Schema+"."+source.Table]; ok {
+			return to, nil
+		}
+	}
+	if to, ok := l.cfg.Renames[source.Table]; ok {
+		return to, nil
+	}
+	return sanitizeTableName(source.Table, l.cfg.TablePrefix, l.cfg.NormalizeTables)
+}
+
+// tableRenames maps source table names, optionally schema-qualified, to the
+// XTDB tables they're loaded into, set with repeated --rename from=to flags.
+// The target is used as it is, without --table-prefix or normalization.
+type tableRenames map[string]string
+
+func (r tableRenames) String() string {
+	var specs []string
+	for from, to := range r {
+		specs = append(specs, from+"="+to)
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, " ")
+}
+
+func (r tableRenames) Set(s string) error {
+	from, to, ok := strings.Cut(s, "=")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" {
+		return fmt.Errorf("expected from=to, got %q", s)
+	}
+	if !tableNamePattern.MatchString(to) {
+		return fmt.Errorf("invalid table name %q: want letters, digits and underscores, at most 63 characters", to)
+	}
+	r[from] = to
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeTableName(t *testing.T) {
+	cases := []struct {
+		name, prefix string
+		normalize    bool
+		want         string // "" for rejected
+	}{
+		{"users", "", true, "users"},
+		{"users", "cdc_", true, "cdc_users"},
+		{"Order-Lines", "", true, "order_lines"},
+		{"inventory.customers", "cdc_", true, "cdc_inventory_customers"},
+		{"Order-Lines", "", false, ""},
+		{"MixedCase", "", false, "MixedCase"},
+		{"users; drop", "", true, ""},
+		{"users'--", "", true, ""},
+		{"9lives", "", true, ""},
+		{"9lives", "t_", true, "t_9lives"},
+		{"", "cdc_", true, ""},
+		{strings.Repeat("a", 60), "cdc_", true, ""},
+	}
+	for _, c := range cases {
+		got, err := sanitizeTableName(c.name, c.prefix, c.normalize)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("sanitizeTableName(%q, %q, %v) = %q, want an error", c.name, c.prefix, c.normalize, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("sanitizeTableName(%q, %q, %v) = %q, %v, want %q", c.name, c.prefix, c.normalize, got, err, c.want)
+		}
+	}
+}
+
+func TestInvalidTableNameNamesEvent(t *testing.T) {
+	src := &mockSource{events: []DebeziumEvent{
+		newEvent("d", "outbox", 1704067200000, map[string]any{"id": "x"}, nil),
+		newEvent("c", "users; drop", 1704067200000, nil, map[string]any{"id": 1}),
+	}}
+	// The skipped outbox row and the rejected name never touch the database
+	l := newLoader(Config{OutboxTable: "outbox", NormalizeTables: true}, nil)
+
+	err := runSource(context.Background(), src, l)
+	if err == nil || !strings.HasPrefix(err.Error(), `event 1: invalid table name "users; drop"`) {
+		t.Errorf("Expected event 1's table name to be rejected, got %v", err)
+	}
+}
+
+func TestParseConfigTablePrefix(t *testing.T) {
+	cfg, err := parseConfig([]string{"--table-prefix", "cdc_"})
+	if err != nil || cfg.TablePrefix != "cdc_" || !cfg.NormalizeTables {
+		t.Errorf("Unexpected config %+v, %v", cfg, err)
+	}
+	if _, err := parseConfig([]string{"--table-prefix", "cdc-"}); err == nil {
+		t.Error("Expected a prefix with a dash to be rejected")
+	}
+}
+
+func TestResolveTable(t *testing.T) {
+	renames := tableRenames{}
+	for _, spec := range []string{"public.orders=sales_orders", "orders=legacy_orders", "audit.users=user_audit"} {
+		if err := renames.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := newLoader(Config{TablePrefix: "cdc_", NormalizeTables: true, Renames: renames}, nil)
+
+	cases := []struct{ schema, table, want string }{
+		{"public", "users", "cdc_users"},
+		{"", "users", "cdc_users"},
+		{"public", "orders", "sales_orders"},
+		{"inventory", "orders", "legacy_orders"},
+		{"audit", "users", "user_audit"},
+	}
+	for _, c := range cases {
+		event := newEvent("c", c.table, 1704067200000, nil, map[string]any{"id": 1})
+		event.Payload.Source.Schema = c.schema
+		if got, err := l.resolveTable(event); err != nil || got != c.want {
+			t.Errorf("resolveTable(%s.%s) = %q, %v, want %q", c.schema, c.table, got, err, c.want)
+		}
+	}
+}
+
+func TestTablePrefixInsertAndDelete(t *testing.T) {
+	ts := int64(1704067200000)
+	events := []DebeziumEvent{
+		newEvent("c", "users", ts, nil, map[string]any{"id": 1}),
+		newEvent("d", "users", ts+1, map[string]any{"id": 1}, nil),
+	}
+	for i := range events {
+		events[i].Payload.Source.Schema = "public"
+	}
+	l := newLoader(Config{BatchSize: 10, TablePrefix: "cdc_", NormalizeTables: true}, nil)
+	batches := recordBatches(l, -1)
+
+	if err := runSource(context.Background(), &mockSource{events: events}, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+	var got []string
+	for _, batch := range *batches {
+		for _, s := range batch {
+			got = append(got, s.table+":"+strings.Fields(s.sql)[0]+" "+strings.Fields(s.sql)[2])
+		}
+	}
+	if strings.Join(got, ", ") != "cdc_users:INSERT cdc_users, cdc_users:DELETE cdc_users" {
+		t.Errorf("Expected public.users written to cdc_users, got %v", got)
+	}
+}
+
+func TestParseConfigRename(t *testing.T) {
+	cfg, err := parseConfig([]string{"--rename", "public.users=people", "--rename", "orders = sales"})
+	if err != nil || cfg.Renames.String() != "orders=sales public.users=people" {
+		t.Errorf("Unexpected renames %v, %v", cfg.Renames, err)
+	}
+	for _, spec := range []string{"users", "=people", "users=people; drop", "users=9lives"} {
+		if _, err := parseConfig([]string{"--rename", spec}); err == nil {
+			t.Errorf("Expected --rename %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// connConfig builds the pgx config for XTDB, with mutual TLS when
+// --sslcert/--sslkey/--sslrootcert are given
+func connConfig(cfg Config) (*pgx.ConnConfig, error) {
+	pgxCfg, err := pgx.ParseConfig(connString())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SSLCert == "" && cfg.SSLKey == "" && cfg.SSLRootCert == "" {
+		return pgxCfg, nil
+	}
+
+	tlsCfg, err := buildTLSConfig(cfg, pgxCfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	pgxCfg.TLSConfig = tlsCfg
+	pgxCfg.Fallbacks = nil // never retry without TLS
+	return pgxCfg, nil
+}
+
+func buildTLSConfig(cfg Config, host string) (*tls.Config, error) {
+	tlsCfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	if cfg.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.SSLCert, cfg.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.SSLRootCert != "" {
+		pem, err := os.ReadFile(cfg.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("reading --sslrootcert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.SSLRootCert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConnConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "loader"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPath := filepath.Join(dir, "loader.crt")
+	keyPath := filepath.Join(dir, "loader.key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	cfg, err := parseConfig([]string{"--sslcert", certPath, "--sslkey", keyPath, "--sslrootcert", certPath})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	pgxCfg, err := connConfig(cfg)
+	if err != nil {
+		t.Fatalf("connConfig failed: %v", err)
+	}
+	if pgxCfg.TLSConfig == nil || len(pgxCfg.TLSConfig.Certificates) != 1 || pgxCfg.TLSConfig.RootCAs == nil {
+		t.Errorf("Expected client cert and root CA in TLSConfig, got %+v", pgxCfg.TLSConfig)
+	}
+	if len(pgxCfg.Fallbacks) != 0 {
+		t.Error("Expected no plaintext fallback with client certificates")
+	}
+
+	if _, err := parseConfig([]string{"--sslcert", certPath}); err == nil {
+		t.Error("Expected --sslcert without --sslkey to be rejected")
+	}
+}
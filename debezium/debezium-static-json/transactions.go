@@ -0,0 +1,42 @@
+package main
+
+// sourceTransaction is the transaction block Debezium adds to each change
+// event when the connector has provide.transaction.metadata=true
+type sourceTransaction struct {
+	ID                  string `json:"id"`
+	TotalOrder          int64  `json:"total_order"`
+	DataCollectionOrder int64  `json:"data_collection_order"`
+}
+
+// Transaction boundary markers, sent on the connector's transaction topic
+// with the transaction id and, for END, its event count
+const (
+	txBegin = "BEGIN"
+	txEnd   = "END"
+)
+
+// isTxMarker reports whether event is a transaction boundary marker rather
+// than a change event
+func isTxMarker(event DebeziumEvent) bool {
+	return event.Payload.Op == "" && (event.Payload.Status == txBegin || event.Payload.Status == txEnd)
+}
+
+// txID returns the source transaction event (or marker) belongs to, or ""
+// when it has none or --per-event-commit is set. Events sharing an id are
+// written to XTDB in one transaction.
+func (l *loader) txID(event DebeziumEvent) string {
+	switch {
+	case l.cfg.PerEventCommit:
+		return ""
+	case isTxMarker(event):
+		return event.Payload.ID
+	case event.Payload.Transaction != nil:
+		return event.Payload.Transaction.ID
+	}
+	return ""
+}
+
+// endsTx reports whether event closes the source transaction id
+func endsTx(event DebeziumEvent, id string) bool {
+	return id != "" && isTxMarker(event) && event.Payload.Status == txEnd && event.Payload.ID == id
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// inTx adds a Debezium transaction block to event
+func inTx(event DebeziumEvent, id string, order int64) DebeziumEvent {
+	event.Payload.Transaction = &sourceTransaction{ID: id, TotalOrder: order, DataCollectionOrder: order}
+	return event
+}
+
+// txMarker is a BEGIN or END marker for transaction id
+func txMarker(status, id string, count int64) DebeziumEvent {
+	var event DebeziumEvent
+	event.Payload.Status = status
+	event.Payload.ID = id
+	event.Payload.EventCount = count
+	return event
+}
+
+// txEvents is a three-event transaction over two tables, a one-event
+// transaction closed by its END marker, and a transaction opened by a BEGIN
+// marker that the source ends
+func txEvents(table string) []DebeziumEvent {
+	ts := int64(1704067200000)
+	return []DebeziumEvent{
+		inTx(newEvent("c", table, ts, nil, map[string]any{"id": 1}), "t1", 1),
+		inTx(newEvent("c", table+"_accounts", ts, nil, map[string]any{"id": 1}), "t1", 2),
+		inTx(newEvent("u", table, ts+1, nil, map[string]any{"id": 1, "name": "a"}), "t1", 3),
+		inTx(newEvent("c", table, ts+2, nil, map[string]any{"id": 2}), "t2", 1),
+		txMarker(txEnd, "t2", 1),
+		txMarker(txBegin, "t3", 0),
+		inTx(newEvent("c", table, ts+3, nil, map[string]any{"id": 3}), "t3", 1),
+	}
+}
+
+// batchSummary lists each batch's statements as table:kind:id
+func batchSummary(batches [][]statement) string {
+	var lines []string
+	for _, batch := range batches {
+		var kinds []string
+		for _, s := range batch {
+			kinds = append(kinds, fmt.Sprintf("%s:%s:%v", s.table, s.kind, s.id))
+		}
+		lines = append(lines, strings.Join(kinds, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSourceTransactions(t *testing.T) {
+	want := strings.Join([]string{
+		"users:insert:1 users_accounts:insert:1 users:update:1",
+		"users:insert:2",
+		"users:insert:3",
+	}, "\n")
+
+	for _, batchSize := range []int{1, 2} {
+		src := &mockSource{events: txEvents("users")}
+		l := newLoader(Config{BatchSize: batchSize}, nil)
+		batches := recordBatches(l, -1)
+
+		if err := runSource(context.Background(), src, l); err != nil {
+			t.Fatalf("batch size %d: runSource failed: %v", batchSize, err)
+		}
+		if got := batchSummary(*batches); got != want {
+			t.Errorf("batch size %d: unexpected transactions:\n%s\nwant:\n%s", batchSize, got, want)
+		}
+		if fmt.Sprint(src.committed) != "[2 4 6]" || l.stats["transactions"] != 3 {
+			t.Errorf("batch size %d: expected each transaction committed at its last event, got %v and %d transactions",
+				batchSize, src.committed, l.stats["transactions"])
+		}
+	}
+}
+
+// quietSource is a Kafka topic that goes quiet after its events: Next
+// blocks until ctx is done
+type quietSource struct {
+	mockSource
+}
+
+func (s *quietSource) Next(ctx context.Context) (DebeziumEvent, bool, error) {
+	if s.next < len(s.events) {
+		return s.mockSource.Next(ctx)
+	}
+	<-ctx.Done()
+	return DebeziumEvent{}, false, nil
+}
+
+// The END marker comes on another topic and may lag, so a held transaction
+// is written once no event has come for --flush-interval
+func TestSourceTransactionWithoutEnd(t *testing.T) {
+	ts := int64(1704067200000)
+	for _, batchSize := range []int{1, 2} {
+		src := &quietSource{mockSource{events: []DebeziumEvent{
+			inTx(newEvent("c", "users", ts, nil, map[string]any{"id": 1}), "t1", 1),
+			inTx(newEvent("c", "users", ts, nil, map[string]any{"id": 2}), "t1", 2),
+		}}}
+		l := newLoader(Config{BatchSize: batchSize, FlushInterval: 20 * time.Millisecond}, nil)
+		recordBatches(l, -1)
+		send := l.sendBatch
+		written := make(chan []statement, 1)
+		l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+			written <- stmts
+			return send(ctx, stmts)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- runSource(ctx, src, l) }()
+		select {
+		case stmts := <-written:
+			if batchSummary([][]statement{stmts}) != "users:insert:1 users:insert:2" {
+				t.Errorf("batch size %d: expected t1 written whole, got %s", batchSize, batchSummary([][]statement{stmts}))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("batch size %d: expected t1 written without its END marker", batchSize)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("batch size %d: runSource failed: %v", batchSize, err)
+		}
+		if fmt.Sprint(src.committed) != "[1]" || l.stats["transactions_unfinished"] != 1 {
+			t.Errorf("batch size %d: expected t1 committed and counted unfinished, got %v and %v", batchSize, src.committed, l.stats)
+		}
+	}
+}
+
+func TestSourceTransactionRolledBack(t *testing.T) {
+	src := &mockSource{events: txEvents("users")}
+	l := newLoader(Config{}, nil)
+	// The accounts insert fails, taking the rest of t1 with it
+	recordBatches(l, 1)
+
+	err := runSource(context.Background(), src, l)
+	if err == nil || !strings.HasPrefix(err.Error(), "event 1: insert: boom") ||
+		!strings.Contains(err.Error(), "resume from event 0") {
+		t.Fatalf("Expected event 1 to fail and resume from event 0, got %v", err)
+	}
+	if len(src.committed) != 0 || l.stats["inserts"] != 0 {
+		t.Errorf("Expected nothing of t1 committed, got %v and %v", src.committed, l.stats)
+	}
+}
+
+func TestPerEventCommit(t *testing.T) {
+	src := &mockSource{events: txEvents("users")}
+	l := newLoader(Config{BatchSize: 3, PerEventCommit: true}, nil)
+	batches := recordBatches(l, -1)
+
+	if err := runSource(context.Background(), src, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+	// Batched by size and table as if there were no transactions, markers skipped
+	want := strings.Join([]string{
+		"users:insert:1",
+		"users_accounts:insert:1",
+		"users:update:1 users:insert:2",
+		"users:insert:3",
+	}, "\n")
+	if got := batchSummary(*batches); got != want {
+		t.Errorf("Unexpected batches:\n%s\nwant:\n%s", got, want)
+	}
+	if l.stats["transactions"] != 0 {
+		t.Errorf("Expected no source transactions, got %d", l.stats["transactions"])
+	}
+
+	cfg, err := parseConfig([]string{"--per-event-commit"})
+	if err != nil || !cfg.PerEventCommit {
+		t.Errorf("Unexpected config %+v, %v", cfg, err)
+	}
+}
+
+func TestDecodeTransactionMetadata(t *testing.T) {
+	event, err := decodeEvent([]byte(`{"op": "c", "ts_ms": 1704067200000, "source": {"table": "users"}, "after": {"id": 1},
+		"transaction": {"id": "571:53195832", "total_order": 1, "data_collection_order": 1}}`))
+	if err != nil || event.Payload.Transaction == nil || event.Payload.Transaction.ID != "571:53195832" {
+		t.Errorf("Expected the transaction block decoded, got %+v, %v", event.Payload.Transaction, err)
+	}
+
+	for _, msg := range []string{
+		`{"status": "END", "id": "571:53195832", "event_count": 2, "data_collections": []}`,
+		`{"schema": {"type": "struct"}, "payload": {"status": "END", "id": "571:53195832", "event_count": 2}}`,
+	} {
+		marker, err := decodeEvent([]byte(msg))
+		if err != nil || !endsTx(marker, "571:53195832") || marker.Payload.EventCount != 2 {
+			t.Errorf("Expected an END marker from %s, got %+v, %v", msg, marker.Payload, err)
+		}
+	}
+}
+
+func TestSourceTransactionsIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	l := newLoader(Config{}, conn)
+	if err := runSource(ctx, &mockSource{events: txEvents(table)}, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+
+	var count int
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 users, got %d", count)
+	}
+	var name string
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT name FROM %s WHERE _id = 1", table)).Scan(&name); err != nil || name != "a" {
+		t.Errorf("Expected t1's update applied, got %q, %v", name, err)
+	}
+}
+
+func TestSourceTransactionRollbackIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	ts := int64(1704067200000)
+	src := &mockSource{events: []DebeziumEvent{
+		inTx(newEvent("c", table, ts, nil, map[string]any{"id": 1, "name": "a"}), "t9", 1),
+		inTx(newEvent("c", table, ts, nil, map[string]any{"id": 2, "name": "b"}), "t9", 2),
+	}}
+	l := newLoader(Config{}, conn)
+	// Have the server reject t9's second insert, after its first has run
+	l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+		stmts[1].sql += " ORDER BY nonsense"
+		return l.execBatch(ctx, stmts)
+	}
+
+	err := runSource(ctx, src, l)
+	if err == nil || !strings.HasPrefix(err.Error(), "event 1: insert:") {
+		t.Fatalf("Expected event 1 to fail, got %v", err)
+	}
+
+	var count int
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected neither of t9's users written, got %d", count)
+	}
+}
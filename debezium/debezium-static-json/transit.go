@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransitOID is XTDB's transit-JSON type OID, for records holding values
+// JSON has no type for, such as a UUID _id from --rekey=uuid-v5-from-id
+const TransitOID = 16384
+
+// transitRecord encodes record as a transit-JSON map: UUIDs as "~u", times
+// and the _valid_from string eventToRecord writes as "~t" instants, strings
+// that start with a transit marker escaped, and everything else as JSON
+func transitRecord(record map[string]any) ([]byte, error) {
+	if s, ok := record["_valid_from"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			copied := make(map[string]any, len(record))
+			for k, v := range record {
+				copied[k] = v
+			}
+			copied["_valid_from"] = t
+			record = copied
+		}
+	}
+	return json.Marshal(transitValue(record))
+}
+
+func transitValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		m := make([]any, 0, 1+2*len(v))
+		m = append(m, "^ ")
+		for _, k := range keys {
+			m = append(m, "~:"+k, transitValue(v[k]))
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = transitValue(item)
+		}
+		return items
+	case string:
+		if strings.HasPrefix(v, "~") || strings.HasPrefix(v, "^") || strings.HasPrefix(v, "`") {
+			return "~" + v
+		}
+		return v
+	case uuid.UUID:
+		return "~u" + v.String()
+	case time.Time:
+		return "~t" + v.UTC().Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
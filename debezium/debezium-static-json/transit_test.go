@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTransitRecord(t *testing.T) {
+	id := uuid.MustParse("886313e1-3b8a-5372-9b90-0c9aee199e5d")
+	got, err := transitRecord(map[string]any{
+		"_id":         id,
+		"_valid_from": "2024-01-01T00:00:00.5Z",
+		"note":        "~not a tag",
+		"tags":        []any{"^ ", 1.5, nil},
+		"price":       json.Number("12.30"),
+		"address":     map[string]any{"city": "Paris"},
+	})
+	if err != nil {
+		t.Fatalf("transitRecord failed: %v", err)
+	}
+	want := `["^ ","~:_id","~u886313e1-3b8a-5372-9b90-0c9aee199e5d","~:_valid_from","~t2024-01-01T00:00:00.5Z",` +
+		`"~:address",["^ ","~:city","Paris"],"~:note","~~not a tag","~:price",12.30,"~:tags",["~^ ",1.5,null]]`
+	if string(got) != want {
+		t.Errorf("Unexpected transit record:\n got %s\nwant %s", got, want)
+	}
+}
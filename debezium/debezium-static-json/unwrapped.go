@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Debezium's ExtractNewRecordState SMT replaces the change event envelope
+// with the row itself, and adds.fields/delete.handling.mode=rewrite add what
+// is left of the envelope as __-prefixed fields:
+//
+//	{"id": 1, "email": "a@example.com", "__op": "c", "__table": "users",
+//	 "__ts_ms": 1704067200000, "__deleted": "false"}
+//
+// Such rows are recognised by their __op or __deleted field and rebuilt into
+// an ordinary event, so they go through the same insert and delete code.
+
+// unwrappedRow returns the flattened row of a message in the unwrapped shape,
+// with or without a schema envelope, and that envelope's schema
+func unwrappedRow(value []byte) (map[string]any, *connectSchema, bool) {
+	var row map[string]any
+	if err := json.Unmarshal(value, &row); err != nil {
+		return nil, nil, false
+	}
+	var schema *connectSchema
+	if payload, ok := row["payload"].(map[string]any); ok {
+		var envelope struct {
+			Schema *connectSchema `json:"schema"`
+		}
+		if err := json.Unmarshal(value, &envelope); err == nil {
+			schema = envelope.Schema
+		}
+		row = payload
+	}
+	_, op := row["__op"]
+	_, deleted := row["__deleted"]
+	return row, schema, op || deleted
+}
+
+// unwrappedEvent rebuilds the event for a flattened row. __deleted=true (or
+// __op d) makes it a delete of the row as it was; anything else is written
+// as the row's new state. A row without __op, from an SMT adding only
+// __deleted, is treated as a create, which XTDB upserts all the same. A row
+// without __ts_ms has no ts_ms to take its valid time from (see
+// validFromSource).
+func unwrappedEvent(row map[string]any, schema *connectSchema) (DebeziumEvent, error) {
+	var event DebeziumEvent
+	image := make(map[string]any, len(row))
+	for k, v := range row {
+		if !strings.HasPrefix(k, "__") {
+			image[k] = v
+		}
+	}
+
+	op, _ := row["__op"].(string)
+	if op == "" {
+		op = "c"
+	}
+	switch v := row["__deleted"].(type) {
+	case bool:
+		if v {
+			op = "d"
+		}
+	case string:
+		if v == "true" {
+			op = "d"
+		}
+	}
+
+	table, _ := row["__table"].(string)
+	if table == "" {
+		return event, fmt.Errorf("unwrapped message has no __table; add table to the SMT's add.fields")
+	}
+	event.Payload.Op = op
+	event.Payload.Source.Table = table
+	event.Payload.Source.DB, _ = row["__db"].(string)
+	if ms, ok := connectInt(row["__ts_ms"]); ok {
+		event.Payload.TsMs = ms
+	} else {
+		// Not 1970: --valid-from falls back to its next source, and fails
+		// the event if it has none
+		event.noTsMs = true
+	}
+	if ms, ok := connectInt(row["__source_ts_ms"]); ok {
+		event.Payload.Source.TsMs = ms
+	}
+
+	if op == "d" {
+		event.Payload.Before = image
+	} else {
+		event.Payload.After = image
+	}
+
+	// The schema describes the flattened row, which is now the before or
+	// after image
+	if schema != nil {
+		before, after := *schema, *schema
+		before.Field, after.Field = "before", "after"
+		event.Schema = &connectSchema{Type: "struct", Fields: []connectSchema{before, after}}
+	}
+	return event, nil
+}
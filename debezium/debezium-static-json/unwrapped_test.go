@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnwrappedEvents(t *testing.T) {
+	enveloped, err := loadEvents("cdc/events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+	unwrapped, err := loadEvents("cdc/unwrapped-events.json")
+	if err != nil {
+		t.Fatalf("loadEvents failed: %v", err)
+	}
+
+	// The flattened users rows write exactly what their envelopes do
+	var users []DebeziumEvent
+	for _, event := range enveloped {
+		if event.Payload.Source.Table == "users" {
+			users = append(users, event)
+		}
+	}
+	if len(unwrapped) != len(users) {
+		t.Fatalf("Expected %d unwrapped events, got %d", len(users), len(unwrapped))
+	}
+	l := newLoader(Config{}, nil)
+	for i := range users {
+		want, _, err := l.prepare(users[i])
+		if err != nil {
+			t.Fatalf("Event %d: prepare failed: %v", i, err)
+		}
+		got, _, err := l.prepare(unwrapped[i])
+		if err != nil {
+			t.Fatalf("Unwrapped event %d: prepare failed: %v", i, err)
+		}
+		if got.kind != want.kind || got.sql != want.sql || string(got.params[0]) != string(want.params[0]) || got.id != want.id {
+			t.Errorf("Event %d: expected %s %s %s, got %s %s %s",
+				i, want.kind, want.sql, want.params[0], got.kind, got.sql, got.params[0])
+		}
+	}
+
+	// A schema envelope still converts logical types; __deleted alone
+	// marks a delete
+	event, err := decodeEvent([]byte(`{"schema": {"type": "struct", "fields": [
+		{"field": "id", "type": "int64"}, {"field": "born", "type": "int32", "name": "io.debezium.time.Date"}]},
+		"payload": {"id": 1, "born": 18545, "__deleted": true, "__table": "users", "__source_ts_ms": 1704067200000}}`))
+	if err != nil {
+		t.Fatalf("decodeEvent failed: %v", err)
+	}
+	if event, err = applyConnectSchema(event); err != nil {
+		t.Fatalf("applyConnectSchema failed: %v", err)
+	}
+	p := event.Payload
+	if p.Op != "d" || p.Source.TsMs != 1704067200000 || p.After != nil || p.Before["born"] != "2020-10-10" || p.Before["__deleted"] != nil {
+		t.Errorf("Unexpected event: %+v", p)
+	}
+
+	if _, err := decodeEvent([]byte(`{"id": 1, "__op": "c"}`)); err == nil || !strings.Contains(err.Error(), "__table") {
+		t.Errorf("Expected a row without __table rejected, got %v", err)
+	}
+
+	// Without __ts_ms the row has no ts_ms, rather than one of 1970: it's
+	// rejected unless --valid-from has somewhere else to look
+	event, err = decodeEvent([]byte(`{"id": 1, "__op": "c", "__table": "users", "__source_ts_ms": 1704067200000}`))
+	if err != nil {
+		t.Fatalf("decodeEvent failed: %v", err)
+	}
+	if _, _, err := newLoader(Config{}, nil).prepare(event); err == nil || !strings.Contains(err.Error(), "no ts_ms") {
+		t.Errorf("Expected a row without __ts_ms rejected, got %v", err)
+	}
+	stmt, _, err := newLoader(Config{ValidFrom: []string{"ts_ms", "source.ts_ms"}}, nil).prepare(event)
+	if err != nil || stmt.validFrom != "2024-01-01T00:00:00Z" {
+		t.Errorf("Expected source.ts_ms used instead, got %q, %v", stmt.validFrom, err)
+	}
+}
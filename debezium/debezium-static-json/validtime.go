@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// validTimeGuard keeps a mis-parsed ts_ms from becoming a _valid_from that
+// shadows all current data (epoch millis read as seconds lands in the year
+// 56843) or hides below it (seconds read as millis lands in January 1970).
+type validTimeGuard struct {
+	Min, Max time.Time // zero means 1900-01-01 and now+1d
+	Policy   string    // reject, clamp or warn
+
+	// MaxSkew, when set, clamps any valid time further than this ahead of
+	// the local clock to now, with a warning, whatever the policy: a source
+	// whose clock runs fast shouldn't write documents that only become
+	// visible later
+	MaxSkew time.Duration
+
+	now func() time.Time
+}
+
+var validTimePolicies = map[string]bool{"reject": true, "clamp": true, "warn": true}
+
+var defaultMinValidTime = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// check returns the valid time to write for t, or an error under the reject policy
+func (g validTimeGuard) check(t time.Time) (time.Time, error) {
+	now := time.Now()
+	if g.now != nil {
+		now = g.now()
+	}
+	lo, hi := g.Min, g.Max
+	if lo.IsZero() {
+		lo = defaultMinValidTime
+	}
+	if hi.IsZero() {
+		hi = now.Add(24 * time.Hour)
+	}
+
+	var corrected time.Time
+	var reason string
+	if c, r, ok := unitMistake(t, now); ok {
+		corrected, reason = c, r
+	} else if g.MaxSkew > 0 && t.After(now.Add(g.MaxSkew)) {
+		fmt.Fprintf(stdout, "Warning: valid time %s is more than %s ahead of the local clock, using %s\n",
+			t.Format(time.RFC3339), g.MaxSkew, now.UTC().Format(time.RFC3339))
+		return now.UTC(), nil
+	} else if t.Before(lo) {
+		corrected, reason = lo, "before minimum "+lo.Format(time.RFC3339)
+	} else if t.After(hi) {
+		corrected, reason = hi, "after maximum "+hi.Format(time.RFC3339)
+	} else {
+		return t, nil
+	}
+
+	switch g.Policy {
+	case "clamp":
+		fmt.Fprintf(stdout, "Warning: valid time %s %s, using %s\n",
+			t.Format(time.RFC3339), reason, corrected.Format(time.RFC3339))
+		return corrected, nil
+	case "warn":
+		fmt.Fprintf(stdout, "Warning: valid time %s %s\n", t.Format(time.RFC3339), reason)
+		return t, nil
+	default:
+		return time.Time{}, fmt.Errorf("valid time %s %s", t.Format(time.RFC3339), reason)
+	}
+}
+
+// unitMistake spots timestamps ~1000x away from now, returning the value that
+// was probably intended
+func unitMistake(t, now time.Time) (time.Time, string, bool) {
+	secs, nowSecs := float64(t.Unix()), float64(now.Unix())
+	if nowSecs <= 0 || secs <= 0 {
+		return time.Time{}, "", false
+	}
+
+	ratio := secs / nowSecs
+	switch {
+	case ratio > 500 && ratio < 2000:
+		return time.UnixMilli(t.Unix()).UTC(), "looks like epoch milliseconds read as seconds", true
+	case ratio > 1.0/2000 && ratio < 1.0/500:
+		return time.Unix(t.UnixMilli(), 0).UTC(), "looks like epoch seconds read as milliseconds", true
+	}
+	return time.Time{}, "", false
+}
+
+// parseBound reads a --valid-from-min/max flag value; empty means the default
+func parseBound(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// validFromSources are the --valid-from choices
+var validFromSources = map[string]bool{"ts_ms": true, "source.ts_ms": true, "none": true}
+
+// parseValidFrom reads --valid-from: sources to take _valid_from from,
+// comma-separated in order of preference
+func parseValidFrom(s string) ([]string, error) {
+	var sources []string
+	for _, source := range strings.Split(s, ",") {
+		source = strings.TrimSpace(source)
+		if !validFromSources[source] {
+			return nil, fmt.Errorf("expected ts_ms, source.ts_ms or none, got %q", source)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// validFromSource picks event's valid time, in epoch millis, from the first
+// of sources it has, and says which it used. ts_ms is there unless an
+// unwrapped row left out __ts_ms; source.ts_ms is missing from some
+// connectors' events. It returns false for none, leaving the valid time to
+// XTDB, and an error if the event has none of sources.
+func validFromSource(event DebeziumEvent, sources []string) (string, int64, bool, error) {
+	if len(sources) == 0 {
+		sources = []string{"ts_ms"}
+	}
+	for _, source := range sources {
+		switch source {
+		case "ts_ms":
+			if !event.noTsMs {
+				return source, event.Payload.TsMs, true, nil
+			}
+		case "source.ts_ms":
+			if event.Payload.Source.TsMs != 0 {
+				return source, event.Payload.Source.TsMs, true, nil
+			}
+		case "none":
+			return source, 0, false, nil
+		}
+	}
+	return "", 0, false, fmt.Errorf("event has no %s for _valid_from", strings.Join(sources, " or "))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidTimeGuard(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fixed := func() time.Time { return now }
+	intended := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	millisAsSeconds := time.Unix(intended.UnixMilli(), 0)
+	secondsAsMillis := time.UnixMilli(intended.Unix())
+	future := now.Add(72 * time.Hour)
+
+	reject := validTimeGuard{Policy: "reject", now: fixed}
+	for _, bad := range []time.Time{millisAsSeconds, secondsAsMillis, future} {
+		if _, err := reject.check(bad); err == nil {
+			t.Errorf("reject: expected %v to be rejected", bad)
+		}
+	}
+	if got, err := reject.check(intended); err != nil || !got.Equal(intended) {
+		t.Errorf("reject: in-range value changed to %v, %v", got, err)
+	}
+
+	clamp := validTimeGuard{Policy: "clamp", now: fixed}
+	if got, _ := clamp.check(millisAsSeconds); !got.Equal(intended) {
+		t.Errorf("clamp: expected millis-as-seconds rescaled to %v, got %v", intended, got)
+	}
+	if got, _ := clamp.check(secondsAsMillis); !got.Equal(intended) {
+		t.Errorf("clamp: expected seconds-as-millis rescaled to %v, got %v", intended, got)
+	}
+	if got, _ := clamp.check(future); !got.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("clamp: expected future value clamped to now+1d, got %v", got)
+	}
+
+	warn := validTimeGuard{Policy: "warn", now: fixed}
+	if got, err := warn.check(future); err != nil || !got.Equal(future) {
+		t.Errorf("warn: expected value kept, got %v, %v", got, err)
+	}
+}
+
+func TestParseConfigValidTime(t *testing.T) {
+	cfg, err := parseConfig([]string{"--valid-time-policy", "clamp", "--valid-from-max", "2030-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if cfg.ValidTime.Policy != "clamp" || cfg.ValidTime.Max.Year() != 2030 {
+		t.Errorf("Unexpected guard config: %+v", cfg.ValidTime)
+	}
+
+	if _, err := parseConfig([]string{"--valid-time-policy", "ignore"}); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestValidTimeGuardClockSkew(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	guard := validTimeGuard{Policy: "reject", MaxSkew: 5 * time.Minute, now: func() time.Time { return now }}
+
+	if got, err := guard.check(now.Add(4 * time.Minute)); err != nil || !got.Equal(now.Add(4*time.Minute)) {
+		t.Errorf("Expected a value within the skew kept, got %v, %v", got, err)
+	}
+	// Clamped rather than rejected, even under the reject policy
+	if got, err := guard.check(now.Add(time.Hour)); err != nil || !got.Equal(now) {
+		t.Errorf("Expected a value past the skew clamped to now, got %v, %v", got, err)
+	}
+	// Unit mistakes are still the policy's to handle
+	if _, err := guard.check(time.Unix(now.UnixMilli(), 0)); err == nil {
+		t.Error("Expected a unit mistake still rejected")
+	}
+}
+
+func TestValidFromSource(t *testing.T) {
+	sourceTs := int64(1704067200000)
+	event := newEvent("u", "users", sourceTs+90_000, map[string]any{"id": 1, "name": "a"}, map[string]any{"id": 1, "name": "b"})
+	event.Payload.Source.TsMs = sourceTs
+	noSourceTs := newEvent("c", "users", sourceTs+90_000, nil, map[string]any{"id": 1})
+
+	cases := []struct {
+		flag   string
+		event  DebeziumEvent
+		source string
+		ms     int64
+		ok     bool
+	}{
+		{"ts_ms", event, "ts_ms", sourceTs + 90_000, true},
+		{"source.ts_ms", event, "source.ts_ms", sourceTs, true},
+		{"source.ts_ms,ts_ms", noSourceTs, "ts_ms", sourceTs + 90_000, true},
+		{"source.ts_ms,none", noSourceTs, "none", 0, false},
+		{"none", event, "none", 0, false},
+	}
+	for _, c := range cases {
+		sources, err := parseValidFrom(c.flag)
+		if err != nil {
+			t.Fatalf("%s: %v", c.flag, err)
+		}
+		source, ms, ok, err := validFromSource(c.event, sources)
+		if err != nil || source != c.source || ms != c.ms || ok != c.ok {
+			t.Errorf("%s: got %s %d %v, %v", c.flag, source, ms, ok, err)
+		}
+	}
+
+	if _, _, _, err := validFromSource(noSourceTs, []string{"source.ts_ms"}); err == nil {
+		t.Error("Expected an event without source.ts_ms rejected with no fallback")
+	}
+	if _, err := parseValidFrom("commit_ts"); err == nil {
+		t.Error("Expected an unknown source rejected")
+	}
+}
+
+func TestValidFromNoneStatements(t *testing.T) {
+	l := newLoader(Config{UpdateMode: "patch", ValidFrom: []string{"none"}}, nil)
+	ts := int64(1704067200000)
+	before, after := map[string]any{"id": 1, "name": "a"}, map[string]any{"id": 1, "name": "b"}
+
+	want := map[string]string{
+		"c": "INSERT INTO users RECORDS $1",
+		"u": "PATCH INTO users RECORDS $1",
+		"d": "DELETE FROM users WHERE _id = $1",
+	}
+	for _, op := range []string{"c", "u", "d"} {
+		event := newEvent(op, "users", ts, before, after)
+		if op == "c" {
+			event.Payload.Before = nil
+		}
+		stmt, ok, err := l.prepare(event)
+		if err != nil || !ok {
+			t.Fatalf("%s: prepare failed: %v", op, err)
+		}
+		if stmt.sql != want[op] || strings.Contains(string(stmt.params[0]), "_valid_from") {
+			t.Errorf("%s: expected %q with no _valid_from, got %q %s", op, want[op], stmt.sql, stmt.params[0])
+		}
+	}
+}
+
+func TestValidFromIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	commitTs := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	processedTs := commitTs.Add(90 * time.Second)
+	start := time.Now()
+
+	for _, c := range []struct {
+		flag string
+		want func(time.Time) bool
+	}{
+		{"ts_ms", processedTs.Equal},
+		{"source.ts_ms", commitTs.Equal},
+		{"none", func(vf time.Time) bool { return !vf.Before(start.Add(-time.Minute)) }},
+	} {
+		table := getCleanTable()
+		event := newEvent("c", table, processedTs.UnixMilli(), nil, map[string]any{"id": 1, "name": "a"})
+		event.Payload.Source.TsMs = commitTs.UnixMilli()
+
+		cfg, err := parseConfig([]string{"--valid-from", c.flag})
+		if err != nil {
+			t.Fatalf("%s: %v", c.flag, err)
+		}
+		if err := newLoader(cfg, conn).apply(ctx, event); err != nil {
+			t.Fatalf("%s: apply failed: %v", c.flag, err)
+		}
+
+		var validFrom time.Time
+		err = conn.QueryRow(ctx, fmt.Sprintf("SELECT _valid_from FROM %s FOR ALL VALID_TIME WHERE _id = 1", table)).Scan(&validFrom)
+		if err != nil {
+			t.Fatalf("%s: query failed: %v", c.flag, err)
+		}
+		if !c.want(validFrom) {
+			t.Errorf("%s: unexpected _valid_from %v", c.flag, validFrom)
+		}
+	}
+}
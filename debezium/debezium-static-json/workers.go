@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// workerQueue is how many events may wait for each worker before reading
+// the source blocks
+const workerQueue = 256
+
+// runWorkers is runSource for --workers > 1. Events are still read and
+// prepared in order here, then handed to one of N workers, each writing
+// with a connection of its own. Every event for a given (table, _id) goes to
+// the same worker, so an entity's changes land in the order they were made;
+// different entities are written in parallel. Each worker writes whatever
+// is waiting for it, up to --batch-size events, as one transaction.
+//
+// Source transactions aren't kept whole, as events from one may go to
+// different workers. The source is committed up to the last event before
+// which everything has been written, so a crash replays nothing unwritten.
+// If a worker fails the rest stop taking new events, and the error is
+// returned once they have finished the batch in hand.
+func runWorkers(ctx context.Context, src EventSource, l *loader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failOnce sync.Once
+	var failed error
+	fail := func(err error) {
+		failOnce.Do(func() { failed = err })
+		cancel()
+	}
+
+	workers := make([]*loader, l.cfg.Workers)
+	queues := make([]chan batchEntry, len(workers))
+	for i := range workers {
+		var conn *pgx.Conn
+		if l.connect != nil {
+			var err error
+			if conn, err = l.connect(ctx); err != nil {
+				for _, w := range workers[:i] {
+					w.conn.Close(context.Background())
+				}
+				return fmt.Errorf("connecting worker %d: %w", i, err)
+			}
+		}
+		workers[i] = l.fork(conn)
+		queues[i] = make(chan batchEntry, workerQueue)
+	}
+
+	// Workers report the offsets they've written; the source is committed
+	// up to the first offset not yet written
+	done := make(chan []int64, len(workers))
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func(w *loader, queue chan batchEntry) {
+			defer wg.Done()
+			w.work(ctx, queue, done, fail)
+		}(w, queues[i])
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	written := map[int64]bool{}
+	next := int64(0) // the first offset not yet written
+	commit := func(offsets []int64) {
+		for _, offset := range offsets {
+			written[offset] = true
+		}
+		start := next
+		for written[next] {
+			delete(written, next)
+			next++
+		}
+		if next > start {
+			// Don't abandon a commit half-way through when asked to stop
+			if err := src.Commit(context.WithoutCancel(ctx), next-1); err != nil {
+				fail(&eventError{next - 1, fmt.Errorf("committing: %w", err)})
+			}
+		}
+	}
+
+	readErr := func() error {
+		for offset := int64(0); ; offset++ {
+			event, ok, err := src.Next(ctx)
+			var de *decodeError
+			if errors.As(err, &de) && l.dead != nil {
+				l.current = offset
+				l.events++
+				if err := l.reject(offset, nil, de.message, de.err); err != nil {
+					return err
+				}
+				commit([]int64{offset})
+				continue
+			}
+			if err != nil {
+				return &eventError{offset, err}
+			}
+			if !ok {
+				return nil
+			}
+			l.current = offset
+			l.events++
+
+			stmt, write, err := l.prepare(event)
+			if err != nil {
+				if err := l.reject(offset, &event, nil, err); err != nil {
+					return err
+				}
+			}
+			for drained := false; !drained; {
+				select {
+				case offsets := <-done:
+					commit(offsets)
+				default:
+					drained = true
+				}
+			}
+			if !write {
+				commit([]int64{offset})
+				continue
+			}
+
+			queue := queues[workerFor(stmt, len(workers))]
+			for sent := false; !sent; {
+				select {
+				case queue <- batchEntry{offset: offset, stmt: stmt, write: true, event: event}:
+					sent = true
+				case offsets := <-done:
+					commit(offsets)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}()
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	for offsets := range done {
+		commit(offsets)
+	}
+
+	for _, w := range workers {
+		l.merge(w)
+		if w.conn != nil {
+			w.conn.Close(context.Background())
+		}
+	}
+	if failed != nil {
+		return failed
+	}
+	return readErr
+}
+
+// workerFor picks the worker for a statement by hashing its table and _id
+func workerFor(stmt statement, workers int) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%v", stmt.table, stmt.id)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// work writes the events queued for a worker, each time taking whatever is
+// waiting (up to --batch-size) as one batch, until the queue is closed. Once
+// ctx is cancelled the rest of the queue is dropped unwritten.
+func (l *loader) work(ctx context.Context, queue <-chan batchEntry, done chan<- []int64, fail func(error)) {
+	for entry := range queue {
+		if ctx.Err() != nil {
+			continue
+		}
+		batch := []batchEntry{entry}
+	fill:
+		for len(batch) < l.cfg.BatchSize {
+			select {
+			case e, ok := <-queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+
+		if err := l.writeBatch(context.WithoutCancel(ctx), batch); err != nil {
+			fail(err)
+			continue
+		}
+		offsets := make([]int64, len(batch))
+		for i, e := range batch {
+			offsets[i] = e.offset
+		}
+		done <- offsets
+	}
+}
+
+// fork makes a loader for a worker, writing with conn. Its counts are its
+// own, so workers never share a map, and are added to l's with merge once
+// the worker has stopped. Without a connection (in tests) it writes with
+// l's sendBatch and versionExists, which must then be safe for concurrent use.
+func (l *loader) fork(conn *pgx.Conn) *loader {
+	w := newLoader(l.cfg, conn)
+	w.latency = l.latency
+	w.dead = l.dead
+	if conn == nil {
+		w.sendBatch = l.sendBatch
+		w.versionExists = l.versionExists
+	}
+	return w
+}
+
+// merge adds a stopped worker's counts to l's
+func (l *loader) merge(w *loader) {
+	for k, n := range w.stats {
+		l.stats[k] += n
+	}
+	for table, counts := range w.tableCounts {
+		total := l.tableCounts[table]
+		if total == nil {
+			total = &tableCounts{}
+			l.tableCounts[table] = total
+		}
+		total.Inserts += counts.Inserts
+		total.Updates += counts.Updates
+		total.Deletes += counts.Deletes
+	}
+}
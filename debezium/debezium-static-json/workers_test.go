@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// writeGeneratedEvents writes n random creates, updates and deletes over
+// 500 ids in each of tables to a JSON array file, as a snapshot and the
+// changes after it would look
+func writeGeneratedEvents(t testing.TB, n int, tables ...string) string {
+	rng := rand.New(rand.NewSource(42))
+	live := map[string]map[int]int{}
+	for _, table := range tables {
+		live[table] = map[int]int{}
+	}
+
+	ts := int64(1704067200000)
+	events := make([]DebeziumEvent, n)
+	for i := range events {
+		table := tables[rng.Intn(len(tables))]
+		id := rng.Intn(500)
+		version, exists := live[table][id]
+		row := func(v int) map[string]any { return map[string]any{"id": id, "version": v} }
+		switch {
+		case !exists:
+			events[i] = newEvent("r", table, ts+int64(i), nil, row(0))
+			live[table][id] = 0
+		case rng.Intn(10) < 7:
+			events[i] = newEvent("u", table, ts+int64(i), row(version), row(version+1))
+			live[table][id] = version + 1
+		default:
+			events[i] = newEvent("d", table, ts+int64(i), row(version), nil)
+			delete(live[table], id)
+		}
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// memStore applies statements to an in-memory table of documents by _id, as
+// XTDB would for the current time, failing the statement at failAt
+type memStore struct {
+	mu     sync.Mutex
+	docs   map[string]string // table/_id -> record JSON
+	sent   int
+	failAt int
+}
+
+func newMemStore(l *loader, failAt int) *memStore {
+	s := &memStore{docs: map[string]string{}, failAt: failAt}
+	l.sendBatch = func(ctx context.Context, stmts []statement) ([]pgconn.CommandTag, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failAt >= s.sent && s.failAt < s.sent+len(stmts) {
+			return nil, &batchError{index: s.failAt - s.sent, err: errors.New("boom")}
+		}
+		s.sent += len(stmts)
+		tags := make([]pgconn.CommandTag, len(stmts))
+		for i, stmt := range stmts {
+			key := fmt.Sprintf("%s/%v", stmt.table, stmt.id)
+			if stmt.kind == "delete" {
+				delete(s.docs, key)
+			} else {
+				s.docs[key] = string(stmt.params[0])
+			}
+			tags[i] = pgconn.NewCommandTag(strings.ToUpper(stmt.kind) + " 0 1")
+		}
+		return tags, nil
+	}
+	return s
+}
+
+func TestWorkersMatchSequential(t *testing.T) {
+	path := writeGeneratedEvents(t, 10000, "users", "orders")
+
+	run := func(workers int) (*loader, *memStore) {
+		src, err := newFileSource(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		l := newLoader(Config{BatchSize: 50, Workers: workers}, nil)
+		store := newMemStore(l, -1)
+		if err := runSource(context.Background(), src, l); err != nil {
+			t.Fatalf("%d workers: runSource failed: %v", workers, err)
+		}
+		return l, store
+	}
+
+	sequential, want := run(1)
+	parallel, got := run(4)
+	if len(got.docs) == 0 || !reflect.DeepEqual(got.docs, want.docs) {
+		t.Errorf("Expected the same %d documents as a sequential run, got %d", len(want.docs), len(got.docs))
+	}
+	for _, kind := range []string{"inserts", "updates", "deletes", "rows_affected"} {
+		if parallel.stats[kind] != sequential.stats[kind] {
+			t.Errorf("%s: expected %d, got %d", kind, sequential.stats[kind], parallel.stats[kind])
+		}
+	}
+	if !reflect.DeepEqual(parallel.tableCounts, sequential.tableCounts) {
+		t.Errorf("Expected per-table counts %v, got %v", sequential.tableCounts, parallel.tableCounts)
+	}
+}
+
+func TestWorkersCommitWrittenPrefix(t *testing.T) {
+	src := &mockSource{events: batchEvents()}
+	l := newLoader(Config{BatchSize: 1, Workers: 3}, nil)
+	newMemStore(l, -1)
+	if err := runSource(context.Background(), src, l); err != nil {
+		t.Fatalf("runSource failed: %v", err)
+	}
+	// Commits only ever move forward, ending at the last event
+	for i := 1; i < len(src.committed); i++ {
+		if src.committed[i] <= src.committed[i-1] {
+			t.Fatalf("Expected increasing commits, got %v", src.committed)
+		}
+	}
+	if last := src.committed[len(src.committed)-1]; last != int64(len(src.events)-1) {
+		t.Errorf("Expected event %d committed last, got %v", len(src.events)-1, src.committed)
+	}
+}
+
+func TestWorkersStopOnError(t *testing.T) {
+	path := writeGeneratedEvents(t, 5000, "users")
+	src, err := newFileSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	l := newLoader(Config{BatchSize: 10, Workers: 4}, nil)
+	newMemStore(l, 1000)
+	err = runSource(context.Background(), src, l)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Expected the worker's failure returned, got %v", err)
+	}
+	var ee *eventError
+	if !errors.As(err, &ee) {
+		t.Errorf("Expected the failed event named, got %v", err)
+	}
+	if l.events >= 5000 {
+		t.Errorf("Expected reading to stop early, read all %d events", l.events)
+	}
+}
+
+func TestParseConfigWorkers(t *testing.T) {
+	cfg, err := parseConfig([]string{"--workers", "8"})
+	if err != nil || cfg.Workers != 8 {
+		t.Errorf("Expected 8 workers, got %d, %v", cfg.Workers, err)
+	}
+	if _, err := parseConfig([]string{"--workers", "0"}); err == nil {
+		t.Error("Expected --workers 0 to be rejected")
+	}
+}
+
+func TestWorkersIngestion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	seqUsers, seqOrders, parUsers, parOrders := getCleanTable(), getCleanTable(), getCleanTable(), getCleanTable()
+	load := func(workers int, users, orders string) {
+		// The same events, by their table's position
+		path := writeGeneratedEvents(t, 2000, users, orders)
+		src, err := newFileSource(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		l := newLoader(Config{BatchSize: 20, Workers: workers}, conn)
+		l.connect = func(ctx context.Context) (*pgx.Conn, error) { return pgx.Connect(ctx, connString()) }
+		if err := runSource(ctx, src, l); err != nil {
+			t.Fatalf("%d workers: runSource failed: %v", workers, err)
+		}
+	}
+	load(1, seqUsers, seqOrders)
+	load(4, parUsers, parOrders)
+
+	count := func(table string) int {
+		var n int
+		if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&n); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return n
+	}
+	for _, pair := range [][2]string{{seqUsers, parUsers}, {seqOrders, parOrders}} {
+		if want, got := count(pair[0]), count(pair[1]); want == 0 || got != want {
+			t.Errorf("Expected %d rows as in the sequential run, got %d", want, got)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/apache/arrow-adbc/go/adbc"
 	"github.com/apache/arrow-adbc/go/adbc/driver/flightsql"
 	"github.com/apache/arrow/go/v17/arrow/memory"
+
+	"github.com/xtdb/driver-examples/go/fixtures"
 )
 
 func getFlightSqlURI() string {
@@ -175,13 +177,8 @@ func TestAdbcInsertAndQuery(t *testing.T) {
 		t.Fatalf("Failed to create statement: %v", err)
 	}
 
-	stmt.SetSqlQuery(fmt.Sprintf(
-		"INSERT INTO %s RECORDS "+
-			"{_id: 1, name: 'Widget', price: 19.99, category: 'gadgets'}, "+
-			"{_id: 2, name: 'Gizmo', price: 29.99, category: 'gadgets'}, "+
-			"{_id: 3, name: 'Thingamajig', price: 9.99, category: 'misc'}",
-		table,
-	))
+	products := fixtures.Products()
+	stmt.SetSqlQuery(fixtures.ProductsInsertSQL(table))
 	_, err = stmt.ExecuteUpdate(ctx)
 	stmt.Close()
 	if err != nil {
@@ -208,12 +205,14 @@ func TestAdbcInsertAndQuery(t *testing.T) {
 	}
 
 	record := reader.Record()
-	if record.NumRows() != 3 {
-		t.Errorf("Expected 3 rows, got %d", record.NumRows())
+	if record.NumRows() != int64(len(products)) {
+		t.Errorf("Expected %d rows, got %d", len(products), record.NumRows())
 	}
 
 	// Cleanup
-	cleanupAdbc(conn, table, 1, 2, 3)
+	for _, p := range products {
+		cleanupAdbc(conn, table, int(p.ID))
+	}
 }
 
 func TestAdbcUpdate(t *testing.T) {
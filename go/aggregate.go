@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AggStats profiles one column. Min, Max and Avg are only meaningful when
+// Count is non-zero.
+type AggStats struct {
+	Count    int64 // non-null values
+	Distinct int64
+	Min      float64
+	Max      float64
+	Avg      float64
+}
+
+// Aggregate computes count, min, max, avg and distinct-count for a numeric
+// column in a single query
+func Aggregate(ctx context.Context, conn *pgx.Conn, table, column string) (AggStats, error) {
+	var stats AggStats
+	if err := checkTable(table); err != nil {
+		return stats, err
+	}
+	if !identifierPattern.MatchString(column) {
+		return stats, fmt.Errorf("invalid column name %q", column)
+	}
+
+	sql := fmt.Sprintf("SELECT COUNT(%[1]s), COUNT(DISTINCT %[1]s), MIN(%[1]s), MAX(%[1]s), AVG(%[1]s) FROM %[2]s",
+		column, table)
+	values := make([]any, 5)
+	ptrs := make([]any, len(values))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := conn.QueryRow(ctx, tagSQL(ctx, sql)).Scan(ptrs...); err != nil {
+		return stats, fmt.Errorf("aggregating %s.%s: %w", table, column, err)
+	}
+
+	// XTDB types aggregates after the column (ints stay ints, AVG may be
+	// numeric), so coerce whatever comes back
+	for i, v := range values {
+		if v == nil {
+			continue // NULL: no non-null values to aggregate
+		}
+		f, err := toFloat64(v)
+		if err != nil {
+			return stats, fmt.Errorf("aggregating %s.%s: %w", table, column, err)
+		}
+		switch i {
+		case 0:
+			stats.Count = int64(f)
+		case 1:
+			stats.Distinct = int64(f)
+		case 2:
+			stats.Min = f
+		case 3:
+			stats.Max = f
+		case 4:
+			stats.Avg = f
+		}
+	}
+	return stats, nil
+}
+
+// toFloat64 coerces a numeric result value to float64
+func toFloat64(v any) (float64, error) {
+	switch n := v.(type) {
+	case int16:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case pgtype.Numeric:
+		f, err := n.Float64Value()
+		if err != nil {
+			return 0, err
+		}
+		return f.Float64, nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	default:
+		return 0, fmt.Errorf("non-numeric value %v (%T)", v, v)
+	}
+}
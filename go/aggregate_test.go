@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s RECORDS
+		{_id: 1, price: 10}, {_id: 2, price: 20}, {_id: 3, price: 20},
+		{_id: 4, price: 50}, {_id: 5, name: 'no price'}`, table))
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	stats, err := Aggregate(ctx, conn, table, "price")
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+
+	expected := AggStats{Count: 4, Distinct: 3, Min: 10, Max: 50, Avg: 25}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+
+	if _, err := Aggregate(ctx, conn, table, "price; DROP"); err == nil {
+		t.Error("Expected invalid column name to be rejected")
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+	for _, v := range []any{int32(3), int64(3), float32(3), 3.0, "3"} {
+		if f, err := toFloat64(v); err != nil || f != 3 {
+			t.Errorf("%T: expected 3, got %v, %v", v, f, err)
+		}
+	}
+	if _, err := toFloat64(true); err == nil {
+		t.Error("Expected bool to be rejected")
+	}
+}
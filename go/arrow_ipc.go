@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// arrowBatchSize is the number of rows per record batch in the IPC stream
+const arrowBatchSize = 1024
+
+// QueryToArrowIPC runs sql over pgx and writes the result to w as an Arrow
+// IPC stream, for handing results to Arrow tooling without going through
+// ADBC. The schema is inferred from the result's column OIDs: UUIDs are
+// written as their canonical strings, numerics as float64 and nested
+// values as JSON text. A value with no Arrow mapping is an error.
+func QueryToArrowIPC(ctx context.Context, conn *pgx.Conn, sql string, w io.Writer, args ...any) error {
+	rows, err := conn.Query(ctx, tagSQL(ctx, sql), args...)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	schema := arrowSchemaFor(rows.FieldDescriptions())
+	mem := memory.NewGoAllocator()
+
+	writer := ipc.NewWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(mem))
+	builder := array.NewRecordBuilder(mem, schema)
+	defer builder.Release()
+
+	flush := func() error {
+		record := builder.NewRecord()
+		defer record.Release()
+		return writer.Write(record)
+	}
+
+	pending := 0
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return fmt.Errorf("reading row: %w", err)
+		}
+		for i, v := range values {
+			if err := appendArrowValue(builder.Field(i), v); err != nil {
+				return fmt.Errorf("column %s: %w", schema.Field(i).Name, err)
+			}
+		}
+		pending++
+
+		if pending == arrowBatchSize {
+			if err := flush(); err != nil {
+				return fmt.Errorf("writing batch: %w", err)
+			}
+			pending = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+
+	if pending > 0 {
+		if err := flush(); err != nil {
+			return fmt.Errorf("writing batch: %w", err)
+		}
+	}
+
+	return writer.Close()
+}
+
+// arrowSchemaFor maps PostgreSQL column OIDs onto Arrow types
+func arrowSchemaFor(fieldDescs []pgconn.FieldDescription) *arrow.Schema {
+	fields := make([]arrow.Field, len(fieldDescs))
+	for i, fd := range fieldDescs {
+		fields[i] = arrow.Field{Name: fd.Name, Type: arrowTypeFor(fd.DataTypeOID), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func arrowTypeFor(oid uint32) arrow.DataType {
+	switch oid {
+	case pgtype.BoolOID:
+		return arrow.FixedWidthTypes.Boolean
+	case pgtype.Int2OID:
+		return arrow.PrimitiveTypes.Int16
+	case pgtype.Int4OID:
+		return arrow.PrimitiveTypes.Int32
+	case pgtype.Int8OID:
+		return arrow.PrimitiveTypes.Int64
+	case pgtype.Float4OID:
+		return arrow.PrimitiveTypes.Float32
+	case pgtype.Float8OID, pgtype.NumericOID:
+		return arrow.PrimitiveTypes.Float64
+	case pgtype.DateOID:
+		return arrow.FixedWidthTypes.Date32
+	case pgtype.TimestampOID:
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	case pgtype.TimestamptzOID:
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	default:
+		// text, JSON, transit and anything else we don't model natively
+		return arrow.BinaryTypes.String
+	}
+}
+
+func appendArrowValue(b array.Builder, value interface{}) error {
+	if value == nil {
+		b.AppendNull()
+		return nil
+	}
+
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %T", value)
+		}
+		b.Append(v)
+	case *array.Int16Builder:
+		v, ok := value.(int16)
+		if !ok {
+			return fmt.Errorf("expected int16, got %T", value)
+		}
+		b.Append(v)
+	case *array.Int32Builder:
+		v, ok := value.(int32)
+		if !ok {
+			return fmt.Errorf("expected int32, got %T", value)
+		}
+		b.Append(v)
+	case *array.Int64Builder:
+		v, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected int64, got %T", value)
+		}
+		b.Append(v)
+	case *array.Float32Builder:
+		v, ok := value.(float32)
+		if !ok {
+			return fmt.Errorf("expected float32, got %T", value)
+		}
+		b.Append(v)
+	case *array.Float64Builder:
+		switch v := value.(type) {
+		case float64:
+			b.Append(v)
+		case pgtype.Numeric:
+			f, err := v.Float64Value()
+			if err != nil {
+				return fmt.Errorf("converting numeric: %w", err)
+			}
+			if !f.Valid {
+				b.AppendNull()
+			} else {
+				b.Append(f.Float64)
+			}
+		default:
+			return fmt.Errorf("expected float64 or numeric, got %T", value)
+		}
+	case *array.Date32Builder:
+		v, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("expected time.Time, got %T", value)
+		}
+		b.Append(arrow.Date32FromTime(v))
+	case *array.TimestampBuilder:
+		v, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("expected time.Time, got %T", value)
+		}
+		b.Append(arrow.Timestamp(v.UnixMicro()))
+	case *array.StringBuilder:
+		switch v := value.(type) {
+		case string:
+			b.Append(v)
+		case [16]byte:
+			b.Append(uuid.UUID(v).String())
+		case map[string]interface{}, []interface{}, float64, bool:
+			// JSON, nested or scalar
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			b.Append(string(data))
+		default:
+			return fmt.Errorf("no Arrow mapping for %T", value)
+		}
+	default:
+		return fmt.Errorf("unsupported builder %T", b)
+	}
+	return nil
+}
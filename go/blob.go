@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// InsertBlob inserts {_id: id, <field>: <bytes of r>} into table, sending the
+// bytes as a transit-JSON ~b value. r is base64-encoded straight into the
+// parameter buffer, so the raw blob is never held in memory alongside its
+// encoding.
+func InsertBlob(ctx context.Context, conn *pgx.Conn, table string, id any, field string, r io.Reader) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	if !identifierPattern.MatchString(field) {
+		return fmt.Errorf("invalid field name %q", field)
+	}
+	switch id.(type) {
+	case string, int, int32, int64, float64, uuid.UUID, xtdb.Keyword:
+	default:
+		return fmt.Errorf("unsupported id type %T", id)
+	}
+
+	var encoder xtdb.Encoder
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `["^ ","~:_id",%s,%s,"~b`, encoder.EncodeValue(id), encoder.EncodeValue(xtdb.Keyword(field)))
+	enc := base64.NewEncoder(base64.StdEncoding, &buf)
+	if _, err := io.Copy(enc, r); err != nil {
+		return fmt.Errorf("reading blob: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("encoding blob: %w", err)
+	}
+	buf.WriteString(`"]`)
+
+	sql := tagSQL(ctx, fmt.Sprintf("INSERT INTO %s RECORDS $1", table))
+	_, err := traceExec(ctx, conn, sql, []any{buf.Bytes()}, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return conn.PgConn().ExecParams(ctx, sql,
+			[][]byte{buf.Bytes()}, // parameter values
+			[]uint32{TransitOID},  // parameter OIDs - OID 16384
+			[]int16{0},            // parameter formats (0 = text)
+			[]int16{0}).Close()    // result formats (0 = text)
+	})
+	if err != nil {
+		return fmt.Errorf("inserting blob %v into %s: %w", id, table, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestInsertBlobRejectsBadInput(t *testing.T) {
+	// Rejected before anything is sent, so no server is needed
+	ctx := context.Background()
+	if err := InsertBlob(ctx, nil, "blobs", true, "data", bytes.NewReader(nil)); err == nil {
+		t.Error("Expected a bool id to be rejected")
+	}
+	if err := InsertBlob(ctx, nil, "blobs", "a", "bad field", bytes.NewReader(nil)); err == nil {
+		t.Error("Expected an invalid field name to be rejected")
+	}
+}
+
+func TestInsertBlob(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	blob := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(blob)
+
+	if err := InsertBlob(ctx, conn, table, "image-1", "data", bytes.NewReader(blob)); err != nil {
+		t.Fatalf("InsertBlob failed: %v", err)
+	}
+
+	var got []byte
+	err := conn.QueryRow(ctx, fmt.Sprintf("SELECT data FROM %s WHERE _id = 'image-1'", table)).Scan(&got)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !bytes.Equal(got, blob) {
+		t.Errorf("Blob differs: got %d bytes, expected %d", len(got), len(blob))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrInsufficientTime is wrapped by every *InsufficientTimeError
+var ErrInsufficientTime = errors.New("insufficient time left before deadline")
+
+// InsufficientTimeError reports how far a multi-statement helper got before
+// its context's deadline ran out
+type InsufficientTimeError struct {
+	// Completed statements succeeded, out of Planned
+	Completed, Planned int
+	// Remaining is the time that was left before the deadline, against a
+	// per-statement floor of Floor
+	Remaining, Floor time.Duration
+	// Err is the statement's own error when the deadline cut it off part
+	// way through, nil when the helper stopped before sending it. pgx
+	// closes a connection whose query is cut off, so when Err is set the
+	// connection can't be used again.
+	Err error
+}
+
+func (e *InsufficientTimeError) Error() string {
+	msg := fmt.Sprintf("%d of %d statements completed with %s left (floor %s per statement)",
+		e.Completed, e.Planned, e.Remaining.Round(time.Millisecond), e.Floor)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *InsufficientTimeError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrInsufficientTime}
+	}
+	return []error{ErrInsufficientTime, e.Err}
+}
+
+// WithStatementFloor budgets the context's deadline across InsertRecords'
+// statements: before each one it checks the time left, and once less than d
+// is left it stops with an *InsufficientTimeError saying how many records
+// were written, rather than sending a statement with no chance of finishing.
+// Statements run under the caller's context as they are. pgx closes the
+// connection when a context cuts off a query, so shortening each
+// statement's deadline would risk the caller's connection for the sake of
+// the budget; with d at least as long as a statement takes, the deadline
+// is never reached mid-statement. Without a deadline on the context it
+// does nothing.
+func WithStatementFloor(d time.Duration) InsertOption {
+	return func(c *insertConfig) { c.statementFloor = d }
+}
+
+// deadlineBudget checks a context's deadline between planned statements
+type deadlineBudget struct {
+	floor     time.Duration
+	planned   int
+	completed int
+	now       func() time.Time
+}
+
+func newDeadlineBudget(floor time.Duration, planned int) *deadlineBudget {
+	return &deadlineBudget{floor: floor, planned: planned, now: time.Now}
+}
+
+// check returns an *InsufficientTimeError if less than the floor is left
+// before ctx's deadline
+func (b *deadlineBudget) check(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok || b.floor <= 0 {
+		return nil
+	}
+	if remaining := deadline.Sub(b.now()); remaining < b.floor {
+		return b.exhausted(remaining, nil)
+	}
+	return nil
+}
+
+// done records a statement as completed
+func (b *deadlineBudget) done() { b.completed++ }
+
+// failed turns err into an *InsufficientTimeError if the statement ran out of
+// time before the deadline, leaving other errors alone
+func (b *deadlineBudget) failed(ctx context.Context, err error) error {
+	deadline, ok := ctx.Deadline()
+	if !ok || b.floor <= 0 || !errors.Is(err, context.DeadlineExceeded) && !pgconn.Timeout(err) {
+		return err
+	}
+	return b.exhausted(deadline.Sub(b.now()), err)
+}
+
+func (b *deadlineBudget) exhausted(remaining time.Duration, err error) error {
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &InsufficientTimeError{
+		Completed: b.completed,
+		Planned:   b.planned,
+		Remaining: remaining,
+		Floor:     b.floor,
+		Err:       err,
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeadlineBudget(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Add(100*time.Millisecond))
+	defer cancel()
+
+	b := newDeadlineBudget(20*time.Millisecond, 4)
+	b.now = func() time.Time { return clock }
+
+	if err := b.check(ctx); err != nil {
+		t.Fatalf("Expected 100ms to cover the first statement, got %v", err)
+	}
+	b.done()
+
+	// A slow first statement leaves 30ms, still over the floor
+	clock = clock.Add(70 * time.Millisecond)
+	if err := b.check(ctx); err != nil {
+		t.Fatalf("Expected 30ms to cover the second statement, got %v", err)
+	}
+	b.done()
+
+	clock = clock.Add(15 * time.Millisecond)
+	err := b.check(ctx)
+	var insufficient *InsufficientTimeError
+	if !errors.As(err, &insufficient) || !errors.Is(err, ErrInsufficientTime) {
+		t.Fatalf("Expected an *InsufficientTimeError, got %v", err)
+	}
+	if insufficient.Completed != 2 || insufficient.Planned != 4 || insufficient.Remaining != 15*time.Millisecond || insufficient.Err != nil {
+		t.Errorf("Unexpected progress: %+v", insufficient)
+	}
+
+	// Statement timeouts are reported with the progress; other errors pass through
+	timeout := fmt.Errorf("insert: %w", context.DeadlineExceeded)
+	if err := b.failed(ctx, timeout); !errors.As(err, &insufficient) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the timeout wrapped with progress, got %v", err)
+	}
+	other := errors.New("duplicate key")
+	if err := b.failed(ctx, other); err != other {
+		t.Errorf("Expected other errors unchanged, got %v", err)
+	}
+
+	// Without a deadline there's nothing to budget
+	if err := b.check(context.Background()); err != nil {
+		t.Errorf("Expected no budgeting without a deadline, got %v", err)
+	}
+}
+
+// steppingClock advances by step each time it's read
+func steppingClock(start time.Time, step time.Duration) func() time.Time {
+	now := start.Add(-step)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestInsertRecordsNoTimeToStart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Stops before touching the connection
+	records := []map[string]interface{}{{"_id": 1}, {"_id": 2}}
+	err := InsertRecords(ctx, nil, "users", records, WithStatementFloor(time.Hour))
+	var insufficient *InsufficientTimeError
+	if !errors.As(err, &insufficient) || insufficient.Completed != 0 || insufficient.Planned != 2 || insufficient.Err != nil {
+		t.Fatalf("Expected an *InsufficientTimeError before the first record, got %v", err)
+	}
+}
+
+func TestInsertRecordsStatementFloor(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	records := make([]map[string]interface{}, 10)
+	for i := range records {
+		records[i] = map[string]interface{}{"_id": i, "n": i}
+	}
+
+	// Each statement appears to take 20 minutes of an hour's deadline, so
+	// three fit before less than the 15 minute floor is left
+	start := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(time.Hour))
+	defer cancel()
+	var result InsertResult
+	err := InsertRecords(ctx, conn, table, records, WithStatementFloor(15*time.Minute), WithResult(&result),
+		func(c *insertConfig) { c.clock = steppingClock(start, 20*time.Minute) })
+
+	var insufficient *InsufficientTimeError
+	if !errors.As(err, &insufficient) || !errors.Is(err, ErrInsufficientTime) {
+		t.Fatalf("Expected an *InsufficientTimeError, got %v", err)
+	}
+	if insufficient.Completed != 3 || insufficient.Planned != len(records) || len(result.Tags) != 3 || insufficient.Err != nil {
+		t.Errorf("Expected 3 of %d statements completed, got %+v and %d tags", len(records), insufficient, len(result.Tags))
+	}
+
+	// The connection is still usable, and holds exactly what was reported
+	var count int
+	if err := conn.QueryRow(context.Background(), fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != insufficient.Completed {
+		t.Errorf("Expected %d rows written, got %d", insufficient.Completed, count)
+	}
+}
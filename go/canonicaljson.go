@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// MarshalCanonicalJSON renders a decoded record as plain JSON with the same
+// bytes for the same data, whichever decoder produced it:
+//
+//   - object keys are sorted
+//   - timestamps are RFC3339 in UTC
+//   - string-backed types (transit keywords, symbols) are plain strings
+//   - 16-byte arrays (UUIDs) are canonical 8-4-4-4-12 strings
+//   - sets (maps to struct{}) are arrays, sorted by their elements' JSON
+//   - integers keep every digit, including *big.Int
+func MarshalCanonicalJSON(record map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, reflect.ValueOf(record)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+func writeCanonical(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		return writeJSON(buf, v.Interface().(time.Time).UTC().Format(time.RFC3339Nano))
+	case bigIntType:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteString(v.Interface().(*big.Int).String())
+		return nil
+	}
+	if n, ok := v.Interface().(json.Number); ok {
+		buf.WriteString(n.String())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeCanonical(buf, v.Elem())
+
+	case reflect.String:
+		return writeJSON(buf, v.String())
+	case reflect.Bool:
+		return writeJSON(buf, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(buf, "%d", v.Int())
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprintf(buf, "%d", v.Uint())
+		return nil
+	case reflect.Float32, reflect.Float64:
+		return writeJSON(buf, v.Float())
+
+	case reflect.Array:
+		if v.Len() == 16 && v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, 16)
+			reflect.Copy(reflect.ValueOf(b), v)
+			h := hex.EncodeToString(b)
+			return writeJSON(buf, h[0:8]+"-"+h[8:12]+"-"+h[12:16]+"-"+h[16:20]+"-"+h[20:32])
+		}
+		return writeCanonicalList(buf, v)
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return writeJSON(buf, v.Bytes()) // base64, as encoding/json does
+		}
+		return writeCanonicalList(buf, v)
+
+	case reflect.Map:
+		if v.Type().Elem().Kind() == reflect.Struct && v.Type().Elem().NumField() == 0 {
+			return writeCanonicalSet(buf, v)
+		}
+		return writeCanonicalObject(buf, v)
+
+	case reflect.Struct:
+		// Anything else structured goes through encoding/json, then gets
+		// canonicalised like a decoded map
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var generic interface{}
+		if err := dec.Decode(&generic); err != nil {
+			return err
+		}
+		return writeCanonical(buf, reflect.ValueOf(generic))
+	}
+	return fmt.Errorf("canonical JSON: unsupported type %s", v.Type())
+}
+
+func writeJSON(buf *bytes.Buffer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("canonical JSON: %w", err)
+	}
+	buf.Write(data)
+	return nil
+}
+
+func writeCanonicalList(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeCanonical(buf, v.Index(i)); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeCanonicalObject(buf *bytes.Buffer, v reflect.Value) error {
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		for k.Kind() == reflect.Interface && !k.IsNil() {
+			k = k.Elem()
+		}
+		var name string
+		if k.Kind() == reflect.String {
+			name = k.String()
+		} else {
+			name = fmt.Sprint(k.Interface())
+		}
+		if _, dup := values[name]; dup {
+			return fmt.Errorf("canonical JSON: duplicate key %q", name)
+		}
+		keys = append(keys, name)
+		values[name] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSON(buf, k); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := writeCanonical(buf, values[k]); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func writeCanonicalSet(buf *bytes.Buffer, v reflect.Value) error {
+	members := make([][]byte, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var member bytes.Buffer
+		if err := writeCanonical(&member, iter.Key()); err != nil {
+			return err
+		}
+		members = append(members, member.Bytes())
+	}
+	sort.Slice(members, func(i, j int) bool { return bytes.Compare(members[i], members[j]) < 0 })
+
+	buf.WriteByte('[')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(m)
+	}
+	buf.WriteByte(']')
+	return nil
+}
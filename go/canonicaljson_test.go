@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Stand-ins for the custom types a transit decoder produces
+type testKeyword string
+
+type testUUID [16]byte
+
+func TestMarshalCanonicalJSON(t *testing.T) {
+	london := time.FixedZone("BST", 3600)
+	id := testUUID{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4, 0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00}
+	big, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	record := map[string]interface{}{
+		"_id":     id,
+		"status":  testKeyword("active"),
+		"created": time.Date(2024, 6, 1, 13, 0, 0, 500000000, london),
+		"tags":    map[interface{}]struct{}{"b": {}, "a": {}, testKeyword("c"): {}},
+		"counts":  []interface{}{int64(9007199254740993), 1.5, big},
+		"profile": map[string]interface{}{"z": nil, "a": true},
+		"raw":     []byte("hi"),
+	}
+
+	expected := `{"_id":"550e8400-e29b-41d4-a716-446655440000",` +
+		`"counts":[9007199254740993,1.5,123456789012345678901234567890],` +
+		`"created":"2024-06-01T12:00:00.5Z",` +
+		`"profile":{"a":true,"z":null},` +
+		`"raw":"aGk=",` +
+		`"status":"active",` +
+		`"tags":["a","b","c"]}`
+
+	for i := 0; i < 5; i++ {
+		got, err := MarshalCanonicalJSON(record)
+		if err != nil {
+			t.Fatalf("MarshalCanonicalJSON failed: %v", err)
+		}
+		if string(got) != expected {
+			t.Fatalf("Run %d:\n got %s\nwant %s", i, got, expected)
+		}
+	}
+
+	if _, err := MarshalCanonicalJSON(map[string]interface{}{"ch": make(chan int)}); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ChangeKind says what happened to a record
+type ChangeKind string
+
+const (
+	ChangeInsert ChangeKind = "insert"
+	ChangeUpdate ChangeKind = "update"
+	ChangeDelete ChangeKind = "delete"
+)
+
+// ChangeEvent is one record's change in one transaction
+type ChangeEvent struct {
+	Kind ChangeKind
+	ID   any
+	// Record is the new document; nil for deletes
+	Record map[string]interface{}
+	// At is the system time of the transaction that made the change
+	At time.Time
+}
+
+// PollChanges returns the changes made to table in transactions after since,
+// in system-time order, along with the cursor to pass next time.
+//
+// XTDB never overwrites: a transaction that changes a record closes the
+// _system_to of the version it supersedes, and adds an open-ended version
+// unless it's a delete. Depending on how the server splits the history, it
+// may also add an end-dated copy of the old document. Versions are read
+// both by when they started and when they were superseded, since a delete
+// may leave nothing but a closed _system_to behind.
+func PollChanges(ctx context.Context, conn *pgx.Conn, table string, since time.Time) ([]ChangeEvent, time.Time, error) {
+	if err := checkTable(table); err != nil {
+		return nil, since, err
+	}
+
+	sinceLit := timestampLiteral(since)
+	sql := fmt.Sprintf(`SELECT *, _system_from, _system_to, _valid_to FROM %s
+		FOR ALL SYSTEM_TIME FOR ALL VALID_TIME
+		WHERE _system_from > %s OR _system_to > %s ORDER BY _system_from`, table, sinceLit, sinceLit)
+	rows, err := conn.Query(ctx, tagSQL(ctx, sql))
+	if err != nil {
+		return nil, since, fmt.Errorf("polling %s: %w", table, err)
+	}
+	versions, err := collectMaps(rows)
+	if err != nil {
+		return nil, since, fmt.Errorf("reading changes to %s: %w", table, err)
+	}
+
+	events := classifyChanges(versions, since)
+	if len(events) > 0 {
+		since = events[len(events)-1].At
+	}
+	return events, since, nil
+}
+
+// classifyChanges turns row versions into one event per record per
+// transaction after since, in system-time order. A transaction that adds an
+// open-ended version inserted the record, or updated it if it also
+// superseded a version; one that only supersedes versions deleted it.
+func classifyChanges(versions []map[string]interface{}, since time.Time) []ChangeEvent {
+	type change struct {
+		event         ChangeEvent
+		current, ends bool
+	}
+	var order []string
+	changes := map[string]*change{}
+	changeAt := func(id any, at time.Time) *change {
+		key := fmt.Sprintf("%v@%s", id, at.Format(time.RFC3339Nano))
+		c, ok := changes[key]
+		if !ok {
+			c = &change{event: ChangeEvent{ID: id, At: at}}
+			changes[key] = c
+			order = append(order, key)
+		}
+		return c
+	}
+
+	for _, version := range versions {
+		id := version["_id"]
+		if from, ok := version["_system_from"].(time.Time); ok && from.After(since) {
+			c := changeAt(id, from)
+			if version["_valid_to"] == nil {
+				c.current = true
+				c.event.Record = documentFields(version)
+			} else {
+				c.ends = true
+			}
+		}
+		if to, ok := version["_system_to"].(time.Time); ok && to.After(since) {
+			changeAt(id, to).ends = true
+		}
+	}
+
+	events := make([]ChangeEvent, 0, len(order))
+	for _, key := range order {
+		c := changes[key]
+		switch {
+		case c.current && c.ends:
+			c.event.Kind = ChangeUpdate
+		case c.current:
+			c.event.Kind = ChangeInsert
+		default:
+			c.event.Kind = ChangeDelete
+		}
+		events = append(events, c.event)
+	}
+	// Supersessions are found on versions that started earlier
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
+
+// documentFields drops temporal columns and the NULLs SELECT * pads with
+func documentFields(version map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(version))
+	for k, v := range version {
+		switch k {
+		case "_valid_from", "_valid_to", "_system_from", "_system_to":
+			continue
+		}
+		if v != nil {
+			doc[k] = v
+		}
+	}
+	return doc
+}
+
+// Tail calls onChange for every change made to table after Tail starts,
+// checking every pollInterval, until ctx is cancelled (which isn't an error).
+func Tail(ctx context.Context, conn *pgx.Conn, table string, pollInterval time.Duration, onChange func(ChangeEvent)) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+
+	// Start from the latest existing version so history isn't replayed
+	var latest *time.Time
+	err := conn.QueryRow(ctx, tagSQL(ctx, fmt.Sprintf("SELECT MAX(_system_from) FROM %s FOR ALL SYSTEM_TIME FOR ALL VALID_TIME", table))).Scan(&latest)
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("finding latest change to %s: %w", table, err)
+	}
+	var since time.Time
+	if latest != nil {
+		since = *latest
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		events, next, err := PollChanges(ctx, conn, table, since)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, event := range events {
+			onChange(event)
+		}
+		since = next
+	}
+}
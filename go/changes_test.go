@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassifyChanges(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	t3 := t2.Add(time.Minute)
+
+	versions := []map[string]interface{}{
+		// tx 1: alice inserted
+		{"_id": "alice", "name": "Alice", "_system_from": t1, "_valid_to": nil},
+		// tx 2: alice updated - old document end-dated, new one open
+		{"_id": "alice", "name": "Alice", "_system_from": t2, "_valid_to": t2},
+		{"_id": "alice", "name": "Alice Smith", "_system_from": t2, "_valid_to": nil},
+		// tx 3: alice deleted
+		{"_id": "alice", "name": "Alice Smith", "_system_from": t3, "_valid_to": t3},
+	}
+
+	events := classifyChanges(versions, time.Time{})
+	var kinds []ChangeKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	if fmt.Sprint(kinds) != "[insert update delete]" {
+		t.Fatalf("Expected [insert update delete], got %v", kinds)
+	}
+	if events[1].Record["name"] != "Alice Smith" || events[1].Record["_system_from"] != nil {
+		t.Errorf("Update should carry the new document without temporal columns, got %v", events[1].Record)
+	}
+	if events[2].Record != nil || !events[2].At.Equal(t3) {
+		t.Errorf("Unexpected delete event: %+v", events[2])
+	}
+}
+
+// The same history as the server may record it without end-dated copies:
+// the update and the delete only close the superseded version's _system_to
+func TestClassifyChangesSupersededOnly(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	t3 := t2.Add(time.Minute)
+
+	versions := []map[string]interface{}{
+		{"_id": "alice", "name": "Alice", "_system_from": t1, "_system_to": t2, "_valid_to": nil},
+		{"_id": "alice", "name": "Alice Smith", "_system_from": t2, "_system_to": t3, "_valid_to": nil},
+	}
+
+	summary := func(events []ChangeEvent) string {
+		var s []string
+		for _, e := range events {
+			s = append(s, fmt.Sprintf("%s@%s", e.Kind, e.At.Format("15:04")))
+		}
+		return fmt.Sprint(s)
+	}
+	events := classifyChanges(versions, time.Time{})
+	if got := summary(events); got != "[insert@00:00 update@00:01 delete@00:02]" {
+		t.Fatalf("Unexpected events %s", got)
+	}
+	if events[1].Record["name"] != "Alice Smith" || events[2].Record != nil {
+		t.Errorf("Unexpected records %v, %v", events[1].Record, events[2].Record)
+	}
+
+	// Polling after the update sees only the delete
+	if got := summary(classifyChanges(versions[1:], t2)); got != "[delete@00:02]" {
+		t.Errorf("Expected only the delete after the update, got %s", got)
+	}
+}
+
+func TestTail(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	writer := getConn(t)
+	defer writer.Close(context.Background())
+
+	table := getCleanTable()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Something already in the table shouldn't be reported
+	if _, err := writer.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'existing'}", table)); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	events := make(chan ChangeEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Tail(ctx, conn, table, 50*time.Millisecond, func(e ChangeEvent) { events <- e })
+	}()
+
+	next := func() ChangeEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a change")
+			return ChangeEvent{}
+		}
+	}
+
+	// Give Tail time to find its starting point
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := writer.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'alice', name: 'Alice'}", table)); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if e := next(); e.Kind != ChangeInsert || e.ID != "alice" || e.Record["name"] != "Alice" {
+		t.Errorf("Expected insert of alice, got %+v", e)
+	}
+
+	if _, err := writer.Exec(ctx, fmt.Sprintf("UPDATE %s SET name = 'Alice Smith' WHERE _id = 'alice'", table)); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if e := next(); e.Kind != ChangeUpdate || e.ID != "alice" || e.Record["name"] != "Alice Smith" {
+		t.Errorf("Expected update of alice, got %+v", e)
+	}
+
+	if _, err := writer.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE _id = 'alice'", table)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if e := next(); e.Kind != ChangeDelete || e.ID != "alice" {
+		t.Errorf("Expected delete of alice, got %+v", e)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Tail returned %v after cancel", err)
+	}
+}
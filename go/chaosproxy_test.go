@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-adbc/go/adbc/driver/flightsql"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/jackc/pgx/v5"
+)
+
+// chaosProxy is a TCP proxy between a client (pgx, ADBC/Flight SQL, ...) and
+// XTDB that injects failures on demand, so resilience tests can reproduce
+// network faults deterministically instead of mocking them.
+type chaosProxy struct {
+	ln     net.Listener
+	target string
+
+	mu             sync.Mutex
+	failNext       int
+	latency        time.Duration
+	dropAfter      int64
+	blackholeUntil time.Time
+	conns          map[net.Conn]bool
+}
+
+// newChaosProxy listens on a local port and forwards to target (host:port).
+// It is closed when the test ends.
+func newChaosProxy(t testing.TB, target string) *chaosProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("chaos proxy: %v", err)
+	}
+	p := &chaosProxy{ln: ln, target: target, conns: map[net.Conn]bool{}}
+	go p.serve()
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Addr is the host:port clients should connect to
+func (p *chaosProxy) Addr() string { return p.ln.Addr().String() }
+
+// FailNextConnection closes the next incoming connection straight away
+func (p *chaosProxy) FailNextConnection() {
+	p.mu.Lock()
+	p.failNext++
+	p.mu.Unlock()
+}
+
+// Latency delays every chunk forwarded in either direction by d
+func (p *chaosProxy) Latency(d time.Duration) {
+	p.mu.Lock()
+	p.latency = d
+	p.mu.Unlock()
+}
+
+// DropAfter cuts each connection once n bytes have passed through it in
+// total; 0 turns it off
+func (p *chaosProxy) DropAfter(n int64) {
+	p.mu.Lock()
+	p.dropAfter = n
+	p.mu.Unlock()
+}
+
+// Blackhole stops forwarding for d, as a partition would; data sent in the
+// meantime is delivered once it heals, like TCP retransmission
+func (p *chaosProxy) Blackhole(d time.Duration) {
+	p.mu.Lock()
+	p.blackholeUntil = time.Now().Add(d)
+	p.mu.Unlock()
+}
+
+// CloseConnections cuts every open connection, as a server restart would
+func (p *chaosProxy) CloseConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c := range p.conns {
+		c.Close()
+	}
+}
+
+func (p *chaosProxy) Close() {
+	p.ln.Close()
+	p.CloseConnections()
+}
+
+func (p *chaosProxy) serve() {
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		p.mu.Lock()
+		fail := p.failNext > 0
+		if fail {
+			p.failNext--
+		}
+		p.mu.Unlock()
+		if fail {
+			client.Close()
+			continue
+		}
+
+		go p.handle(client)
+	}
+}
+
+func (p *chaosProxy) handle(client net.Conn) {
+	server, err := net.Dial("tcp", p.target)
+	if err != nil {
+		client.Close()
+		return
+	}
+
+	p.mu.Lock()
+	p.conns[client] = true
+	p.conns[server] = true
+	p.mu.Unlock()
+
+	var mu sync.Mutex
+	var total int64
+	closeBoth := func() {
+		client.Close()
+		server.Close()
+		p.mu.Lock()
+		delete(p.conns, client)
+		delete(p.conns, server)
+		p.mu.Unlock()
+	}
+
+	pipe := func(dst, src net.Conn) {
+		defer closeBoth()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				p.mu.Lock()
+				latency, dropAfter, until := p.latency, p.dropAfter, p.blackholeUntil
+				p.mu.Unlock()
+
+				if wait := time.Until(until); wait > 0 {
+					time.Sleep(wait)
+				}
+				time.Sleep(latency)
+
+				chunk := buf[:n]
+				if dropAfter > 0 {
+					mu.Lock()
+					remaining := dropAfter - total
+					total += int64(n)
+					mu.Unlock()
+					if remaining <= 0 {
+						return
+					}
+					if int64(n) > remaining {
+						dst.Write(chunk[:remaining])
+						return
+					}
+				}
+				if _, err := dst.Write(chunk); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	go pipe(server, client)
+	pipe(client, server)
+}
+
+// echoServer accepts connections and echoes what it reads
+func echoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("echo server: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestChaosProxy(t *testing.T) {
+	proxy := newChaosProxy(t, echoServer(t))
+
+	roundTrip := func(msg string) (string, error) {
+		c, err := net.Dial("tcp", proxy.Addr())
+		if err != nil {
+			return "", err
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := c.Write([]byte(msg)); err != nil {
+			return "", err
+		}
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(c, buf)
+		return string(buf), err
+	}
+
+	if got, err := roundTrip("hello"); err != nil || got != "hello" {
+		t.Fatalf("Expected clean round trip, got %q, %v", got, err)
+	}
+
+	proxy.FailNextConnection()
+	if _, err := roundTrip("hello"); err == nil {
+		t.Error("Expected the failed connection to error")
+	}
+	if got, err := roundTrip("hello"); err != nil || got != "hello" {
+		t.Errorf("Only one connection should fail, got %q, %v", got, err)
+	}
+
+	proxy.Latency(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := roundTrip("hello"); err != nil {
+		t.Fatalf("Round trip with latency failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected ~100ms each way, took %v", elapsed)
+	}
+	proxy.Latency(0)
+
+	proxy.DropAfter(8)
+	if got, err := roundTrip(strings.Repeat("x", 16)); err == nil {
+		t.Errorf("Expected connection to be cut after 8 bytes, got %q", got)
+	}
+	proxy.DropAfter(0)
+
+	proxy.Blackhole(300 * time.Millisecond)
+	start = time.Now()
+	if got, err := roundTrip("after"); err != nil || got != "after" {
+		t.Errorf("Expected traffic to resume after the blackhole, got %q, %v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Expected the blackhole to stall traffic, took %v", elapsed)
+	}
+}
+
+func TestPgxThroughChaosProxy(t *testing.T) {
+	proxy := newChaosProxy(t, getXtdbHost()+":5432")
+	connStr := fmt.Sprintf("postgres://%s/xtdb", proxy.Addr())
+	ctx := context.Background()
+
+	proxy.FailNextConnection()
+	if conn, err := pgx.Connect(ctx, connStr); err == nil {
+		conn.Close(ctx)
+		t.Fatal("Expected the first connection attempt to fail")
+	}
+
+	conn, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var n int
+	if err := conn.QueryRow(ctx, "SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("Query through proxy failed: %d, %v", n, err)
+	}
+
+	// A server going away mid-session surfaces as an error, not a hang
+	proxy.CloseConnections()
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := conn.QueryRow(queryCtx, "SELECT 1").Scan(&n); err == nil {
+		t.Error("Expected query on a cut connection to fail")
+	}
+	if !conn.IsClosed() {
+		t.Error("Expected pgx to mark the cut connection closed")
+	}
+}
+
+func TestAdbcThroughChaosProxy(t *testing.T) {
+	proxy := newChaosProxy(t, getXtdbHost()+":9833")
+	ctx := context.Background()
+
+	db, err := flightsql.NewDriver(memory.NewGoAllocator()).NewDatabase(map[string]string{
+		"uri": "grpc://" + proxy.Addr(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// gRPC redials transparently, so a dropped first connection and a slow
+	// link should cost time, not the query
+	proxy.FailNextConnection()
+	proxy.Latency(50 * time.Millisecond)
+
+	conn, err := db.Open(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open connection: %v", err)
+	}
+	defer conn.Close()
+
+	stmt, err := conn.NewStatement()
+	if err != nil {
+		t.Fatalf("Failed to create statement: %v", err)
+	}
+	defer stmt.Close()
+
+	stmt.SetSqlQuery("SELECT 1 AS x")
+	reader, _, err := stmt.ExecuteQuery(ctx)
+	if err != nil {
+		t.Fatalf("Query through proxy failed: %v", err)
+	}
+	defer reader.Release()
+
+	if !reader.Next() || reader.Record().NumRows() != 1 {
+		t.Error("Expected one row through the proxy")
+	}
+}
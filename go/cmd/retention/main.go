@@ -0,0 +1,89 @@
+// Command retention expires records older than a TTL, for running from cron:
+//
+//	retention -table sessions -older-than 720h -mode delete
+//
+// It mirrors ApplyRetention in the parent example package, which as a
+// package main can't be imported, and renders ids with the same
+// xtdb.Literal, so UUID, timestamp and quoted string ids all work.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func main() {
+	table := flag.String("table", "", "table to expire records from")
+	olderThan := flag.Duration("older-than", 30*24*time.Hour, "expire current records valid from before now minus this")
+	mode := flag.String("mode", "delete", "delete (keep history) or erase (purge history)")
+	batchSize := flag.Int("batch-size", 500, "ids per DELETE/ERASE statement")
+	dryRun := flag.Bool("dry-run", false, "report what would expire without removing it")
+	flag.Parse()
+
+	if !identifierPattern.MatchString(*table) {
+		log.Fatalf("-table must be a plain identifier, got %q", *table)
+	}
+	verb := map[string]string{"delete": "DELETE", "erase": "ERASE"}[*mode]
+	if verb == "" {
+		log.Fatalf("-mode must be delete or erase, got %q", *mode)
+	}
+	if *batchSize <= 0 {
+		log.Fatalf("-batch-size must be positive")
+	}
+
+	host := os.Getenv("XTDB_HOST")
+	if host == "" {
+		host = "xtdb"
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, fmt.Sprintf("postgres://%s:5432/xtdb", host))
+	if err != nil {
+		log.Fatalf("Unable to connect: %v\n", err)
+	}
+	defer conn.Close(ctx)
+
+	cutoff := time.Now().Add(-*olderThan).UTC()
+	cutoffLit, _ := xtdb.Literal(cutoff)
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id FROM %s WHERE _valid_from < %s ORDER BY _id",
+		*table, cutoffLit))
+	if err != nil {
+		log.Fatalf("Finding expired records failed: %v\n", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[any])
+	if err != nil {
+		log.Fatalf("Finding expired records failed: %v\n", err)
+	}
+
+	fmt.Printf("%d records in %s valid from before %s\n", len(ids), *table, cutoff.Format(time.RFC3339))
+	if *dryRun {
+		return
+	}
+
+	for start := 0; start < len(ids); start += *batchSize {
+		batch := ids[start:min(start+*batchSize, len(ids))]
+		lits := make([]string, len(batch))
+		for i, id := range batch {
+			if lits[i], err = xtdb.Literal(id); err != nil {
+				log.Fatalf("Formatting id %v failed: %v\n", id, err)
+			}
+		}
+
+		sql := fmt.Sprintf("%s FROM %s WHERE _id IN (%s)", verb, *table, strings.Join(lits, ", "))
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			log.Fatalf("%s failed after %d of %d: %v\n", verb, start, len(ids), err)
+		}
+		fmt.Printf("  %sd %d/%d\n", *mode, start+len(batch), len(ids))
+	}
+}
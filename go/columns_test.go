@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AssertColumns fails the test unless rows has each expected column with the
+// expected type OID, pinning down a query's result schema so an XTDB upgrade
+// that changes column typing is caught. Extra columns are ignored.
+func AssertColumns(t testing.TB, rows pgx.Rows, expected map[string]uint32) {
+	t.Helper()
+	for _, err := range matchColumns(rows.FieldDescriptions(), expected) {
+		t.Errorf("Column mismatch: %v", err)
+	}
+}
+
+func matchColumns(fields []pgconn.FieldDescription, expected map[string]uint32) []error {
+	got := make(map[string]uint32, len(fields))
+	for _, fd := range fields {
+		got[fd.Name] = fd.DataTypeOID
+	}
+
+	// Report in a fixed order so failures read the same every run
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		oid, ok := got[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s: missing", name))
+		case oid != expected[name]:
+			errs = append(errs, fmt.Errorf("%s: expected %s, got %s",
+				name, oidName(expected[name]), oidName(oid)))
+		}
+	}
+	return errs
+}
+
+var columnTypes = pgtype.NewMap()
+
+// oidName names a type OID for failure messages, including XTDB's transit
+func oidName(oid uint32) string {
+	switch oid {
+	case TransitOID:
+		return fmt.Sprintf("transit (%d)", oid)
+	case JSONOID:
+		return fmt.Sprintf("json (%d)", oid)
+	}
+	if typ, ok := columnTypes.TypeForOID(oid); ok {
+		return fmt.Sprintf("%s (%d)", typ.Name, oid)
+	}
+	return fmt.Sprintf("oid %d", oid)
+}
+
+func TestAssertColumnsMatches(t *testing.T) {
+	fields := []pgconn.FieldDescription{
+		{Name: "_id", DataTypeOID: pgtype.TextOID},
+		{Name: "age", DataTypeOID: pgtype.Int8OID},
+		{Name: "metadata", DataTypeOID: TransitOID},
+		{Name: "extra", DataTypeOID: pgtype.BoolOID},
+	}
+	errs := matchColumns(fields, map[string]uint32{
+		"_id":      pgtype.TextOID,
+		"age":      pgtype.Int8OID,
+		"metadata": TransitOID,
+	})
+	if len(errs) > 0 {
+		t.Errorf("Expected columns to match, got %v", errs)
+	}
+}
+
+func TestAssertColumnsMismatches(t *testing.T) {
+	fields := []pgconn.FieldDescription{
+		{Name: "_id", DataTypeOID: pgtype.TextOID},
+		{Name: "age", DataTypeOID: pgtype.Float8OID},
+		{Name: "metadata", DataTypeOID: JSONOID},
+	}
+	errs := matchColumns(fields, map[string]uint32{
+		"_id":      pgtype.TextOID,
+		"age":      pgtype.Int8OID,
+		"email":    pgtype.TextOID,
+		"metadata": TransitOID,
+	})
+
+	want := []string{
+		"age: expected int8 (20), got float8 (701)",
+		"email: missing",
+		"metadata: expected transit (16384), got json (114)",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d mismatches, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("Mismatch %d: expected %q, got %q", i, want[i], err)
+		}
+	}
+}
+
+func TestAssertColumnsSampleUsers(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	loadSampleUsers(t, conn, table)
+
+	rows, err := conn.Query(context.Background(),
+		fmt.Sprintf("SELECT _id, name, age, active, metadata FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	AssertColumns(t, rows, map[string]uint32{
+		"_id":    pgtype.TextOID,
+		"name":   pgtype.TextOID,
+		"age":    pgtype.Int8OID,
+		"active": pgtype.BoolOID,
+		// Nested objects have no Postgres type, so come back as transit
+		"metadata": TransitOID,
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CompareReport is the outcome of CompareTables. Keys are as read from the
+// source table.
+type CompareReport struct {
+	SourceRows   int
+	XTDBRows     int
+	OnlyInSource []any
+	OnlyInXTDB   []any
+	Differing    []RowDiff
+}
+
+// Matches reports whether the tables held the same rows
+func (r CompareReport) Matches() bool {
+	return len(r.OnlyInSource) == 0 && len(r.OnlyInXTDB) == 0 && len(r.Differing) == 0
+}
+
+// RowDiff lists the fields that differ for one key
+type RowDiff struct {
+	Key    any
+	Fields []FieldDiff
+}
+
+// FieldDiff is a field whose values differ; a field missing on one side
+// reads as nil
+type FieldDiff struct {
+	Field  string
+	Source any
+	XTDB   any
+}
+
+// CompareTables checks an XTDB table against the source table it was copied
+// from, e.g. after a Debezium backfill. Source rows are keyed by keyCol and
+// XTDB rows by _id (the loader's mapping); keyCol itself isn't compared.
+//
+// Values are compared loosely, since the copy goes through JSON: numbers
+// compare by value whatever their type, timestamps by instant (including
+// against RFC3339 strings), and a missing field equals NULL.
+func CompareTables(ctxA context.Context, srcConn *pgx.Conn, ctxB context.Context, xtdbConn *pgx.Conn, srcTable, xtdbTable, keyCol string) (CompareReport, error) {
+	var report CompareReport
+	if err := checkTable(srcTable); err != nil {
+		return report, err
+	}
+	if err := checkTable(xtdbTable); err != nil {
+		return report, err
+	}
+	if !identifierPattern.MatchString(keyCol) {
+		return report, fmt.Errorf("invalid key column %q", keyCol)
+	}
+
+	source, err := readKeyed(ctxA, srcConn, srcTable, keyCol)
+	if err != nil {
+		return report, err
+	}
+	xtdb, err := readKeyed(ctxB, xtdbConn, xtdbTable, "_id")
+	if err != nil {
+		return report, err
+	}
+	report.SourceRows, report.XTDBRows = len(source), len(xtdb)
+
+	for _, key := range sortedRowKeys(source) {
+		src := source[key]
+		dst, ok := xtdb[key]
+		if !ok {
+			report.OnlyInSource = append(report.OnlyInSource, src[keyCol])
+			continue
+		}
+		if fields := diffRows(src, dst, keyCol); len(fields) > 0 {
+			report.Differing = append(report.Differing, RowDiff{Key: src[keyCol], Fields: fields})
+		}
+	}
+	for _, key := range sortedRowKeys(xtdb) {
+		if _, ok := source[key]; !ok {
+			report.OnlyInXTDB = append(report.OnlyInXTDB, xtdb[key]["_id"])
+		}
+	}
+	return report, nil
+}
+
+// readKeyed reads every row of table, keyed by the normalised key column
+func readKeyed(ctx context.Context, conn *pgx.Conn, table, keyCol string) (map[string]map[string]interface{}, error) {
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT * FROM %s", table)))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", table, err)
+	}
+	records, err := collectMaps(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", table, err)
+	}
+
+	keyed := make(map[string]map[string]interface{}, len(records))
+	for _, record := range records {
+		key, ok := record[keyCol]
+		if !ok || key == nil {
+			return nil, fmt.Errorf("%s: row without %s: %v", table, keyCol, record)
+		}
+		keyed[compareKey(key)] = record
+	}
+	return keyed, nil
+}
+
+// compareKey renders a key so that 1, int64(1) and 1.0 match
+func compareKey(v any) string {
+	if _, isString := v.(string); !isString {
+		if f, err := toFloat64(v); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedRowKeys(m map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffRows compares every field but the keys, in field order
+func diffRows(src, dst map[string]interface{}, keyCol string) []FieldDiff {
+	fields := map[string]bool{}
+	for k := range src {
+		fields[k] = true
+	}
+	for k := range dst {
+		fields[k] = true
+	}
+	delete(fields, keyCol)
+	delete(fields, "_id")
+
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var diffs []FieldDiff
+	for _, name := range names {
+		if !looselyEqual(src[name], dst[name]) {
+			diffs = append(diffs, FieldDiff{Field: name, Source: src[name], XTDB: dst[name]})
+		}
+	}
+	return diffs
+}
+
+// looselyEqual compares values that may have gone through a JSON round trip
+func looselyEqual(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if at, ok := asTime(a); ok {
+		bt, ok := asTime(b)
+		return ok && at.Equal(bt)
+	}
+	if _, ok := asTime(b); ok {
+		return false
+	}
+
+	_, aString := a.(string)
+	_, bString := b.(string)
+	if !aString || !bString {
+		af, aErr := toFloat64(a)
+		bf, bErr := toFloat64(b)
+		if aErr == nil && bErr == nil {
+			return af == bf
+		}
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if !looselyEqual(v, bv[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !looselyEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b) || fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// asTime reads time.Time values and RFC3339 strings
+func asTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLooselyEqual(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		a, b  any
+		equal bool
+	}{
+		{int64(1), float64(1), true},
+		{int32(7), "7", true},
+		{"7", "7.0", false},
+		{at, "2024-01-01T12:00:00Z", true},
+		{at, at.In(time.FixedZone("X", 3600)), true},
+		{at, "2024-01-01T12:00:01Z", false},
+		{nil, nil, true},
+		{nil, "", false},
+		{map[string]interface{}{"n": int64(1)}, map[string]interface{}{"n": 1.0}, true},
+		{[]interface{}{"a", int64(2)}, []interface{}{"a", 2.0}, true},
+		{[]interface{}{"a"}, []interface{}{"a", "b"}, false},
+		{"x", "y", false},
+	}
+	for _, c := range cases {
+		if got := looselyEqual(c.a, c.b); got != c.equal {
+			t.Errorf("looselyEqual(%#v, %#v) = %v, want %v", c.a, c.b, got, c.equal)
+		}
+	}
+}
+
+func TestCompareTables(t *testing.T) {
+	srcConn := getConn(t)
+	defer srcConn.Close(context.Background())
+	xtdbConn := getConn(t)
+	defer xtdbConn.Close(context.Background())
+
+	ctx := context.Background()
+	srcTable, xtdbTable := getCleanTable(), getCleanTable()
+
+	for _, stmt := range []string{
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 1, name: 'Alice', score: 10}, {_id: 2, name: 'Bob', score: 20}, {_id: 3, name: 'Carol'}, {_id: 4, name: 'Dan'}", srcTable),
+		// 2's score drifted, 3 is missing, 5 shouldn't be there; 1 differs
+		// only in numeric type, which isn't a discrepancy
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 1, name: 'Alice', score: 10.0}, {_id: 2, name: 'Bob', score: 21}, {_id: 4, name: 'Dan'}, {_id: 5, name: 'Eve'}", xtdbTable),
+	} {
+		if _, err := srcConn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	report, err := CompareTables(ctx, srcConn, ctx, xtdbConn, srcTable, xtdbTable, "_id")
+	if err != nil {
+		t.Fatalf("CompareTables failed: %v", err)
+	}
+	if report.Matches() || report.SourceRows != 4 || report.XTDBRows != 4 {
+		t.Errorf("Unexpected totals: %+v", report)
+	}
+	if fmt.Sprint(report.OnlyInSource) != "[3]" || fmt.Sprint(report.OnlyInXTDB) != "[5]" {
+		t.Errorf("Expected 3 only in source and 5 only in XTDB, got %v and %v", report.OnlyInSource, report.OnlyInXTDB)
+	}
+	if len(report.Differing) != 1 || fmt.Sprint(report.Differing[0].Key) != "2" ||
+		len(report.Differing[0].Fields) != 1 || report.Differing[0].Fields[0].Field != "score" {
+		t.Errorf("Expected only 2's score to differ, got %+v", report.Differing)
+	}
+
+	same, err := CompareTables(ctx, srcConn, ctx, xtdbConn, srcTable, srcTable, "_id")
+	if err != nil || !same.Matches() {
+		t.Errorf("Expected a table to match itself, got %+v, %v", same, err)
+	}
+}
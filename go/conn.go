@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ConnectOption configures Connect
+type ConnectOption func(*connectConfig)
+
+type connectConfig struct {
+	readOnly         bool
+	tls              *TLSFiles
+	statementTimeout time.Duration
+	slowQueries      *slowQueryTracer
+	telemetry        *telemetryTracer
+}
+
+// Conn is a *pgx.Conn with the client-side checks and timeouts its
+// ConnectOptions ask for. Exec, Query, QueryRow, SendBatch, CopyFrom, Begin
+// and BeginTx go through the checks; the embedded *pgx.Conn deliberately
+// doesn't, so helpers that take a *pgx.Conn still work, given conn.Conn.
+// Nor does PgConn(): statements sent with its Exec or ExecParams escape
+// ReadOnly and the statement timeout entirely.
+type Conn struct {
+	*pgx.Conn
+	cfg connectConfig
+}
+
+// Connect opens a connection to XTDB with the given options
+func Connect(ctx context.Context, connString string, opts ...ConnectOption) (*Conn, error) {
+	var cfg connectConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	pgxCfg, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.tls != nil {
+		tlsCfg, err := buildTLSConfig(*cfg.tls, pgxCfg.Host)
+		if err != nil {
+			return nil, err
+		}
+		pgxCfg.TLSConfig = tlsCfg
+		// Don't let sslmode=prefer fall back to plaintext
+		pgxCfg.Fallbacks = nil
+	}
+	var tracers multiTracer
+	if cfg.slowQueries != nil {
+		tracers = append(tracers, cfg.slowQueries)
+	}
+	if cfg.telemetry != nil {
+		tracers = append(tracers, cfg.telemetry)
+	}
+	switch len(tracers) {
+	case 0:
+	case 1:
+		pgxCfg.Tracer = tracers[0]
+	default:
+		pgxCfg.Tracer = tracers
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, pgxCfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{Conn: conn, cfg: cfg}
+
+	if cfg.statementTimeout > 0 {
+		c.setSessionStatementTimeout(ctx)
+	}
+	return c, nil
+}
+
+func (c *Conn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := c.check(ctx, sql); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.Conn.Exec(ctx, tagSQL(ctx, sql), args...)
+}
+
+func (c *Conn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := c.check(ctx, sql); err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	rows, err := c.Conn.Query(ctx, tagSQL(ctx, sql), args...)
+	if err != nil {
+		cancel()
+		return rows, err
+	}
+	return timeoutRows{rows, cancel}, nil
+}
+
+func (c *Conn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := c.check(ctx, sql); err != nil {
+		return errRow{err}
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	return timeoutRow{c.Conn.QueryRow(ctx, tagSQL(ctx, sql), args...), cancel}
+}
+
+// SendBatch sends a tagged copy of b, leaving the caller's batch as it was,
+// so sending it again doesn't tag its statements twice
+func (c *Conn) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	tagged := &pgx.Batch{QueuedQueries: make([]*pgx.QueuedQuery, len(b.QueuedQueries))}
+	for i, q := range b.QueuedQueries {
+		if err := c.check(ctx, q.SQL); err != nil {
+			return errBatchResults{err}
+		}
+		cp := *q
+		cp.SQL = tagSQL(ctx, q.SQL)
+		tagged.QueuedQueries[i] = &cp
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	return timeoutBatchResults{c.Conn.SendBatch(ctx, tagged), cancel}
+}
+
+func (c *Conn) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	if err := c.check(ctx, "COPY "+tableName.Sanitize()+" FROM STDIN"); err != nil {
+		return 0, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.Conn.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// Begin starts a transaction, BEGIN READ ONLY if the connection is (unless
+// ctx allows writes). Statements run on the pgx.Tx aren't checked
+// client-side, so this leaves it to the server, and a server that can't
+// start a read-only transaction fails Begin rather than writing anyway.
+func (c *Conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.BeginTx(ctx, pgx.TxOptions{})
+}
+
+// BeginTx is Begin with txOptions. On a read-only connection (unless ctx
+// allows writes) the transaction is always READ ONLY, and asking for a READ
+// WRITE one is refused with ErrReadOnly.
+func (c *Conn) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	if c.cfg.readOnly && !writesAllowed(ctx) {
+		if txOptions.AccessMode == pgx.ReadWrite {
+			return nil, &ReadOnlyError{Statement: "BEGIN READ WRITE", Verb: "BEGIN READ WRITE"}
+		}
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+	return c.Conn.BeginTx(ctx, txOptions)
+}
+
+// check runs every client-side check the options enabled
+func (c *Conn) check(ctx context.Context, sql string) error {
+	if c.cfg.readOnly {
+		return checkReadOnly(ctx, sql)
+	}
+	return nil
+}
+
+// errRow reports an error from Scan, as pgx does for a failed QueryRow
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error { return r.err }
+
+type errBatchResults struct{ err error }
+
+func (b errBatchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, b.err }
+func (b errBatchResults) Query() (pgx.Rows, error)         { return nil, b.err }
+func (b errBatchResults) QueryRow() pgx.Row                { return errRow{b.err} }
+func (b errBatchResults) Close() error                     { return b.err }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// CopyFromTransit loads a transit-json or transit-msgpack stream from r into
+// table with COPY ... FROM STDIN, returning the number of rows copied. The
+// connection needs fallback_output_format=transit (see getConnTransit).
+//
+// Without options the stream goes to the server as it is. With any, as with
+// InsertRecords, each record is checked first (schema, valid-time guard,
+// metadata and so on), so a transit-json stream is read into memory and
+// copied with CopyRecords; transit-msgpack can't be, and is refused.
+func CopyFromTransit(ctx context.Context, conn *pgx.Conn, table string, r io.Reader, format string, opts ...InsertOption) (int64, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	if format != "transit-json" && format != "transit-msgpack" {
+		return 0, fmt.Errorf("unsupported COPY format %q", format)
+	}
+	if len(opts) > 0 {
+		if format != "transit-json" {
+			return 0, fmt.Errorf("insert options need a transit-json stream, not %s", format)
+		}
+		var records []map[string]any
+		err := xtdb.StreamLines(r, func(record map[string]interface{}) error {
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("reading %s stream: %w", format, err)
+		}
+		return CopyRecords(ctx, conn, table, records, format, opts...)
+	}
+	return copyFromTransit(ctx, conn, table, r, format)
+}
+
+func copyFromTransit(ctx context.Context, conn *pgx.Conn, table string, r io.Reader, format string) (int64, error) {
+	sql := fmt.Sprintf("COPY %s FROM STDIN WITH (FORMAT '%s')", table, format)
+	tag, err := traceCopy(ctx, conn, table, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return conn.PgConn().CopyFrom(ctx, r, tagSQL(ctx, sql))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("copying into %s: %w", table, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CopyRecords loads records into table with a single COPY, encoding each as
+// a transit-json line as the server reads them, and returns the number of
+// rows copied. Only "transit-json" is supported: records are encoded with
+// xtdb.Encoder, which has no msgpack form. The options apply as they do to
+// InsertRecords, before anything is sent; under SchemaRejectRecord the
+// valid records are copied and the *SchemaError returned after.
+func CopyRecords(ctx context.Context, conn *pgx.Conn, table string, records []map[string]any, format string, opts ...InsertOption) (int64, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	if format != "transit-json" {
+		return 0, fmt.Errorf("unsupported CopyRecords format %q (only transit-json)", format)
+	}
+
+	cfg := newInsertConfig(opts)
+	records, schemaErr := cfg.batch(table, records)
+	if schemaErr != nil && cfg.schemaPolicy == SchemaRejectBatch {
+		return 0, schemaErr
+	}
+	prepared := make([]map[string]any, len(records))
+	for i, record := range records {
+		record, err := cfg.prepare(record)
+		if err != nil {
+			return 0, fmt.Errorf("record %d: %w", i, err)
+		}
+		prepared[i] = transitValidFrom(record)
+	}
+	if len(prepared) == 0 {
+		return 0, schemaErr
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		var encoder xtdb.Encoder
+		for _, record := range prepared {
+			if _, err := io.WriteString(pw, encoder.EncodeMap(record)+"\n"); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	n, err := copyFromTransit(ctx, conn, table, pr, format)
+	// Unblock the encoder if the COPY stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return n, err
+	}
+	if schemaErr != nil {
+		return n, schemaErr
+	}
+	return n, nil
+}
+
+// transitValidFrom turns a _valid_from the valid-time guard wrote back as
+// an RFC3339 string into a time, so it's encoded as a transit instant
+func transitValidFrom(record map[string]any) map[string]any {
+	s, ok := record["_valid_from"].(string)
+	if !ok {
+		return record
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return record
+	}
+	copied := make(map[string]any, len(record))
+	for k, v := range record {
+		copied[k] = v
+	}
+	copied["_valid_from"] = t
+	return copied
+}
+
+// LineError is a line of a transit-JSON stream that failed validation
+type LineError struct {
+	Line int // 1-based
+	Err  error
+}
+
+func (e LineError) Error() string { return fmt.Sprintf("line %d: %v", e.Line, e.Err) }
+func (e LineError) Unwrap() error { return e.Err }
+
+// ValidateTransitStream checks a transit-JSON stream before it's given to
+// CopyFromTransit, inserting nothing: every line must decode as a transit
+// map (as xtdb.StreamLines reads it) and have each required field, not null.
+// It reads to the end and returns every bad line. The error is only for
+// failing to read r, including a line longer than xtdb.MaxLineSize.
+func ValidateTransitStream(r io.Reader, required []string) ([]LineError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), xtdb.MaxLineSize)
+
+	var bad []LineError
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		record, err := xtdb.DecodeLine(text)
+		if err != nil {
+			bad = append(bad, LineError{Line: line, Err: err})
+			continue
+		}
+		var missing []string
+		for _, field := range required {
+			if record[field] == nil {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			bad = append(bad, LineError{Line: line, Err: fmt.Errorf("missing required %s", strings.Join(missing, ", "))})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return bad, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return bad, nil
+}
+
+// CopyFormat is an output format for COPY ... TO STDOUT
+type CopyFormat string
+
+const (
+	CopyCSV            CopyFormat = "csv"
+	CopyTransitJSON    CopyFormat = "transit-json"
+	CopyTransitMsgpack CopyFormat = "transit-msgpack"
+)
+
+func (f CopyFormat) valid() bool {
+	return f == CopyCSV || f == CopyTransitJSON || f == CopyTransitMsgpack
+}
+
+// CopyQueryTo streams the results of query to w with COPY (query) TO STDOUT,
+// returning the number of rows exported. This skips pgx's row decoding, so
+// it's the fastest way to get a large result set out.
+func CopyQueryTo(ctx context.Context, conn *pgx.Conn, query string, w io.Writer, format CopyFormat) (int64, error) {
+	if !format.valid() {
+		return 0, fmt.Errorf("unsupported COPY format %q", format)
+	}
+
+	sql := tagSQL(ctx, copyToStatement(query, format))
+	tag, err := traceExec(ctx, conn, sql, nil, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return conn.PgConn().CopyTo(ctx, w, sql)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("copying query results: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// copyToStatement wraps query in COPY (...) TO STDOUT, dropping any trailing
+// semicolons, which can't go inside the parentheses
+func copyToStatement(query string, format CopyFormat) string {
+	query = strings.TrimRight(query, "; \t\r\n")
+	return fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT '%s')", query, format)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtdb/driver-examples/go/fixtures"
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+func TestCopyQueryToRejectsUnknownFormat(t *testing.T) {
+	if _, err := CopyQueryTo(context.Background(), nil, "SELECT 1", &bytes.Buffer{}, "parquet"); err == nil {
+		t.Error("Expected an unsupported format to be rejected before reaching the server")
+	}
+	if _, err := ExportTables(context.Background(), nil, t.TempDir(), []string{"users"}, WithCopyFormat("xml")); err == nil {
+		t.Error("Expected ExportTables to reject an unsupported COPY format")
+	}
+}
+
+func TestCopyToStatement(t *testing.T) {
+	want := "COPY (SELECT * FROM users) TO STDOUT WITH (FORMAT 'csv')"
+	for _, query := range []string{"SELECT * FROM users", "SELECT * FROM users;", "SELECT * FROM users ;\n", "SELECT * FROM users;;"} {
+		if got := copyToStatement(query, CopyCSV); got != want {
+			t.Errorf("copyToStatement(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// selectRows runs query and returns its rows, for comparing with COPY output
+func selectRows(t *testing.T, query string) []map[string]interface{} {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	rows, err := conn.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	results, err := collectMaps(rows)
+	if err != nil {
+		t.Fatalf("Reading rows failed: %v", err)
+	}
+	return results
+}
+
+func TestCopyQueryToCSV(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	loadSampleUsers(t, conn, table)
+	query := fmt.Sprintf("SELECT _id, name, age FROM %s ORDER BY _id", table)
+
+	var buf bytes.Buffer
+	n, err := CopyQueryTo(context.Background(), conn, query, &buf, CopyCSV)
+	if err != nil {
+		t.Fatalf("CopyQueryTo failed: %v", err)
+	}
+
+	want := selectRows(t, query)
+	if n != int64(len(want)) {
+		t.Errorf("Expected %d rows exported, got %d", len(want), n)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Parsing CSV failed: %v\n%s", err, buf.String())
+	}
+	// Some servers write a header row
+	if len(records) == len(want)+1 {
+		records = records[1:]
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d CSV rows, got %d:\n%s", len(want), len(records), buf.String())
+	}
+	for i, record := range records {
+		for j, col := range []string{"_id", "name", "age"} {
+			if record[j] != fmt.Sprint(want[i][col]) {
+				t.Errorf("row %d %s: COPY gave %q, SELECT gave %v", i, col, record[j], want[i][col])
+			}
+		}
+	}
+}
+
+// decodeTransitLines decodes transit-JSON COPY output, one map per line, with
+// keyword keys read as plain strings
+func decodeTransitLines(t *testing.T, data []byte) []map[string]interface{} {
+	var docs []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		decoded, ok := xtdb.DecodeValue(line).(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected a transit map, got %q", line)
+		}
+		doc := make(map[string]interface{}, len(decoded))
+		for k, v := range decoded {
+			doc[strings.TrimPrefix(k, "~:")] = v
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func TestCopyQueryToTransitJSON(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	loadSampleUsers(t, conn, table)
+	query := fmt.Sprintf("SELECT _id, name, email FROM %s ORDER BY _id", table)
+
+	var buf bytes.Buffer
+	n, err := CopyQueryTo(context.Background(), conn, query, &buf, CopyTransitJSON)
+	if err != nil {
+		t.Fatalf("CopyQueryTo failed: %v", err)
+	}
+
+	want := selectRows(t, query)
+	got := decodeTransitLines(t, buf.Bytes())
+	if n != int64(len(want)) || len(got) != len(want) {
+		t.Fatalf("Expected %d rows, COPY reported %d and wrote %d", len(want), n, len(got))
+	}
+	for i := range want {
+		for _, col := range []string{"_id", "name", "email"} {
+			if got[i][col] != want[i][col] {
+				t.Errorf("row %d %s: COPY gave %v, SELECT gave %v", i, col, got[i][col], want[i][col])
+			}
+		}
+	}
+}
+
+func TestExportTablesWithCopyFormat(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	users := loadSampleUsers(t, conn, table)
+
+	dir := t.TempDir()
+	manifest, err := ExportTables(context.Background(), conn, dir, []string{table}, WithCopyFormat(CopyTransitJSON))
+	if err != nil {
+		t.Fatalf("ExportTables failed: %v", err)
+	}
+
+	exported := manifest.Tables[0]
+	if exported.Rows != int64(len(users)) {
+		t.Errorf("Expected %d rows, got %d", len(users), exported.Rows)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, exported.File))
+	if err != nil {
+		t.Fatalf("Reading export failed: %v", err)
+	}
+
+	switch exported.Format {
+	case string(CopyTransitJSON):
+		if docs := decodeTransitLines(t, data); len(docs) != len(users) || docs[0]["_id"] == nil {
+			t.Errorf("Expected %d transit documents, got %v", len(users), docs)
+		}
+	case "ndjson":
+		t.Log("Server doesn't support COPY TO; the export fell back to NDJSON")
+		if ids := exportedIDs(t, filepath.Join(dir, exported.File)); len(ids) != len(users) {
+			t.Errorf("Expected %d NDJSON documents, got %v", len(users), ids)
+		}
+	default:
+		t.Errorf("Unexpected export format %q", exported.Format)
+	}
+}
+
+func TestCopyRecordsRejectsBadInput(t *testing.T) {
+	records := []map[string]any{{"_id": 1}}
+	if _, err := CopyRecords(context.Background(), nil, "users", records, "transit-msgpack"); err == nil {
+		t.Error("Expected CopyRecords to reject a format it can't encode")
+	}
+	if _, err := CopyRecords(context.Background(), nil, "users; DROP TABLE x", records, "transit-json"); err == nil {
+		t.Error("Expected CopyRecords to reject an invalid table name")
+	}
+	if n, err := CopyRecords(context.Background(), nil, "users", nil, "transit-json"); err != nil || n != 0 {
+		t.Errorf("Expected no records to copy nothing, got %d, %v", n, err)
+	}
+}
+
+// Options are applied before anything reaches the connection, as with
+// InsertRecords
+func TestCopyRecordsOptions(t *testing.T) {
+	ctx := context.Background()
+	bad := []map[string]any{{"_id": "x", "name": "X", "age": "thirty"}}
+	_, err := CopyRecords(ctx, nil, "users", bad, "transit-json", WithSchemas(userSchemaRegistry(t, "users"), SchemaRejectBatch))
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Errorf("Expected a *SchemaError, got %v", err)
+	}
+	if n, err := CopyRecords(ctx, nil, "users", bad, "transit-json", WithSchemas(userSchemaRegistry(t, "users"), SchemaRejectRecord)); n != 0 || !errors.As(err, &schemaErr) {
+		t.Errorf("Expected nothing copied and a *SchemaError, got %d, %v", n, err)
+	}
+
+	ancient := []map[string]any{{"_id": 1, "_valid_from": "1066-10-14T00:00:00Z"}}
+	if _, err := CopyRecords(ctx, nil, "users", ancient, "transit-json"); err == nil {
+		t.Error("Expected the valid-time guard to reject a _valid_from before 1900")
+	}
+	stream := strings.NewReader(`["^ ","~:_id",1,"~:_valid_from","~t1066-10-14T00:00:00Z"]` + "\n")
+	if _, err := CopyFromTransit(ctx, nil, "users", stream, "transit-json", WithValidTimeGuard(ValidTimeGuard{})); err == nil {
+		t.Error("Expected CopyFromTransit to apply the valid-time guard with options")
+	}
+	if _, err := CopyFromTransit(ctx, nil, "users", strings.NewReader(""), "transit-msgpack", WithoutValidTimeGuard()); err == nil {
+		t.Error("Expected options to be refused for a transit-msgpack stream")
+	}
+
+	record := transitValidFrom(map[string]any{"_id": 1, "_valid_from": "2024-01-01T00:00:00Z"})
+	if _, ok := record["_valid_from"].(time.Time); !ok {
+		t.Errorf("Expected a guarded _valid_from to be encoded as an instant, got %T", record["_valid_from"])
+	}
+}
+
+func TestCopyRecordsSampleUsers(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	users, err := fixtures.SampleUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]map[string]any, len(users))
+	for i, u := range users {
+		tags := make([]interface{}, len(u.Tags))
+		for j, tag := range u.Tags {
+			tags[j] = tag
+		}
+		records[i] = map[string]any{
+			"_id": u.ID, "name": u.Name, "age": u.Age, "email": u.Email,
+			"active": u.Active, "salary": u.Salary, "tags": tags,
+			"metadata": map[string]interface{}{
+				"department": u.Metadata.Department,
+				"level":      u.Metadata.Level,
+				"joined":     u.Metadata.Joined,
+			},
+		}
+	}
+
+	n, err := CopyRecords(context.Background(), conn, table, records, "transit-json")
+	if err != nil {
+		t.Fatalf("CopyRecords failed: %v", err)
+	}
+	if n != int64(len(users)) {
+		t.Errorf("Expected %d rows copied, got %d", len(users), n)
+	}
+
+	var count int64
+	if err := conn.QueryRow(context.Background(),
+		fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != int64(len(users)) {
+		t.Errorf("Expected %d rows, got %d", len(users), count)
+	}
+}
+
+func TestValidateTransitStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`["^ ","~:_id","alice","~:email","alice@example.com"]`,
+		`["^ ","~:_id","bob","~:email"`, // truncated
+		``,
+		`["^ ","~:_id","carol"]`,
+		`["^ ","~:_id","dave","~:email",null]`,
+		`{"_id": "eve"}`, // plain JSON, not transit
+		`["^ ","~:_id","frank","~:email","frank@example.com"]`,
+	}, "\n")
+
+	bad, err := ValidateTransitStream(strings.NewReader(stream), []string{"_id", "email"})
+	if err != nil {
+		t.Fatalf("ValidateTransitStream failed: %v", err)
+	}
+	var got []string
+	for _, e := range bad {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"line 2: unexpected end of JSON input",
+		"line 4: missing required email",
+		"line 5: missing required email",
+		"line 6: expected a transit map, got map[string]interface {}",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if bad, err := ValidateTransitStream(strings.NewReader(stream[:strings.Index(stream, "\n")]), []string{"_id"}); err != nil || len(bad) != 0 {
+		t.Errorf("Expected a valid line to pass, got %v, %v", bad, err)
+	}
+}
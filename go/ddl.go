@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUnsupportedDDL is returned (wrapped in a *DDLError) for Postgres DDL that
+// has no XTDB equivalent.
+var ErrUnsupportedDDL = errors.New("unsupported DDL")
+
+// DDLError explains why a DDL statement was rejected by the shim
+type DDLError struct {
+	Statement string
+	Reason    string
+}
+
+func (e *DDLError) Error() string {
+	return fmt.Sprintf("unsupported DDL %q: %s", e.Statement, e.Reason)
+}
+
+func (e *DDLError) Unwrap() error { return ErrUnsupportedDDL }
+
+// DDLShim lets tools ported from Postgres keep issuing DDL against XTDB.
+//
+// XTDB is schemaless: tables spring into existence on first insert and
+// documents carry their own columns, so CREATE TABLE and ALTER TABLE ... ADD
+// COLUMN become no-ops and TRUNCATE becomes a DELETE. Statements that would
+// silently mean something different (indexes, drops, constraints, CREATE
+// TABLE ... AS) are rejected with ErrUnsupportedDDL instead.
+type DDLShim struct {
+	// Disabled sends every statement to XTDB untouched
+	Disabled bool
+}
+
+// ddlNoOp is the translation for statements XTDB doesn't need
+var ddlNoOp = []string{}
+
+var (
+	createTableAsRe = regexp.MustCompile(`(?is)^CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMP|TEMPORARY|UNLOGGED)\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?[\w."]+\s*(?:\([\w\s,"]*\)\s*)?AS\b`)
+	createTableRe   = regexp.MustCompile(`(?is)^CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMP|TEMPORARY|UNLOGGED)\s+)?TABLE\b`)
+	createIndexRe   = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\b`)
+	alterAddColRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?[\w."]+\s+ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?[\w"]+`)
+	alterAddConRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?[\w."]+\s+ADD\s+(?:CONSTRAINT|PRIMARY|UNIQUE|FOREIGN|CHECK|EXCLUDE)\b`)
+	alterTableRe    = regexp.MustCompile(`(?is)^ALTER\s+TABLE\b`)
+	truncateRe      = regexp.MustCompile(`(?is)^TRUNCATE\s+(?:TABLE\s+)?(?:ONLY\s+)?([\w.]+(?:\s*,\s*[\w.]+)*)(?:\s+(?:RESTART|CONTINUE)\s+IDENTITY)?(?:\s+(?:CASCADE|RESTRICT))?$`)
+	dropTableRe     = regexp.MustCompile(`(?is)^DROP\s+TABLE\b`)
+	otherCreateRe   = regexp.MustCompile(`(?is)^(?:CREATE|DROP)\s+(?:OR\s+REPLACE\s+)?(SCHEMA|SEQUENCE|EXTENSION|VIEW|MATERIALIZED\s+VIEW|TYPE|DOMAIN|FUNCTION|TRIGGER|INDEX)\b`)
+	trailingSemiRe  = regexp.MustCompile(`;\s*$`)
+)
+
+// Translate returns the statements to run in place of sql. A non-DDL
+// statement is returned unchanged, a no-op translates to no statements.
+func (s DDLShim) Translate(sql string) ([]string, error) {
+	if s.Disabled {
+		return []string{sql}, nil
+	}
+
+	stmt := trailingSemiRe.ReplaceAllString(strings.TrimSpace(stripLeadingComments(sql)), "")
+
+	switch {
+	case createTableAsRe.MatchString(stmt):
+		return nil, &DDLError{Statement: stmt,
+			Reason: "XTDB creates tables on first insert; copy the rows with INSERT INTO ... SELECT, including an _id"}
+
+	case createTableRe.MatchString(stmt):
+		return ddlNoOp, nil
+
+	case createIndexRe.MatchString(stmt):
+		return nil, &DDLError{Statement: stmt,
+			Reason: "XTDB has no user-defined indexes; it maintains its own storage layout for every column"}
+
+	case alterAddConRe.MatchString(stmt):
+		return nil, &DDLError{Statement: stmt,
+			Reason: "XTDB doesn't enforce constraints; every table is keyed on _id"}
+
+	case alterAddColRe.MatchString(stmt):
+		return ddlNoOp, nil
+
+	case alterTableRe.MatchString(stmt):
+		return nil, &DDLError{Statement: stmt,
+			Reason: "XTDB tables are schemaless; only ADD COLUMN (a no-op) is supported"}
+
+	case truncateRe.MatchString(stmt):
+		tables := strings.Split(truncateRe.FindStringSubmatch(stmt)[1], ",")
+		stmts := make([]string, len(tables))
+		for i, table := range tables {
+			stmts[i] = fmt.Sprintf("DELETE FROM %s WHERE 1=1", strings.TrimSpace(table))
+		}
+		return stmts, nil
+
+	case dropTableRe.MatchString(stmt):
+		return nil, &DDLError{Statement: stmt,
+			Reason: "XTDB tables can't be dropped; use DELETE to end rows or ERASE to remove their history"}
+
+	case otherCreateRe.MatchString(stmt):
+		return nil, &DDLError{Statement: stmt,
+			Reason: "XTDB has no schema objects besides tables, which are created on first insert"}
+	}
+
+	return []string{sql}, nil
+}
+
+// Exec runs sql through Translate, executing the resulting statements in
+// order. No-ops report the original command as their tag.
+func (s DDLShim) Exec(ctx context.Context, conn *pgx.Conn, sql string, args ...any) (pgconn.CommandTag, error) {
+	stmts, err := s.Translate(sql)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	if len(stmts) == 0 {
+		fields := strings.Fields(stripLeadingComments(sql))
+		if len(fields) > 2 {
+			fields = fields[:2]
+		}
+		return pgconn.NewCommandTag(strings.ToUpper(strings.Join(fields, " "))), nil
+	}
+
+	var tag pgconn.CommandTag
+	for _, stmt := range stmts {
+		if stmt != sql {
+			// Translated DDL never takes parameters
+			tag, err = conn.Exec(ctx, tagSQL(ctx, stmt))
+		} else {
+			tag, err = conn.Exec(ctx, tagSQL(ctx, stmt), args...)
+		}
+		if err != nil {
+			return tag, err
+		}
+	}
+	return tag, nil
+}
+
+// stripLeadingComments drops whitespace, -- line comments and /* block
+// comments */ from the start of a statement
+func stripLeadingComments(sql string) string {
+	for {
+		sql = strings.TrimLeft(sql, " \t\r\n")
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			end := strings.IndexByte(sql, '\n')
+			if end < 0 {
+				return ""
+			}
+			sql = sql[end+1:]
+		case strings.HasPrefix(sql, "/*"):
+			end := strings.Index(sql, "*/")
+			if end < 0 {
+				return ""
+			}
+			sql = sql[end+2:]
+		default:
+			return sql
+		}
+	}
+}
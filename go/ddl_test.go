@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDDLShimTranslate(t *testing.T) {
+	shim := DDLShim{}
+
+	cases := []struct {
+		sql      string
+		expected []string
+		unsup    bool
+	}{
+		{"CREATE TABLE IF NOT EXISTS users (id INT PRIMARY KEY, name TEXT)", []string{}, false},
+		{"-- ported from postgres\ncreate table orders (id int);", []string{}, false},
+		{"ALTER TABLE users ADD COLUMN email TEXT", []string{}, false},
+		{"TRUNCATE TABLE users", []string{"DELETE FROM users WHERE 1=1"}, false},
+		{"TRUNCATE a, b CASCADE;", []string{"DELETE FROM a WHERE 1=1", "DELETE FROM b WHERE 1=1"}, false},
+		{"CREATE UNIQUE INDEX users_email ON users (email)", nil, true},
+		{"ALTER TABLE users DROP COLUMN email", nil, true},
+		{"ALTER TABLE orders ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id)", nil, true},
+		{"ALTER TABLE users ADD PRIMARY KEY (id)", nil, true},
+		{"ALTER TABLE users ADD UNIQUE (email)", nil, true},
+		{"ALTER TABLE users ADD CHECK (age > 0)", nil, true},
+		{"ALTER TABLE users ADD COLUMN unique_code TEXT", []string{}, false},
+		{"CREATE TABLE active_users AS SELECT * FROM users WHERE active", nil, true},
+		{"CREATE TEMP TABLE IF NOT EXISTS names (id, name) AS TABLE users", nil, true},
+		{"DROP TABLE users", nil, true},
+		{"CREATE SEQUENCE user_ids", nil, true},
+		{"SELECT * FROM users", []string{"SELECT * FROM users"}, false},
+	}
+
+	for _, tc := range cases {
+		stmts, err := shim.Translate(tc.sql)
+		if tc.unsup {
+			var ddlErr *DDLError
+			if !errors.Is(err, ErrUnsupportedDDL) || !errors.As(err, &ddlErr) {
+				t.Errorf("%q: expected ErrUnsupportedDDL, got %v", tc.sql, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.sql, err)
+			continue
+		}
+		if fmt.Sprint(stmts) != fmt.Sprint(tc.expected) || len(stmts) != len(tc.expected) {
+			t.Errorf("%q: expected %q, got %q", tc.sql, tc.expected, stmts)
+		}
+	}
+
+	disabled := DDLShim{Disabled: true}
+	stmts, err := disabled.Translate("CREATE INDEX idx ON users (email)")
+	if err != nil || len(stmts) != 1 || stmts[0] != "CREATE INDEX idx ON users (email)" {
+		t.Errorf("Disabled shim should pass statements through, got %q, %v", stmts, err)
+	}
+}
+
+func TestDDLShimExec(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+	shim := DDLShim{}
+
+	// CREATE TABLE IF NOT EXISTS succeeds without touching the server
+	tag, err := shim.Exec(ctx, conn,
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (_id TEXT PRIMARY KEY, name TEXT)", table))
+	if err != nil {
+		t.Fatalf("CREATE TABLE should be a no-op, got: %v", err)
+	}
+	if tag.String() != "CREATE TABLE" {
+		t.Errorf("Expected CREATE TABLE tag, got %q", tag.String())
+	}
+
+	_, err = shim.Exec(ctx, conn,
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'a', name: 'A'}, {_id: 'b', name: 'B'}", table))
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	// CREATE INDEX is rejected with a typed error
+	_, err = shim.Exec(ctx, conn, fmt.Sprintf("CREATE INDEX %s_name ON %s (name)", table, table))
+	if !errors.Is(err, ErrUnsupportedDDL) {
+		t.Errorf("Expected ErrUnsupportedDDL for CREATE INDEX, got %v", err)
+	}
+
+	// TRUNCATE is mapped to DELETE FROM
+	if _, err := shim.Exec(ctx, conn, fmt.Sprintf("TRUNCATE TABLE %s", table)); err != nil {
+		t.Fatalf("TRUNCATE failed: %v", err)
+	}
+
+	var count int64
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected 0 rows after TRUNCATE, got %d", count)
+	}
+}
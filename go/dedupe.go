@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithDedupeByID keeps only the last record for each _id and _valid_from in
+// the batch, as when a CDC topic hasn't been compacted yet, so InsertRecords
+// and CopyRecords write each version once rather than upserting it again and
+// again. Records for the same _id at different valid times are versions of
+// the document, and all kept; records without an _id are all kept too.
+func WithDedupeByID() InsertOption {
+	return func(c *insertConfig) { c.dedupe = true }
+}
+
+// dedupeByID returns records with every record but the last for each _id
+// and _valid_from dropped, keeping the survivors in order
+func dedupeByID(records []map[string]interface{}) []map[string]interface{} {
+	last := make(map[string]int, len(records))
+	for i, record := range records {
+		if key, ok := dedupeKey(record); ok {
+			last[key] = i
+		}
+	}
+	if len(last) == len(records) {
+		return records
+	}
+
+	kept := make([]map[string]interface{}, 0, len(last))
+	for i, record := range records {
+		key, ok := dedupeKey(record)
+		if !ok || last[key] == i {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// dedupeKey identifies the version a record writes: its _id, keyed by type
+// too so "1" and 1 stay distinct as they do in XTDB, and its _valid_from,
+// read with NormalizeTimestamp so the same instant matches however it's
+// written. It returns false for a record without an _id.
+func dedupeKey(record map[string]interface{}) (string, bool) {
+	id, ok := record["_id"]
+	if !ok {
+		return "", false
+	}
+	key := fmt.Sprintf("%T:%v", id, id)
+	if raw, ok := record["_valid_from"]; ok {
+		if t, err := NormalizeTimestamp(raw); err == nil {
+			key += "@" + t.UTC().Format(time.RFC3339Nano)
+		} else {
+			key += fmt.Sprintf("@%T:%v", raw, raw)
+		}
+	}
+	return key, true
+}
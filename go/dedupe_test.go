@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// compactedUsers is a CDC batch where alice changed twice and bob once
+func compactedUsers() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"_id": "alice", "status": "new"},
+		{"_id": "bob", "status": "new"},
+		{"_id": "alice", "status": "active"},
+		{"_id": "carol", "status": "new"},
+		{"_id": "bob", "status": "suspended"},
+		{"_id": "alice", "status": "closed"},
+	}
+}
+
+func TestDedupeByID(t *testing.T) {
+	got := dedupeByID(compactedUsers())
+	want := []map[string]interface{}{
+		{"_id": "carol", "status": "new"},
+		{"_id": "bob", "status": "suspended"},
+		{"_id": "alice", "status": "closed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Ids of different types are different documents; records without one
+	// can't be duplicates
+	mixed := []map[string]interface{}{
+		{"_id": "1"}, {"_id": int64(1)}, {"name": "x"}, {"name": "x"},
+	}
+	if got := dedupeByID(mixed); len(got) != len(mixed) {
+		t.Errorf("Expected nothing dropped, got %v", got)
+	}
+
+	// Versions at different valid times are all kept; the same instant,
+	// however it's written, is one version
+	versions := []map[string]interface{}{
+		{"_id": "alice", "_valid_from": "2024-01-01T00:00:00Z", "status": "new"},
+		{"_id": "alice", "_valid_from": "2024-02-01T00:00:00Z", "status": "active"},
+		{"_id": "alice", "_valid_from": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "status": "pending"},
+		{"_id": "alice", "status": "current"},
+	}
+	got = dedupeByID(versions)
+	want = []map[string]interface{}{versions[1], versions[2], versions[3]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestInsertRecordsWithDedupeByID(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	var result InsertResult
+	if err := InsertRecords(ctx, conn, table, compactedUsers(), WithDedupeByID(), WithResult(&result)); err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+	if len(result.Tags) != 3 || result.Deduplicated != 3 {
+		t.Errorf("Expected 3 statements sent and 3 duplicates dropped, got %d and %d",
+			len(result.Tags), result.Deduplicated)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id, status FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got, err := collectMaps(rows)
+	if err != nil {
+		t.Fatalf("Reading rows failed: %v", err)
+	}
+	want := []map[string]interface{}{
+		{"_id": "alice", "status": "closed"},
+		{"_id": "bob", "status": "suspended"},
+		{"_id": "carol", "status": "new"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Only the last version was written, so each has a single row of history
+	var versions int64
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR ALL VALID_TIME", table)).Scan(&versions); err != nil {
+		t.Fatalf("History query failed: %v", err)
+	}
+	if versions != 3 {
+		t.Errorf("Expected 3 versions in total, got %d", versions)
+	}
+}
+
+func TestCopyRecordsWithDedupeByID(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	var result InsertResult
+	n, err := CopyRecords(ctx, conn, table, compactedUsers(), "transit-json", WithDedupeByID(), WithResult(&result))
+	if err != nil {
+		t.Fatalf("CopyRecords failed: %v", err)
+	}
+	if n != 3 || result.Deduplicated != 3 {
+		t.Errorf("Expected 3 rows copied and 3 duplicates dropped, got %d and %d", n, result.Deduplicated)
+	}
+
+	var status string
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT status FROM %s WHERE _id = 'alice'", table)).Scan(&status); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if status != "closed" {
+		t.Errorf("Expected the last alice to win, got %q", status)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotFound is returned (wrapped in a *NotFoundError) by Get when no
+// current document has the id.
+var ErrNotFound = errors.New("document not found")
+
+// NotFoundError names the table and id Get looked for
+type NotFoundError struct {
+	Table string
+	ID    any
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s: no document with _id %v", e.Table, e.ID)
+}
+
+func (e *NotFoundError) Unwrap() error { return ErrNotFound }
+
+// DocumentOption configures RegisterDocument
+type DocumentOption func(*documentType)
+
+// WithDocumentSchema validates documents against schema before Put writes them
+func WithDocumentSchema(schema *JSONSchema) DocumentOption {
+	return func(d *documentType) { d.schema = schema }
+}
+
+// documentType is a struct type registered against a table
+type documentType struct {
+	table   string
+	idField int // index of the field tagged json:"_id"
+	schema  *JSONSchema
+}
+
+var documents = struct {
+	sync.RWMutex
+	byType  map[reflect.Type]*documentType
+	byTable map[string]reflect.Type
+}{byType: map[reflect.Type]*documentType{}, byTable: map[string]reflect.Type{}}
+
+// RegisterDocument associates the struct type T with table, so Put, Get and
+// QueryDocs don't need the table name. T is (de)serialised with
+// encoding/json and must have a field tagged `json:"_id"`. A table or type
+// can only be registered once.
+func RegisterDocument[T any](table string, opts ...DocumentOption) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("registering %s: %v is not a struct", table, typ)
+	}
+
+	doc := &documentType{table: table, idField: -1}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "_id" {
+			doc.idField = i
+			break
+		}
+	}
+	if doc.idField < 0 {
+		return fmt.Errorf("registering %s: %v has no field tagged `json:\"_id\"`", table, typ)
+	}
+	for _, opt := range opts {
+		opt(doc)
+	}
+
+	documents.Lock()
+	defer documents.Unlock()
+	if existing, ok := documents.byTable[table]; ok {
+		return fmt.Errorf("registering %s: table already registered to %v", table, existing)
+	}
+	if existing, ok := documents.byType[typ]; ok {
+		return fmt.Errorf("registering %s: %v already registered to table %s", table, typ, existing.table)
+	}
+	documents.byType[typ] = doc
+	documents.byTable[table] = typ
+	return nil
+}
+
+// lookupDocument finds T's registration
+func lookupDocument[T any]() (*documentType, error) {
+	typ := reflect.TypeFor[T]()
+	documents.RLock()
+	defer documents.RUnlock()
+	doc, ok := documents.byType[typ]
+	if !ok {
+		return nil, fmt.Errorf("%v is not a registered document type", typ)
+	}
+	return doc, nil
+}
+
+// Put inserts doc into its registered table with InsertRecords, validating
+// it first if it was registered with a schema
+func Put[T any](ctx context.Context, conn *pgx.Conn, doc T, opts ...InsertOption) error {
+	dt, err := lookupDocument[T]()
+	if err != nil {
+		return err
+	}
+	if reflect.ValueOf(doc).Field(dt.idField).IsZero() {
+		return fmt.Errorf("%s: document has no _id", dt.table)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("%s: marshaling document: %w", dt.table, err)
+	}
+	// Numbers stay json.Number, so an int64 past 2^53 isn't rounded through
+	// float64 on its way to InsertRecords
+	var record map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return fmt.Errorf("%s: marshaling document: %w", dt.table, err)
+	}
+
+	if dt.schema != nil {
+		schemas := NewSchemaRegistry()
+		schemas.Register(dt.table, dt.schema)
+		opts = append(opts, WithSchemas(schemas, SchemaRejectBatch))
+	}
+	return InsertRecords(ctx, conn, dt.table, []map[string]interface{}{record}, opts...)
+}
+
+// Get reads the current document with the given id, returning a
+// *NotFoundError if there isn't one
+func Get[T any](ctx context.Context, conn *pgx.Conn, id any) (T, error) {
+	var zero T
+	dt, err := lookupDocument[T]()
+	if err != nil {
+		return zero, err
+	}
+	idLit, err := formatLiteral(id)
+	if err != nil {
+		return zero, fmt.Errorf("formatting id: %w", err)
+	}
+
+	docs, err := queryDocs[T](ctx, conn, dt, fmt.Sprintf("SELECT * FROM %s WHERE _id = %s", dt.table, idLit))
+	if err != nil {
+		return zero, err
+	}
+	if len(docs) == 0 {
+		return zero, &NotFoundError{Table: dt.table, ID: id}
+	}
+	return docs[0], nil
+}
+
+// QueryDocs reads the current documents matching where, e.g.
+// QueryDocs[User](ctx, conn, "age > $1", 30). An empty where reads them all.
+func QueryDocs[T any](ctx context.Context, conn *pgx.Conn, where string, args ...any) ([]T, error) {
+	dt, err := lookupDocument[T]()
+	if err != nil {
+		return nil, err
+	}
+	sql := "SELECT * FROM " + dt.table
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	return queryDocs[T](ctx, conn, dt, sql, args...)
+}
+
+func queryDocs[T any](ctx context.Context, conn *pgx.Conn, dt *documentType, sql string, args ...any) ([]T, error) {
+	rows, err := conn.Query(ctx, tagSQL(ctx, sql), args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", dt.table, err)
+	}
+	records, err := collectMaps(rows)
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", dt.table, err)
+	}
+
+	docs := make([]T, len(records))
+	for i, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s: decoding document %v: %w", dt.table, record["_id"], err)
+		}
+		if err := json.Unmarshal(data, &docs[i]); err != nil {
+			return nil, fmt.Errorf("%s: decoding document %v: %w", dt.table, record["_id"], err)
+		}
+	}
+	return docs, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type docAddress struct {
+	City     string   `json:"city"`
+	Postcode string   `json:"postcode"`
+	Lines    []string `json:"lines"`
+}
+
+type docCustomer struct {
+	ID      string     `json:"_id"`
+	Name    string     `json:"name"`
+	Address docAddress `json:"address"`
+}
+
+type docOrder struct {
+	ID       int64   `json:"_id"`
+	Customer string  `json:"customer,omitempty"`
+	Total    float64 `json:"total"`
+}
+
+type docNoID struct {
+	Name string `json:"name"`
+}
+
+// registerDocumentForTest registers T and drops the registration when the
+// test finishes, so tests can re-register with a fresh table
+func registerDocumentForTest[T any](t *testing.T, table string, opts ...DocumentOption) {
+	if err := RegisterDocument[T](table, opts...); err != nil {
+		t.Fatalf("RegisterDocument failed: %v", err)
+	}
+	t.Cleanup(func() {
+		documents.Lock()
+		defer documents.Unlock()
+		delete(documents.byType, reflect.TypeFor[T]())
+		delete(documents.byTable, table)
+	})
+}
+
+func TestRegisterDocumentErrors(t *testing.T) {
+	registerDocumentForTest[docCustomer](t, "reg_customers")
+
+	if err := RegisterDocument[docOrder]("reg_customers"); err == nil {
+		t.Error("Expected duplicate table to be rejected")
+	}
+	if err := RegisterDocument[docCustomer]("reg_customers_2"); err == nil {
+		t.Error("Expected a type registered twice to be rejected")
+	}
+	if err := RegisterDocument[docNoID]("reg_no_id"); err == nil {
+		t.Error("Expected a type without an _id field to be rejected")
+	}
+	if err := RegisterDocument[string]("reg_string"); err == nil {
+		t.Error("Expected a non-struct type to be rejected")
+	}
+	if err := RegisterDocument[docOrder]("bad table"); err == nil {
+		t.Error("Expected an invalid table name to be rejected")
+	}
+	if _, err := lookupDocument[docOrder](); err == nil {
+		t.Error("Failed registrations shouldn't register anything")
+	}
+}
+
+func TestTypedDocuments(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	registerDocumentForTest[docCustomer](t, getCleanTable())
+	registerDocumentForTest[docOrder](t, getCleanTable(), WithDocumentSchema(&JSONSchema{
+		Type: schemaTypes{"object"}, Required: []string{"customer"},
+	}))
+
+	alice := docCustomer{ID: "alice", Name: "Alice", Address: docAddress{
+		City: "London", Postcode: "N1", Lines: []string{"1 High St", "Flat 2"},
+	}}
+	if err := Put(ctx, conn, alice); err != nil {
+		t.Fatalf("Put customer failed: %v", err)
+	}
+	for _, o := range []docOrder{{ID: 1, Customer: "alice", Total: 12.5}, {ID: 2, Customer: "alice", Total: 40}} {
+		if err := Put(ctx, conn, o); err != nil {
+			t.Fatalf("Put order failed: %v", err)
+		}
+	}
+
+	got, err := Get[docCustomer](ctx, conn, "alice")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, alice) {
+		t.Errorf("Round trip changed the document:\n got %+v\nwant %+v", got, alice)
+	}
+
+	big, err := QueryDocs[docOrder](ctx, conn, "total > $1", 20.0)
+	if err != nil {
+		t.Fatalf("QueryDocs failed: %v", err)
+	}
+	if len(big) != 1 || big[0].ID != 2 {
+		t.Errorf("Expected order 2, got %+v", big)
+	}
+
+	// An id past 2^53 survives the round trip exactly
+	huge := docOrder{ID: 1<<53 + 1, Customer: "alice", Total: 1}
+	if err := Put(ctx, conn, huge); err != nil {
+		t.Fatalf("Put order failed: %v", err)
+	}
+	if got, err := Get[docOrder](ctx, conn, huge.ID); err != nil || got != huge {
+		t.Errorf("Expected %+v back, got %+v, %v", huge, got, err)
+	}
+
+	_, err = Get[docOrder](ctx, conn, int64(99))
+	var notFound *NotFoundError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &notFound) || notFound.ID != int64(99) {
+		t.Errorf("Expected *NotFoundError for 99, got %v", err)
+	}
+
+	if err := Put(ctx, conn, docOrder{ID: 3}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Expected schema violation for order without customer, got %v", err)
+	}
+	if err := Put(ctx, conn, docNoID{Name: "x"}); err == nil {
+		t.Error("Expected Put of an unregistered type to fail")
+	}
+}
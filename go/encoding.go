@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// encodingProbeTable is where ProbeEncoding writes its sample document,
+// which it erases again afterwards
+const encodingProbeTable = "xtdb_encoding_probe"
+
+// encodingSamples are multibyte strings that come back mangled when the
+// client and server disagree about the encoding
+var encodingSamples = map[string]string{
+	"accented":  "José Müller, Ångström, façade",
+	"cjk":       "北京 東京 서울",
+	"emoji":     "🚀 👩‍💻 🎉",
+	"rtl":       "שלום مرحبا",
+	"combining": "e\u0301 n\u0303",
+	"astral":    "𝄞 𝔘𝔫𝔦𝔠𝔬𝔡𝔢",
+}
+
+// ProbeEncoding round-trips multibyte strings (accented Latin, CJK, emoji,
+// right-to-left and combining characters) through conn, writing them as SQL
+// literals and reading them back as text, and reports any that don't come
+// back byte for byte, e.g. because client_encoding isn't UTF8.
+func ProbeEncoding(ctx context.Context, conn *pgx.Conn) error {
+	id := fmt.Sprintf("probe-%d", time.Now().UnixNano())
+	doc := map[string]interface{}{"_id": id}
+	for name, s := range encodingSamples {
+		doc[name] = s
+	}
+	sql, err := RecordsSQL(encodingProbeTable, doc)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, tagSQL(ctx, sql)); err != nil {
+		return fmt.Errorf("encoding probe: writing samples: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx),
+		tagSQL(ctx, fmt.Sprintf("ERASE FROM %s WHERE _id = $1", encodingProbeTable)), id)
+
+	names := sortedSampleNames()
+	got := make([]string, len(names))
+	dest := make([]any, len(names))
+	for i := range got {
+		dest[i] = &got[i]
+	}
+	err = conn.QueryRow(ctx, tagSQL(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE _id = $1",
+		strings.Join(names, ", "), encodingProbeTable)), id).Scan(dest...)
+	if err != nil {
+		return fmt.Errorf("encoding probe: reading samples back: %w", err)
+	}
+
+	returned := make(map[string]string, len(names))
+	for i, name := range names {
+		returned[name] = got[i]
+	}
+	if err := compareEncodingSamples(returned); err != nil {
+		return fmt.Errorf("%w (client_encoding=%q, server_encoding=%q)", err,
+			conn.PgConn().ParameterStatus("client_encoding"), conn.PgConn().ParameterStatus("server_encoding"))
+	}
+	return nil
+}
+
+// compareEncodingSamples lists every sample that didn't come back intact
+func compareEncodingSamples(returned map[string]string) error {
+	var mismatches []string
+	for _, name := range sortedSampleNames() {
+		want, got := encodingSamples[name], returned[name]
+		if got != want {
+			mismatches = append(mismatches, fmt.Sprintf("%s: sent %q (% x), got %q (% x)", name, want, want, got, got))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("encoding probe: %d of %d strings changed in transit:\n  %s",
+			len(mismatches), len(encodingSamples), strings.Join(mismatches, "\n  "))
+	}
+	return nil
+}
+
+func sortedSampleNames() []string {
+	names := make([]string, 0, len(encodingSamples))
+	for name := range encodingSamples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompareEncodingSamples(t *testing.T) {
+	intact := map[string]string{}
+	for name, s := range encodingSamples {
+		intact[name] = s
+	}
+	if err := compareEncodingSamples(intact); err != nil {
+		t.Errorf("Expected intact samples to pass, got %v", err)
+	}
+
+	// UTF-8 bytes read back as Latin-1: the classic "JosÃ©"
+	var mangled strings.Builder
+	for _, b := range []byte(encodingSamples["accented"]) {
+		mangled.WriteRune(rune(b))
+	}
+	intact["accented"] = mangled.String()
+	err := compareEncodingSamples(intact)
+	if err == nil || !strings.Contains(err.Error(), "1 of") || !strings.Contains(err.Error(), "JosÃ©") {
+		t.Errorf("Expected the mojibake to be reported, got %v", err)
+	}
+}
+
+func TestProbeEncoding(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	if err := ProbeEncoding(context.Background(), conn); err != nil {
+		t.Errorf("Expected a UTF-8 connection to pass the probe: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// divergentDocuments are five documents that share a table but little else:
+// disjoint fields, age as a number and as a string, address as a nested
+// struct and as a flat string
+func divergentDocuments() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"_id": "a-flat", "name": "Alice", "age": 30},
+		{"_id": "b-disjoint", "sku": "W-1", "price": 9.5},
+		{"_id": "c-retyped", "name": "Bob", "age": "thirty"},
+		{"_id": "d-nested", "name": "Carol", "tags": []interface{}{"x", "y"},
+			"address": map[string]interface{}{"city": "London", "geo": map[string]interface{}{"lat": 51.5, "lon": -0.1}}},
+		{"_id": "e-flattened", "name": "Dave", "address": "Paris"},
+	}
+}
+
+// divergentColumns is the union of every document's fields
+var divergentColumns = []string{"_id", "address", "age", "name", "price", "sku", "tags"}
+
+// seedDivergentTable inserts divergentDocuments as SQL literals, so nested
+// values stay structs, and returns the table
+func seedDivergentTable(t *testing.T, conn *pgx.Conn) string {
+	t.Helper()
+	table := getCleanTable()
+	sql, err := RecordsSQL(table, divergentDocuments()...)
+	if err != nil {
+		t.Fatalf("RecordsSQL failed: %v", err)
+	}
+	if _, err := conn.Exec(context.Background(), sql); err != nil {
+		t.Fatalf("Seeding failed: %v", err)
+	}
+	return table
+}
+
+// TestSchemaEvolution pins how each read path copes with documents of
+// different shapes in one table
+func TestSchemaEvolution(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+	table := seedDivergentTable(t, conn)
+
+	t.Run("select star", func(t *testing.T) {
+		// SELECT * returns the union of all fields, NULL where a document lacks one
+		rows, err := conn.Query(ctx, fmt.Sprintf("SELECT * FROM %s ORDER BY _id", table))
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		docs, err := collectMaps(rows)
+		if err != nil {
+			t.Fatalf("collectMaps failed: %v", err)
+		}
+		if len(docs) != 5 {
+			t.Fatalf("Expected 5 documents, got %d", len(docs))
+		}
+		var columns []string
+		for col := range docs[0] {
+			columns = append(columns, col)
+		}
+		sort.Strings(columns)
+		if fmt.Sprint(columns) != fmt.Sprint(divergentColumns) {
+			t.Errorf("Expected columns %v, got %v", divergentColumns, columns)
+		}
+
+		byID := map[string]map[string]interface{}{}
+		for _, doc := range docs {
+			byID[fmt.Sprint(doc["_id"])] = doc
+		}
+		if byID["b-disjoint"]["name"] != nil || byID["a-flat"]["sku"] != nil {
+			t.Errorf("Expected missing fields as NULL, got %v and %v", byID["b-disjoint"], byID["a-flat"])
+		}
+		// A column holding two types comes back with each value's own type
+		if fmt.Sprint(byID["a-flat"]["age"]) != "30" || byID["c-retyped"]["age"] != "thirty" {
+			t.Errorf("Expected age 30 and \"thirty\", got %#v and %#v", byID["a-flat"]["age"], byID["c-retyped"]["age"])
+		}
+		AssertShape(t, byID["d-nested"], Shape{
+			"address": Shape{"city": KindString, "geo": Shape{"lat": KindNumber, "lon": KindNumber}},
+			"tags":    ArrayOf(KindString),
+		})
+		if byID["e-flattened"]["address"] != "Paris" {
+			t.Errorf("Expected the flat address as a string, got %#v", byID["e-flattened"]["address"])
+		}
+	})
+
+	t.Run("struct scan", func(t *testing.T) {
+		// Pointer fields scan missing values as nil
+		type person struct {
+			ID   string  `db:"_id"`
+			Name *string `db:"name"`
+		}
+		rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id, name FROM %s ORDER BY _id", table))
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		people, err := pgx.CollectRows(rows, pgx.RowToStructByName[person])
+		if err != nil {
+			t.Fatalf("CollectRows failed: %v", err)
+		}
+		if len(people) != 5 || people[1].ID != "b-disjoint" || people[1].Name != nil || people[0].Name == nil || *people[0].Name != "Alice" {
+			t.Errorf("Unexpected scan: %+v", people)
+		}
+	})
+
+	t.Run("documents", func(t *testing.T) {
+		// QueryDocs fills what matches and errors, naming the document, on a type clash
+		type evolvedDoc struct {
+			ID   string `json:"_id"`
+			Name string `json:"name"`
+			Age  int    `json:"age"`
+		}
+		registerDocumentForTest[evolvedDoc](t, table)
+
+		docs, err := QueryDocs[evolvedDoc](ctx, conn, "_id IN ('a-flat', 'b-disjoint')")
+		if err != nil {
+			t.Fatalf("QueryDocs failed: %v", err)
+		}
+		if len(docs) != 2 {
+			t.Fatalf("Expected 2 documents, got %v", docs)
+		}
+		for _, doc := range docs {
+			if doc.ID == "b-disjoint" && (doc.Name != "" || doc.Age != 0) {
+				t.Errorf("Expected missing fields as zero values, got %+v", doc)
+			}
+			if doc.ID == "a-flat" && (doc.Name != "Alice" || doc.Age != 30) {
+				t.Errorf("Unexpected document %+v", doc)
+			}
+		}
+
+		_, err = QueryDocs[evolvedDoc](ctx, conn, "_id = 'c-retyped'")
+		if err == nil || !strings.Contains(err.Error(), "c-retyped") {
+			t.Errorf("Expected a string age to fail naming c-retyped, got %v", err)
+		}
+	})
+
+	t.Run("arrow ipc", func(t *testing.T) {
+		// Columns without a native Arrow type degrade to JSON text
+		var buf bytes.Buffer
+		if err := QueryToArrowIPC(ctx, conn, fmt.Sprintf("SELECT * FROM %s ORDER BY _id", table), &buf); err != nil {
+			t.Fatalf("QueryToArrowIPC failed: %v", err)
+		}
+		reader, err := ipc.NewReader(&buf)
+		if err != nil {
+			t.Fatalf("Failed to open IPC stream: %v", err)
+		}
+		defer reader.Release()
+
+		if n := len(reader.Schema().Fields()); n != len(divergentColumns) {
+			t.Errorf("Expected %d fields, got %v", len(divergentColumns), reader.Schema())
+		}
+		for _, name := range []string{"age", "address"} {
+			indices := reader.Schema().FieldIndices(name)
+			if len(indices) != 1 || reader.Schema().Field(indices[0]).Type.ID() != arrow.STRING {
+				t.Errorf("Expected mixed-type %s as a string column, got %v", name, reader.Schema())
+			}
+		}
+		var rows int64
+		for reader.Next() {
+			rows += reader.Record().NumRows()
+		}
+		if rows != 5 {
+			t.Errorf("Expected 5 rows, got %d", rows)
+		}
+	})
+
+	t.Run("adbc", func(t *testing.T) {
+		// Flight SQL reports the union of fields, mixed types as Arrow unions
+		db, adbcConn := getAdbcConn(t)
+		defer db.Close()
+		defer adbcConn.Close()
+
+		stmt, err := adbcConn.NewStatement()
+		if err != nil {
+			t.Fatalf("Failed to create statement: %v", err)
+		}
+		defer stmt.Close()
+		stmt.SetSqlQuery(fmt.Sprintf("SELECT * FROM %s ORDER BY _id", table))
+		reader, _, err := stmt.ExecuteQuery(ctx)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer reader.Release()
+
+		var names []string
+		for _, field := range reader.Schema().Fields() {
+			names = append(names, field.Name)
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(divergentColumns) {
+			t.Errorf("Expected fields %v, got %v", divergentColumns, reader.Schema())
+		}
+		age := reader.Schema().Field(reader.Schema().FieldIndices("age")[0])
+		if !strings.Contains(age.Type.String(), "union") {
+			t.Errorf("Expected age as a union of its types, got %v", age.Type)
+		}
+		var rows int64
+		for reader.Next() {
+			rows += reader.Record().NumRows()
+		}
+		if rows != 5 {
+			t.Errorf("Expected 5 rows, got %d", rows)
+		}
+	})
+
+	t.Run("transit", func(t *testing.T) {
+		// NEST_ONE through the transit fallback decodes each shape as written
+		transit := getConnTransit(t)
+		defer transit.Close(ctx)
+
+		want := map[string]Shape{
+			"a-flat":      {"name": KindString, "age": KindNumber},
+			"b-disjoint":  {"sku": KindString, "price": KindNumber},
+			"c-retyped":   {"name": KindString, "age": KindString},
+			"d-nested":    {"address": Shape{"geo": Shape{"lat": KindNumber}}, "tags": ArrayOf(KindString)},
+			"e-flattened": {"address": KindString},
+		}
+		for id, shape := range want {
+			var raw interface{}
+			err := transit.QueryRow(ctx, fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = '%s') AS r", table, id)).Scan(&raw)
+			if err != nil {
+				t.Fatalf("%s: query failed: %v", id, err)
+			}
+			AssertShape(t, xtdb.StripKeywordKeys(xtdb.DecodeValue(raw)), shape)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		// NDJSON export writes every document whatever its shape
+		dir := t.TempDir()
+		manifest, err := ExportTables(ctx, conn, dir, []string{table})
+		if err != nil {
+			t.Fatalf("ExportTables failed: %v", err)
+		}
+		if len(manifest.Tables) != 1 || manifest.Tables[0].Rows != 5 {
+			t.Errorf("Unexpected manifest: %+v", manifest)
+		}
+		ids := exportedIDs(t, filepath.Join(dir, table+".ndjson"))
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != "[a-flat b-disjoint c-retyped d-nested e-flattened]" {
+			t.Errorf("Expected every document exported, got %v", ids)
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ExportManifest describes an ExportTables run; it's written alongside the
+// data as manifest.json
+type ExportManifest struct {
+	ExportedAt time.Time `json:"exported_at"`
+	// Basis is the system time every table was read as of, for snapshot
+	// exports; nil means each table was read as it stood when exported
+	Basis  *time.Time      `json:"basis,omitempty"`
+	Tables []ExportedTable `json:"tables"`
+}
+
+// ExportedTable is one table's file in an export
+type ExportedTable struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Format string `json:"format"` // "ndjson", or the CopyFormat the file was written in
+	Rows   int64  `json:"rows"`
+}
+
+// ExportOption configures ExportTables
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	snapshot   bool
+	copyFormat CopyFormat
+	// afterTable lets tests act between tables
+	afterTable func(table string)
+}
+
+// WithSnapshot exports every table as of a single basis - the system time of
+// the latest committed transaction when the export starts - so related
+// tables are consistent with each other even if writes land mid-export
+func WithSnapshot() ExportOption {
+	return func(c *exportConfig) { c.snapshot = true }
+}
+
+// WithCopyFormat exports each table with COPY ... TO STDOUT in format,
+// written to dir/<table>.<format>, rather than decoding it row by row. If
+// the server doesn't support COPY ... TO, the table falls back to NDJSON
+// (the manifest records which format each file is in); any other COPY
+// failure fails the export.
+func WithCopyFormat(format CopyFormat) ExportOption {
+	return func(c *exportConfig) { c.copyFormat = format }
+}
+
+// ExportTables writes the current rows of each table to dir/<table>.ndjson,
+// one JSON document per line, plus dir/manifest.json
+func ExportTables(ctx context.Context, conn *pgx.Conn, dir string, tables []string, opts ...ExportOption) (ExportManifest, error) {
+	var cfg exportConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	manifest := ExportManifest{ExportedAt: time.Now().UTC()}
+	for _, table := range tables {
+		if err := checkTable(table); err != nil {
+			return manifest, err
+		}
+	}
+	if cfg.copyFormat != "" && !cfg.copyFormat.valid() {
+		return manifest, fmt.Errorf("unsupported COPY format %q", cfg.copyFormat)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return manifest, err
+	}
+
+	if cfg.snapshot {
+		basis, err := currentBasis(ctx, conn)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Basis = &basis
+	}
+
+	for _, table := range tables {
+		sql := fmt.Sprintf("SELECT * FROM %s", table)
+		if manifest.Basis != nil {
+			ts := timestampLiteral(*manifest.Basis)
+			sql = fmt.Sprintf("SELECT * FROM %s FOR SYSTEM_TIME AS OF %s FOR VALID_TIME AS OF %s", table, ts, ts)
+		}
+
+		exported, err := exportTable(ctx, conn, cfg, sql, dir, table)
+		if err != nil {
+			return manifest, fmt.Errorf("exporting %s: %w", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, exported)
+
+		if cfg.afterTable != nil {
+			cfg.afterTable(table)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0o644)
+}
+
+// currentBasis returns the system time of the latest committed transaction
+func currentBasis(ctx context.Context, conn *pgx.Conn) (time.Time, error) {
+	var basis *time.Time
+	if err := conn.QueryRow(ctx, tagSQL(ctx, "SELECT MAX(system_time) FROM xt.txs WHERE committed = TRUE")).Scan(&basis); err != nil {
+		return time.Time{}, fmt.Errorf("finding snapshot basis: %w", err)
+	}
+	if basis == nil {
+		return time.Time{}, fmt.Errorf("finding snapshot basis: no committed transactions")
+	}
+	return basis.UTC(), nil
+}
+
+// exportTable writes one table's rows, with COPY if cfg asks for it and the
+// server obliges, otherwise as NDJSON
+func exportTable(ctx context.Context, conn *pgx.Conn, cfg exportConfig, sql, dir, table string) (ExportedTable, error) {
+	if cfg.copyFormat != "" {
+		file := table + "." + string(cfg.copyFormat)
+		n, err := exportCopy(ctx, conn, sql, filepath.Join(dir, file), cfg.copyFormat)
+		if err == nil {
+			return ExportedTable{Name: table, File: file, Format: string(cfg.copyFormat), Rows: n}, nil
+		}
+		os.Remove(filepath.Join(dir, file))
+		if !copyUnsupported(err) {
+			return ExportedTable{}, err
+		}
+	}
+
+	file := table + ".ndjson"
+	n, err := exportQuery(ctx, conn, sql, filepath.Join(dir, file))
+	if err != nil {
+		return ExportedTable{}, err
+	}
+	return ExportedTable{Name: table, File: file, Format: "ndjson", Rows: n}, nil
+}
+
+// copyUnsupported reports whether err is the server refusing COPY ... TO
+// itself, feature_not_supported. A syntax error, a failure part way
+// through, or a file that couldn't be written isn't, and falling back would
+// only run the query again and hide it.
+func copyUnsupported(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "0A000"
+}
+
+// exportCopy writes the results of sql to path with CopyQueryTo
+func exportCopy(ctx context.Context, conn *pgx.Conn, sql, path string, format CopyFormat) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	n, err := CopyQueryTo(ctx, conn, sql, w, format)
+	if err != nil {
+		return n, err
+	}
+	if err := w.Flush(); err != nil {
+		return n, err
+	}
+	return n, f.Close()
+}
+
+// exportQuery writes each row of sql to path as NDJSON, omitting NULL fields
+func exportQuery(ctx context.Context, conn *pgx.Conn, sql, path string) (int64, error) {
+	rows, err := conn.Query(ctx, tagSQL(ctx, sql))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	var n int64
+	fieldDescs := rows.FieldDescriptions()
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return n, err
+		}
+		doc := make(map[string]interface{}, len(fieldDescs))
+		for i, fd := range fieldDescs {
+			if values[i] != nil {
+				doc[fd.Name] = values[i]
+			}
+		}
+		if err := enc.Encode(doc); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if err := w.Flush(); err != nil {
+		return n, err
+	}
+	return n, f.Close()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// exportedIDs reads the _id of every document in an exported file
+func exportedIDs(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Opening export failed: %v", err)
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("Bad export line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, fmt.Sprint(doc["_id"]))
+	}
+	return ids
+}
+
+func TestExportTablesSnapshot(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	orders, lines := getCleanTable(), getCleanTable()
+
+	for _, stmt := range []string{
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'o1'}", orders),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'o1-l1', order_id: 'o1'}", lines),
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	// Write a new order and its line after the first table has been exported
+	writer := getConn(t)
+	defer writer.Close(ctx)
+	lateWrite := func(table string) {
+		if table != orders {
+			return
+		}
+		for _, stmt := range []string{
+			fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'o2'}", orders),
+			fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'o2-l1', order_id: 'o2'}", lines),
+		} {
+			if _, err := writer.Exec(ctx, stmt); err != nil {
+				t.Fatalf("Late insert failed: %v", err)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	manifest, err := ExportTables(ctx, conn, dir, []string{orders, lines}, WithSnapshot(),
+		func(c *exportConfig) { c.afterTable = lateWrite })
+	if err != nil {
+		t.Fatalf("ExportTables failed: %v", err)
+	}
+
+	if manifest.Basis == nil {
+		t.Fatal("Snapshot export should record its basis")
+	}
+	if ids := exportedIDs(t, filepath.Join(dir, orders+".ndjson")); fmt.Sprint(ids) != "[o1]" {
+		t.Errorf("Expected only o1 in orders, got %v", ids)
+	}
+	if ids := exportedIDs(t, filepath.Join(dir, lines+".ndjson")); fmt.Sprint(ids) != "[o1-l1]" {
+		t.Errorf("Expected the late line to be excluded, got %v", ids)
+	}
+
+	var onDisk ExportManifest
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil || json.Unmarshal(data, &onDisk) != nil || onDisk.Basis == nil || !onDisk.Basis.Equal(*manifest.Basis) {
+		t.Errorf("manifest.json should carry the basis, got %s (%v)", data, err)
+	}
+
+	// Without a snapshot, a fresh export sees the late write
+	current, err := ExportTables(ctx, conn, t.TempDir(), []string{lines})
+	if err != nil || current.Basis != nil || current.Tables[0].Rows != 2 {
+		t.Errorf("Expected a basis-less export of 2 lines, got %+v, %v", current, err)
+	}
+}
+
+func TestCopyUnsupported(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("copying query results: %w", &pgconn.PgError{Code: "0A000"}), true},
+		{&pgconn.PgError{Code: "42601", Message: "mismatched input 'COPY'"}, false},
+		{&pgconn.PgError{Code: "42P01", Message: "table not found"}, false},
+		{fmt.Errorf("copying query results: %w", io.ErrUnexpectedEOF), false},
+		{os.ErrPermission, false},
+	}
+	for _, c := range cases {
+		if got := copyUnsupported(c.err); got != c.want {
+			t.Errorf("copyUnsupported(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Package fixtures seeds XTDB with the canonical test data and returns the
+// values tests should expect back, so the expectations live next to the data
+// rather than being copied into every test.
+package fixtures
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// XTDB PostgreSQL wire protocol OIDs, as in the example package
+const (
+	transitOID = 16384
+	jsonOID    = 114
+)
+
+// DataDir is the repository's test-data directory
+var DataDir = defaultDataDir()
+
+func defaultDataDir() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "../test-data"
+	}
+	return filepath.Join(filepath.Dir(file), "..", "..", "test-data")
+}
+
+// User is a record from sample-users.json
+type User struct {
+	ID       string       `json:"_id"`
+	Name     string       `json:"name"`
+	Age      int64        `json:"age"`
+	Email    string       `json:"email"`
+	Active   bool         `json:"active"`
+	Salary   float64      `json:"salary"`
+	Tags     []string     `json:"tags"`
+	Metadata UserMetadata `json:"metadata"`
+}
+
+// UserMetadata is a sample user's nested metadata object
+type UserMetadata struct {
+	Department string `json:"department"`
+	Level      int64  `json:"level"`
+	Joined     string `json:"joined"` // a date, kept as the string the file has
+}
+
+// SampleUsers reads the canonical users, in _id order
+func SampleUsers() ([]User, error) {
+	content, err := os.ReadFile(filepath.Join(DataDir, "sample-users.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading sample users: %w", err)
+	}
+	var users []User
+	if err := json.Unmarshal(content, &users); err != nil {
+		return nil, fmt.Errorf("parsing sample users: %w", err)
+	}
+	return users, nil
+}
+
+// LoadSampleUsers inserts sample-users.json into table a record at a time
+// with the JSON OID, and returns the users it inserted
+func LoadSampleUsers(ctx context.Context, conn *pgx.Conn, table string) ([]User, error) {
+	content, err := os.ReadFile(filepath.Join(DataDir, "sample-users.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading sample users: %w", err)
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("parsing sample users: %w", err)
+	}
+	for i, user := range raw {
+		if err := insertParam(ctx, conn, table, user, jsonOID); err != nil {
+			return nil, fmt.Errorf("inserting user %d: %w", i, err)
+		}
+	}
+	return SampleUsers()
+}
+
+// LoadSampleUsersTransit inserts sample-users-transit.json into table a line
+// at a time with the transit OID, and returns the users it inserted
+func LoadSampleUsersTransit(ctx context.Context, conn *pgx.Conn, table string) ([]User, error) {
+	content, err := os.ReadFile(filepath.Join(DataDir, "sample-users-transit.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading transit users: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := insertParam(ctx, conn, table, line, transitOID); err != nil {
+			return nil, fmt.Errorf("inserting line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading transit users: %w", err)
+	}
+	return SampleUsers()
+}
+
+// CopySampleUsers loads the transit-json or transit-msgpack sample users into
+// table with COPY ... FROM STDIN, and returns the users it loaded. The
+// connection needs fallback_output_format=transit.
+func CopySampleUsers(ctx context.Context, conn *pgx.Conn, table, format string) ([]User, error) {
+	var file string
+	switch format {
+	case "transit-json":
+		file = "sample-users-transit.json"
+	case "transit-msgpack":
+		file = "sample-users-transit.msgpack"
+	default:
+		return nil, fmt.Errorf("unsupported COPY format %q", format)
+	}
+	f, err := os.Open(filepath.Join(DataDir, file))
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", file, err)
+	}
+	defer f.Close()
+
+	sql := fmt.Sprintf("COPY %s FROM STDIN WITH (FORMAT '%s')", table, format)
+	if _, err := conn.PgConn().CopyFrom(ctx, f, sql); err != nil {
+		return nil, fmt.Errorf("copying %s: %w", file, err)
+	}
+	return SampleUsers()
+}
+
+// WideDocument is document i of LoadWideDocuments: forty fields covering
+// strings, integers, floats, booleans, nulls, arrays and nested objects
+func WideDocument(i int) map[string]interface{} {
+	doc := map[string]interface{}{"_id": fmt.Sprintf("wide-%03d", i)}
+	for f := 0; f < 8; f++ {
+		doc[fmt.Sprintf("str_%d", f)] = fmt.Sprintf("doc %d field %d", i, f)
+		doc[fmt.Sprintf("int_%d", f)] = int64(i*100 + f)
+		doc[fmt.Sprintf("float_%d", f)] = float64(i) + float64(f)/8
+		doc[fmt.Sprintf("bool_%d", f)] = (i+f)%2 == 0
+	}
+	for f := 0; f < 3; f++ {
+		doc[fmt.Sprintf("list_%d", f)] = []interface{}{int64(i), int64(f), fmt.Sprintf("item-%d", f)}
+		doc[fmt.Sprintf("nested_%d", f)] = map[string]interface{}{
+			"level": int64(f),
+			"label": fmt.Sprintf("nested %d of doc %d", f, i),
+			"inner": map[string]interface{}{"flag": f == 0},
+		}
+	}
+	doc["nothing"] = nil
+	return doc
+}
+
+// LoadWideDocuments inserts n wide documents (see WideDocument) into table
+// and returns them
+func LoadWideDocuments(ctx context.Context, conn *pgx.Conn, table string, n int) ([]map[string]interface{}, error) {
+	docs := make([]map[string]interface{}, n)
+	for i := range docs {
+		docs[i] = WideDocument(i)
+		encoded, err := json.Marshal(docs[i])
+		if err != nil {
+			return nil, fmt.Errorf("document %d: marshaling: %w", i, err)
+		}
+		if err := insertParam(ctx, conn, table, encoded, jsonOID); err != nil {
+			return nil, fmt.Errorf("inserting document %d: %w", i, err)
+		}
+	}
+	return docs, nil
+}
+
+// Version is one version of an entity in valid time. ValidTo is zero for the
+// current version.
+type Version struct {
+	ValidFrom time.Time
+	ValidTo   time.Time
+	Record    map[string]interface{}
+}
+
+// TimelineStart is when the first version of a temporal timeline is valid from
+var TimelineStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TimelineStep separates the versions of a temporal timeline
+const TimelineStep = 30 * 24 * time.Hour
+
+// TemporalTimeline is the history LoadTemporalTimeline writes: versions
+// contiguous versions of id, TimelineStep apart from TimelineStart, each
+// with a version number and a status that cycles through draft, active and
+// archived
+func TemporalTimeline(id interface{}, versions int) []Version {
+	statuses := []string{"draft", "active", "archived"}
+	timeline := make([]Version, versions)
+	for v := range timeline {
+		from := TimelineStart.Add(time.Duration(v) * TimelineStep)
+		timeline[v] = Version{
+			ValidFrom: from,
+			Record: map[string]interface{}{
+				"_id":     id,
+				"version": int64(v + 1),
+				"status":  statuses[v%len(statuses)],
+			},
+		}
+		if v > 0 {
+			timeline[v-1].ValidTo = from
+		}
+	}
+	return timeline
+}
+
+// LoadTemporalTimeline writes TemporalTimeline(id, versions) into table, one
+// insert per version with its _valid_from, and returns it
+func LoadTemporalTimeline(ctx context.Context, conn *pgx.Conn, table string, id interface{}, versions int) ([]Version, error) {
+	timeline := TemporalTimeline(id, versions)
+	for v, version := range timeline {
+		record := make(map[string]interface{}, len(version.Record)+1)
+		for k, val := range version.Record {
+			record[k] = val
+		}
+		record["_valid_from"] = version.ValidFrom.Format(time.RFC3339Nano)
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: marshaling: %w", v+1, err)
+		}
+		if err := insertParam(ctx, conn, table, encoded, jsonOID); err != nil {
+			return nil, fmt.Errorf("inserting version %d: %w", v+1, err)
+		}
+	}
+	return timeline, nil
+}
+
+// Product is a row of the product catalogue the ADBC examples use
+type Product struct {
+	ID       int64
+	Name     string
+	Price    float64
+	Category string
+}
+
+// Products is the canonical product catalogue, in _id order
+func Products() []Product {
+	return []Product{
+		{ID: 1, Name: "Widget", Price: 19.99, Category: "gadgets"},
+		{ID: 2, Name: "Gizmo", Price: 29.99, Category: "gadgets"},
+		{ID: 3, Name: "Thingamajig", Price: 9.99, Category: "misc"},
+	}
+}
+
+// ProductsInsertSQL is an INSERT ... RECORDS statement for Products, for
+// clients (such as ADBC) that can't send parameters with an OID
+func ProductsInsertSQL(table string) string {
+	var records []string
+	for _, p := range Products() {
+		records = append(records, fmt.Sprintf("{_id: %d, name: '%s', price: %v, category: '%s'}",
+			p.ID, strings.ReplaceAll(p.Name, "'", "''"), p.Price, strings.ReplaceAll(p.Category, "'", "''")))
+	}
+	return fmt.Sprintf("INSERT INTO %s RECORDS %s", table, strings.Join(records, ", "))
+}
+
+// insertParam runs INSERT INTO table RECORDS $1 with param sent as oid
+func insertParam(ctx context.Context, conn *pgx.Conn, table string, param []byte, oid uint32) error {
+	sql := fmt.Sprintf("INSERT INTO %s RECORDS $1", table)
+	result := conn.PgConn().ExecParams(ctx, sql,
+		[][]byte{param}, // parameter values
+		[]uint32{oid},   // parameter OIDs
+		[]int16{0},      // parameter formats (0 = text)
+		[]int16{0})      // result formats (0 = text)
+	_, err := result.Close()
+	return err
+}
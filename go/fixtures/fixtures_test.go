@@ -0,0 +1,148 @@
+package fixtures
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// These tests pin the canonical dataset, so every suite that asserts against
+// the fixtures is asserting against the same values.
+
+func TestSampleUsers(t *testing.T) {
+	users, err := SampleUsers()
+	if err != nil {
+		t.Fatalf("SampleUsers failed: %v", err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("Expected 3 users, got %d", len(users))
+	}
+
+	alice := users[0]
+	if alice.ID != "alice" || alice.Name != "Alice Smith" || alice.Age != 30 || !alice.Active ||
+		alice.Email != "alice@example.com" || alice.Salary != 125000.5 {
+		t.Errorf("Unexpected first user %+v", alice)
+	}
+	if strings.Join(alice.Tags, ",") != "admin,developer" {
+		t.Errorf("Expected tags admin,developer, got %v", alice.Tags)
+	}
+	if alice.Metadata != (UserMetadata{Department: "Engineering", Level: 5, Joined: "2020-01-15"}) {
+		t.Errorf("Unexpected metadata %+v", alice.Metadata)
+	}
+
+	for i := 1; i < len(users); i++ {
+		if users[i-1].ID >= users[i].ID {
+			t.Errorf("Expected users in _id order, got %q before %q", users[i-1].ID, users[i].ID)
+		}
+	}
+}
+
+// The transit file must carry the same users as the JSON one
+func TestSampleUsersTransitMatchesJSON(t *testing.T) {
+	users, err := SampleUsers()
+	if err != nil {
+		t.Fatalf("SampleUsers failed: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(DataDir, "sample-users-transit.json"))
+	if err != nil {
+		t.Fatalf("Opening transit users failed: %v", err)
+	}
+	defer f.Close()
+
+	var i int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if i >= len(users) {
+			t.Fatalf("Transit file has more than %d users", len(users))
+		}
+		record := transitMap(t, line)
+		want := users[i]
+		if record["_id"] != want.ID || record["name"] != want.Name || record["email"] != want.Email ||
+			record["age"] != float64(want.Age) || record["active"] != want.Active || record["salary"] != want.Salary {
+			t.Errorf("Transit user %d %v doesn't match JSON user %+v", i, record, want)
+		}
+		metadata, _ := record["metadata"].([]interface{})
+		if m := transitPairs(metadata); m["joined"] != "~t"+want.Metadata.Joined || m["department"] != want.Metadata.Department {
+			t.Errorf("Transit user %d metadata %v doesn't match %+v", i, m, want.Metadata)
+		}
+		i++
+	}
+	if i != len(users) {
+		t.Errorf("Expected %d transit users, got %d", len(users), i)
+	}
+}
+
+func transitMap(t *testing.T, line string) map[string]interface{} {
+	t.Helper()
+	var arr []interface{}
+	if err := json.Unmarshal([]byte(line), &arr); err != nil {
+		t.Fatalf("Parsing transit line failed: %v", err)
+	}
+	return transitPairs(arr)
+}
+
+// transitPairs reads a ["^ ", k, v, ...] transit map, without decoding values
+func transitPairs(arr []interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if len(arr) == 0 || arr[0] != "^ " {
+		return m
+	}
+	for i := 1; i+1 < len(arr); i += 2 {
+		key, _ := arr[i].(string)
+		m[strings.TrimPrefix(key, "~:")] = arr[i+1]
+	}
+	return m
+}
+
+func TestWideDocument(t *testing.T) {
+	doc := WideDocument(7)
+	if doc["_id"] != "wide-007" {
+		t.Errorf("Expected _id wide-007, got %v", doc["_id"])
+	}
+	if len(doc) != 40 {
+		t.Errorf("Expected 40 fields, got %d", len(doc))
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("Expected a JSON-encodable document: %v", err)
+	}
+}
+
+func TestTemporalTimeline(t *testing.T) {
+	timeline := TemporalTimeline("order-1", 4)
+	if len(timeline) != 4 {
+		t.Fatalf("Expected 4 versions, got %d", len(timeline))
+	}
+	if !timeline[0].ValidFrom.Equal(TimelineStart) {
+		t.Errorf("Expected the first version from %v, got %v", TimelineStart, timeline[0].ValidFrom)
+	}
+	for v := 1; v < len(timeline); v++ {
+		if !timeline[v-1].ValidTo.Equal(timeline[v].ValidFrom) {
+			t.Errorf("Version %d ends at %v but version %d starts at %v", v, timeline[v-1].ValidTo, v+1, timeline[v].ValidFrom)
+		}
+		if timeline[v].Record["version"] != int64(v+1) {
+			t.Errorf("Expected version %d, got %v", v+1, timeline[v].Record["version"])
+		}
+	}
+	if !timeline[3].ValidTo.IsZero() {
+		t.Errorf("Expected the last version to be open-ended, got %v", timeline[3].ValidTo)
+	}
+}
+
+func TestProductsInsertSQL(t *testing.T) {
+	got := ProductsInsertSQL("products")
+	want := "INSERT INTO products RECORDS " +
+		"{_id: 1, name: 'Widget', price: 19.99, category: 'gadgets'}, " +
+		"{_id: 2, name: 'Gizmo', price: 29.99, category: 'gadgets'}, " +
+		"{_id: 3, name: 'Thingamajig', price: 9.99, category: 'misc'}"
+	if got != want {
+		t.Errorf("ProductsInsertSQL = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ValidTimeHistogram counts the records in table that were valid at some
+// point during each bucket from, from+bucket, ... up to to, keyed by bucket
+// start. A record valid across several buckets counts in each; one with
+// several versions in a bucket counts once. Like SampleAsOfSeries, the
+// per-bucket queries go in a single batch.
+func ValidTimeHistogram(ctx context.Context, conn *pgx.Conn, table string, bucket time.Duration, from, to time.Time) (map[time.Time]int64, error) {
+	if err := checkTable(table); err != nil {
+		return nil, err
+	}
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket must be positive, got %v", bucket)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("to (%s) must be after from (%s)", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	var starts []time.Time
+	batch := &pgx.Batch{}
+	for start := from; start.Before(to); start = start.Add(bucket) {
+		end := start.Add(bucket)
+		if end.After(to) {
+			end = to
+		}
+		starts = append(starts, start)
+		batch.Queue(tagSQL(ctx, fmt.Sprintf("SELECT COUNT(DISTINCT _id) FROM %s FOR VALID_TIME FROM %s TO %s",
+			table, timestampLiteral(start), timestampLiteral(end))))
+	}
+
+	counts := make(map[time.Time]int64, len(starts))
+	results := conn.SendBatch(ctx, batch)
+	for _, start := range starts {
+		var n int64
+		if err := results.QueryRow().Scan(&n); err != nil {
+			results.Close()
+			return nil, fmt.Errorf("counting %s from %s: %w", table, start.Format(time.RFC3339), err)
+		}
+		counts[start] = n
+	}
+	if err := results.Close(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidTimeHistogram(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	day := func(d, h int) time.Time { return time.Date(2024, 5, d, h, 0, 0, 0, time.UTC) }
+
+	// a: valid all three days; b: 2nd only; c: from midday on the 3rd
+	for _, stmt := range []string{
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'a', _valid_from: %s}", table, timestampLiteral(day(1, 0))),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'b', _valid_from: %s, _valid_to: %s}", table, timestampLiteral(day(2, 6)), timestampLiteral(day(2, 18))),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'c', _valid_from: %s}", table, timestampLiteral(day(3, 12))),
+		// A second version of a within the 2nd mustn't be counted twice
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'a', v: 2, _valid_from: %s}", table, timestampLiteral(day(2, 12))),
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	hist, err := ValidTimeHistogram(ctx, conn, table, 24*time.Hour, day(1, 0), day(4, 0))
+	if err != nil {
+		t.Fatalf("ValidTimeHistogram failed: %v", err)
+	}
+	expected := map[time.Time]int64{day(1, 0): 1, day(2, 0): 2, day(3, 0): 2}
+	if len(hist) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %v", len(expected), hist)
+	}
+	for start, n := range expected {
+		if hist[start] != n {
+			t.Errorf("Bucket %s: expected %d, got %d", start.Format("01-02"), n, hist[start])
+		}
+	}
+
+	hourly, err := ValidTimeHistogram(ctx, conn, table, time.Hour, day(3, 11), day(3, 13))
+	if err != nil {
+		t.Fatalf("Hourly histogram failed: %v", err)
+	}
+	if hourly[day(3, 11)] != 1 || hourly[day(3, 12)] != 2 {
+		t.Errorf("Expected hourly counts 1 then 2, got %v", hourly)
+	}
+
+	if _, err := ValidTimeHistogram(ctx, conn, table, 0, day(1, 0), day(2, 0)); err == nil {
+		t.Error("Expected error for a zero bucket")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// RecordHistory returns every valid-time version of id in table, oldest
+// first, each with its _valid_from and _valid_to
+func RecordHistory(ctx context.Context, conn *pgx.Conn, table string, id any) ([]map[string]interface{}, error) {
+	if err := checkTable(table); err != nil {
+		return nil, err
+	}
+	idLit, err := formatLiteral(id)
+	if err != nil {
+		return nil, fmt.Errorf("formatting id: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf(
+		"SELECT *, _valid_from, _valid_to FROM %s FOR ALL VALID_TIME WHERE _id = %s ORDER BY _valid_from",
+		table, idLit)))
+	if err != nil {
+		return nil, fmt.Errorf("querying history of %v: %w", id, err)
+	}
+	return collectMaps(rows)
+}
+
+// TimelinePoint is the value a record took from At until the next point
+type TimelinePoint struct {
+	At    time.Time
+	Value map[string]interface{}
+}
+
+// ChangeTimeline is RecordHistory shaped for plotting: one point per change,
+// with the document (minus temporal columns) that took effect then
+func ChangeTimeline(ctx context.Context, conn *pgx.Conn, table string, id any) ([]TimelinePoint, error) {
+	versions, err := RecordHistory(ctx, conn, table, id)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]TimelinePoint, 0, len(versions))
+	for _, version := range versions {
+		at, ok := version["_valid_from"].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("unexpected _valid_from %v (%T)", version["_valid_from"], version["_valid_from"])
+		}
+		points = append(points, TimelinePoint{At: at, Value: documentFields(version)})
+	}
+	return points, nil
+}
+
+// ExportHistory writes every valid-time version of every record in table to
+// w, one transit-JSON map per line, ordered by _id and then _valid_from, as
+// the rows arrive. Each version carries its _valid_from and _valid_to
+// (absent while it's still current) and, for reference, the _system_from it
+// was recorded at. Unlike ExportTables, which captures current rows only,
+// the output can rebuild the table's valid-time history with ImportHistory.
+func ExportHistory(ctx context.Context, conn *pgx.Conn, table string, w io.Writer) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf(
+		"SELECT *, _valid_from, _valid_to, _system_from FROM %s FOR ALL VALID_TIME ORDER BY _id, _valid_from",
+		table)))
+	if err != nil {
+		return fmt.Errorf("querying history of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	bw := bufio.NewWriter(w)
+	var encoder xtdb.Encoder
+	fieldDescs := rows.FieldDescriptions()
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return fmt.Errorf("reading history of %s: %w", table, err)
+		}
+		version := make(map[string]interface{}, len(fieldDescs))
+		for i, fd := range fieldDescs {
+			switch v := values[i].(type) {
+			case nil:
+				// SELECT * pads missing columns with NULL, and a current
+				// version has no _valid_to
+			case float64:
+				version[fd.Name] = xtdb.Double(v) // 2.0 must not come back as 2
+			case float32:
+				version[fd.Name] = xtdb.Double(v)
+			default:
+				version[fd.Name] = v
+			}
+		}
+		if _, err := bw.WriteString(encoder.EncodeMap(version) + "\n"); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading history of %s: %w", table, err)
+	}
+	return bw.Flush()
+}
+
+// ImportHistory replays versions written by ExportHistory into table, one
+// INSERT per version with its original _valid_from and _valid_to, so the
+// restored valid-time history matches the exported one, gaps included. It
+// adds to whatever table already holds; restore into an empty table.
+//
+// Each line is sent as it is, as a transit parameter, so values keep the
+// types the export gave them: UUIDs, keywords, sets, and floats that happen
+// to be whole numbers. Nested documents read over a connection without
+// fallback_output_format=transit arrive as JSON, though, so a whole-number
+// float inside one was already exported as an integer.
+//
+// System time can't be restored: XTDB stamps every write with the time of
+// its own transaction, so each restored version's _system_from is the time
+// of the import, and queries FOR SYSTEM_TIME AS OF a moment before it see
+// nothing. The exported _system_from is dropped. Only the valid-time history
+// as of the export is captured in the first place, not versions that later
+// corrections superseded in system time.
+func ImportHistory(ctx context.Context, conn *pgx.Conn, table string, r io.Reader) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	sql := tagSQL(ctx, fmt.Sprintf("INSERT INTO %s RECORDS $1", table))
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), xtdb.MaxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if err := importVersion(ctx, conn, sql, text); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return nil
+}
+
+// importVersion inserts one line of ExportHistory output, less its
+// _system_from
+func importVersion(ctx context.Context, conn *pgx.Conn, sql string, text []byte) error {
+	version, err := xtdb.DecodeLine(text)
+	if err != nil {
+		return err
+	}
+	if _, ok := version["_valid_from"].(time.Time); !ok {
+		return fmt.Errorf("version has no _valid_from timestamp: %v", version["_valid_from"])
+	}
+	record, err := dropTransitKey(text, "_system_from")
+	if err != nil {
+		return err
+	}
+
+	_, err = traceExec(ctx, conn, sql, []any{record}, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return conn.PgConn().ExecParams(ctx, sql,
+			[][]byte{record},     // parameter values
+			[]uint32{TransitOID}, // parameter OIDs - OID 16384
+			[]int16{0},           // parameter formats (0 = text)
+			[]int16{0}).Close()   // result formats (0 = text)
+	})
+	if err != nil {
+		return fmt.Errorf("restoring %v: %w", version["_id"], err)
+	}
+	return nil
+}
+
+// dropTransitKey removes key from a transit-JSON map line, leaving every
+// other value exactly as written
+func dropTransitKey(text []byte, key string) ([]byte, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(text, &items); err != nil {
+		return nil, err
+	}
+	kept := items[:1]
+	for i := 1; i+1 < len(items); i += 2 {
+		var k string
+		if json.Unmarshal(items[i], &k) == nil && k == "~:"+key {
+			continue
+		}
+		kept = append(kept, items[i], items[i+1])
+	}
+	return json.Marshal(kept)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+func TestChangeTimeline(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	times := []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	statuses := []string{"trial", "active", "cancelled"}
+
+	// Insert out of order to show the timeline is sorted by valid time
+	for _, i := range []int{1, 0, 2} {
+		_, err := conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'acct-1', status: '%s', _valid_from: %s}",
+			table, statuses[i], timestampLiteral(times[i])))
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	points, err := ChangeTimeline(ctx, conn, table, "acct-1")
+	if err != nil {
+		t.Fatalf("ChangeTimeline failed: %v", err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 points, got %d: %v", len(points), points)
+	}
+	for i, p := range points {
+		if !p.At.Equal(times[i]) || p.Value["status"] != statuses[i] {
+			t.Errorf("Point %d: expected %s at %v, got %v at %v", i, statuses[i], times[i], p.Value["status"], p.At)
+		}
+		if _, ok := p.Value["_valid_to"]; ok {
+			t.Errorf("Point %d: temporal columns should be stripped, got %v", i, p.Value)
+		}
+	}
+}
+
+// AssertContiguousHistory fails t unless id's valid-time versions in table
+// form one timeline without gaps or overlaps: each version's _valid_to is the
+// next one's _valid_from. Only the last version may be open-ended.
+func AssertContiguousHistory(t testing.TB, conn *pgx.Conn, table string, id any) {
+	t.Helper()
+	history, err := RecordHistory(context.Background(), conn, table, id)
+	if err != nil {
+		t.Errorf("Reading history of %v: %v", id, err)
+		return
+	}
+	if len(history) == 0 {
+		t.Errorf("No history for %v in %s", id, table)
+		return
+	}
+	if err := checkContiguous(history); err != nil {
+		t.Errorf("History of %v in %s isn't contiguous: %v", id, table, err)
+	}
+}
+
+// checkContiguous checks versions ordered by _valid_from, as RecordHistory
+// returns them
+func checkContiguous(history []map[string]interface{}) error {
+	for i := 0; i < len(history)-1; i++ {
+		from, _ := history[i]["_valid_from"].(time.Time)
+		to, ok := history[i]["_valid_to"].(time.Time)
+		next, _ := history[i+1]["_valid_from"].(time.Time)
+		switch {
+		case !ok:
+			return fmt.Errorf("version %d (from %s) is open-ended but version %d starts at %s",
+				i, from.Format(time.RFC3339), i+1, next.Format(time.RFC3339))
+		case to.Before(next):
+			return fmt.Errorf("gap between version %d, valid to %s, and version %d, valid from %s",
+				i, to.Format(time.RFC3339), i+1, next.Format(time.RFC3339))
+		case to.After(next):
+			return fmt.Errorf("version %d, valid to %s, overlaps version %d, valid from %s",
+				i, to.Format(time.RFC3339), i+1, next.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// recordingT records the failures of an assertion under test instead of
+// failing the test running it
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestCheckContiguous(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	version := func(from time.Time, to any) map[string]interface{} {
+		return map[string]interface{}{"_id": 1, "_valid_from": from, "_valid_to": to}
+	}
+
+	cases := []struct {
+		name    string
+		history []map[string]interface{}
+		want    string // "" for contiguous
+	}{
+		{"clean", []map[string]interface{}{version(day(1), day(2)), version(day(2), day(5)), version(day(5), nil)}, ""},
+		{"deleted", []map[string]interface{}{version(day(1), day(2)), version(day(2), day(3))}, ""},
+		{"single", []map[string]interface{}{version(day(1), nil)}, ""},
+		{"gap", []map[string]interface{}{version(day(1), day(2)), version(day(3), nil)}, "gap between version 0"},
+		{"overlap", []map[string]interface{}{version(day(1), day(4)), version(day(3), nil)}, "overlaps version 1"},
+		{"open", []map[string]interface{}{version(day(1), nil), version(day(3), nil)}, "version 0 (from 2024-01-01T00:00:00Z) is open-ended"},
+	}
+	for _, c := range cases {
+		err := checkContiguous(c.history)
+		if c.want == "" && err != nil || c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)) {
+			t.Errorf("%s: got %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestAssertContiguousHistory(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+	table := getCleanTable()
+
+	// Each update ends the previous version where the new one starts
+	for i, month := range []time.Month{1, 2, 3} {
+		sql := fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'acct-1', version: %d, _valid_from: %s}",
+			table, i, timestampLiteral(time.Date(2024, month, 1, 0, 0, 0, 0, time.UTC)))
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	AssertContiguousHistory(t, conn, table, "acct-1")
+
+	// Deleting part of February leaves a gap
+	sql := fmt.Sprintf("DELETE FROM %s FOR PORTION OF VALID_TIME FROM %s TO %s WHERE _id = 'acct-1'", table,
+		timestampLiteral(time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)),
+		timestampLiteral(time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC)))
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	rec := &recordingT{TB: t}
+	AssertContiguousHistory(rec, conn, table, "acct-1")
+	if len(rec.failures) != 1 || !strings.Contains(rec.failures[0], "gap between version 1, valid to 2024-02-10") {
+		t.Errorf("Expected the gap to be reported, got %v", rec.failures)
+	}
+}
+
+func TestImportHistoryRejects(t *testing.T) {
+	ctx := context.Background()
+	if err := ImportHistory(ctx, nil, "bad-table", strings.NewReader("")); err == nil {
+		t.Error("Expected an invalid table name to be rejected")
+	}
+	// Checked before anything is written
+	input := `["^ ","~:_id",1,"~:name","a"]` + "\n"
+	if err := ImportHistory(ctx, nil, "users", strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "line 1: version has no _valid_from") {
+		t.Errorf("Expected a version without _valid_from to be rejected, got %v", err)
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+	table := getCleanTable()
+
+	for i, month := range []time.Month{1, 2, 3} {
+		sql := fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'acct-1', version: %d, balance: %d.5, _valid_from: %s}",
+			table, i, i*100, timestampLiteral(time.Date(2024, month, 1, 0, 0, 0, 0, time.UTC)))
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	// A gap in February, and a record whose times have microseconds
+	sql := fmt.Sprintf("DELETE FROM %s FOR PORTION OF VALID_TIME FROM %s TO %s WHERE _id = 'acct-1'", table,
+		timestampLiteral(time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)),
+		timestampLiteral(time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC)))
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	sql = fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'acct-2', owner: {name: 'Bob', tags: ['x', 'y']}, _valid_from: %s, _valid_to: %s}", table,
+		timestampLiteral(time.Date(2024, 1, 5, 9, 30, 0, 123456000, time.UTC)),
+		timestampLiteral(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)))
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportHistory(ctx, conn, table, &buf); err != nil {
+		t.Fatalf("ExportHistory failed: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 5 {
+		t.Errorf("Expected 5 versions exported, got %d:\n%s", lines, buf.String())
+	}
+
+	restored := getCleanTable()
+	if err := ImportHistory(ctx, conn, restored, &buf); err != nil {
+		t.Fatalf("ImportHistory failed: %v", err)
+	}
+	for _, id := range []string{"acct-1", "acct-2"} {
+		want, err := RecordHistory(ctx, conn, table, id)
+		if err != nil {
+			t.Fatalf("RecordHistory failed: %v", err)
+		}
+		got, err := RecordHistory(ctx, conn, restored, id)
+		if err != nil {
+			t.Fatalf("RecordHistory failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("History of %s differs after the round trip:\ngot  %v\nwant %v", id, got, want)
+		}
+	}
+}
+
+func TestDropTransitKey(t *testing.T) {
+	line := `["^ ","~:_id","~u6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6","~:price",2.0,"~:_system_from","~t2024-01-01T00:00:00Z"]`
+	got, err := dropTransitKey([]byte(line), "_system_from")
+	if err != nil {
+		t.Fatalf("dropTransitKey failed: %v", err)
+	}
+	if want := `["^ ","~:_id","~u6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6","~:price",2.0]`; string(got) != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// UUID ids, and floats that are whole numbers, keep their types through the
+// round trip
+func TestHistoryRoundTripTypes(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+	table := getCleanTable()
+
+	ids := []uuid.UUID{
+		uuid.MustParse("6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6"),
+		uuid.MustParse("0b8d2a4c-7e1f-4a3b-9c5d-6e7f8a9b0c1d"),
+	}
+	var encoder xtdb.Encoder
+	for i, id := range ids {
+		for month := time.January; month <= time.February; month++ {
+			record := encoder.EncodeMap(map[string]interface{}{
+				"_id": id, "price": xtdb.Double(float64(i + int(month))),
+				"_valid_from": time.Date(2024, month, 1, 0, 0, 0, 0, time.UTC),
+			})
+			_, err := conn.PgConn().ExecParams(ctx, fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+				[][]byte{[]byte(record)}, []uint32{TransitOID}, []int16{0}, []int16{0}).Close()
+			if err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ExportHistory(ctx, conn, table, &buf); err != nil {
+		t.Fatalf("ExportHistory failed: %v", err)
+	}
+	restored := getCleanTable()
+	if err := ImportHistory(ctx, conn, restored, &buf); err != nil {
+		t.Fatalf("ImportHistory failed: %v", err)
+	}
+	for _, id := range ids {
+		want, err := RecordHistory(ctx, conn, table, id)
+		if err != nil {
+			t.Fatalf("RecordHistory failed: %v", err)
+		}
+		got, err := RecordHistory(ctx, conn, restored, id)
+		if err != nil {
+			t.Fatalf("RecordHistory failed: %v", err)
+		}
+		if len(got) != 2 || !reflect.DeepEqual(got, want) {
+			t.Errorf("History of %s differs after the round trip:\ngot  %v\nwant %v", id, got, want)
+		}
+		for _, version := range got {
+			if _, ok := version["price"].(float64); !ok {
+				t.Errorf("Expected price to stay a float, got %T %v", version["price"], version["price"])
+			}
+		}
+	}
+}
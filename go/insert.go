@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// InsertOption configures InsertRecords
+type InsertOption func(*insertConfig)
+
+type insertConfig struct {
+	validTime    *ValidTimeGuard
+	schemas      *SchemaRegistry
+	schemaPolicy SchemaPolicy
+	metadata     map[string]interface{}
+	result       *InsertResult
+	transform    Transform
+	dedupe       bool
+	// statementFloor enables deadline budgeting, see WithStatementFloor
+	statementFloor time.Duration
+	// clock lets tests step time between statements; nil is time.Now
+	clock func() time.Time
+}
+
+func newInsertConfig(opts []InsertOption) insertConfig {
+	cfg := insertConfig{validTime: &ValidTimeGuard{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithValidTimeGuard replaces the default guard (reject anything outside
+// 1900..now+1d) applied to each record's _valid_from
+func WithValidTimeGuard(guard ValidTimeGuard) InsertOption {
+	return func(c *insertConfig) { c.validTime = &guard }
+}
+
+// WithoutValidTimeGuard inserts _valid_from values unchecked
+func WithoutValidTimeGuard() InsertOption {
+	return func(c *insertConfig) { c.validTime = nil }
+}
+
+// WithMetadata merges fields into every record, e.g. a source tag or ingest
+// batch id for tracing provenance. Fields the record already has win.
+func WithMetadata(fields map[string]interface{}) InsertOption {
+	return func(c *insertConfig) {
+		if c.metadata == nil {
+			c.metadata = make(map[string]interface{}, len(fields))
+		}
+		for k, v := range fields {
+			c.metadata[k] = v
+		}
+	}
+}
+
+// InsertResult collects the command tags the server returned for an insert
+type InsertResult struct {
+	Tags []pgconn.CommandTag // one per statement sent
+
+	// Deduplicated counts the records WithDedupeByID dropped in favour of a
+	// later record with the same _id and _valid_from
+	Deduplicated int
+}
+
+// RowsAffected totals the rows the server reported across every statement
+func (r *InsertResult) RowsAffected() int64 {
+	var n int64
+	for _, tag := range r.Tags {
+		n += tag.RowsAffected()
+	}
+	return n
+}
+
+// WithResult records the server's command tags in result, which is reset
+// first. On error it holds the tags of the statements that succeeded.
+func WithResult(result *InsertResult) InsertOption {
+	return func(c *insertConfig) {
+		result.Tags = result.Tags[:0]
+		result.Deduplicated = 0
+		c.result = result
+	}
+}
+
+// InsertRecords inserts each record into table with INSERT ... RECORDS $1,
+// sending the record as JSON with an explicit OID (see xtdb_types.go).
+func InsertRecords(ctx context.Context, conn *pgx.Conn, table string, records []map[string]interface{}, opts ...InsertOption) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	cfg := newInsertConfig(opts)
+	records, schemaErr := cfg.batch(table, records)
+	if schemaErr != nil && cfg.schemaPolicy == SchemaRejectBatch {
+		return schemaErr
+	}
+
+	sql := tagSQL(ctx, fmt.Sprintf("INSERT INTO %s RECORDS $1", table))
+	budget := newDeadlineBudget(cfg.statementFloor, len(records))
+	if cfg.clock != nil {
+		budget.now = cfg.clock
+	}
+
+	for i, record := range records {
+		record, err := cfg.prepare(record)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+
+		recordJSON, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("record %d: marshaling: %w", i, err)
+		}
+
+		if err := budget.check(ctx); err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		tag, err := traceExec(ctx, conn, sql, []any{recordJSON}, func(ctx context.Context) (pgconn.CommandTag, error) {
+			return conn.PgConn().ExecParams(ctx, sql,
+				[][]byte{recordJSON}, // parameter values
+				[]uint32{JSONOID},    // parameter OIDs - OID 114
+				[]int16{0},           // parameter formats (0 = text)
+				[]int16{0}).Close()   // result formats (0 = text)
+		})
+		if err != nil {
+			return fmt.Errorf("record %d: insert failed: %w", i, budget.failed(ctx, err))
+		}
+		budget.done()
+		if cfg.result != nil {
+			cfg.result.Tags = append(cfg.result.Tags, tag)
+		}
+	}
+
+	if schemaErr != nil {
+		return schemaErr
+	}
+	return nil
+}
+
+// InsertAndGetValidFrom inserts record, which must have an _id, and returns
+// the _valid_from XTDB gave it: the record's own _valid_from if it had one,
+// otherwise the transaction's system time, taken from the server's clock
+// rather than the client's. It reads back the version with the latest
+// _system_from, so a concurrent write to the same _id can be returned instead.
+func InsertAndGetValidFrom(ctx context.Context, conn *pgx.Conn, table string, record map[string]interface{}) (time.Time, error) {
+	id, ok := record["_id"]
+	if !ok {
+		return time.Time{}, fmt.Errorf("record has no _id")
+	}
+	idLit, err := formatLiteral(id)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("formatting id: %w", err)
+	}
+	if err := InsertRecords(ctx, conn, table, []map[string]interface{}{record}); err != nil {
+		return time.Time{}, err
+	}
+
+	var validFrom time.Time
+	err = conn.QueryRow(ctx, tagSQL(ctx, fmt.Sprintf(
+		"SELECT _valid_from FROM %s FOR ALL VALID_TIME WHERE _id = %s ORDER BY _system_from DESC LIMIT 1",
+		table, idLit))).Scan(&validFrom)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading back _valid_from of %v: %w", id, err)
+	}
+	return validFrom, nil
+}
+
+// batch applies the options that act on a whole batch - the transform,
+// dedupe and schema validation - returning the records to write and a
+// *SchemaError for those that failed validation
+func (c insertConfig) batch(table string, records []map[string]interface{}) ([]map[string]interface{}, error) {
+	records = applyTransform(c.transform, records)
+	if c.dedupe {
+		n := len(records)
+		records = dedupeByID(records)
+		if c.result != nil {
+			c.result.Deduplicated = n - len(records)
+		}
+	}
+	return c.validate(table, records)
+}
+
+// validate checks records against table's schema, returning the ones that
+// passed and a *SchemaError for the rest
+func (c insertConfig) validate(table string, records []map[string]interface{}) ([]map[string]interface{}, error) {
+	if c.schemas == nil {
+		return records, nil
+	}
+
+	var valid []map[string]interface{}
+	var violations []SchemaViolation
+	for _, record := range records {
+		if v := c.schemas.Validate(table, record); len(v) > 0 {
+			violations = append(violations, v...)
+			continue
+		}
+		valid = append(valid, record)
+	}
+	if len(violations) > 0 {
+		return valid, &SchemaError{Violations: violations}
+	}
+	return records, nil
+}
+
+// prepare applies the insert options to a record, copying it if it changes
+func (c insertConfig) prepare(record map[string]interface{}) (map[string]interface{}, error) {
+	if len(c.metadata) > 0 {
+		merged := make(map[string]interface{}, len(record)+len(c.metadata))
+		for k, v := range c.metadata {
+			merged[k] = v
+		}
+		for k, v := range record {
+			merged[k] = v
+		}
+		record = merged
+	}
+
+	if c.validTime == nil {
+		return record, nil
+	}
+	return c.checkValidFrom(record)
+}
+
+// checkValidFrom applies the valid-time guard to the record's _valid_from,
+// read with NormalizeTimestamp, and writes it back as RFC3339 if it changed
+// or arrived in another form
+func (c insertConfig) checkValidFrom(record map[string]interface{}) (map[string]interface{}, error) {
+	raw, ok := record["_valid_from"]
+	if !ok {
+		return record, nil
+	}
+
+	validFrom, err := NormalizeTimestamp(raw)
+	if err != nil {
+		// Leave anything we can't read for XTDB to judge
+		return record, nil
+	}
+
+	checked, err := c.validTime.Check(validFrom)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := raw.(time.Time); ok && checked.Equal(t) {
+		return record, nil
+	}
+	normalized := checked.UTC().Format(time.RFC3339Nano)
+	if raw == normalized {
+		return record, nil
+	}
+
+	copied := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		copied[k] = v
+	}
+	copied["_valid_from"] = normalized
+	return copied, nil
+}
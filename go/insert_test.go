@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInsertRecordsWithResult(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	records := []map[string]interface{}{
+		{"_id": "a", "n": 1},
+		{"_id": "b", "n": 2},
+		{"_id": "c", "n": 3},
+	}
+	var result InsertResult
+	if err := InsertRecords(ctx, conn, table, records, WithResult(&result)); err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+	if len(result.Tags) != len(records) {
+		t.Fatalf("Expected a command tag per record, got %v", result.Tags)
+	}
+	for _, tag := range result.Tags {
+		if !tag.Insert() {
+			t.Errorf("Expected an INSERT command tag, got %q", tag)
+		}
+	}
+	if result.RowsAffected() != int64(len(records)) {
+		t.Errorf("Expected %d rows affected, got %d (%v)", len(records), result.RowsAffected(), result.Tags)
+	}
+
+	// Reusing the result resets it
+	if err := InsertRecords(ctx, conn, table, records[:1], WithResult(&result)); err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+	if len(result.Tags) != 1 {
+		t.Errorf("Expected the result to be reset, got %v", result.Tags)
+	}
+}
+
+func TestInsertAndGetValidFrom(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	validFrom, err := InsertAndGetValidFrom(ctx, conn, table, map[string]interface{}{"_id": "w1", "n": 1})
+	if err != nil {
+		t.Fatalf("InsertAndGetValidFrom failed: %v", err)
+	}
+	// Allow for the server's clock being a little off the client's
+	if skew := time.Since(validFrom); skew < -time.Minute || skew > time.Minute {
+		t.Errorf("Expected _valid_from close to now, got %s", validFrom)
+	}
+
+	// Visible from the returned time on, not just before it
+	count := func(at time.Time) int64 {
+		var n int64
+		err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR VALID_TIME AS OF %s WHERE _id = 'w1'",
+			table, timestampLiteral(at))).Scan(&n)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return n
+	}
+	if count(validFrom) != 1 || count(validFrom.Add(-time.Microsecond)) != 0 {
+		t.Errorf("Expected the record valid from exactly %s", validFrom)
+	}
+
+	// An explicit _valid_from comes back as given
+	at := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	got, err := InsertAndGetValidFrom(ctx, conn, table, map[string]interface{}{"_id": "w2", "_valid_from": at})
+	if err != nil || !got.Equal(at) {
+		t.Errorf("Expected %s, got %s, %v", at, got, err)
+	}
+
+	if _, err := InsertAndGetValidFrom(ctx, conn, table, map[string]interface{}{"n": 1}); err == nil {
+		t.Error("Expected a record without _id rejected")
+	}
+}
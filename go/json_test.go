@@ -2,10 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"testing"
+
+	"github.com/xtdb/driver-examples/go/fixtures"
 )
 
 func TestJSONInsertAndQuery(t *testing.T) {
@@ -59,40 +59,12 @@ func TestJSONLoadSampleData(t *testing.T) {
 
 	table := getCleanTable()
 
-	// Load sample-users.json
-	content, err := os.ReadFile("../test-data/sample-users.json")
+	// Load the canonical sample users
+	users, err := fixtures.LoadSampleUsers(context.Background(), conn, table)
 	if err != nil {
-		t.Fatalf("Failed to read JSON file: %v", err)
-	}
-
-	var users []map[string]interface{}
-	if err := json.Unmarshal(content, &users); err != nil {
-		t.Fatalf("Failed to parse JSON: %v", err)
-	}
-
-	sql := fmt.Sprintf("INSERT INTO %s RECORDS $1", table)
-
-	// Insert using JSON OID (114) with single parameter per record
-	// Use low-level ExecParams to specify OID explicitly
-	pgconn := conn.PgConn()
-	for _, user := range users {
-		userJSON, err := json.Marshal(user)
-		if err != nil {
-			t.Fatalf("Failed to marshal user: %v", err)
-		}
-
-		// Use ExecParams with explicit OID 114 (JSON)
-		result := pgconn.ExecParams(context.Background(), sql,
-			[][]byte{userJSON},       // parameter values
-			[]uint32{JSONOID},        // parameter OIDs - OID 114
-			[]int16{0},               // parameter formats (0 = text)
-			[]int16{0})               // result formats (0 = text)
-
-		_, err = result.Close()
-		if err != nil {
-			t.Fatalf("Insert failed: %v", err)
-		}
+		t.Fatalf("Insert failed: %v", err)
 	}
+	want := users[0]
 
 	// Query back and verify - get ALL columns including nested data
 	rows, err := conn.Query(context.Background(),
@@ -124,13 +96,15 @@ func TestJSONLoadSampleData(t *testing.T) {
 
 		count++
 
+		AssertShape(t, rowMap, sampleUserShape)
+
 		// Verify first record (alice)
 		if count == 1 {
-			if rowMap["_id"] != "alice" {
-				t.Errorf("Expected _id='alice', got %v", rowMap["_id"])
+			if rowMap["_id"] != want.ID {
+				t.Errorf("Expected _id=%q, got %v", want.ID, rowMap["_id"])
 			}
-			if rowMap["name"] != "Alice Smith" {
-				t.Errorf("Expected name='Alice Smith', got %v", rowMap["name"])
+			if rowMap["name"] != want.Name {
+				t.Errorf("Expected name=%q, got %v", want.Name, rowMap["name"])
 			}
 			// Age might be int32, int64, or float64 depending on how pgx decodes it
 			ageVal := rowMap["age"]
@@ -145,29 +119,32 @@ func TestJSONLoadSampleData(t *testing.T) {
 			default:
 				t.Errorf("Expected age to be numeric, got %T: %v", ageVal, ageVal)
 			}
-			if age != 30 {
-				t.Errorf("Expected age=30, got %d", age)
+			if age != want.Age {
+				t.Errorf("Expected age=%d, got %d", want.Age, age)
 			}
-			if active, ok := rowMap["active"].(bool); !ok || !active {
-				t.Errorf("Expected active=true, got %v", rowMap["active"])
+			if active, ok := rowMap["active"].(bool); !ok || active != want.Active {
+				t.Errorf("Expected active=%v, got %v", want.Active, rowMap["active"])
 			}
-			if rowMap["email"] != "alice@example.com" {
-				t.Errorf("Expected email='alice@example.com', got %v", rowMap["email"])
+			if rowMap["email"] != want.Email {
+				t.Errorf("Expected email=%q, got %v", want.Email, rowMap["email"])
 			}
 
 			// Verify salary (float field) - should be native float64
-			if salary, ok := rowMap["salary"].(float64); !ok || salary != 125000.5 {
-				t.Errorf("Expected salary=125000.5 (float64), got %v (type %T)", rowMap["salary"], rowMap["salary"])
+			if salary, ok := rowMap["salary"].(float64); !ok || salary != want.Salary {
+				t.Errorf("Expected salary=%v (float64), got %v (type %T)", want.Salary, rowMap["salary"], rowMap["salary"])
 			}
 
 			// Verify nested array (tags) - should be native []interface{}
 			if tags, ok := rowMap["tags"].([]interface{}); ok {
 				t.Logf("✅ Tags properly typed as []interface{}: %v", tags)
-				if len(tags) != 2 {
-					t.Errorf("Expected 2 tags, got %d", len(tags))
+				if len(tags) != len(want.Tags) {
+					t.Errorf("Expected %d tags, got %d", len(want.Tags), len(tags))
 				} else {
-					if tags[0] != "admin" || tags[1] != "developer" {
-						t.Errorf("Expected tags ['admin', 'developer'], got %v", tags)
+					for i, tag := range want.Tags {
+						if tags[i] != tag {
+							t.Errorf("Expected tags %v, got %v", want.Tags, tags)
+							break
+						}
 					}
 				}
 			} else {
@@ -179,8 +156,8 @@ func TestJSONLoadSampleData(t *testing.T) {
 				t.Logf("✅ Metadata properly typed as map[string]interface{}: %v", metadata)
 
 				// Validate metadata fields
-				if dept, ok := metadata["department"].(string); !ok || dept != "Engineering" {
-					t.Errorf("Expected department='Engineering', got %v (type %T)", metadata["department"], metadata["department"])
+				if dept, ok := metadata["department"].(string); !ok || dept != want.Metadata.Department {
+					t.Errorf("Expected department=%q, got %v (type %T)", want.Metadata.Department, metadata["department"], metadata["department"])
 				}
 
 				// Level might be float64 or int from JSON parsing
@@ -195,15 +172,15 @@ func TestJSONLoadSampleData(t *testing.T) {
 				default:
 					t.Errorf("Expected level to be numeric, got %T: %v", metadata["level"], metadata["level"])
 				}
-				if level != 5 {
-					t.Errorf("Expected level=5, got %d", level)
+				if level != want.Metadata.Level {
+					t.Errorf("Expected level=%d, got %d", want.Metadata.Level, level)
 				}
 
 				// Joined date - should be a string
 				if joined, ok := metadata["joined"].(string); !ok {
 					t.Errorf("Expected joined to be string, got %T: %v", metadata["joined"], metadata["joined"])
-				} else if joined != "2020-01-15" {
-					t.Errorf("Expected joined='2020-01-15', got %v", joined)
+				} else if joined != want.Metadata.Joined {
+					t.Errorf("Expected joined=%q, got %v", want.Metadata.Joined, joined)
 				}
 			} else {
 				t.Errorf("Expected metadata to be map[string]interface{}, got %T: %v", rowMap["metadata"], rowMap["metadata"])
@@ -211,8 +188,8 @@ func TestJSONLoadSampleData(t *testing.T) {
 		}
 	}
 
-	if count != 3 {
-		t.Errorf("Expected 3 records, got %d", count)
+	if count != len(users) {
+		t.Errorf("Expected %d records, got %d", len(users), count)
 	}
 
 	t.Logf("✅ JSON OID approach working! Inserted and queried %d records with OID 114", count)
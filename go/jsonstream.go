@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamJSONArray decodes the JSON array in r one element at a time, passing
+// each to fn, so files far larger than memory (sample-users.json scaled up,
+// a Debezium snapshot) can be loaded. Errors say which element went wrong
+// and the byte offset just past the element before it. It returns the number of elements fn accepted.
+func StreamJSONArray[T any](r io.Reader, fn func(T) error) (int, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, fmt.Errorf("reading array start: %w", err)
+	}
+	if tok != json.Delim('[') {
+		return 0, fmt.Errorf("expected a JSON array, got %v at byte %d", tok, dec.InputOffset())
+	}
+
+	n := 0
+	for dec.More() {
+		offset := dec.InputOffset()
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return n, fmt.Errorf("element %d (byte %d): %w", n, offset, err)
+		}
+		if err := fn(v); err != nil {
+			return n, fmt.Errorf("element %d (byte %d): %w", n, offset, err)
+		}
+		n++
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return n, fmt.Errorf("reading array end after element %d (byte %d): %w", n, dec.InputOffset(), err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return n, fmt.Errorf("unexpected data after the array at byte %d", dec.InputOffset())
+	}
+	return n, nil
+}
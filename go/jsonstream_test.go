@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestStreamJSONArray(t *testing.T) {
+	var ids []string
+	n, err := StreamJSONArray(strings.NewReader(` [{"_id": "a"}, {"_id": "b"}] `), func(u map[string]interface{}) error {
+		ids = append(ids, u["_id"].(string))
+		return nil
+	})
+	if err != nil || n != 2 || fmt.Sprint(ids) != "[a b]" {
+		t.Errorf("Expected [a b], got %v (%d), %v", ids, n, err)
+	}
+
+	cases := map[string]string{
+		`{"_id": "a"}`:                  "expected a JSON array",
+		`[{"_id": "a"}, {"_id": }]`:     "element 1 (byte 13)",
+		`[{"_id": "a"}, {"_id": "b"}`:   "element 2 (byte 27): unexpected end",
+		`[{"_id": "a"}] [{"_id": "b"}]`: "unexpected data after the array",
+	}
+	for input, want := range cases {
+		_, err := StreamJSONArray(strings.NewReader(input), func(map[string]interface{}) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", input, want, err)
+		}
+	}
+
+	stop := errors.New("stop")
+	_, err = StreamJSONArray(strings.NewReader(`[1, 2, 3]`), func(v int) error {
+		if v == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || !strings.Contains(err.Error(), "element 1") {
+		t.Errorf("Expected fn's error for element 1, got %v", err)
+	}
+}
+
+// arrayGenerator produces a JSON array of count copies of element without
+// ever holding more than one element in memory
+type arrayGenerator struct {
+	element []byte
+	count   int
+	emitted int
+	pending []byte
+	done    bool
+}
+
+func (g *arrayGenerator) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(g.pending) == 0 {
+			switch {
+			case g.done:
+				if n == 0 {
+					return 0, io.EOF
+				}
+				return n, nil
+			case g.emitted == 0 && g.pending == nil:
+				g.pending = []byte("[")
+			case g.emitted == g.count:
+				g.pending, g.done = []byte("]"), true
+			default:
+				g.pending = g.element
+				if g.emitted > 0 {
+					g.pending = append([]byte(","), g.element...)
+				}
+				g.emitted++
+			}
+		}
+		c := copy(p[n:], g.pending)
+		g.pending = g.pending[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func TestStreamJSONArrayMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams 2GB of JSON")
+	}
+
+	element := []byte(fmt.Sprintf(`{"_id": "user", "name": "A. User", "bio": "%s", "tags": ["a", "b"], "age": 42}`,
+		strings.Repeat("x", 400)))
+	count := (2 << 30) / len(element)
+
+	heapNow := func() uint64 {
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+	baseline := heapNow()
+
+	var peak uint64
+	seen := 0
+	n, err := StreamJSONArray(&arrayGenerator{element: element, count: count}, func(u map[string]interface{}) error {
+		if seen%(count/10) == 0 {
+			if h := heapNow(); h > peak {
+				peak = h
+			}
+		}
+		seen++
+		return nil
+	})
+	if err != nil || n != count {
+		t.Fatalf("Expected %d elements, got %d, %v", count, n, err)
+	}
+
+	// Holding the array would take several GB; streaming needs a few buffers
+	if growth := int64(peak) - int64(baseline); growth > 32<<20 {
+		t.Errorf("Heap grew by %d bytes while streaming, expected under 32MB", growth)
+	}
+}
@@ -4,18 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/xtdb/driver-examples/go/xtdb"
 )
 
 func main() {
-	host := os.Getenv("XTDB_HOST")
-	if host == "" {
-		host = "xtdb"
-	}
-	connStr := fmt.Sprintf("postgres://%s:5432/xtdb", host)
-	conn, err := pgx.Connect(context.Background(), connStr)
+	conn, err := xtdb.Connect(context.Background(), xtdb.Options{})
 	if err != nil {
 		log.Fatalf("Unable to connect: %v\n", err)
 	}
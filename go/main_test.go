@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+
+	"github.com/xtdb/driver-examples/go/fixtures"
+	"github.com/xtdb/driver-examples/go/xtdb"
 )
 
 var tableCounter int
@@ -22,18 +25,22 @@ func getXtdbHost() string {
 
 // getConn creates a standard database connection (for JSON and basic tests)
 func getConn(t *testing.T) *pgx.Conn {
-	connStr := fmt.Sprintf("postgres://%s:5432/xtdb", getXtdbHost())
-	conn, err := pgx.Connect(context.Background(), connStr)
-	if err != nil {
-		t.Fatalf("Unable to connect: %v", err)
-	}
-	return conn
+	return connectRetrying(t, xtdb.Connect)
 }
 
 // getConnTransit creates a database connection with transit fallback (for transit tests only)
 func getConnTransit(t *testing.T) *pgx.Conn {
-	connStr := fmt.Sprintf("postgres://%s:5432/xtdb?fallback_output_format=transit", getXtdbHost())
-	conn, err := pgx.Connect(context.Background(), connStr)
+	return connectRetrying(t, xtdb.ConnectTransit)
+}
+
+// connectRetrying connects with connect, retrying as ConnectPool does while
+// XTDB is still starting
+func connectRetrying(t *testing.T, connect func(context.Context, xtdb.Options) (*pgx.Conn, error)) *pgx.Conn {
+	var conn *pgx.Conn
+	err := retryConnect(context.Background(), PoolOptions{}, func(ctx context.Context) (err error) {
+		conn, err = connect(ctx, xtdb.Options{Host: getXtdbHost()})
+		return err
+	})
 	if err != nil {
 		t.Fatalf("Unable to connect: %v", err)
 	}
@@ -45,6 +52,15 @@ func getCleanTable() string {
 	return fmt.Sprintf("test_table_%d_%d", time.Now().Unix(), tableCounter)
 }
 
+// loadSampleUsers inserts the canonical sample users into table via the JSON OID
+func loadSampleUsers(t *testing.T, conn *pgx.Conn, table string) []fixtures.User {
+	users, err := fixtures.LoadSampleUsers(context.Background(), conn, table)
+	if err != nil {
+		t.Fatalf("Loading users failed: %v", err)
+	}
+	return users
+}
+
 func TestConnection(t *testing.T) {
 	conn := getConn(t)
 	defer conn.Close(context.Background())
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ManagedOption configures NewManagedConn
+type ManagedOption func(*managedConfig)
+
+type managedConfig struct {
+	connectOpts []ConnectOption
+	setup       []string
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+	onReconnect func(ctx context.Context, conn *Conn) error
+}
+
+// WithConnectOptions passes opts to Connect on every dial, so read-only
+// mode, statement timeouts and tracing survive a reconnect
+func WithConnectOptions(opts ...ConnectOption) ManagedOption {
+	return func(c *managedConfig) { c.connectOpts = append(c.connectOpts, opts...) }
+}
+
+// WithSessionSetup runs each statement, in order, on every new connection,
+// e.g. SET TIME ZONE. Settings in the connection string (such as
+// fallback_output_format) are reapplied anyway.
+func WithSessionSetup(sql ...string) ManagedOption {
+	return func(c *managedConfig) { c.setup = append(c.setup, sql...) }
+}
+
+// WithReconnectBackoff waits min after the first failed redial, doubling up
+// to max, and gives up after attempts redials (0, the default, keeps trying
+// until the context is done). The default backoff is 100ms to 5s.
+func WithReconnectBackoff(min, max time.Duration, attempts int) ManagedOption {
+	return func(c *managedConfig) {
+		c.minBackoff, c.maxBackoff, c.maxAttempts = min, max, attempts
+	}
+}
+
+// OnReconnect calls fn with each replacement connection, after session setup
+// and before the failed work is retried, so callers can re-establish state
+// of their own such as a Tail watermark. An error fails the reconnect.
+func OnReconnect(fn func(ctx context.Context, conn *Conn) error) ManagedOption {
+	return func(c *managedConfig) { c.onReconnect = fn }
+}
+
+// ManagedConn is a long-lived connection that outlives the server going
+// away. When work fails because the connection was lost, it redials with
+// backoff, replays the session setup and calls the OnReconnect hook. Reads
+// are then retried once on the new connection; other work only if it never
+// reached the server (pgconn.SafeToRetry), since a write that committed just
+// before the connection dropped would otherwise run twice. Like pgx.Conn it
+// isn't safe for concurrent use.
+type ManagedConn struct {
+	connString string
+	cfg        managedConfig
+	conn       *Conn
+}
+
+// NewManagedConn connects to XTDB and runs the session setup. The first
+// dial isn't retried, so a bad connection string fails straight away.
+func NewManagedConn(ctx context.Context, connString string, opts ...ManagedOption) (*ManagedConn, error) {
+	cfg := managedConfig{minBackoff: 100 * time.Millisecond, maxBackoff: 5 * time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	m := &ManagedConn{connString: connString, cfg: cfg}
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.conn = conn
+	return m, nil
+}
+
+// Conn is the current connection; it changes after a reconnect
+func (m *ManagedConn) Conn() *Conn { return m.conn }
+
+// Close closes the current connection
+func (m *ManagedConn) Close(ctx context.Context) error { return m.conn.Close(ctx) }
+
+// Do runs fn on the connection. If fn fails because the connection was lost,
+// Do reconnects, then runs fn again only if the failure came before anything
+// was sent (pgconn.SafeToRetry); otherwise it returns fn's error, leaving the
+// caller to decide whether the work is safe to repeat.
+func (m *ManagedConn) Do(ctx context.Context, fn func(conn *Conn) error) error {
+	return m.do(ctx, false, fn)
+}
+
+// do is Do, retrying fn after any lost connection if it's a read
+func (m *ManagedConn) do(ctx context.Context, read bool, fn func(conn *Conn) error) error {
+	err := fn(m.conn)
+	if !connectionLost(ctx, m.conn, err) {
+		return err
+	}
+	if rerr := m.reconnect(ctx); rerr != nil {
+		return fmt.Errorf("%w (and reconnecting failed: %v)", err, rerr)
+	}
+	if !read && !pgconn.SafeToRetry(err) {
+		return err
+	}
+	return fn(m.conn)
+}
+
+// Exec retries sql only if it never reached the server; see Do
+func (m *ManagedConn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	var tag pgconn.CommandTag
+	err := m.Do(ctx, func(conn *Conn) (err error) {
+		tag, err = conn.Exec(ctx, sql, args...)
+		return err
+	})
+	return tag, err
+}
+
+// Query retries a query after a lost connection, as reads are safe to
+// repeat; rows lost part-way through reading surface from rows.Err() as usual.
+func (m *ManagedConn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	var rows pgx.Rows
+	err := m.do(ctx, true, func(conn *Conn) (err error) {
+		rows, err = conn.Query(ctx, sql, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow runs the query when Scan is called, retrying it there
+func (m *ManagedConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return managedRow{m: m, ctx: ctx, sql: sql, args: args}
+}
+
+type managedRow struct {
+	m    *ManagedConn
+	ctx  context.Context
+	sql  string
+	args []any
+}
+
+func (r managedRow) Scan(dest ...any) error {
+	return r.m.do(r.ctx, true, func(conn *Conn) error {
+		return conn.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	})
+}
+
+// dial connects and runs the session setup
+func (m *ManagedConn) dial(ctx context.Context) (*Conn, error) {
+	conn, err := Connect(ctx, m.connString, m.cfg.connectOpts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, sql := range m.cfg.setup {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			conn.Close(ctx)
+			return nil, fmt.Errorf("session setup %q: %w", sql, err)
+		}
+	}
+	return conn, nil
+}
+
+// reconnect replaces the lost connection, redialling until it succeeds, the
+// attempts run out or ctx is done
+func (m *ManagedConn) reconnect(ctx context.Context) error {
+	m.conn.Close(ctx)
+
+	delay := m.cfg.minBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := m.dial(ctx)
+		if err == nil {
+			if m.cfg.onReconnect != nil {
+				if err := m.cfg.onReconnect(ctx, conn); err != nil {
+					conn.Close(ctx)
+					return fmt.Errorf("reconnect hook: %w", err)
+				}
+			}
+			m.conn = conn
+			return nil
+		}
+		if m.cfg.maxAttempts > 0 && attempt >= m.cfg.maxAttempts {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = nextBackoff(delay, m.cfg.maxBackoff)
+	}
+}
+
+// nextBackoff doubles delay, up to max
+func nextBackoff(delay, max time.Duration) time.Duration {
+	if delay *= 2; delay > max {
+		return max
+	}
+	return delay
+}
+
+// connectionLost reports whether err means conn is gone, rather than the
+// statement failing or the caller giving up
+func connectionLost(ctx context.Context, conn *Conn, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if conn.IsClosed() {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
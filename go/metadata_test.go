@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestInsertConfigMetadata(t *testing.T) {
+	cfg := newInsertConfig([]InsertOption{
+		WithMetadata(map[string]interface{}{"source": "debezium", "ingest_batch": "b-1"}),
+	})
+
+	record := map[string]interface{}{"_id": 1, "source": "manual"}
+	prepared, err := cfg.prepare(record)
+	if err != nil {
+		t.Fatalf("prepare failed: %v", err)
+	}
+	if prepared["source"] != "manual" || prepared["ingest_batch"] != "b-1" {
+		t.Errorf("Expected metadata merged without overwriting, got %v", prepared)
+	}
+	if _, ok := record["ingest_batch"]; ok {
+		t.Error("prepare should not modify the caller's record")
+	}
+}
+
+func TestInsertRecordsWithMetadata(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	records := []map[string]interface{}{
+		{"_id": "alice", "name": "Alice"},
+		{"_id": "bob", "name": "Bob", "source": "backfill"},
+	}
+	err := InsertRecords(ctx, conn, table, records,
+		WithMetadata(map[string]interface{}{"source": "debezium", "ingest_batch": "2024-06-01-001"}))
+	if err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id, source, ingest_batch FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var id, source, batch string
+		if err := rows.Scan(&id, &source, &batch); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s:%s:%s", id, source, batch))
+	}
+	expected := "[alice:debezium:2024-06-01-001 bob:backfill:2024-06-01-001]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("Expected %s, got %v", expected, got)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// NestManyStream runs NEST_MANY over table, filtered by where (with args,
+// or everything when where is empty), and passes each nested record (keys
+// without their "~:") to onRecord as it's decoded, so the whole array is
+// never built as one value. conn needs the transit fallback output format
+// (xtdb.ConnectTransit). Errors name the record that failed.
+func NestManyStream(ctx context.Context, conn *pgx.Conn, table, where string, onRecord func(map[string]interface{}) error, args ...any) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("FROM %s", table)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT NEST_MANY(%s) AS r", query)), args...)
+	if err != nil {
+		return fmt.Errorf("NEST_MANY over %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// The raw column bytes are decoded record by record
+		raw := rows.RawValues()[0]
+		if raw == nil {
+			continue
+		}
+		if err := streamTransitRecords(bytes.NewReader(raw), onRecord); err != nil {
+			return fmt.Errorf("NEST_MANY over %s: %w", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("NEST_MANY over %s: %w", table, err)
+	}
+	return nil
+}
+
+// streamTransitRecords decodes a transit-JSON array of maps one element at
+// a time, passing each to fn
+func streamTransitRecords(r io.Reader, fn func(map[string]interface{}) error) error {
+	_, err := StreamJSONArray(r, func(elem []interface{}) error {
+		record, ok := xtdb.StripKeywordKeys(xtdb.DecodeValue(elem)).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a transit map, got an array")
+		}
+		return fn(record)
+	})
+	return err
+}
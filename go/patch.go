@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PatchRecords merges each patch into the current document with the same
+// _id: fields the patch names are replaced (a nested struct as a whole),
+// every other field is kept, and a patch for an _id that doesn't exist
+// inserts it. INSERT ... RECORDS would replace the whole document instead.
+//
+// It sends a single PATCH INTO ... RECORDS statement. On servers without
+// PATCH it falls back to reading each document, merging the patch and
+// re-inserting it, which isn't atomic with respect to concurrent writers.
+func PatchRecords(ctx context.Context, conn *pgx.Conn, table string, patches []map[string]any) error {
+	if err := checkPatches(table, patches); err != nil || len(patches) == 0 {
+		return err
+	}
+
+	lit, err := BuildRecordsLiteral(patches...)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, tagSQL(ctx, fmt.Sprintf("PATCH INTO %s RECORDS %s", table, lit)))
+	if err == nil {
+		return nil
+	}
+	if !patchUnsupported(err) {
+		return fmt.Errorf("patching %s: %w", table, err)
+	}
+	return patchByReinsert(ctx, conn, table, patches)
+}
+
+// checkPatches rejects patches PATCH couldn't apply
+func checkPatches(table string, patches []map[string]any) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	for i, patch := range patches {
+		if _, ok := patch["_id"]; !ok {
+			return fmt.Errorf("patch %d: missing _id", i)
+		}
+	}
+	return nil
+}
+
+// patchUnsupported reports whether err is the server saying it doesn't
+// support PATCH (feature_not_supported), rather than the patch itself
+// failing. A syntax error isn't taken as one: it's as likely a bad field
+// name or literal in the patch, and re-inserting would hide that.
+func patchUnsupported(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "0A000"
+}
+
+// patchByReinsert applies patches by reading each current document, merging
+// the patch into it and inserting the result. Patches that change nothing
+// aren't written.
+func patchByReinsert(ctx context.Context, conn *pgx.Conn, table string, patches []map[string]any) error {
+	if err := checkPatches(table, patches); err != nil {
+		return err
+	}
+
+	var merged []map[string]any
+	for i, patch := range patches {
+		idLit, err := formatLiteral(patch["_id"])
+		if err != nil {
+			return fmt.Errorf("patch %d: formatting _id: %w", i, err)
+		}
+		rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT * FROM %s WHERE _id = %s", table, idLit)))
+		if err != nil {
+			return fmt.Errorf("patch %d: reading %v: %w", i, patch["_id"], err)
+		}
+		current, err := collectMaps(rows)
+		if err != nil {
+			return fmt.Errorf("patch %d: reading %v: %w", i, patch["_id"], err)
+		}
+
+		doc := map[string]any{}
+		if len(current) > 0 {
+			doc = documentFields(current[0])
+		}
+		changed := len(current) == 0
+		for k, v := range patch {
+			if !reflect.DeepEqual(doc[k], v) {
+				doc[k] = v
+				changed = true
+			}
+		}
+		if changed {
+			merged = append(merged, doc)
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	sql, err := RecordsSQL(table, merged...)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, tagSQL(ctx, sql)); err != nil {
+		return fmt.Errorf("patching %s: %w", table, err)
+	}
+	return nil
+}
+
+// UpdateChangedFields reads the current record with the given _id, compares
+// it with newValues and sets only the fields that differ with a single
+// UPDATE ... SET, returning their names in sorted order. Fields newValues
+// doesn't mention are left alone, and nothing is written if none changed.
+// The id and values are sent as parameters, encoded as SafeExec encodes
+// them (maps and slices as JSON). Like patchByReinsert, the read and the
+// update aren't atomic with respect to concurrent writers.
+func UpdateChangedFields(ctx context.Context, conn *pgx.Conn, table string, id any, newValues map[string]interface{}) (updated []string, err error) {
+	if err := checkTable(table); err != nil {
+		return nil, err
+	}
+	idParam, idOID, err := inferParam(id)
+	if err != nil {
+		return nil, fmt.Errorf("encoding id: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT * FROM %s WHERE _id = $1", table)), id)
+	if err != nil {
+		return nil, fmt.Errorf("reading %v from %s: %w", id, table, err)
+	}
+	current, err := collectMaps(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading %v from %s: %w", id, table, err)
+	}
+	if len(current) == 0 {
+		return nil, fmt.Errorf("no record %v in %s", id, table)
+	}
+
+	updated, err = changedFields(documentFields(current[0]), newValues)
+	if err != nil || len(updated) == 0 {
+		return nil, err
+	}
+
+	sets := make([]string, len(updated))
+	values := make([][]byte, len(updated)+1)
+	oids := make([]uint32, len(updated)+1)
+	args := make([]any, len(updated)+1)
+	for i, k := range updated {
+		if values[i], oids[i], err = inferParam(newValues[k]); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		sets[i] = fmt.Sprintf("%s = $%d", k, i+1)
+		args[i] = newValues[k]
+	}
+	n := len(updated)
+	values[n], oids[n], args[n] = idParam, idOID, id
+
+	sql := tagSQL(ctx, fmt.Sprintf("UPDATE %s SET %s WHERE _id = $%d", table, strings.Join(sets, ", "), n+1))
+	_, err = traceExec(ctx, conn, sql, args, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return conn.PgConn().ExecParams(ctx, sql, values, oids, make([]int16, len(values)), nil).Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("updating %v in %s: %w", id, table, err)
+	}
+	return updated, nil
+}
+
+// changedFields returns the sorted names of the fields in newValues whose
+// value differs from doc's. Values are compared as the literals they'd be
+// written as, so an int matches the int64 read back and a time matches the
+// same instant in another zone.
+func changedFields(doc, newValues map[string]interface{}) ([]string, error) {
+	var changed []string
+	for k, v := range newValues {
+		switch k {
+		case "_id":
+			if !sameValue(doc[k], v) {
+				return nil, fmt.Errorf("can't change _id from %v to %v", doc[k], v)
+			}
+			continue
+		case "_valid_from", "_valid_to", "_system_from", "_system_to":
+			return nil, fmt.Errorf("can't set %s with UPDATE ... SET", k)
+		}
+		if !identifierPattern.MatchString(k) {
+			return nil, fmt.Errorf("invalid field name %q", k)
+		}
+		if !sameValue(doc[k], v) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// sameValue compares two field values by their literals, falling back to
+// reflect.DeepEqual for values formatLiteral doesn't render
+func sameValue(a, b interface{}) bool {
+	if t, ok := a.(time.Time); ok {
+		a = t.UTC()
+	}
+	if t, ok := b.(time.Time); ok {
+		b = t.UTC()
+	}
+	litA, errA := formatLiteral(a)
+	litB, errB := formatLiteral(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return litA == litB
+}
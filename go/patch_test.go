@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+func TestPatchRecordsChecks(t *testing.T) {
+	ctx := context.Background()
+	if err := PatchRecords(ctx, nil, "users", []map[string]any{{"name": "no id"}}); err == nil {
+		t.Error("Expected a patch without _id to be rejected")
+	}
+	if err := PatchRecords(ctx, nil, "users; DROP TABLE users", []map[string]any{{"_id": 1}}); err == nil {
+		t.Error("Expected an invalid table name to be rejected")
+	}
+	if err := PatchRecords(ctx, nil, "users", nil); err != nil {
+		t.Errorf("Expected no patches to be a no-op, got %v", err)
+	}
+}
+
+func TestPatchUnsupported(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "0A000"}, true},
+		{fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "0A000"}), true},
+		{&pgconn.PgError{Code: "42601", Message: "mismatched input 'PATCH'"}, false},
+		{&pgconn.PgError{Code: "22P02", Message: "invalid input"}, false},
+		{fmt.Errorf("connection reset"), false},
+	}
+	for _, c := range cases {
+		if got := patchUnsupported(c.err); got != c.want {
+			t.Errorf("patchUnsupported(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+// tenFieldDocument has nine fields besides _id, two of them nested
+func tenFieldDocument() map[string]any {
+	return map[string]any{
+		"_id":     "patched",
+		"name":    "Alice",
+		"email":   "alice@example.com",
+		"age":     30,
+		"active":  true,
+		"score":   9.5,
+		"plan":    "pro",
+		"visits":  12,
+		"tags":    []interface{}{"admin", "beta"},
+		"address": map[string]interface{}{"city": "London", "geo": map[string]interface{}{"lat": 51.5}},
+	}
+}
+
+// testPatch inserts tenFieldDocument, patches its email with patch and checks
+// the other nine fields survive
+func testPatch(t *testing.T, patch func(ctx context.Context, conn *pgx.Conn, table string, patches []map[string]any) error) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	sql, err := RecordsSQL(table, tenFieldDocument())
+	if err != nil {
+		t.Fatalf("RecordsSQL failed: %v", err)
+	}
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	if err := patch(ctx, conn, table, []map[string]any{{"_id": "patched", "email": "alice@new.example.com"}}); err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+
+	var raw interface{}
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = 'patched') AS r", table)).Scan(&raw); err != nil {
+		t.Fatalf("Reading back failed: %v", err)
+	}
+	got, ok := xtdb.StripKeywordKeys(xtdb.DecodeValue(raw)).(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a document, got %T: %v", raw, raw)
+	}
+
+	// Numbers come back through JSON as float64
+	want := map[string]interface{}{
+		"_id":     "patched",
+		"name":    "Alice",
+		"email":   "alice@new.example.com",
+		"age":     float64(30),
+		"active":  true,
+		"score":   9.5,
+		"plan":    "pro",
+		"visits":  float64(12),
+		"tags":    []interface{}{"admin", "beta"},
+		"address": map[string]interface{}{"city": "London", "geo": map[string]interface{}{"lat": 51.5}},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("%s = %#v, want %#v", k, got[k], v)
+		}
+	}
+}
+
+func TestPatchRecords(t *testing.T) {
+	testPatch(t, PatchRecords)
+}
+
+func TestPatchRecordsFallback(t *testing.T) {
+	testPatch(t, patchByReinsert)
+}
+
+func TestChangedFields(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	doc := map[string]interface{}{
+		"_id": "u1", "name": "Alice", "age": int64(30), "score": 9.5, "joined": at, "tags": []interface{}{"a"},
+	}
+	newValues := map[string]interface{}{
+		"_id": "u1", "name": "Alice", "age": 30, "score": 9.5, "tags": []interface{}{"a", "b"},
+		"joined": at.In(time.FixedZone("CET", 3600)), "email": "alice@example.com", "nickname": nil,
+	}
+	got, err := changedFields(doc, newValues)
+	if err != nil || fmt.Sprint(got) != "[email tags]" {
+		t.Errorf("Expected [email tags] changed, got %v, %v", got, err)
+	}
+
+	if got, err := changedFields(doc, map[string]interface{}{"age": int32(30)}); err != nil || len(got) != 0 {
+		t.Errorf("Expected no change, got %v, %v", got, err)
+	}
+	for _, bad := range []map[string]interface{}{
+		{"_id": "u2"},
+		{"_valid_from": at},
+		{"bad name": 1},
+	} {
+		if _, err := changedFields(doc, bad); err == nil {
+			t.Errorf("Expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestUpdateChangedFields(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	sql, err := RecordsSQL(table, tenFieldDocument())
+	if err != nil {
+		t.Fatalf("RecordsSQL failed: %v", err)
+	}
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	newValues := map[string]interface{}{
+		"name": "Alice", "email": "alice@new.example.com", "age": 30, "active": true, "score": 9.5, "plan": "pro", "visits": 12,
+	}
+	updated, err := UpdateChangedFields(ctx, conn, table, "patched", newValues)
+	if err != nil {
+		t.Fatalf("UpdateChangedFields failed: %v", err)
+	}
+	if fmt.Sprint(updated) != "[email]" {
+		t.Errorf("Expected only email updated, got %v", updated)
+	}
+
+	var email, name string
+	var age int64
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT email, name, age FROM %s WHERE _id = 'patched'", table)).Scan(&email, &name, &age)
+	if err != nil {
+		t.Fatalf("Reading back failed: %v", err)
+	}
+	if email != "alice@new.example.com" || name != "Alice" || age != 30 {
+		t.Errorf("Unexpected record: email %q, name %q, age %d", email, name, age)
+	}
+
+	// Again with the same values: nothing to write, so no new version
+	updated, err = UpdateChangedFields(ctx, conn, table, "patched", newValues)
+	if err != nil || len(updated) != 0 {
+		t.Errorf("Expected a no-op, got %v, %v", updated, err)
+	}
+	history, err := RecordHistory(ctx, conn, table, "patched")
+	if err != nil {
+		t.Fatalf("RecordHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("Expected the insert and one update in history, got %d versions", len(history))
+	}
+
+	// Values go as parameters, so quotes need no escaping
+	note := `O'Brien said "hi"; DROP TABLE users`
+	if updated, err := UpdateChangedFields(ctx, conn, table, "patched", map[string]interface{}{"note": note}); err != nil || fmt.Sprint(updated) != "[note]" {
+		t.Fatalf("Expected note updated, got %v, %v", updated, err)
+	}
+	var gotNote string
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT note FROM %s WHERE _id = 'patched'", table)).Scan(&gotNote); err != nil || gotNote != note {
+		t.Errorf("Expected note %q, got %q, %v", note, gotNote, err)
+	}
+
+	if _, err := UpdateChangedFields(ctx, conn, table, "missing", newValues); err == nil {
+		t.Error("Expected a missing record to be reported")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolOptions configures ConnectPool. Zero values take the defaults.
+type PoolOptions struct {
+	// Timeout bounds how long ConnectPool keeps trying (default 30s)
+	Timeout time.Duration
+	// MinBackoff is the wait after the first failed attempt, doubling up to
+	// MaxBackoff (defaults 100ms and 2s)
+	MinBackoff, MaxBackoff time.Duration
+	// MaxConns caps the pool (default pgxpool's: 4, or the number of CPUs
+	// if that's more)
+	MaxConns int32
+}
+
+// ConnectPool opens a connection pool and pings XTDB through it, retrying
+// with exponential backoff until the server answers or opts.Timeout runs
+// out, e.g. while XTDB is still starting in CI. A malformed dsn, or a server
+// that refuses the login, fails straight away. Parameters in dsn that pgx
+// doesn't know, such as fallback_output_format=transit, are sent to XTDB on
+// every connection the pool opens.
+func ConnectPool(ctx context.Context, dsn string, opts PoolOptions) (*pgxpool.Pool, error) {
+	cfg, err := poolConfig(dsn, opts)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := retryConnect(ctx, opts, pool.Ping); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// retryConnect calls connect until it succeeds, fails in a way waiting
+// won't fix (see retryableConnectError) or opts.Timeout runs out, backing
+// off between attempts as ConnectPool does
+func retryConnect(ctx context.Context, opts PoolOptions, connect func(context.Context) error) error {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	delay, maxDelay := opts.MinBackoff, opts.MaxBackoff
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 2 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		err := connect(ctx)
+		if err == nil {
+			return nil
+		}
+		if retryableConnectError(err) && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+				delay = nextBackoff(delay, maxDelay)
+				continue
+			}
+		}
+		return fmt.Errorf("connecting to XTDB: gave up after %d attempts: %w", attempt, err)
+	}
+}
+
+// poolConfig parses dsn for ConnectPool
+func poolConfig(dsn string, opts PoolOptions) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	return cfg, nil
+}
+
+// retryableConnectError reports whether a failed connection attempt may
+// succeed later: the host name doesn't resolve yet (as with a docker-compose
+// service whose container isn't up), nothing is listening yet (refused), the
+// server dropped the connection or didn't answer in time while starting, or
+// it's up but not yet accepting connections. Anything else, such as a TLS
+// failure or a bad password, won't go away by waiting.
+func retryableConnectError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "57P03" // cannot_connect_now
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsNotFound || dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
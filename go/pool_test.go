@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+func TestPoolConfig(t *testing.T) {
+	cfg, err := poolConfig("postgres://xtdb:5432/xtdb?fallback_output_format=transit", PoolOptions{MaxConns: 3})
+	if err != nil {
+		t.Fatalf("poolConfig failed: %v", err)
+	}
+	if got := cfg.ConnConfig.RuntimeParams["fallback_output_format"]; got != "transit" {
+		t.Errorf("Expected fallback_output_format sent to the server, got %q", got)
+	}
+	if cfg.MaxConns != 3 {
+		t.Errorf("Expected MaxConns 3, got %d", cfg.MaxConns)
+	}
+
+	if _, err := ConnectPool(context.Background(), "postgres://xtdb:notaport/xtdb", PoolOptions{}); err == nil {
+		t.Error("Expected a malformed DSN to be rejected")
+	}
+}
+
+func TestRetryableConnectError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{fmt.Errorf("receive message failed: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "xtdb", IsNotFound: true}}, true},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", Name: "xtdb", IsTimeout: true}}, true},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", Name: "xtdb"}}, false},
+		{fmt.Errorf("tls error: %w", x509.UnknownAuthorityError{}), false},
+		{errors.New("server refused TLS connection"), false},
+		{&pgconn.PgError{Code: "57P03", Message: "the database system is starting up"}, true},
+		{&pgconn.PgError{Code: "28P01", Message: "password authentication failed"}, false},
+	}
+	for _, c := range cases {
+		if got := retryableConnectError(c.err); got != c.want {
+			t.Errorf("retryableConnectError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestConnectPoolGivesUp(t *testing.T) {
+	// A port nothing listens on, so every attempt is refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	timeout := 500 * time.Millisecond
+	start := time.Now()
+	pool, err := ConnectPool(context.Background(), "postgres://xtdb@"+addr+"/xtdb",
+		PoolOptions{Timeout: timeout, MinBackoff: 20 * time.Millisecond, MaxBackoff: 100 * time.Millisecond})
+	elapsed := time.Since(start)
+	if err == nil {
+		pool.Close()
+		t.Fatal("Expected ConnectPool to fail")
+	}
+	if !strings.Contains(err.Error(), "gave up after") || strings.Contains(err.Error(), "after 1 attempts") {
+		t.Errorf("Expected several attempts, got %v", err)
+	}
+	if elapsed < timeout-50*time.Millisecond || elapsed > timeout+time.Second {
+		t.Errorf("Expected to give up at the %s deadline, took %s", timeout, elapsed)
+	}
+}
+
+func TestConnectPool(t *testing.T) {
+	ctx := context.Background()
+	dsn := xtdb.Options{Host: getXtdbHost()}.ConnString() + "?fallback_output_format=transit"
+	pool, err := ConnectPool(ctx, dsn, PoolOptions{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("ConnectPool failed: %v", err)
+	}
+	defer pool.Close()
+
+	table := getCleanTable()
+	if _, err := pool.Exec(ctx, "INSERT INTO "+table+" RECORDS {_id: 1, meta: {tag: 'a'}}"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	var meta string
+	if err := pool.QueryRow(ctx, "SELECT meta FROM "+table).Scan(&meta); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	// A map comes back as a transit map, ["^ ","~:tag","a"], where JSON
+	// would give {"tag":"a"}
+	if !strings.HasPrefix(meta, `["^ "`) || !strings.Contains(meta, `"~:tag"`) {
+		t.Errorf("Expected a transit map, got %q", meta)
+	}
+}
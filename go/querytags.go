@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Query tags let DBAs attribute load to application features: tags put on
+// the context with WithQueryTags are prepended to every statement the
+// helpers issue as a comment, e.g. /* app=checkout,route=POST:/orders */.
+
+type queryTagsKey struct{}
+
+var (
+	queryTagMu        sync.RWMutex
+	queryTagAllowlist = map[string]bool{"app": true, "route": true, "feature": true, "job": true}
+)
+
+// SetQueryTagAllowlist replaces the tag keys that are rendered (by default
+// app, route, feature and job); other keys on the context are ignored
+func SetQueryTagAllowlist(keys ...string) {
+	allow := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		allow[k] = true
+	}
+	queryTagMu.Lock()
+	queryTagAllowlist = allow
+	queryTagMu.Unlock()
+}
+
+// WithQueryTags returns a context carrying tags, on top of any already there
+func WithQueryTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := map[string]string{}
+	if existing, ok := ctx.Value(queryTagsKey{}).(map[string]string); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, queryTagsKey{}, merged)
+}
+
+// tagSQL prepends ctx's query tags to sql as a comment. Statements that
+// already start with a comment (typically tagged by an outer helper) are
+// left alone, as are contexts without allowlisted tags.
+func tagSQL(ctx context.Context, sql string) string {
+	tags, ok := ctx.Value(queryTagsKey{}).(map[string]string)
+	if !ok || len(tags) == 0 {
+		return sql
+	}
+	trimmed := strings.TrimLeft(sql, " \t\r\n")
+	if strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "--") {
+		return sql
+	}
+
+	queryTagMu.RLock()
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if queryTagAllowlist[k] {
+			pairs = append(pairs, sanitizeTag(k)+"="+sanitizeTag(v))
+		}
+	}
+	queryTagMu.RUnlock()
+
+	if len(pairs) == 0 {
+		return sql
+	}
+	sort.Strings(pairs)
+	return "/* " + strings.Join(pairs, ",") + " */ " + sql
+}
+
+// sanitizeTag keeps letters, digits and _.:/- so a tag can't close the
+// comment or smuggle in separators
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("_.:/-", r):
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestTagSQL(t *testing.T) {
+	ctx := WithQueryTags(context.Background(), map[string]string{"app": "checkout", "route": "POST:/orders"})
+	ctx = WithQueryTags(ctx, map[string]string{"user": "alice", "feature": "x*/ DROP"})
+
+	got := tagSQL(ctx, "SELECT 1")
+	expected := "/* app=checkout,feature=x_/_DROP,route=POST:/orders */ SELECT 1"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	if got := tagSQL(ctx, "/* already tagged */ SELECT 1"); got != "/* already tagged */ SELECT 1" {
+		t.Errorf("Statements starting with a comment should be left alone, got %q", got)
+	}
+	if got := tagSQL(context.Background(), "SELECT 1"); got != "SELECT 1" {
+		t.Errorf("Untagged context should leave SQL alone, got %q", got)
+	}
+	if got := tagSQL(WithQueryTags(context.Background(), map[string]string{"user": "alice"}), "SELECT 1"); got != "SELECT 1" {
+		t.Errorf("Only allowlisted keys should be rendered, got %q", got)
+	}
+}
+
+// wireTracer records every byte the client sends, i.e. exactly what the
+// server sees
+type wireTracer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+type tracedConn struct {
+	net.Conn
+	tracer *wireTracer
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	c.tracer.mu.Lock()
+	c.tracer.buf.Write(b)
+	c.tracer.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func (w *wireTracer) take() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.buf.String()
+	w.buf.Reset()
+	return s
+}
+
+func TestQueryTagsOnTheWire(t *testing.T) {
+	cfg, err := pgx.ParseConfig(fmt.Sprintf("postgres://%s:5432/xtdb?fallback_output_format=transit", getXtdbHost()))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	tracer := &wireTracer{}
+	cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedConn{Conn: conn, tracer: tracer}, nil
+	}
+	conn, err := pgx.ConnectConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	const comment = "/* app=checkout,route=POST:/orders */ "
+	ctx := WithQueryTags(context.Background(), map[string]string{"app": "checkout", "route": "POST:/orders"})
+	tracer.take()
+
+	if err := InsertRecords(ctx, conn, table, []map[string]interface{}{{"_id": "o1", "total": 10}}); err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+	if sent := tracer.take(); !strings.Contains(sent, comment+"INSERT INTO "+table) {
+		t.Errorf("Insert wasn't tagged: %q", sent)
+	}
+
+	transit, err := os.ReadFile("../test-data/sample-users-transit.json")
+	if err != nil {
+		t.Fatalf("Failed to read transit-json file: %v", err)
+	}
+	if _, err := CopyFromTransit(ctx, conn, table, bytes.NewReader(transit), "transit-json"); err != nil {
+		t.Fatalf("CopyFromTransit failed: %v", err)
+	}
+	if sent := tracer.take(); !strings.Contains(sent, comment+"COPY "+table) {
+		t.Errorf("COPY wasn't tagged: %q", sent)
+	}
+
+	if _, err := SnapshotTable(ctx, conn, table); err != nil {
+		t.Fatalf("SnapshotTable failed: %v", err)
+	}
+	if sent := tracer.take(); !strings.Contains(sent, comment+"SELECT * FROM "+table) {
+		t.Errorf("Query wasn't tagged: %q", sent)
+	}
+
+	if _, err := SnapshotTable(context.Background(), conn, table); err != nil {
+		t.Fatalf("SnapshotTable failed: %v", err)
+	}
+	if sent := tracer.take(); strings.Contains(sent, "/*") {
+		t.Errorf("Untagged context shouldn't add a comment: %q", sent)
+	}
+}
+
+func TestSendBatchLeavesBatchUntagged(t *testing.T) {
+	conn, err := Connect(context.Background(), fmt.Sprintf("postgres://%s:5432/xtdb", getXtdbHost()))
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close(context.Background())
+
+	ctx := WithQueryTags(context.Background(), map[string]string{"app": "checkout"})
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1")
+	for i := 0; i < 2; i++ {
+		if err := conn.SendBatch(ctx, batch).Close(); err != nil {
+			t.Fatalf("SendBatch %d failed: %v", i, err)
+		}
+		if sql := batch.QueuedQueries[0].SQL; sql != "SELECT 1" {
+			t.Errorf("SendBatch %d changed the caller's batch to %q", i, sql)
+		}
+	}
+}
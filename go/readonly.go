@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReadOnly is returned (wrapped in a *ReadOnlyError) when a ReadOnly
+// connection is asked to run a write.
+var ErrReadOnly = errors.New("write on read-only connection")
+
+// ReadOnlyError names the statement a ReadOnly connection refused
+type ReadOnlyError struct {
+	Statement string
+	// Verb is the write that was found: INSERT, UPDATE, DELETE, ERASE, ...
+	Verb string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s refused on read-only connection: %q", e.Verb, e.Statement)
+}
+
+func (e *ReadOnlyError) Unwrap() error { return ErrReadOnly }
+
+// ReadOnly makes Connect's connection refuse writes before they reach the
+// wire, and starts transactions from Begin as READ ONLY so the server refuses
+// the writes inside them. The session itself stays read-write, so
+// AllowWrites can let a single call, or a transaction begun under it,
+// through.
+//
+// Statements are classified by their leading keyword (looking through
+// comments and WITH clauses), not parsed, so this guards against mistakes
+// rather than hostile SQL.
+func ReadOnly() ConnectOption {
+	return func(c *connectConfig) { c.readOnly = true }
+}
+
+type allowWritesKey struct{}
+
+// AllowWrites returns a context under which a ReadOnly connection will run
+// writes anyway
+func AllowWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowWritesKey{}, true)
+}
+
+func writesAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowWritesKey{}).(bool)
+	return allowed
+}
+
+func checkReadOnly(ctx context.Context, sql string) error {
+	if writesAllowed(ctx) {
+		return nil
+	}
+	if verb := writeVerb(sql); verb != "" {
+		return &ReadOnlyError{Statement: sql, Verb: verb}
+	}
+	return nil
+}
+
+var writeVerbs = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "ERASE": true,
+	"PATCH": true, "MERGE": true, "TRUNCATE": true,
+}
+
+// writeVerb returns the first write keyword leading any statement in sql (or
+// any WITH query in it), or "" if sql only reads
+func writeVerb(sql string) string {
+	for _, stmt := range splitStatements(sql) {
+		if verb := statementWriteVerb(stmt); verb != "" {
+			return verb
+		}
+	}
+	return ""
+}
+
+func statementWriteVerb(stmt string) string {
+	words := sqlWords(stmt)
+	if len(words) == 0 {
+		return ""
+	}
+
+	first := words[0]
+	switch {
+	case writeVerbs[first.text]:
+		return first.text
+	case first.text == "COPY":
+		// COPY t FROM loads data, COPY t TO / COPY (SELECT ...) TO exports it
+		for _, w := range words[1:] {
+			if w.depth == 0 && (w.text == "FROM" || w.text == "TO") {
+				if w.text == "FROM" {
+					return "COPY FROM"
+				}
+				return ""
+			}
+		}
+		return ""
+	case first.text == "WITH":
+		// The first word of each CTE body and of the main statement are the
+		// ones that decide; the main statement follows the last ")" at depth 0
+		// that isn't followed by a comma.
+		for i, w := range words[1:] {
+			prev := words[i]
+			leading := w.afterOpen || (w.depth == 0 && prev.text == ")" && w.text != ",")
+			if leading && writeVerbs[w.text] {
+				return w.text
+			}
+		}
+	}
+	return ""
+}
+
+// sqlWord is an upper-cased keyword or punctuation token outside string
+// literals, quoted identifiers and comments
+type sqlWord struct {
+	text       string
+	depth      int  // parenthesis depth
+	afterOpen  bool // first token after a "("
+	start, end int  // byte span in the statement; quoted sections read as "?"
+}
+
+func sqlWords(sql string) []sqlWord {
+	var words []sqlWord
+	depth := 0
+	afterOpen := false
+
+	add := func(text string, start, end int) {
+		words = append(words, sqlWord{text: text, depth: depth, afterOpen: afterOpen, start: start, end: end})
+		afterOpen = false
+	}
+
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			start := i
+			i = skipQuoted(sql, i)
+			add("?", start, i)
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return words
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return words
+			}
+			i += end + 4
+		case ch == '(':
+			add("(", i, i+1)
+			depth++
+			afterOpen = true
+			i++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+			add(")", i, i+1)
+			i++
+		case ch == ',':
+			add(",", i, i+1)
+			i++
+		case isWordByte(ch):
+			start := i
+			for i < len(sql) && isWordByte(sql[i]) {
+				i++
+			}
+			add(strings.ToUpper(sql[start:i]), start, i)
+		default:
+			i++
+		}
+	}
+	return words
+}
+
+// splitStatements splits sql on semicolons outside quotes and comments
+func splitStatements(sql string) []string {
+	var stmts []string
+	start := 0
+	for i := 0; i < len(sql); {
+		switch {
+		case sql[i] == '\'' || sql[i] == '"':
+			i = skipQuoted(sql, i)
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+		case sql[i] == ';':
+			stmts = append(stmts, sql[start:i])
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	return append(stmts, sql[start:])
+}
+
+// skipQuoted returns the index just past the quoted section starting at i,
+// treating a doubled quote as an escape
+func skipQuoted(sql string, i int) int {
+	quote := sql[i]
+	for i++; i < len(sql); i++ {
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+func isWordByte(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestWriteVerb(t *testing.T) {
+	cases := []struct {
+		sql  string
+		verb string
+	}{
+		{"SELECT * FROM users", ""},
+		{"select _id from users for all valid_time where name = 'DELETE FROM users'", ""},
+		{"-- INSERT INTO audit\n/* UPDATE users */ SELECT 1", ""},
+		{"WITH recent AS (SELECT * FROM orders), big AS (SELECT * FROM recent WHERE total > 100) SELECT * FROM big", ""},
+		{"WITH t AS MATERIALIZED (SELECT 1) SELECT * FROM (SELECT 2) x", ""},
+		{"COPY (SELECT * FROM users) TO STDOUT", ""},
+		{"SHOW TIMEZONE", ""},
+		{"INSERT INTO users RECORDS {_id: 1}", "INSERT"},
+		{"  update users SET name = 'x' WHERE _id = 1", "UPDATE"},
+		{"/* cleanup */ DELETE FROM users WHERE _id = 1", "DELETE"},
+		{"-- hard delete\nERASE FROM users WHERE _id = 1", "ERASE"},
+		{"PATCH INTO users RECORDS {_id: 1, name: 'x'}", "PATCH"},
+		{"COPY users FROM STDIN WITH (FORMAT 'transit-json')", "COPY FROM"},
+		{"SELECT 1; DELETE FROM users WHERE _id = 1", "DELETE"},
+		{"WITH gone AS (DELETE FROM users WHERE _id = 1) SELECT 1", "DELETE"},
+		{"WITH src AS (SELECT * FROM staging) INSERT INTO users SELECT * FROM src", "INSERT"},
+	}
+
+	for _, tc := range cases {
+		if got := writeVerb(tc.sql); got != tc.verb {
+			t.Errorf("%q: expected %q, got %q", tc.sql, tc.verb, got)
+		}
+	}
+}
+
+func TestReadOnlyConnBlocksWrites(t *testing.T) {
+	// Writes are refused before anything is sent, so no server is needed
+	c := &Conn{cfg: connectConfig{readOnly: true}}
+	ctx := context.Background()
+
+	var roErr *ReadOnlyError
+
+	_, err := c.Exec(ctx, "INSERT INTO users RECORDS {_id: 1}")
+	if !errors.Is(err, ErrReadOnly) || !errors.As(err, &roErr) || roErr.Verb != "INSERT" {
+		t.Errorf("Exec: expected INSERT to be refused, got %v", err)
+	}
+
+	_, err = c.Query(ctx, "UPDATE users SET name = 'x' WHERE _id = 1")
+	if !errors.As(err, &roErr) || roErr.Verb != "UPDATE" {
+		t.Errorf("Query: expected UPDATE to be refused, got %v", err)
+	}
+
+	err = c.QueryRow(ctx, "DELETE FROM users WHERE _id = 1").Scan()
+	if !errors.As(err, &roErr) || roErr.Verb != "DELETE" {
+		t.Errorf("QueryRow: expected DELETE to be refused, got %v", err)
+	}
+
+	_, err = c.CopyFrom(ctx, []string{"users"}, []string{"_id"}, nil)
+	if !errors.As(err, &roErr) || roErr.Verb != "COPY FROM" {
+		t.Errorf("CopyFrom: expected COPY FROM to be refused, got %v", err)
+	}
+
+	_, err = c.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadWrite})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("BeginTx: expected a READ WRITE transaction to be refused, got %v", err)
+	}
+}
+
+func TestReadOnlyConn(t *testing.T) {
+	ctx := context.Background()
+	table := getCleanTable()
+
+	connStr := fmt.Sprintf("postgres://%s:5432/xtdb", getXtdbHost())
+	conn, err := Connect(ctx, connStr, ReadOnly())
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var n int
+	if err := conn.QueryRow(ctx, "SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("SELECT should pass, got %d, %v", n, err)
+	}
+
+	_, err = conn.Exec(ctx, fmt.Sprintf("ERASE FROM %s WHERE _id = 1", table))
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ERASE to be refused, got %v", err)
+	}
+
+	// The escape hatch still works, and the connection is usable afterwards
+	_, err = conn.Exec(AllowWrites(ctx), fmt.Sprintf("INSERT INTO %s RECORDS {_id: 1, name: 'allowed'}", table))
+	if err != nil {
+		t.Fatalf("AllowWrites insert failed: %v", err)
+	}
+
+	var name string
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT name FROM %s WHERE _id = 1", table)).Scan(&name)
+	if err != nil || name != "allowed" {
+		t.Errorf("Expected the allowed write to be visible, got %q, %v", name, err)
+	}
+
+	// Transactions are read-only on the server, unless begun under AllowWrites
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: 2}", table))
+	if err == nil {
+		err = tx.Commit(ctx)
+	} else {
+		tx.Rollback(ctx)
+	}
+	if err == nil {
+		t.Error("Expected a write in a read-only transaction to fail")
+	}
+
+	// BeginTx, promoted from pgx.Conn, would otherwise skip the guard
+	tx, err = conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: 2}", table))
+	if err == nil {
+		err = tx.Commit(ctx)
+	} else {
+		tx.Rollback(ctx)
+	}
+	if err == nil {
+		t.Error("Expected a write in a read-only BeginTx transaction to fail")
+	}
+
+	tx, err = conn.Begin(AllowWrites(ctx))
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: 3}", table)); err != nil {
+		tx.Rollback(ctx)
+		t.Fatalf("Insert in an allowed transaction failed: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Errorf("Commit failed: %v", err)
+	}
+}
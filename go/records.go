@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	tablePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+)
+
+// checkTable rejects table names that can't be interpolated into SQL safely
+func checkTable(table string) error {
+	if !tablePattern.MatchString(table) {
+		return fmt.Errorf("invalid table name %q", table)
+	}
+	return nil
+}
+
+// collectMaps reads every remaining row into a column name -> value map
+func collectMaps(rows pgx.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+
+	fieldDescs := rows.FieldDescriptions()
+	var result []map[string]interface{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(fieldDescs))
+		for i, fd := range fieldDescs {
+			row[fd.Name] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// BuildRecordsLiteral renders records as the body of an INSERT ... RECORDS
+// statement, e.g. {_id: 'alice', age: 30}, {_id: 'bob', age: 25}.
+//
+// Values are rendered as SQL literals rather than bound parameters, so types
+// that the JSON OID path would flatten (timestamps, nested structs) survive.
+func BuildRecordsLiteral(records ...map[string]interface{}) (string, error) {
+	if len(records) == 0 {
+		return "", fmt.Errorf("no records to render")
+	}
+
+	rendered := make([]string, len(records))
+	for i, record := range records {
+		lit, err := formatLiteral(record)
+		if err != nil {
+			return "", fmt.Errorf("record %d: %w", i, err)
+		}
+		rendered[i] = lit
+	}
+	return strings.Join(rendered, ", "), nil
+}
+
+// RecordsSQL renders a complete INSERT INTO table RECORDS ... statement for
+// records without running it, e.g. for a migration file or a log line
+func RecordsSQL(table string, records ...map[string]interface{}) (string, error) {
+	if err := checkTable(table); err != nil {
+		return "", err
+	}
+	lit, err := BuildRecordsLiteral(records...)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INSERT INTO %s RECORDS %s", table, lit), nil
+}
+
+// formatLiteral renders a Go value as an XTDB SQL literal (see xtdb.Literal)
+func formatLiteral(value interface{}) (string, error) {
+	return xtdb.Literal(value)
+}
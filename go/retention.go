@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteOrErase picks how ApplyRetention removes expired records
+type DeleteOrErase int
+
+const (
+	// RetentionDelete ends each record's validity now; its history stays
+	// queryable with FOR VALID_TIME
+	RetentionDelete DeleteOrErase = iota
+	// RetentionErase purges every version of the record
+	RetentionErase
+)
+
+func (m DeleteOrErase) String() string {
+	if m == RetentionErase {
+		return "erase"
+	}
+	return "delete"
+}
+
+// RetentionOption configures ApplyRetention
+type RetentionOption func(*retentionConfig)
+
+type retentionConfig struct {
+	dryRun   bool
+	progress func(done, total int)
+	now      func() time.Time
+}
+
+// RetentionDryRun finds the expired records without removing them
+func RetentionDryRun() RetentionOption {
+	return func(c *retentionConfig) { c.dryRun = true }
+}
+
+// RetentionProgress calls fn after each batch with the number of records
+// removed so far and the number that expired
+func RetentionProgress(fn func(done, total int)) RetentionOption {
+	return func(c *retentionConfig) { c.progress = fn }
+}
+
+// RetentionResult summarises an ApplyRetention run
+type RetentionResult struct {
+	Cutoff  time.Time
+	Expired []any // _ids of current records valid from before Cutoff
+	Removed int   // zero on a dry run
+}
+
+// ApplyRetention removes the current records in table whose _valid_from is
+// more than olderThan ago, batchSize ids per statement. A failed batch stops
+// the run; Removed counts the batches that succeeded, and rerunning picks up
+// where it left off.
+func ApplyRetention(ctx context.Context, conn *pgx.Conn, table string, olderThan time.Duration, mode DeleteOrErase, batchSize int, opts ...RetentionOption) (RetentionResult, error) {
+	if err := checkTable(table); err != nil {
+		return RetentionResult{}, err
+	}
+	if batchSize <= 0 {
+		return RetentionResult{}, fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+	cfg := retentionConfig{now: time.Now}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	result := RetentionResult{Cutoff: cfg.now().Add(-olderThan).UTC()}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT _id FROM %s WHERE _valid_from < %s ORDER BY _id",
+		table, timestampLiteral(result.Cutoff))))
+	if err != nil {
+		return result, fmt.Errorf("finding expired records in %s: %w", table, err)
+	}
+	result.Expired, err = pgx.CollectRows(rows, pgx.RowTo[any])
+	if err != nil {
+		return result, fmt.Errorf("finding expired records in %s: %w", table, err)
+	}
+	if cfg.dryRun {
+		return result, nil
+	}
+
+	verb := "DELETE"
+	if mode == RetentionErase {
+		verb = "ERASE"
+	}
+	for start := 0; start < len(result.Expired); start += batchSize {
+		batch := result.Expired[start:min(start+batchSize, len(result.Expired))]
+		ids := make([]string, len(batch))
+		for i, id := range batch {
+			if ids[i], err = formatLiteral(id); err != nil {
+				return result, fmt.Errorf("formatting id %v: %w", id, err)
+			}
+		}
+
+		sql := fmt.Sprintf("%s FROM %s WHERE _id IN (%s)", verb, table, strings.Join(ids, ", "))
+		if _, err := conn.Exec(ctx, tagSQL(ctx, sql)); err != nil {
+			return result, fmt.Errorf("%s of %d records from %s: %w", mode, len(batch), table, err)
+		}
+		result.Removed += len(batch)
+		if cfg.progress != nil {
+			cfg.progress(result.Removed, len(result.Expired))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// insertSessions inserts sessions created 40, 35 and 10 days ago
+func insertSessions(t *testing.T, ctx context.Context, conn *pgx.Conn, table string) {
+	now := time.Now()
+	for id, age := range map[string]int{"old-1": 40, "old-2": 35, "fresh": 10} {
+		_, err := conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: '%s', _valid_from: %s}",
+			table, id, timestampLiteral(now.AddDate(0, 0, -age))))
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+}
+
+func countRows(t *testing.T, ctx context.Context, conn *pgx.Conn, sql string) int64 {
+	var n int64
+	if err := conn.QueryRow(ctx, sql).Scan(&n); err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	return n
+}
+
+func TestApplyRetention(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	const ttl = 30 * 24 * time.Hour
+
+	for _, mode := range []DeleteOrErase{RetentionDelete, RetentionErase} {
+		t.Run(mode.String(), func(t *testing.T) {
+			table := getCleanTable()
+			insertSessions(t, ctx, conn, table)
+
+			dry, err := ApplyRetention(ctx, conn, table, ttl, mode, 1, RetentionDryRun())
+			if err != nil {
+				t.Fatalf("Dry run failed: %v", err)
+			}
+			if len(dry.Expired) != 2 || dry.Removed != 0 {
+				t.Fatalf("Expected dry run to find 2 expired and remove none, got %+v", dry)
+			}
+			if n := countRows(t, ctx, conn, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)); n != 3 {
+				t.Fatalf("Dry run removed records: %d left", n)
+			}
+
+			var progress [][2]int
+			result, err := ApplyRetention(ctx, conn, table, ttl, mode, 1,
+				RetentionProgress(func(done, total int) { progress = append(progress, [2]int{done, total}) }))
+			if err != nil {
+				t.Fatalf("ApplyRetention failed: %v", err)
+			}
+			if result.Removed != 2 || len(progress) != 2 || progress[1] != [2]int{2, 2} {
+				t.Errorf("Expected 2 removed in 2 batches, got %+v with progress %v", result, progress)
+			}
+
+			var current []string
+			rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id FROM %s", table))
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if current, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(current) != 1 || current[0] != "fresh" {
+				t.Errorf("Expected only 'fresh' to remain, got %v", current)
+			}
+
+			history := countRows(t, ctx, conn, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR ALL VALID_TIME WHERE _id LIKE 'old-%%'", table))
+			if mode == RetentionDelete && history != 2 {
+				t.Errorf("Delete mode should keep history, got %d old versions", history)
+			}
+			if mode == RetentionErase && history != 0 {
+				t.Errorf("Erase mode should purge history, got %d old versions", history)
+			}
+		})
+	}
+}
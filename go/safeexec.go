@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SafeExec runs sql through conn.Exec and, if that fails because the
+// statement's parameters couldn't be described or encoded (as with INSERT ...
+// RECORDS $1, see xtdb_types.go), runs it again with PgConn().ExecParams and
+// parameter OIDs inferred from args. Maps, slices and structs are sent as
+// JSON (OID 114), so a RECORDS insert can be passed the record itself.
+//
+// Only failures that happen before the statement runs trigger the fallback;
+// any other error is returned as is.
+func SafeExec(ctx context.Context, conn *pgx.Conn, sql string, args ...any) (pgconn.CommandTag, error) {
+	sql = tagSQL(ctx, sql)
+	tag, err := conn.Exec(ctx, sql, args...)
+	if err == nil || !isDescribeFailure(err) && !isEncodeFailure(ctx, conn, sql, args, err) {
+		return tag, err
+	}
+
+	values := make([][]byte, len(args))
+	oids := make([]uint32, len(args))
+	for i, arg := range args {
+		values[i], oids[i], err = inferParam(arg)
+		if err != nil {
+			return pgconn.CommandTag{}, fmt.Errorf("args[%d]: %w", i, err)
+		}
+	}
+	formats := make([]int16, len(args)) // all text
+
+	return traceExec(ctx, conn, sql, args, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return conn.PgConn().ExecParams(ctx, sql, values, oids, formats, nil).Close()
+	})
+}
+
+// isDescribeFailure reports whether err is the server refusing to describe
+// the statement's parameters, indeterminate_datatype (42P18), in which case
+// the statement never ran
+func isDescribeFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42P18"
+}
+
+// isEncodeFailure reports whether err, a client-side error from Exec, was pgx
+// failing to encode args for the parameter types the server describes for
+// sql. pgx's encode error has no type of its own, so sql is described again
+// and args encoded against it here; only the failure path pays for that.
+func isEncodeFailure(ctx context.Context, conn *pgx.Conn, sql string, args []any, err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) || conn.IsClosed() {
+		return false
+	}
+	sd, err := conn.PgConn().Prepare(ctx, "", sql, nil)
+	if err != nil || len(sd.ParamOIDs) != len(args) {
+		return false
+	}
+	for i, arg := range args {
+		if !canEncode(conn.TypeMap(), sd.ParamOIDs[i], arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// canEncode reports whether m can encode arg as oid, in either format, as
+// pgx tries both before giving up
+func canEncode(m *pgtype.Map, oid uint32, arg any) bool {
+	for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+		if _, err := m.Encode(oid, format, arg, nil); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inferParam encodes arg as a text-format parameter and picks its OID
+func inferParam(arg any) ([]byte, uint32, error) {
+	switch v := arg.(type) {
+	case nil:
+		return nil, 0, nil
+	case json.RawMessage:
+		return v, JSONOID, nil
+	case []byte:
+		if json.Valid(v) {
+			return v, JSONOID, nil
+		}
+		return []byte(`\x` + hex.EncodeToString(v)), pgtype.ByteaOID, nil
+	case string:
+		return []byte(v), pgtype.TextOID, nil
+	case bool:
+		return []byte(strconv.FormatBool(v)), pgtype.BoolOID, nil
+	case int:
+		return []byte(strconv.FormatInt(int64(v), 10)), pgtype.Int8OID, nil
+	case int32:
+		return []byte(strconv.FormatInt(int64(v), 10)), pgtype.Int8OID, nil
+	case int64:
+		return []byte(strconv.FormatInt(v, 10)), pgtype.Int8OID, nil
+	case float32:
+		return []byte(strconv.FormatFloat(float64(v), 'g', -1, 32)), pgtype.Float8OID, nil
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'g', -1, 64)), pgtype.Float8OID, nil
+	case time.Time:
+		return []byte(v.Format(time.RFC3339Nano)), pgtype.TimestamptzOID, nil
+	case uuid.UUID:
+		return []byte(v.String()), pgtype.UUIDOID, nil
+	}
+
+	encoded, err := json.Marshal(arg)
+	if err != nil {
+		return nil, 0, fmt.Errorf("encoding %T as JSON: %w", arg, err)
+	}
+	return encoded, JSONOID, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestInferParam(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		arg   any
+		value string
+		oid   uint32
+	}{
+		{map[string]interface{}{"_id": 1}, `{"_id":1}`, JSONOID},
+		{[]byte(`{"a":1}`), `{"a":1}`, JSONOID},
+		{[]byte{0xde, 0xad}, `\xdead`, pgtype.ByteaOID},
+		{"Alice", "Alice", pgtype.TextOID},
+		{int64(42), "42", pgtype.Int8OID},
+		{1.5, "1.5", pgtype.Float8OID},
+		{true, "true", pgtype.BoolOID},
+		{at, "2024-01-02T03:04:05Z", pgtype.TimestamptzOID},
+		{uuid.MustParse("11111111-2222-3333-4444-555555555555"), "11111111-2222-3333-4444-555555555555", pgtype.UUIDOID},
+		{nil, "", 0},
+	}
+	for _, c := range cases {
+		value, oid, err := inferParam(c.arg)
+		if err != nil {
+			t.Errorf("inferParam(%#v) failed: %v", c.arg, err)
+			continue
+		}
+		if string(value) != c.value || oid != c.oid {
+			t.Errorf("inferParam(%#v) = (%q, %d), want (%q, %d)", c.arg, value, oid, c.value, c.oid)
+		}
+	}
+
+	if _, _, err := inferParam(make(chan int)); err == nil {
+		t.Error("Expected an error for a value that can't be sent as JSON")
+	}
+}
+
+func TestIsDescribeFailure(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "42P18", Message: "could not determine data type of parameter $1"}, true},
+		{fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "42P18"}), true},
+		{fmt.Errorf("failed to encode args[0]: %w", errors.New("cannot find encode plan")), false},
+		{&pgconn.PgError{Code: "0A000", Message: "not supported"}, false},
+		{&pgconn.PgError{Code: "23505", Message: "duplicate key"}, false},
+		{&pgconn.PgError{Code: "42601", Message: "failed to encode args while describing"}, false},
+		{errors.New("connection reset"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := isDescribeFailure(c.err); got != c.want {
+			t.Errorf("isDescribeFailure(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestCanEncode(t *testing.T) {
+	m := pgtype.NewMap()
+	record := map[string]interface{}{"_id": "a"}
+	if !canEncode(m, pgtype.Int8OID, int64(5)) {
+		t.Error("Expected an int64 to encode as int8")
+	}
+	if !canEncode(m, JSONOID, record) {
+		t.Error("Expected a map to encode as JSON")
+	}
+	if canEncode(m, pgtype.Int8OID, record) {
+		t.Error("Expected a map not to encode as int8")
+	}
+}
+
+func TestSafeExecRecords(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+	sql := fmt.Sprintf("INSERT INTO %s RECORDS $1", table)
+	record := map[string]interface{}{"_id": "a", "name": "Alice"}
+
+	// Plain Exec can't describe the RECORDS parameter
+	if _, err := conn.Exec(ctx, sql, record); err == nil {
+		t.Log("Plain Exec succeeded; this server describes RECORDS parameters")
+	} else if !isDescribeFailure(err) && !isEncodeFailure(ctx, conn, sql, []any{record}, err) {
+		t.Fatalf("Plain Exec failed in a way SafeExec wouldn't retry: %v", err)
+	}
+
+	tag, err := SafeExec(ctx, conn, sql, record)
+	if err != nil {
+		t.Fatalf("SafeExec failed: %v", err)
+	}
+	if !tag.Insert() {
+		t.Errorf("Expected an INSERT command tag, got %q", tag)
+	}
+
+	var name string
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT name FROM %s WHERE _id = 'a'", table)).Scan(&name); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if name != "Alice" {
+		t.Errorf("Expected Alice, got %q", name)
+	}
+}
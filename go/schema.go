@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrSchemaViolation is wrapped by every *SchemaError
+var ErrSchemaViolation = errors.New("schema violation")
+
+// SchemaViolation is one way a document failed its table's schema
+type SchemaViolation struct {
+	ID      any
+	Path    string // e.g. $.metadata.level
+	Message string
+}
+
+// SchemaError lists the violations that stopped records being inserted
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = fmt.Sprintf("_id %v: %s: %s", v.ID, v.Path, v.Message)
+	}
+	return fmt.Sprintf("%d schema violation(s): %s", len(e.Violations), strings.Join(msgs, "; "))
+}
+
+func (e *SchemaError) Unwrap() error { return ErrSchemaViolation }
+
+// SchemaPolicy decides what a violation does to the rest of an insert
+type SchemaPolicy int
+
+const (
+	// SchemaRejectRecord skips invalid records, inserts the rest, then
+	// returns a *SchemaError
+	SchemaRejectRecord SchemaPolicy = iota
+	// SchemaRejectBatch inserts nothing if any record is invalid
+	SchemaRejectBatch
+)
+
+// JSONSchema is the subset of JSON Schema the validator understands: type,
+// properties, required, additionalProperties (boolean), items, enum,
+// minimum/maximum and minLength/maxLength. Other keywords are ignored.
+type JSONSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*JSONSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *JSONSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+}
+
+// schemaTypes accepts "type" as a string or a list of strings
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or list of strings")
+	}
+	*t = many
+	return nil
+}
+
+// LoadJSONSchema reads a JSON Schema file
+func LoadJSONSchema(path string) (*JSONSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema JSONSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &schema, nil
+}
+
+// SchemaRegistry maps table names to the schema their documents must match.
+// Tables without a schema aren't validated.
+type SchemaRegistry struct {
+	schemas map[string]*JSONSchema
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: map[string]*JSONSchema{}}
+}
+
+// Register sets the schema for table
+func (r *SchemaRegistry) Register(table string, schema *JSONSchema) {
+	r.schemas[table] = schema
+}
+
+// RegisterFile loads path and registers it for table
+func (r *SchemaRegistry) RegisterFile(table, path string) error {
+	schema, err := LoadJSONSchema(path)
+	if err != nil {
+		return err
+	}
+	r.Register(table, schema)
+	return nil
+}
+
+// WithSchemas validates each record against its table's schema before it's
+// inserted
+func WithSchemas(registry *SchemaRegistry, policy SchemaPolicy) InsertOption {
+	return func(c *insertConfig) {
+		c.schemas = registry
+		c.schemaPolicy = policy
+	}
+}
+
+// Validate checks record against table's schema, if it has one
+func (r *SchemaRegistry) Validate(table string, record map[string]interface{}) []SchemaViolation {
+	schema := r.schemas[table]
+	if schema == nil {
+		return nil
+	}
+	var violations []SchemaViolation
+	schema.validate("$", record, func(path, msg string) {
+		violations = append(violations, SchemaViolation{ID: record["_id"], Path: path, Message: msg})
+	})
+	return violations
+}
+
+func (s *JSONSchema) validate(path string, value interface{}, report func(path, msg string)) {
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		report(path, fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), jsonTypeOf(value)))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report(path, fmt.Sprintf("%v is not one of %v", value, s.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				report(path+"."+name, "required field missing")
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(path+"."+k, v[k], report)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties && !strings.HasPrefix(k, "_") {
+				report(path+"."+k, "unexpected field")
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, report)
+			}
+		}
+
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			report(path, fmt.Sprintf("shorter than %d characters", *s.MinLength))
+		}
+		if s.MaxLength != nil && len(v) > *s.MaxLength {
+			report(path, fmt.Sprintf("longer than %d characters", *s.MaxLength))
+		}
+
+	default:
+		if n, ok := schemaNumber(value); ok {
+			if s.Minimum != nil && n < *s.Minimum {
+				report(path, fmt.Sprintf("%v is less than minimum %v", n, *s.Minimum))
+			}
+			if s.Maximum != nil && n > *s.Maximum {
+				report(path, fmt.Sprintf("%v is greater than maximum %v", n, *s.Maximum))
+			}
+		}
+	}
+}
+
+func (s *JSONSchema) matchesType(value interface{}) bool {
+	actual := jsonTypeOf(value)
+	for _, t := range s.Type {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf names value's JSON Schema type. Timestamps count as strings,
+// as they would once encoded.
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string, time.Time:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if n, ok := schemaNumber(v); ok {
+			if n == math.Trunc(n) {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func schemaNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
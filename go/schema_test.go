@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const userSchemaJSON = `{
+  "type": "object",
+  "required": ["_id", "name", "email"],
+  "properties": {
+    "_id": {"type": "string"},
+    "name": {"type": "string", "minLength": 1},
+    "email": {"type": "string"},
+    "age": {"type": "integer", "minimum": 0},
+    "active": {"type": "boolean"},
+    "tags": {"type": "array", "items": {"type": "string"}},
+    "metadata": {
+      "type": "object",
+      "properties": {
+        "department": {"type": "string", "enum": ["Engineering", "Product", "Sales"]},
+        "level": {"type": "integer", "minimum": 1, "maximum": 10}
+      }
+    }
+  }
+}`
+
+func userSchemaRegistry(t *testing.T, table string) *SchemaRegistry {
+	path := filepath.Join(t.TempDir(), "users.schema.json")
+	if err := os.WriteFile(path, []byte(userSchemaJSON), 0o644); err != nil {
+		t.Fatalf("Writing schema failed: %v", err)
+	}
+	registry := NewSchemaRegistry()
+	if err := registry.RegisterFile(table, path); err != nil {
+		t.Fatalf("RegisterFile failed: %v", err)
+	}
+	return registry
+}
+
+func TestSchemaValidate(t *testing.T) {
+	registry := userSchemaRegistry(t, "users")
+
+	// Every sample user matches the schema
+	content, err := os.ReadFile("../test-data/sample-users.json")
+	if err != nil {
+		t.Fatalf("Failed to read JSON file: %v", err)
+	}
+	var users []map[string]interface{}
+	if err := json.Unmarshal(content, &users); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	for _, user := range users {
+		if v := registry.Validate("users", user); len(v) > 0 {
+			t.Errorf("Sample user %v failed validation: %v", user["_id"], v)
+		}
+	}
+
+	cases := []struct {
+		record map[string]interface{}
+		path   string
+	}{
+		{map[string]interface{}{"_id": "x", "name": "X", "email": "x@example.com", "age": "thirty"}, "$.age"},
+		{map[string]interface{}{"_id": "x", "name": "X", "email": "x@example.com", "age": 1.5}, "$.age"},
+		{map[string]interface{}{"_id": "x", "name": "X"}, "$.email"},
+		{map[string]interface{}{"_id": "x", "name": "X", "email": "x@example.com", "tags": []interface{}{"ok", 7}}, "$.tags[1]"},
+		{map[string]interface{}{"_id": "x", "name": "X", "email": "x@example.com",
+			"metadata": map[string]interface{}{"department": "Legal"}}, "$.metadata.department"},
+		{map[string]interface{}{"_id": "x", "name": "X", "email": "x@example.com",
+			"metadata": map[string]interface{}{"level": 11}}, "$.metadata.level"},
+	}
+	for _, tc := range cases {
+		v := registry.Validate("users", tc.record)
+		if len(v) != 1 || v[0].Path != tc.path || v[0].ID != "x" {
+			t.Errorf("%v: expected one violation at %s, got %v", tc.record, tc.path, v)
+		}
+	}
+
+	if v := registry.Validate("orders", map[string]interface{}{"anything": true}); v != nil {
+		t.Errorf("Tables without a schema should pass, got %v", v)
+	}
+}
+
+func TestInsertRecordsWithSchemas(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	good := map[string]interface{}{"_id": "good", "name": "Good", "email": "good@example.com"}
+	bad := map[string]interface{}{"_id": "bad", "name": "Bad"}
+
+	count := func(table string) int64 {
+		var n int64
+		if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&n); err != nil {
+			return 0 // table never created
+		}
+		return n
+	}
+
+	batchTable := getCleanTable()
+	err := InsertRecords(ctx, conn, batchTable, []map[string]interface{}{good, bad},
+		WithSchemas(userSchemaRegistry(t, batchTable), SchemaRejectBatch))
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || len(schemaErr.Violations) != 1 || schemaErr.Violations[0].ID != "bad" {
+		t.Fatalf("Expected one violation for 'bad', got %v", err)
+	}
+	if n := count(batchTable); n != 0 {
+		t.Errorf("Reject-batch should insert nothing, found %d rows", n)
+	}
+
+	recordTable := getCleanTable()
+	err = InsertRecords(ctx, conn, recordTable, []map[string]interface{}{good, bad},
+		WithSchemas(userSchemaRegistry(t, recordTable), SchemaRejectRecord))
+	if !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("Expected ErrSchemaViolation, got %v", err)
+	}
+	if n := count(recordTable); n != 1 {
+		t.Errorf("Reject-record should insert the valid record, found %d rows", n)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Sample is a query's result as of one point in valid time
+type Sample struct {
+	At   time.Time
+	Rows []map[string]interface{}
+}
+
+// SampleAsOfSeries runs query as of each point from, from+step, ... up to and
+// including to, e.g. "how many users were active at the start of each
+// month". The query is run once per point with SETTING DEFAULT VALID_TIME, so
+// it can be any SELECT; the runs are pipelined in a single batch rather
+// than costing a round trip each.
+func SampleAsOfSeries(ctx context.Context, conn *pgx.Conn, query string, from, to time.Time, step time.Duration) ([]Sample, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive, got %v", step)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to (%s) is before from (%s)", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	var samples []Sample
+	batch := &pgx.Batch{}
+	for at := from; !at.After(to); at = at.Add(step) {
+		samples = append(samples, Sample{At: at})
+		batch.Queue(tagSQL(ctx, fmt.Sprintf("SETTING DEFAULT VALID_TIME AS OF %s %s", timestampLiteral(at), query)))
+	}
+
+	results := conn.SendBatch(ctx, batch)
+	for i := range samples {
+		rows, err := results.Query()
+		if err != nil {
+			results.Close()
+			return nil, fmt.Errorf("sampling as of %s: %w", samples[i].At.Format(time.RFC3339), err)
+		}
+		samples[i].Rows, err = collectMaps(rows)
+		if err != nil {
+			results.Close()
+			return nil, fmt.Errorf("sampling as of %s: %w", samples[i].At.Format(time.RFC3339), err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
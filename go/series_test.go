@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSampleAsOfSeries(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, stmt := range []string{
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'alice', _valid_from: %s}", table, timestampLiteral(jan)),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'bob', _valid_from: %s}", table, timestampLiteral(feb)),
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := SoftDelete(ctx, conn, table, "alice", mar); err != nil {
+		t.Fatalf("SoftDelete failed: %v", err)
+	}
+
+	// Mid-December (before any data), then roughly mid-month through March
+	from := time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	samples, err := SampleAsOfSeries(ctx, conn, fmt.Sprintf("SELECT COUNT(*) AS n FROM %s", table), from, to, 31*24*time.Hour)
+	if err != nil {
+		t.Fatalf("SampleAsOfSeries failed: %v", err)
+	}
+
+	var counts []string
+	for _, s := range samples {
+		counts = append(counts, fmt.Sprintf("%s=%v", s.At.Format("01-02"), s.Rows[0]["n"]))
+	}
+	if fmt.Sprint(counts) != "[12-15=0 01-15=1 02-15=2 03-17=1]" {
+		t.Errorf("Unexpected samples: %v", counts)
+	}
+
+	if _, err := SampleAsOfSeries(ctx, conn, "SELECT 1", to, from, time.Hour); err == nil {
+		t.Error("Expected error when to is before from")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Shape describes the expected structure of a decoded record: each field maps
+// to a Kind, a nested Shape, or an ArrayOf element descriptor.
+type Shape map[string]interface{}
+
+// Kind is the expected type of a scalar field
+type Kind int
+
+const (
+	KindAny Kind = iota
+	KindString
+	KindNumber
+	KindBool
+	KindTime
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindAny:
+		return "any"
+	case KindString:
+		return "string"
+	case KindNumber:
+		return "number"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "time"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+type arrayShape struct {
+	elem interface{}
+}
+
+// ArrayOf describes an array whose elements all match elem
+func ArrayOf(elem interface{}) interface{} {
+	return arrayShape{elem: elem}
+}
+
+// AssertShape fails the test at the first path in value that doesn't match
+// shape. Fields absent from shape are ignored.
+func AssertShape(t testing.TB, value interface{}, shape Shape) {
+	t.Helper()
+	if err := matchShape("$", value, shape); err != nil {
+		t.Errorf("Shape mismatch: %v", err)
+	}
+}
+
+func matchShape(path string, value interface{}, expected interface{}) error {
+	switch want := expected.(type) {
+	case Kind:
+		if !isKind(value, want) {
+			return fmt.Errorf("%s: expected %s, got %T (%v)", path, want, value, value)
+		}
+
+	case Shape:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T (%v)", path, value, value)
+		}
+		// Walk fields in a fixed order so the first mismatch is deterministic
+		fields := make([]string, 0, len(want))
+		for field := range want {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			v, present := m[field]
+			if !present {
+				return fmt.Errorf("%s.%s: missing", path, field)
+			}
+			if err := matchShape(path+"."+field, v, want[field]); err != nil {
+				return err
+			}
+		}
+
+	case arrayShape:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T (%v)", path, value, value)
+		}
+		for i, elem := range arr {
+			if err := matchShape(fmt.Sprintf("%s[%d]", path, i), elem, want.elem); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("%s: invalid shape descriptor %T", path, expected)
+	}
+	return nil
+}
+
+func isKind(value interface{}, kind Kind) bool {
+	switch kind {
+	case KindAny:
+		return true
+	case KindString:
+		_, ok := value.(string)
+		return ok
+	case KindNumber:
+		switch value.(type) {
+		case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64, json.Number:
+			return true
+		}
+	case KindBool:
+		_, ok := value.(bool)
+		return ok
+	case KindTime:
+		_, ok := value.(time.Time)
+		return ok
+	}
+	return false
+}
+
+// sampleUserShape is the decoded shape of a record from sample-users.json
+var sampleUserShape = Shape{
+	"_id":    KindString,
+	"name":   KindString,
+	"age":    KindNumber,
+	"email":  KindString,
+	"active": KindBool,
+	"salary": KindNumber,
+	"tags":   ArrayOf(KindString),
+	"metadata": Shape{
+		"department": KindString,
+		"level":      KindNumber,
+		"joined":     KindString,
+	},
+}
+
+func TestAssertShapeMatches(t *testing.T) {
+	record := map[string]interface{}{
+		"_id":    "alice",
+		"name":   "Alice Smith",
+		"age":    int64(30),
+		"email":  "alice@example.com",
+		"active": true,
+		"salary": 125000.5,
+		"tags":   []interface{}{"admin", "developer"},
+		"metadata": map[string]interface{}{
+			"department": "Engineering",
+			"level":      float64(5),
+			"joined":     "2020-01-15",
+		},
+		"extra": "ignored",
+	}
+
+	AssertShape(t, record, sampleUserShape)
+}
+
+func TestAssertShapeMismatches(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		shape Shape
+		path  string
+	}{
+		{
+			name:  "nested scalar",
+			value: map[string]interface{}{"metadata": map[string]interface{}{"level": "five"}},
+			shape: Shape{"metadata": Shape{"level": KindNumber}},
+			path:  "$.metadata.level",
+		},
+		{
+			name:  "missing nested field",
+			value: map[string]interface{}{"metadata": map[string]interface{}{}},
+			shape: Shape{"metadata": Shape{"department": KindString}},
+			path:  "$.metadata.department",
+		},
+		{
+			name:  "array element",
+			value: map[string]interface{}{"tags": []interface{}{"admin", 42}},
+			shape: Shape{"tags": ArrayOf(KindString)},
+			path:  "$.tags[1]",
+		},
+		{
+			name:  "array of shapes",
+			value: map[string]interface{}{"items": []interface{}{map[string]interface{}{"qty": true}}},
+			shape: Shape{"items": ArrayOf(Shape{"qty": KindNumber})},
+			path:  "$.items[0].qty",
+		},
+		{
+			name:  "object expected",
+			value: map[string]interface{}{"metadata": "flat"},
+			shape: Shape{"metadata": Shape{}},
+			path:  "$.metadata",
+		},
+		{
+			name:  "unknown kind",
+			value: map[string]interface{}{"age": 30},
+			shape: Shape{"age": Kind(99)},
+			path:  "$.age",
+		},
+	}
+
+	for _, tc := range cases {
+		err := matchShape("$", tc.value, tc.shape)
+		if err == nil {
+			t.Errorf("%s: expected mismatch, got none", tc.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tc.path+":") {
+			t.Errorf("%s: expected mismatch at %s, got %v", tc.name, tc.path, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// Snapshot holds the current rows of a table, as captured by SnapshotTable
+type Snapshot struct {
+	Table string
+	Rows  []map[string]interface{}
+}
+
+// SnapshotTable captures every current row of table so a test can mutate
+// shared data and put it back afterwards with RestoreTable.
+func SnapshotTable(ctx context.Context, conn *pgx.Conn, table string) (Snapshot, error) {
+	if err := checkTable(table); err != nil {
+		return Snapshot{}, err
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT * FROM %s", table)))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("querying %s: %w", table, err)
+	}
+	records, err := collectMaps(rows)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("reading %s: %w", table, err)
+	}
+
+	// SELECT * pads missing columns with NULL; drop them so restored
+	// documents keep their original shape
+	for _, record := range records {
+		for k, v := range record {
+			if v == nil {
+				delete(record, k)
+			}
+		}
+	}
+
+	return Snapshot{Table: table, Rows: records}, nil
+}
+
+// restoreBatch is how many ids RestoreTable erases, and how many rows it
+// re-inserts, per statement
+const restoreBatch = 500
+
+// RestoreTable erases every entity in table (including its history) and
+// re-inserts the rows captured in snap, in one transaction, so a restore
+// that fails part way leaves the table as it was. The restored rows are
+// valid from now, not from their original _valid_from.
+func RestoreTable(ctx context.Context, conn *pgx.Conn, table string, snap Snapshot) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT DISTINCT _id FROM %s FOR ALL VALID_TIME", table)))
+	if err != nil {
+		return fmt.Errorf("listing ids in %s: %w", table, err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[interface{}])
+	if err != nil {
+		return fmt.Errorf("listing ids in %s: %w", table, err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("restoring %s: %w", table, err)
+	}
+	defer tx.Rollback(ctx)
+
+	// One ERASE per batch of ids, as ApplyRetention does, rather than one
+	// per id
+	for start := 0; start < len(ids); start += restoreBatch {
+		batch := ids[start:min(start+restoreBatch, len(ids))]
+		lits := make([]string, len(batch))
+		for i, id := range batch {
+			if lits[i], err = formatLiteral(id); err != nil {
+				return fmt.Errorf("erasing %v: %w", id, err)
+			}
+		}
+		sql := fmt.Sprintf("ERASE FROM %s WHERE _id IN (%s)", table, strings.Join(lits, ", "))
+		if _, err := tx.Exec(ctx, tagSQL(ctx, sql)); err != nil {
+			return fmt.Errorf("erasing %d records from %s: %w", len(batch), table, err)
+		}
+	}
+
+	// Rows go as transit parameters, which keep their types as the
+	// snapshot read them
+	var encoder xtdb.Encoder
+	for start := 0; start < len(snap.Rows); start += restoreBatch {
+		batch := snap.Rows[start:min(start+restoreBatch, len(snap.Rows))]
+		values := make([][]byte, len(batch))
+		for i, row := range batch {
+			values[i] = []byte(encoder.EncodeMap(row))
+		}
+		oids := make([]uint32, len(batch))
+		for i := range oids {
+			oids[i] = TransitOID
+		}
+		sql := tagSQL(ctx, restoreInsertSQL(table, len(batch)))
+		_, err := traceExec(ctx, tx.Conn(), sql, nil, func(ctx context.Context) (pgconn.CommandTag, error) {
+			return tx.Conn().PgConn().ExecParams(ctx, sql, values, oids, nil, nil).Close()
+		})
+		if err != nil {
+			return fmt.Errorf("restoring %d records to %s: %w", len(batch), table, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("restoring %s: %w", table, err)
+	}
+	return nil
+}
+
+// restoreInsertSQL is INSERT INTO table RECORDS $1, ..., $n
+func restoreInsertSQL(table string, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return fmt.Sprintf("INSERT INTO %s RECORDS %s", table, strings.Join(params, ", "))
+}
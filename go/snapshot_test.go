@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSnapshotAndRestoreTable(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	_, err := conn.Exec(ctx,
+		fmt.Sprintf(`INSERT INTO %s RECORDS
+			{_id: 'alice', name: 'Alice', age: 30, address: {city: 'London'}},
+			{_id: 'bob', name: 'Bob', age: 25}`, table))
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	snap, err := SnapshotTable(ctx, conn, table)
+	if err != nil {
+		t.Fatalf("SnapshotTable failed: %v", err)
+	}
+	if len(snap.Rows) != 2 {
+		t.Fatalf("Expected 2 rows in snapshot, got %d", len(snap.Rows))
+	}
+
+	// Mutate: update one row, delete another, add a new one
+	for _, sql := range []string{
+		fmt.Sprintf("UPDATE %s SET age = 31 WHERE _id = 'alice'", table),
+		fmt.Sprintf("DELETE FROM %s WHERE _id = 'bob'", table),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'carol', name: 'Carol', age: 40}", table),
+	} {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatalf("Mutation failed (%s): %v", sql, err)
+		}
+	}
+
+	if err := RestoreTable(ctx, conn, table, snap); err != nil {
+		t.Fatalf("RestoreTable failed: %v", err)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id, name, age FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer rows.Close()
+
+	expected := []struct {
+		id, name string
+		age      int64
+	}{
+		{"alice", "Alice", 30},
+		{"bob", "Bob", 25},
+	}
+
+	count := 0
+	for rows.Next() {
+		var id, name string
+		var age int64
+		if err := rows.Scan(&id, &name, &age); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if count < len(expected) {
+			want := expected[count]
+			if id != want.id || name != want.name || age != want.age {
+				t.Errorf("Row %d: expected (%s, %s, %d), got (%s, %s, %d)",
+					count, want.id, want.name, want.age, id, name, age)
+			}
+		}
+		count++
+	}
+
+	if count != len(expected) {
+		t.Errorf("Expected %d rows after restore, got %d", len(expected), count)
+	}
+
+	// The erase should also have removed carol's history
+	var versions int64
+	err = conn.QueryRow(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s FOR ALL VALID_TIME WHERE _id = 'carol'", table)).Scan(&versions)
+	if err != nil {
+		t.Fatalf("History query failed: %v", err)
+	}
+	if versions != 0 {
+		t.Errorf("Expected carol to be erased, found %d versions", versions)
+	}
+}
+
+func TestRestoreInsertSQL(t *testing.T) {
+	if got := restoreInsertSQL("users", 3); got != "INSERT INTO users RECORDS $1, $2, $3" {
+		t.Errorf("Unexpected statement %s", got)
+	}
+}
+
+func TestBuildRecordsLiteral(t *testing.T) {
+	literal, err := BuildRecordsLiteral(
+		map[string]interface{}{"_id": "o'brien", "age": 30, "tags": []interface{}{"a", true}},
+		map[string]interface{}{"_id": 2, "meta": map[string]interface{}{"level": 5.5}},
+	)
+	if err != nil {
+		t.Fatalf("BuildRecordsLiteral failed: %v", err)
+	}
+
+	expected := `{_id: 'o''brien', age: 30, tags: ['a', TRUE]}, {_id: 2, meta: {level: 5.5}}`
+	if literal != expected {
+		t.Errorf("Expected %s, got %s", expected, literal)
+	}
+
+	id := uuid.MustParse("6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6")
+	if literal, err := BuildRecordsLiteral(map[string]interface{}{"_id": id}); err != nil || literal != `{_id: CAST('6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6' AS UUID)}` {
+		t.Errorf("Unexpected UUID literal %s, %v", literal, err)
+	}
+
+	if _, err := BuildRecordsLiteral(map[string]interface{}{"bad key": 1}); err == nil {
+		t.Error("Expected error for invalid field name")
+	}
+}
+
+func TestRecordsSQL(t *testing.T) {
+	sql, err := RecordsSQL("users",
+		map[string]interface{}{"_id": "alice", "note": "it's here"},
+		map[string]interface{}{"_id": "bob", "age": 25},
+	)
+	if err != nil {
+		t.Fatalf("RecordsSQL failed: %v", err)
+	}
+
+	expected := `INSERT INTO users RECORDS {_id: 'alice', note: 'it''s here'}, {_id: 'bob', age: 25}`
+	if sql != expected {
+		t.Errorf("Expected %s, got %s", expected, sql)
+	}
+
+	if _, err := RecordsSQL("users; DROP TABLE users", map[string]interface{}{"_id": 1}); err == nil {
+		t.Error("Expected error for invalid table name")
+	}
+	if _, err := RecordsSQL("users"); err == nil {
+		t.Error("Expected error for no records")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// XTDB's valid time already models "deleted_at": deleting an entity ends its
+// current version without touching history. These helpers give that the
+// soft-delete verbs ORM users expect.
+
+// SoftDelete ends id's validity from at onwards. Reads as of any time before
+// at still see the record.
+func SoftDelete(ctx context.Context, conn *pgx.Conn, table string, id any, at time.Time) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	idLit, err := formatLiteral(id)
+	if err != nil {
+		return fmt.Errorf("formatting id: %w", err)
+	}
+
+	sql := fmt.Sprintf("DELETE FROM %s FOR PORTION OF VALID_TIME FROM %s TO NULL WHERE _id = %s",
+		table, timestampLiteral(at), idLit)
+	if _, err := conn.Exec(ctx, tagSQL(ctx, sql)); err != nil {
+		return fmt.Errorf("soft-deleting %v from %s: %w", id, table, err)
+	}
+	return nil
+}
+
+// EndDateMany soft-deletes every id in ids from at onwards in a single
+// statement, e.g. to end-date a cohort; ids that don't exist are ignored
+func EndDateMany(ctx context.Context, conn *pgx.Conn, table string, ids []any, at time.Time) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	lits := make([]string, len(ids))
+	for i, id := range ids {
+		lit, err := formatLiteral(id)
+		if err != nil {
+			return fmt.Errorf("formatting id %v: %w", id, err)
+		}
+		lits[i] = lit
+	}
+
+	sql := fmt.Sprintf("DELETE FROM %s FOR PORTION OF VALID_TIME FROM %s TO NULL WHERE _id IN (%s)",
+		table, timestampLiteral(at), strings.Join(lits, ", "))
+	if _, err := conn.Exec(ctx, tagSQL(ctx, sql)); err != nil {
+		return fmt.Errorf("end-dating %d records in %s: %w", len(ids), table, err)
+	}
+	return nil
+}
+
+// IsDeletedAsOf reports whether id had existed before t but was no longer
+// valid at t. An id that never existed is not considered deleted.
+func IsDeletedAsOf(ctx context.Context, conn *pgx.Conn, table string, id any, t time.Time) (bool, error) {
+	if err := checkTable(table); err != nil {
+		return false, err
+	}
+	idLit, err := formatLiteral(id)
+	if err != nil {
+		return false, fmt.Errorf("formatting id: %w", err)
+	}
+	ts := timestampLiteral(t)
+
+	var current int64
+	err = conn.QueryRow(ctx, tagSQL(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR VALID_TIME AS OF %s WHERE _id = %s",
+		table, ts, idLit))).Scan(&current)
+	if err != nil {
+		return false, fmt.Errorf("checking %v as of %s: %w", id, ts, err)
+	}
+	if current > 0 {
+		return false, nil
+	}
+
+	var ended int64
+	err = conn.QueryRow(ctx, tagSQL(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR ALL VALID_TIME WHERE _id = %s AND _valid_to <= %s",
+		table, idLit, ts))).Scan(&ended)
+	if err != nil {
+		return false, fmt.Errorf("checking history of %v: %w", id, err)
+	}
+	return ended > 0, nil
+}
+
+// ListIncludingDeleted returns every version of every record that was valid
+// at some point between from and to, deleted or not, with its _valid_from and
+// _valid_to bounds.
+func ListIncludingDeleted(ctx context.Context, conn *pgx.Conn, table string, from, to time.Time) ([]map[string]interface{}, error) {
+	if err := checkTable(table); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf(
+		"SELECT *, _valid_from, _valid_to FROM %s FOR VALID_TIME BETWEEN %s AND %s ORDER BY _id, _valid_from",
+		table, timestampLiteral(from), timestampLiteral(to))))
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", table, err)
+	}
+	return collectMaps(rows)
+}
+
+// timestampLiteral renders t as a UTC TIMESTAMP literal
+func timestampLiteral(t time.Time) string {
+	lit, _ := formatLiteral(t.UTC())
+	return lit
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	deleted := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	restored := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s RECORDS {_id: 'sd1', name: 'Soft', _valid_from: TIMESTAMP '2024-01-01T00:00:00Z'}", table))
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	if err := SoftDelete(ctx, conn, table, "sd1", deleted); err != nil {
+		t.Fatalf("SoftDelete failed: %v", err)
+	}
+
+	// Gone from current reads
+	var current int64
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&current); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if current != 0 {
+		t.Errorf("Expected soft-deleted record to be hidden from current reads, got %d rows", current)
+	}
+
+	isDeleted, err := IsDeletedAsOf(ctx, conn, table, "sd1", deleted.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("IsDeletedAsOf failed: %v", err)
+	}
+	if !isDeleted {
+		t.Error("Expected record to be deleted after the delete time")
+	}
+
+	isDeleted, err = IsDeletedAsOf(ctx, conn, table, "sd1", created.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("IsDeletedAsOf failed: %v", err)
+	}
+	if isDeleted {
+		t.Error("Expected record to be live before the delete time")
+	}
+
+	// Still visible in historical reads
+	history, err := ListIncludingDeleted(ctx, conn, table, created, restored)
+	if err != nil {
+		t.Fatalf("ListIncludingDeleted failed: %v", err)
+	}
+	if len(history) != 1 || history[0]["name"] != "Soft" {
+		t.Fatalf("Expected the deleted version in history, got %v", history)
+	}
+	if validTo, ok := history[0]["_valid_to"].(time.Time); !ok || !validTo.Equal(deleted) {
+		t.Errorf("Expected _valid_to=%v, got %v", deleted, history[0]["_valid_to"])
+	}
+
+	// "Restore" by inserting again from a later valid time
+	_, err = conn.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s RECORDS {_id: 'sd1', name: 'Restored', _valid_from: TIMESTAMP '2024-03-01T00:00:00Z'}", table))
+	if err != nil {
+		t.Fatalf("Restore insert failed: %v", err)
+	}
+
+	isDeleted, err = IsDeletedAsOf(ctx, conn, table, "sd1", restored.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("IsDeletedAsOf failed: %v", err)
+	}
+	if isDeleted {
+		t.Error("Expected record to be live after restore")
+	}
+
+	isDeleted, err = IsDeletedAsOf(ctx, conn, table, "sd1", deleted.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("IsDeletedAsOf failed: %v", err)
+	}
+	if !isDeleted {
+		t.Error("Expected the gap between delete and restore to remain deleted")
+	}
+
+	var validFrom time.Time
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT _valid_from FROM %s WHERE _id = 'sd1'", table)).Scan(&validFrom)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !validFrom.Equal(restored) {
+		t.Errorf("Expected restored _valid_from=%v, got %v", restored, validFrom)
+	}
+}
+
+func TestEndDateMany(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s RECORDS
+		{_id: 'a', _valid_from: TIMESTAMP '2024-01-01T00:00:00Z'},
+		{_id: 'b', _valid_from: TIMESTAMP '2024-01-01T00:00:00Z'},
+		{_id: 'o''brien', _valid_from: TIMESTAMP '2024-01-01T00:00:00Z'},
+		{_id: 'keep', _valid_from: TIMESTAMP '2024-01-01T00:00:00Z'}`, table))
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := EndDateMany(ctx, conn, table, []any{"a", "b", "o'brien"}, at); err != nil {
+		t.Fatalf("EndDateMany failed: %v", err)
+	}
+
+	var current []string
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id FROM %s", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		current = append(current, id)
+	}
+	if fmt.Sprint(current) != "[keep]" {
+		t.Errorf("Expected only 'keep' in current reads, got %v", current)
+	}
+
+	var before, ended int64
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR VALID_TIME AS OF %s", table, timestampLiteral(at.Add(-time.Hour)))).Scan(&before)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s FOR ALL VALID_TIME WHERE _valid_to = %s", table, timestampLiteral(at))).Scan(&ended)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if before != 4 || ended != 3 {
+		t.Errorf("Expected all 4 in history before %v and 3 versions ending then, got %d and %d", at, before, ended)
+	}
+
+	if err := EndDateMany(ctx, conn, table, nil, at); err != nil {
+		t.Errorf("Expected no ids to be a no-op, got %v", err)
+	}
+}
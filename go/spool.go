@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SpooledRows is a query result parked on disk, so it can be read more than
+// once without holding it in memory or re-running the query. Rows are stored
+// as gzipped NDJSON, so values come back as JSON types (numbers as
+// json.Number, timestamps as strings).
+type SpooledRows struct {
+	// Count is the number of rows spooled
+	Count int64
+	path  string
+}
+
+// Spool streams the result of sql into a temporary file. Call Close to
+// remove it.
+func Spool(ctx context.Context, conn *pgx.Conn, sql string, args ...any) (*SpooledRows, error) {
+	rows, err := conn.Query(ctx, tagSQL(ctx, sql), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	w, err := newSpoolWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	fieldDescs := rows.FieldDescriptions()
+	row := make(map[string]interface{}, len(fieldDescs))
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			w.abort()
+			return nil, err
+		}
+		for i, fd := range fieldDescs {
+			row[fd.Name] = values[i]
+		}
+		if err := w.write(row); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		w.abort()
+		return nil, err
+	}
+
+	return w.finish()
+}
+
+// Each calls fn for every spooled row in query order, stopping at the first
+// error. fn must not keep row after returning.
+func (s *SpooledRows) Each(fn func(row map[string]interface{}) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("opening spool: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("reading spool: %w", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+	for {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading spool: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// Close removes the spool file
+func (s *SpooledRows) Close() error {
+	return os.Remove(s.path)
+}
+
+type spoolWriter struct {
+	file  *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	count int64
+}
+
+func newSpoolWriter() (*spoolWriter, error) {
+	f, err := os.CreateTemp("", "xtdb-spool-*.ndjson.gz")
+	if err != nil {
+		return nil, fmt.Errorf("creating spool: %w", err)
+	}
+	buf := bufio.NewWriter(f)
+	gz := gzip.NewWriter(buf)
+	return &spoolWriter{file: f, buf: buf, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+func (w *spoolWriter) write(row map[string]interface{}) error {
+	if err := w.enc.Encode(row); err != nil {
+		return fmt.Errorf("writing spool row %d: %w", w.count, err)
+	}
+	w.count++
+	return nil
+}
+
+func (w *spoolWriter) finish() (*SpooledRows, error) {
+	err := w.gz.Close()
+	if err == nil {
+		err = w.buf.Flush()
+	}
+	if err == nil {
+		err = w.file.Close()
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return nil, fmt.Errorf("writing spool: %w", err)
+	}
+	return &SpooledRows{Count: w.count, path: w.file.Name()}, nil
+}
+
+func (w *spoolWriter) abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSpoolWriterRoundTrip(t *testing.T) {
+	w, err := newSpoolWriter()
+	if err != nil {
+		t.Fatalf("newSpoolWriter failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.write(map[string]interface{}{"_id": i, "name": fmt.Sprintf("user-%d", i)}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	spool, err := w.finish()
+	if err != nil {
+		t.Fatalf("finish failed: %v", err)
+	}
+
+	var names []string
+	err = spool.Each(func(row map[string]interface{}) error {
+		names = append(names, row["name"].(string))
+		return nil
+	})
+	if err != nil || spool.Count != 3 || fmt.Sprint(names) != "[user-0 user-1 user-2]" {
+		t.Errorf("Expected 3 rows back, got %d %v, %v", spool.Count, names, err)
+	}
+
+	if err := spool.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(spool.path); !os.IsNotExist(err) {
+		t.Errorf("Expected spool file removed, stat gave %v", err)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	const n = 200000
+	pad := strings.Repeat("x", 200)
+	sql := fmt.Sprintf("SELECT x.n AS n, '%s' AS pad FROM generate_series(1, %d) AS x(n)", pad, n)
+
+	heapNow := func() uint64 {
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+	baseline := heapNow()
+
+	spool, err := Spool(context.Background(), conn, sql)
+	if err != nil {
+		t.Fatalf("Spool failed: %v", err)
+	}
+	defer spool.Close()
+
+	if spool.Count != n {
+		t.Fatalf("Expected %d rows spooled, got %d", n, spool.Count)
+	}
+
+	// Read twice, checking both passes see the same rows and that the heap
+	// stays far below what holding all 200k rows would take (~100MB)
+	var peak uint64
+	pass := func() []string {
+		var sample []string
+		var i int
+		err := spool.Each(func(row map[string]interface{}) error {
+			if i%20000 == 0 {
+				sample = append(sample, fmt.Sprint(row["n"]))
+				if h := heapNow(); h > peak {
+					peak = h
+				}
+			}
+			if row["pad"] != pad {
+				return fmt.Errorf("row %d: unexpected pad", i)
+			}
+			i++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Each failed: %v", err)
+		}
+		if i != n {
+			t.Fatalf("Expected %d rows, read %d", n, i)
+		}
+		return sample
+	}
+
+	first, second := pass(), pass()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Passes differ: %v vs %v", first, second)
+	}
+
+	if peak > baseline && peak-baseline > 16<<20 {
+		t.Errorf("Heap grew by %d bytes while iterating", peak-baseline)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const telemetryScope = "xtdb-example"
+
+// maxSpanStatement caps the db.statement attribute; RECORDS literals can be
+// arbitrarily long
+const maxSpanStatement = 1024
+
+// WithTelemetry reports every statement as an OpenTelemetry span, and rows
+// written and statement latency as metrics. Either provider may be nil to
+// leave that half out; without this option no tracer is installed at all.
+func WithTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) ConnectOption {
+	return func(c *connectConfig) {
+		c.telemetry = newTelemetryTracer(tp, mp)
+	}
+}
+
+// telemetryTracer is a pgx tracer (query, batch and COPY), so like the slow
+// query log it also sees helpers that are handed conn.Conn
+type telemetryTracer struct {
+	tracer      trace.Tracer
+	rowsWritten metric.Int64Counter
+	duration    metric.Float64Histogram
+	now         func() time.Time
+}
+
+func newTelemetryTracer(tp trace.TracerProvider, mp metric.MeterProvider) *telemetryTracer {
+	t := &telemetryTracer{now: time.Now}
+	if tp != nil {
+		t.tracer = tp.Tracer(telemetryScope)
+	}
+	if mp != nil {
+		meter := mp.Meter(telemetryScope)
+		// The instruments are only nil if the provider is broken, in which
+		// case there's nothing to record to anyway
+		t.rowsWritten, _ = meter.Int64Counter("xtdb.client.rows_written",
+			metric.WithDescription("Rows written by INSERT, UPDATE, DELETE, ERASE, PATCH and COPY"),
+			metric.WithUnit("{row}"))
+		t.duration, _ = meter.Float64Histogram("xtdb.client.operation.duration",
+			metric.WithDescription("Time from sending a statement to its result"),
+			metric.WithUnit("s"))
+	}
+	return t
+}
+
+type telemetryKey struct{}
+
+// telemetryOp is one statement, batch or COPY in flight
+type telemetryOp struct {
+	span      trace.Span
+	operation string
+	table     string
+	start     time.Time
+}
+
+func (t *telemetryTracer) start(ctx context.Context, operation, table, statement string) context.Context {
+	op := &telemetryOp{operation: operation, table: table, start: t.now()}
+	if t.tracer != nil {
+		name := operation
+		if table != "" {
+			name += " " + table
+		}
+		attrs := []attribute.KeyValue{
+			attribute.String("db.system", "xtdb"),
+			attribute.String("db.operation", operation),
+		}
+		if table != "" {
+			attrs = append(attrs, attribute.String("db.sql.table", table))
+		}
+		if statement != "" {
+			attrs = append(attrs, attribute.String("db.statement", truncateStatement(statement)))
+		}
+		ctx, op.span = t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	}
+	return context.WithValue(ctx, telemetryKey{}, op)
+}
+
+func (t *telemetryTracer) end(ctx context.Context, tag pgconn.CommandTag, err error) {
+	op, ok := ctx.Value(telemetryKey{}).(*telemetryOp)
+	if !ok {
+		return
+	}
+	rows := tag.RowsAffected()
+
+	if op.span != nil {
+		op.span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+		if err != nil {
+			op.span.RecordError(err)
+			op.span.SetStatus(codes.Error, err.Error())
+		}
+		op.span.End()
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("db.operation", op.operation),
+		attribute.String("db.sql.table", op.table),
+		attribute.Bool("error", err != nil),
+	)
+	if t.duration != nil {
+		t.duration.Record(ctx, t.now().Sub(op.start).Seconds(), attrs)
+	}
+	if t.rowsWritten != nil && err == nil && rows > 0 && writesRows(op.operation) {
+		t.rowsWritten.Add(ctx, rows, attrs)
+	}
+}
+
+func (t *telemetryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation, table := statementTarget(data.SQL)
+	return t.start(ctx, operation, table, data.SQL)
+}
+
+func (t *telemetryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, data.CommandTag, data.Err)
+}
+
+// A batch is one span; its statements are events on it and their rows are
+// counted as they complete
+
+func (t *telemetryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return t.start(ctx, "BATCH", "", "")
+}
+
+func (t *telemetryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	op, ok := ctx.Value(telemetryKey{}).(*telemetryOp)
+	if !ok {
+		return
+	}
+	operation, table := statementTarget(data.SQL)
+	if op.span != nil {
+		attrs := []attribute.KeyValue{
+			attribute.String("db.statement", truncateStatement(data.SQL)),
+			attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()),
+		}
+		if data.Err != nil {
+			attrs = append(attrs, attribute.String("error", data.Err.Error()))
+		}
+		op.span.AddEvent("statement", trace.WithAttributes(attrs...))
+	}
+	if t.rowsWritten != nil && data.Err == nil && writesRows(operation) {
+		t.rowsWritten.Add(ctx, data.CommandTag.RowsAffected(), metric.WithAttributes(
+			attribute.String("db.operation", operation),
+			attribute.String("db.sql.table", table),
+			attribute.Bool("error", false),
+		))
+	}
+}
+
+func (t *telemetryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	// The statements' rows were counted by TraceBatchQuery
+	t.end(ctx, pgconn.CommandTag{}, data.Err)
+}
+
+func (t *telemetryTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	table := strings.Join(data.TableName, ".")
+	return t.start(ctx, "COPY", table, "COPY "+data.TableName.Sanitize()+" FROM STDIN")
+}
+
+func (t *telemetryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, data.CommandTag, data.Err)
+}
+
+// statementTarget picks out a statement's leading keyword and the table it
+// reads or writes, e.g. ("INSERT", "users") for INSERT INTO users RECORDS ...
+func statementTarget(sql string) (operation, table string) {
+	words := sqlWords(sql)
+	for i, w := range words {
+		if w.depth != 0 {
+			continue
+		}
+		if operation == "" {
+			operation = w.text
+			if operation == "UPDATE" || operation == "PATCH" {
+				// UPDATE users SET ... names its table straight away
+				if i+1 < len(words) {
+					table = sql[words[i+1].start:words[i+1].end]
+				}
+				return operation, table
+			}
+			continue
+		}
+		if (w.text == "INTO" || w.text == "FROM") && i+1 < len(words) && isIdentifierWord(words[i+1]) {
+			return operation, sql[words[i+1].start:words[i+1].end]
+		}
+	}
+	return operation, ""
+}
+
+func writesRows(operation string) bool {
+	switch operation {
+	case "INSERT", "UPDATE", "DELETE", "ERASE", "PATCH", "COPY":
+		return true
+	}
+	return false
+}
+
+func truncateStatement(sql string) string {
+	if len(sql) <= maxSpanStatement {
+		return sql
+	}
+	return strings.ToValidUTF8(sql[:maxSpanStatement], "") + "..."
+}
+
+// multiTracer hands each pgx trace call to every tracer that implements it,
+// so the slow query log and telemetry can share a connection
+type multiTracer []pgx.QueryTracer
+
+func (m multiTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, t := range m {
+		ctx = t.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for _, t := range m {
+		t.TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+func (m multiTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	for _, t := range m {
+		if bt, ok := t.(pgx.BatchTracer); ok {
+			ctx = bt.TraceBatchStart(ctx, conn, data)
+		}
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	for _, t := range m {
+		if bt, ok := t.(pgx.BatchTracer); ok {
+			bt.TraceBatchQuery(ctx, conn, data)
+		}
+	}
+}
+
+func (m multiTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	for _, t := range m {
+		if bt, ok := t.(pgx.BatchTracer); ok {
+			bt.TraceBatchEnd(ctx, conn, data)
+		}
+	}
+}
+
+func (m multiTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	for _, t := range m {
+		if ct, ok := t.(pgx.CopyFromTracer); ok {
+			ctx = ct.TraceCopyFromStart(ctx, conn, data)
+		}
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	for _, t := range m {
+		if ct, ok := t.(pgx.CopyFromTracer); ok {
+			ct.TraceCopyFromEnd(ctx, conn, data)
+		}
+	}
+}
+
+// traceExec runs a statement sent straight to the PgConn (which pgx doesn't
+// trace) through the connection's tracer, if it has one
+func traceExec(ctx context.Context, conn *pgx.Conn, sql string, args []any, exec func(context.Context) (pgconn.CommandTag, error)) (pgconn.CommandTag, error) {
+	tracer, ok := conn.Config().Tracer.(pgx.QueryTracer)
+	if !ok {
+		return exec(ctx)
+	}
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: sql, Args: args})
+	tag, err := exec(ctx)
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{CommandTag: tag, Err: err})
+	return tag, err
+}
+
+// traceCopy is traceExec for a COPY ... FROM STDIN sent to the PgConn
+func traceCopy(ctx context.Context, conn *pgx.Conn, table string, copy func(context.Context) (pgconn.CommandTag, error)) (pgconn.CommandTag, error) {
+	tracer, ok := conn.Config().Tracer.(pgx.CopyFromTracer)
+	if !ok {
+		return copy(ctx)
+	}
+	ctx = tracer.TraceCopyFromStart(ctx, conn, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{table}})
+	tag, err := copy(ctx)
+	tracer.TraceCopyFromEnd(ctx, conn, pgx.TraceCopyFromEndData{CommandTag: tag, Err: err})
+	return tag, err
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestTelemetry returns providers backed by in-memory exporters
+func newTestTelemetry(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter, *sdkmetric.MeterProvider, *sdkmetric.ManualReader) {
+	spans := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		mp.Shutdown(context.Background())
+	})
+	return tp, spans, mp, reader
+}
+
+func spanAttr(span tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// collectMetric returns the named metric's data from reader, or nil
+func collectMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+func TestTelemetryTracer(t *testing.T) {
+	tp, spans, mp, reader := newTestTelemetry(t)
+	tracer := newTelemetryTracer(tp, mp)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracer.now = func() time.Time { now = now.Add(250 * time.Millisecond); return now }
+	ctx := context.Background()
+
+	// A query, an insert and a failed statement
+	qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT _id, name FROM users WHERE _id = $1"})
+	tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	ictx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "/* app=billing */ INSERT INTO users RECORDS $1"})
+	tracer.TraceQueryEnd(ictx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("INSERT 0 1")})
+
+	ectx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "DELETE FROM users WHERE _id = 1"})
+	tracer.TraceQueryEnd(ectx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	got := spans.GetSpans()
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(got))
+	}
+	wantNames := []string{"SELECT users", "INSERT users", "DELETE users"}
+	for i, span := range got {
+		if span.Name != wantNames[i] {
+			t.Errorf("span %d: expected name %q, got %q", i, wantNames[i], span.Name)
+		}
+		if v, _ := spanAttr(span, "db.sql.table"); v.AsString() != "users" {
+			t.Errorf("span %d: expected db.sql.table users, got %q", i, v.AsString())
+		}
+	}
+	if v, _ := spanAttr(got[1], "db.rows_affected"); v.AsInt64() != 1 {
+		t.Errorf("Expected the insert span to report 1 row, got %d", v.AsInt64())
+	}
+	if v, _ := spanAttr(got[1], "db.statement"); v.AsString() != "/* app=billing */ INSERT INTO users RECORDS $1" {
+		t.Errorf("Unexpected db.statement %q", v.AsString())
+	}
+	if got[0].Status.Code == codes.Error || got[1].Status.Code == codes.Error {
+		t.Error("Expected successful statements not to have an error status")
+	}
+	if got[2].Status.Code != codes.Error || got[2].Status.Description != "boom" {
+		t.Errorf("Expected the failed statement's span to have error status, got %+v", got[2].Status)
+	}
+
+	rows, ok := collectMetric(t, reader, "xtdb.client.rows_written").(metricdata.Sum[int64])
+	if !ok || len(rows.DataPoints) != 1 || rows.DataPoints[0].Value != 1 {
+		t.Errorf("Expected one rows_written point of 1 (the insert), got %+v", rows.DataPoints)
+	}
+	latency, ok := collectMetric(t, reader, "xtdb.client.operation.duration").(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatal("Expected an operation.duration histogram")
+	}
+	var count uint64
+	for _, dp := range latency.DataPoints {
+		count += dp.Count
+		if dp.Sum != float64(dp.Count)*0.25 {
+			t.Errorf("Expected each statement to take 250ms, got sum %v over %d", dp.Sum, dp.Count)
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 latency measurements, got %d", count)
+	}
+}
+
+func TestTelemetryTracerTruncatesStatement(t *testing.T) {
+	tp, spans, _, _ := newTestTelemetry(t)
+	tracer := newTelemetryTracer(tp, nil)
+
+	long := "INSERT INTO users RECORDS " + fmt.Sprintf("%02000d", 0)
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: long})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	v, _ := spanAttr(spans.GetSpans()[0], "db.statement")
+	if len(v.AsString()) != maxSpanStatement+len("...") {
+		t.Errorf("Expected db.statement truncated to %d bytes, got %d", maxSpanStatement, len(v.AsString()))
+	}
+}
+
+func TestStatementTarget(t *testing.T) {
+	cases := []struct{ sql, operation, table string }{
+		{"SELECT * FROM users", "SELECT", "users"},
+		{"SELECT (SELECT 1 FROM other) FROM users", "SELECT", "users"},
+		{"INSERT INTO orders RECORDS $1", "INSERT", "orders"},
+		{"UPDATE users SET name = 'x'", "UPDATE", "users"},
+		{"ERASE FROM users WHERE _id = 1", "ERASE", "users"},
+		{"SELECT 1", "SELECT", ""},
+	}
+	for _, c := range cases {
+		op, table := statementTarget(c.sql)
+		if op != c.operation || table != c.table {
+			t.Errorf("statementTarget(%q) = (%q, %q), want (%q, %q)", c.sql, op, table, c.operation, c.table)
+		}
+	}
+}
+
+func TestConnectTelemetry(t *testing.T) {
+	tp, spans, mp, reader := newTestTelemetry(t)
+	ctx := context.Background()
+
+	conn, err := Connect(ctx, fmt.Sprintf("postgres://%s:5432/xtdb", getXtdbHost()), WithTelemetry(tp, mp))
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	table := getCleanTable()
+	if err := InsertRecords(ctx, conn.Conn, table, []map[string]interface{}{{"_id": 1, "name": "Alice"}}); err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id FROM %s", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	rows.Close()
+
+	var names []string
+	for _, span := range spans.GetSpans() {
+		names = append(names, span.Name)
+	}
+	for _, want := range []string{"INSERT " + table, "SELECT " + table} {
+		found := false
+		for _, name := range names {
+			found = found || name == want
+		}
+		if !found {
+			t.Errorf("Expected a %q span, got %v", want, names)
+		}
+	}
+
+	written, ok := collectMetric(t, reader, "xtdb.client.rows_written").(metricdata.Sum[int64])
+	if !ok || len(written.DataPoints) == 0 {
+		t.Error("Expected a rows_written point for the insert")
+	}
+}
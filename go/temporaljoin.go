@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Each table in an XTDB query defaults to "now" in valid time unless it says
+// otherwise, so a join where only one side carries FOR VALID_TIME AS OF
+// mixes past and present rows. JoinAsOf puts the same clause on every table.
+
+// JoinAsOf rewrites query so that every table it reads, in the main query,
+// joins and subqueries alike, is read FOR VALID_TIME AS OF at. The clause
+// goes straight after the table name, before any alias. References to CTEs
+// and table functions are left alone, and a table that already has a FOR
+// clause is an error rather than being silently overridden.
+//
+// The rewrite works on tokens, not a parse tree: it finds table names
+// after FROM, JOIN and the commas of a FROM list.
+func JoinAsOf(query string, at time.Time) (string, error) {
+	words := sqlWords(query)
+	clause := " FOR VALID_TIME AS OF " + timestampLiteral(at)
+
+	ctes := cteNames(words)
+
+	// queryScope[d] says whether the parentheses at depth d hold a query, so
+	// FROM inside EXTRACT(... FROM ...) and the like isn't taken for a table
+	queryScope := map[int]bool{0: true}
+	fromList := map[int]bool{}
+	var inserts []int
+
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if w.afterOpen && w.text != ")" {
+			queryScope[w.depth] = w.text == "SELECT" || w.text == "WITH" || w.text == "VALUES"
+			fromList[w.depth] = false
+		}
+		if !queryScope[w.depth] {
+			continue
+		}
+
+		startsRef := false
+		switch w.text {
+		case "FROM":
+			fromList[w.depth] = true
+			startsRef = true
+		case "JOIN":
+			startsRef = true
+		case ",":
+			startsRef = fromList[w.depth]
+		case "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "OFFSET", "FETCH",
+			"UNION", "EXCEPT", "INTERSECT", "WINDOW", "ON", "USING", "SELECT":
+			fromList[w.depth] = false
+		}
+		if !startsRef || i+1 >= len(words) {
+			continue
+		}
+
+		// The table reference: skip LATERAL, then a name (possibly qualified
+		// or quoted); subqueries and table functions are handled elsewhere or
+		// not at all
+		j := i + 1
+		if words[j].text == "LATERAL" {
+			continue
+		}
+		if words[j].text == "(" || (!isIdentifierWord(words[j]) && words[j].text != "?") {
+			continue
+		}
+		name := words[j]
+		for j+1 < len(words) && name.end < len(query) && query[name.end] == '.' {
+			j++
+			name = words[j]
+		}
+		if j+1 < len(words) && words[j+1].text == "(" && words[j+1].start == name.end {
+			continue // table function, e.g. generate_series(1, 10)
+		}
+		if j == i+1 && ctes[strings.ToLower(query[name.start:name.end])] {
+			continue
+		}
+		if j+1 < len(words) && words[j+1].text == "FOR" {
+			return "", fmt.Errorf("table %s already has a FOR clause", query[words[i+1].start:name.end])
+		}
+
+		inserts = append(inserts, name.end)
+		i = j
+	}
+
+	if len(inserts) == 0 {
+		return "", fmt.Errorf("no tables found in query")
+	}
+
+	sort.Ints(inserts)
+	var b strings.Builder
+	prev := 0
+	for _, pos := range inserts {
+		b.WriteString(query[prev:pos])
+		b.WriteString(clause)
+		prev = pos
+	}
+	b.WriteString(query[prev:])
+	return b.String(), nil
+}
+
+// QueryJoinAsOf runs query, rewritten by JoinAsOf, and returns its rows
+func QueryJoinAsOf(ctx context.Context, conn *pgx.Conn, at time.Time, query string, args ...any) ([]map[string]interface{}, error) {
+	rewritten, err := JoinAsOf(query, at)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, tagSQL(ctx, rewritten), args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying as of %s: %w", at.Format(time.RFC3339), err)
+	}
+	return collectMaps(rows)
+}
+
+// cteNames collects the lower-cased names a WITH clause defines
+func cteNames(words []sqlWord) map[string]bool {
+	names := map[string]bool{}
+	// A CTE is "name AS (" or "name (cols) AS (" directly after WITH
+	// [RECURSIVE] or a comma at the WITH's depth
+	for i, w := range words {
+		if w.text != "WITH" {
+			continue
+		}
+		depth := w.depth
+		j := i + 1
+		if j < len(words) && words[j].text == "RECURSIVE" {
+			j++
+		}
+		for j < len(words) && words[j].depth == depth && isIdentifierWord(words[j]) {
+			names[strings.ToLower(words[j].text)] = true
+			// Skip to the comma that starts the next CTE, or stop at the
+			// main query
+			k := j + 1
+			for k < len(words) && !(words[k].depth == depth && (words[k].text == "," || isQueryStart(words[k].text))) {
+				k++
+			}
+			if k >= len(words) || words[k].text != "," {
+				break
+			}
+			j = k + 1
+		}
+	}
+	return names
+}
+
+func isQueryStart(word string) bool {
+	return word == "SELECT" || word == "VALUES" || word == "FROM"
+}
+
+// isIdentifierWord reports whether w is a bare identifier rather than
+// punctuation or a keyword that can follow FROM/JOIN
+func isIdentifierWord(w sqlWord) bool {
+	if w.text == "(" || w.text == ")" || w.text == "," || w.text == "?" {
+		return false
+	}
+	switch w.text {
+	case "SELECT", "LATERAL", "UNNEST", "VALUES":
+		return false
+	}
+	return w.text[0] < '0' || w.text[0] > '9'
+}
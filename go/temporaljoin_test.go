@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJoinAsOf(t *testing.T) {
+	at := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	asOf := " FOR VALID_TIME AS OF TIMESTAMP '2024-01-15T00:00:00Z'"
+
+	cases := []struct{ in, out string }{
+		{
+			"SELECT u.name, o.total FROM users u JOIN orders AS o ON o.user_id = u._id",
+			"SELECT u.name, o.total FROM users" + asOf + " u JOIN orders" + asOf + " AS o ON o.user_id = u._id",
+		},
+		{
+			"SELECT * FROM users, orders o WHERE o.user_id = users._id ORDER BY users.name",
+			"SELECT * FROM users" + asOf + ", orders" + asOf + " o WHERE o.user_id = users._id ORDER BY users.name",
+		},
+		{
+			"SELECT * FROM users u LEFT JOIN (SELECT user_id, COUNT(*) AS n FROM orders GROUP BY user_id) c ON c.user_id = u._id",
+			"SELECT * FROM users" + asOf + " u LEFT JOIN (SELECT user_id, COUNT(*) AS n FROM orders" + asOf + " GROUP BY user_id) c ON c.user_id = u._id",
+		},
+		{
+			"SELECT name FROM users WHERE _id IN (SELECT user_id FROM orders WHERE total > 10)",
+			"SELECT name FROM users" + asOf + " WHERE _id IN (SELECT user_id FROM orders" + asOf + " WHERE total > 10)",
+		},
+		{
+			// Functions using FROM, CTE references, strings and comments are left alone
+			"WITH big AS (SELECT * FROM orders WHERE total > 10) " +
+				"SELECT EXTRACT(YEAR FROM b.placed_at), now(), 'FROM fake' FROM big b JOIN users u ON u._id = b.user_id -- FROM x",
+			"WITH big AS (SELECT * FROM orders" + asOf + " WHERE total > 10) " +
+				"SELECT EXTRACT(YEAR FROM b.placed_at), now(), 'FROM fake' FROM big b JOIN users" + asOf + " u ON u._id = b.user_id -- FROM x",
+		},
+		{
+			"SELECT * FROM xt.txs t, generate_series(1, 3) AS g(n)",
+			"SELECT * FROM xt.txs" + asOf + " t, generate_series(1, 3) AS g(n)",
+		},
+	}
+	for _, c := range cases {
+		got, err := JoinAsOf(c.in, at)
+		if err != nil {
+			t.Errorf("JoinAsOf(%q) failed: %v", c.in, err)
+			continue
+		}
+		if got != c.out {
+			t.Errorf("JoinAsOf(%q):\n got %s\nwant %s", c.in, got, c.out)
+		}
+	}
+
+	if _, err := JoinAsOf("SELECT * FROM users FOR VALID_TIME AS OF NOW u JOIN orders o ON true", at); err == nil ||
+		!strings.Contains(err.Error(), "users") {
+		t.Errorf("Expected an existing FOR clause to be rejected, got %v", err)
+	}
+	if _, err := JoinAsOf("SELECT 1", at); err == nil {
+		t.Error("Expected an error for a query without tables")
+	}
+}
+
+func TestQueryJoinAsOf(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	users, orders := getCleanTable(), getCleanTable()
+
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, stmt := range []string{
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'alice', tier: 'basic', _valid_from: %s}", users, timestampLiteral(jan)),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'o1', user_id: 'alice', status: 'pending', _valid_from: %s}", orders, timestampLiteral(jan)),
+		// Both change in March
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'alice', tier: 'gold', _valid_from: %s}", users, timestampLiteral(mar)),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'o1', user_id: 'alice', status: 'shipped', _valid_from: %s}", orders, timestampLiteral(mar)),
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT u.tier, o.status FROM %s u JOIN %s o ON o.user_id = u._id", users, orders)
+
+	rows, err := QueryJoinAsOf(ctx, conn, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), query)
+	if err != nil {
+		t.Fatalf("QueryJoinAsOf failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["tier"] != "basic" || rows[0]["status"] != "pending" {
+		t.Errorf("Expected February's values from both tables, got %v", rows)
+	}
+
+	rows, err = QueryJoinAsOf(ctx, conn, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), query)
+	if err != nil {
+		t.Fatalf("QueryJoinAsOf failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["tier"] != "gold" || rows[0]["status"] != "shipped" {
+		t.Errorf("Expected April's values from both tables, got %v", rows)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUnscopedTable is returned when SQL run through a TenantScope names a
+// table without the scope's prefix
+var ErrUnscopedTable = errors.New("table not scoped to tenant")
+
+// Tenant ids can't contain "_" so that acme_orders can only belong to acme
+var tenantPattern = regexp.MustCompile(`^[a-z][a-z0-9]{0,31}$`)
+
+// TenantScope prefixes table names with a tenant id (orders -> acme_orders),
+// for deployments that isolate tenants by table prefix. Helpers called
+// through the scope only ever see prefixed tables; raw SQL is refused if it
+// mentions a known table unprefixed or under another tenant's prefix.
+type TenantScope struct {
+	Tenant string
+	conn   *pgx.Conn
+	known  map[string]bool // upper-cased unprefixed table names
+}
+
+// NewTenantScope scopes conn to tenant. knownTables lists the unprefixed
+// table names raw SQL is checked for.
+func NewTenantScope(conn *pgx.Conn, tenant string, knownTables ...string) (*TenantScope, error) {
+	if !tenantPattern.MatchString(tenant) {
+		return nil, fmt.Errorf("invalid tenant id %q: must match %s", tenant, tenantPattern)
+	}
+	known := make(map[string]bool, len(knownTables))
+	for _, table := range knownTables {
+		known[strings.ToUpper(table)] = true
+	}
+	return &TenantScope{Tenant: tenant, conn: conn, known: known}, nil
+}
+
+// Table returns the tenant's name for table
+func (s *TenantScope) Table(table string) (string, error) {
+	if !identifierPattern.MatchString(table) {
+		return "", fmt.Errorf("invalid table name %q", table)
+	}
+	return s.Tenant + "_" + table, nil
+}
+
+// InsertRecords inserts into the tenant's copy of table
+func (s *TenantScope) InsertRecords(ctx context.Context, table string, records []map[string]interface{}, opts ...InsertOption) error {
+	scoped, err := s.Table(table)
+	if err != nil {
+		return err
+	}
+	return InsertRecords(ctx, s.conn, scoped, records, opts...)
+}
+
+// InsertSQL renders an INSERT ... RECORDS statement into the tenant's copy
+// of table
+func (s *TenantScope) InsertSQL(table string, records ...map[string]interface{}) (string, error) {
+	scoped, err := s.Table(table)
+	if err != nil {
+		return "", err
+	}
+	return RecordsSQL(scoped, records...)
+}
+
+// QueryRecords returns the current rows of the tenant's copy of table
+func (s *TenantScope) QueryRecords(ctx context.Context, table string) ([]map[string]interface{}, error) {
+	scoped, err := s.Table(table)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT * FROM %s", scoped)))
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", scoped, err)
+	}
+	return collectMaps(rows)
+}
+
+// Query runs raw SQL after checking it only names the tenant's tables
+func (s *TenantScope) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := s.checkSQL(ctx, sql); err != nil {
+		return nil, err
+	}
+	return s.conn.Query(ctx, tagSQL(ctx, sql), args...)
+}
+
+// Exec runs raw SQL after checking it only names the tenant's tables
+func (s *TenantScope) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := s.checkSQL(ctx, sql); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return s.conn.Exec(ctx, tagSQL(ctx, sql), args...)
+}
+
+type allowUnscopedKey struct{}
+
+// AllowUnscopedSQL returns a context under which a TenantScope runs raw SQL
+// without checking its table names, e.g. for cross-tenant admin reports
+func AllowUnscopedSQL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowUnscopedKey{}, true)
+}
+
+// checkSQL looks for known tables named without this tenant's prefix. Like
+// the read-only check it works on keywords, not a parse tree, and treats any
+// <word>_<known table> as another tenant's.
+func (s *TenantScope) checkSQL(ctx context.Context, sql string) error {
+	if allowed, _ := ctx.Value(allowUnscopedKey{}).(bool); allowed {
+		return nil
+	}
+
+	prefix := strings.ToUpper(s.Tenant) + "_"
+	for _, w := range sqlWords(sql) {
+		if s.known[w.text] {
+			return fmt.Errorf("%w: %s (use %s_%s)", ErrUnscopedTable, strings.ToLower(w.text), s.Tenant, strings.ToLower(w.text))
+		}
+		if strings.HasPrefix(w.text, prefix) {
+			continue
+		}
+		// another tenant's copy of a known table
+		if i := strings.IndexByte(w.text, '_'); i > 0 && s.known[w.text[i+1:]] {
+			return fmt.Errorf("%w: %s belongs to another tenant", ErrUnscopedTable, strings.ToLower(w.text))
+		}
+	}
+	return nil
+}
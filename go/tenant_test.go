@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTenantScopeCheckSQL(t *testing.T) {
+	if _, err := NewTenantScope(nil, "Acme_Corp"); err == nil {
+		t.Error("Expected tenant id with underscore and capitals to be rejected")
+	}
+
+	acme, err := NewTenantScope(nil, "acme", "orders", "customers")
+	if err != nil {
+		t.Fatalf("NewTenantScope failed: %v", err)
+	}
+	ctx := context.Background()
+
+	allowed := []string{
+		"SELECT * FROM acme_orders",
+		"SELECT o.* FROM acme_orders o JOIN acme_customers c ON o.customer = c._id",
+		"SELECT * FROM acme_orders WHERE status = 'orders shipped'",
+		"SELECT * FROM audit_log",
+	}
+	for _, sql := range allowed {
+		if err := acme.checkSQL(ctx, sql); err != nil {
+			t.Errorf("%q: unexpected error %v", sql, err)
+		}
+	}
+
+	refused := []string{
+		"SELECT * FROM orders",
+		"select * from acme_orders join Customers on true",
+		"SELECT * FROM globex_orders",
+	}
+	for _, sql := range refused {
+		if err := acme.checkSQL(ctx, sql); !errors.Is(err, ErrUnscopedTable) {
+			t.Errorf("%q: expected ErrUnscopedTable, got %v", sql, err)
+		}
+	}
+
+	if err := acme.checkSQL(AllowUnscopedSQL(ctx), "SELECT * FROM globex_orders"); err != nil {
+		t.Errorf("AllowUnscopedSQL should skip the check, got %v", err)
+	}
+
+	sql, err := acme.InsertSQL("orders", map[string]interface{}{"_id": 1, "total": 10})
+	if err != nil || sql != "INSERT INTO acme_orders RECORDS {_id: 1, total: 10}" {
+		t.Errorf("Unexpected InsertSQL result %q, %v", sql, err)
+	}
+}
+
+func TestTenantScopeIsolation(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	acme, _ := NewTenantScope(conn, "acme", table)
+	globex, _ := NewTenantScope(conn, "globex", table)
+
+	if err := acme.InsertRecords(ctx, table, []map[string]interface{}{{"_id": 1, "customer": "acme-1"}}); err != nil {
+		t.Fatalf("acme insert failed: %v", err)
+	}
+	sql, err := globex.InsertSQL(table, map[string]interface{}{"_id": 1, "customer": "globex-1"})
+	if err != nil {
+		t.Fatalf("InsertSQL failed: %v", err)
+	}
+	if _, err := globex.Exec(ctx, sql); err != nil {
+		t.Fatalf("globex insert failed: %v", err)
+	}
+
+	for scope, expected := range map[*TenantScope]string{acme: "acme-1", globex: "globex-1"} {
+		rows, err := scope.QueryRecords(ctx, table)
+		if err != nil {
+			t.Fatalf("%s: QueryRecords failed: %v", scope.Tenant, err)
+		}
+		if len(rows) != 1 || rows[0]["customer"] != expected {
+			t.Errorf("%s: expected only %s, got %v", scope.Tenant, expected, rows)
+		}
+	}
+
+	globexTable, _ := globex.Table(table)
+	if _, err := acme.Query(ctx, "SELECT * FROM "+globexTable); !errors.Is(err, ErrUnscopedTable) {
+		t.Errorf("Expected acme to be refused globex's table, got %v", err)
+	}
+	if _, err := acme.Query(ctx, "SELECT * FROM "+table); !errors.Is(err, ErrUnscopedTable) {
+		t.Errorf("Expected unprefixed table to be refused, got %v", err)
+	}
+}
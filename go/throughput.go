@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// DecodeThroughput decodes each transit-JSON line in data with
+// xtdb.DecodeLine, as xtdb.StreamLines does before handing records to its
+// callback, and returns the rate in records per second, as a
+// number to track across changes to the decoder. It returns 0 if any line
+// fails to decode, since a rate over broken input means nothing.
+func DecodeThroughput(data [][]byte) (recordsPerSec float64) {
+	start := time.Now()
+	n, err := decodeTransitRecords(data)
+	elapsed := time.Since(start)
+	if err != nil || n == 0 {
+		return 0
+	}
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// decodeTransitRecords decodes each line of data with xtdb.DecodeLine and
+// returns how many it decoded
+func decodeTransitRecords(data [][]byte) (int, error) {
+	for i, line := range data {
+		if _, err := xtdb.DecodeLine(line); err != nil {
+			return i, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return len(data), nil
+}
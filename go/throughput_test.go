@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xtdb/driver-examples/go/fixtures"
+)
+
+// scaledTransitUsers repeats the sample-users transit lines until there are
+// n of them
+func scaledTransitUsers(t testing.TB, n int) [][]byte {
+	content, err := os.ReadFile(filepath.Join(fixtures.DataDir, "sample-users-transit.json"))
+	if err != nil {
+		t.Fatalf("Reading transit users: %v", err)
+	}
+	var lines [][]byte
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	scaled := make([][]byte, n)
+	for i := range scaled {
+		scaled[i] = lines[i%len(lines)]
+	}
+	return scaled
+}
+
+func TestDecodeThroughput(t *testing.T) {
+	data := scaledTransitUsers(t, 3000)
+	if n, err := decodeTransitRecords(data); err != nil || n != len(data) {
+		t.Fatalf("Expected all %d records decoded, got %d, %v", len(data), n, err)
+	}
+	if rate := DecodeThroughput(data); rate <= 0 {
+		t.Errorf("Expected a positive rate, got %f", rate)
+	}
+
+	broken := append(scaledTransitUsers(t, 3), []byte(`["^ ","~:_id"`))
+	if rate := DecodeThroughput(broken); rate != 0 {
+		t.Errorf("Expected no rate for broken input, got %f", rate)
+	}
+}
+
+func BenchmarkDecodeThroughput(b *testing.B) {
+	data := scaledTransitUsers(b, 10000)
+	var total float64
+	for i := 0; i < b.N; i++ {
+		total += DecodeThroughput(data)
+	}
+	b.ReportMetric(total/float64(b.N), "records/s")
+}
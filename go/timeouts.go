@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithStatementTimeout aborts any Exec, Query, QueryRow, SendBatch or
+// CopyFrom on the connection that runs longer than d, by cancelling its
+// context. The server is also asked to set statement_timeout where it
+// supports that, which covers transactions too. StatementTimeout overrides
+// it for a single call.
+func WithStatementTimeout(d time.Duration) ConnectOption {
+	return func(c *connectConfig) { c.statementTimeout = d }
+}
+
+// WithSlowQueryLog logs every statement that takes longer than threshold to
+// logger at warn level, with its SQL, duration and row count. Parameters are
+// never logged, only how many there were. SlowQueryThreshold overrides the
+// threshold for a single call.
+func WithSlowQueryLog(threshold time.Duration, logger *slog.Logger) ConnectOption {
+	return func(c *connectConfig) {
+		c.slowQueries = &slowQueryTracer{threshold: threshold, logger: logger, now: time.Now}
+	}
+}
+
+type statementTimeoutKey struct{}
+
+// StatementTimeout returns a context under which calls on a Conn time out
+// after d instead of the connection's timeout; zero disables it
+func StatementTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, statementTimeoutKey{}, d)
+}
+
+type slowQueryThresholdKey struct{}
+
+// SlowQueryThreshold returns a context under which statements are logged as
+// slow after d instead of the connection's threshold
+func SlowQueryThreshold(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, slowQueryThresholdKey{}, d)
+}
+
+// withTimeout applies the call's or connection's statement timeout to ctx
+func (c *Conn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := c.cfg.statementTimeout
+	if override, ok := ctx.Value(statementTimeoutKey{}).(time.Duration); ok {
+		d = override
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// setSessionStatementTimeout is best-effort: the context deadline still
+// applies if the server ignores it
+func (c *Conn) setSessionStatementTimeout(ctx context.Context) {
+	_, _ = c.Conn.Exec(ctx, fmt.Sprintf("SET statement_timeout = %d", c.cfg.statementTimeout.Milliseconds()))
+}
+
+// timeoutRows releases the statement timeout once the rows are done with
+type timeoutRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r timeoutRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+	return false
+}
+
+func (r timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+type timeoutRow struct {
+	pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r timeoutRow) Scan(dest ...any) error {
+	defer r.cancel()
+	return r.Row.Scan(dest...)
+}
+
+type timeoutBatchResults struct {
+	pgx.BatchResults
+	cancel context.CancelFunc
+}
+
+func (b timeoutBatchResults) Close() error {
+	defer b.cancel()
+	return b.BatchResults.Close()
+}
+
+// slowQueryTracer is a pgx.QueryTracer, so it sees statements run through
+// the embedded *pgx.Conn by the helpers as well as the Conn's own methods
+type slowQueryTracer struct {
+	threshold time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type slowQueryStartKey struct{}
+
+type slowQueryStart struct {
+	sql       string
+	params    int
+	threshold time.Duration
+	at        time.Time
+}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	threshold := t.threshold
+	if override, ok := ctx.Value(slowQueryThresholdKey{}).(time.Duration); ok {
+		threshold = override
+	}
+	return context.WithValue(ctx, slowQueryStartKey{}, slowQueryStart{
+		sql: data.SQL, params: len(data.Args), threshold: threshold, at: t.now(),
+	})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(slowQueryStartKey{}).(slowQueryStart)
+	if !ok {
+		return
+	}
+	elapsed := t.now().Sub(start.at)
+	if elapsed < start.threshold {
+		return
+	}
+
+	attrs := []any{
+		slog.String("sql", start.sql),
+		slog.Duration("duration", elapsed),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+		slog.Int("params", start.params),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+	t.logger.WarnContext(ctx, "slow query", attrs...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// slowLogEntries decodes the JSON log lines written to buf
+func slowLogEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Bad log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestSlowQueryTracer(t *testing.T) {
+	var buf bytes.Buffer
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracer := &slowQueryTracer{
+		threshold: 100 * time.Millisecond,
+		logger:    slog.New(slog.NewJSONHandler(&buf, nil)),
+		now:       func() time.Time { return clock },
+	}
+
+	run := func(ctx context.Context, sql string, took time.Duration) {
+		ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{"secret-token"}})
+		clock = clock.Add(took)
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 42")})
+	}
+
+	ctx := context.Background()
+	run(ctx, "SELECT fast", 10*time.Millisecond)
+	run(ctx, "SELECT slow WHERE token = $1", 250*time.Millisecond)
+	run(SlowQueryThreshold(ctx, time.Second), "SELECT tolerated", 250*time.Millisecond)
+
+	entries := slowLogEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("Expected exactly one slow query logged, got %v", entries)
+	}
+	e := entries[0]
+	if e["level"] != "WARN" || e["sql"] != "SELECT slow WHERE token = $1" || e["rows"] != float64(42) ||
+		e["duration"] != float64(250*time.Millisecond) || e["params"] != float64(1) {
+		t.Errorf("Unexpected log entry: %v", e)
+	}
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Error("Parameters should be redacted from the log")
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	conn, err := Connect(ctx, fmt.Sprintf("postgres://%s:5432/xtdb", getXtdbHost()),
+		WithStatementTimeout(100*time.Millisecond),
+		WithSlowQueryLog(50*time.Millisecond, slog.New(slog.NewJSONHandler(&buf, nil))))
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	const slow = "SELECT COUNT(*) FROM generate_series(1, 5000) AS a(x), generate_series(1, 5000) AS b(y)"
+
+	var n int64
+	err = conn.QueryRow(ctx, slow).Scan(&n)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the slow query to time out, got n=%d, err=%v", n, err)
+	}
+
+	// The connection is still usable, and a per-call override lifts the limit
+	if err := conn.QueryRow(ctx, "SELECT 1").Scan(&n); err != nil {
+		t.Fatalf("Query after timeout failed: %v", err)
+	}
+	if err := conn.QueryRow(StatementTimeout(ctx, time.Minute), slow).Scan(&n); err != nil {
+		t.Fatalf("Query with a longer timeout failed: %v", err)
+	}
+
+	var logged int
+	for _, e := range slowLogEntries(t, &buf) {
+		if e["sql"] == slow && e["error"] == nil {
+			logged++
+		}
+	}
+	if logged != 1 {
+		t.Errorf("Expected the completed slow query to be logged once, got %s", buf.String())
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	conn, err := Connect(ctx, fmt.Sprintf("postgres://%s:5432/xtdb", getXtdbHost()),
+		WithSlowQueryLog(50*time.Millisecond, slog.New(slog.NewJSONHandler(&buf, nil))))
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	const slow = "SELECT COUNT(*) FROM generate_series(1, 5000) AS a(x), generate_series(1, 5000) AS b(y)"
+
+	var n int64
+	if err := conn.QueryRow(ctx, slow).Scan(&n); err != nil {
+		t.Fatalf("Slow query failed: %v", err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("Fast query failed: %v", err)
+	}
+
+	entries := slowLogEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["sql"] != slow {
+		t.Fatalf("Expected only the slow query to be logged, got %s", buf.String())
+	}
+	if d, _ := entries[0]["duration"].(float64); time.Duration(d) < 50*time.Millisecond {
+		t.Errorf("Logged duration %v is under the threshold", time.Duration(d))
+	}
+}
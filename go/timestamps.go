@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the string forms NormalizeTimestamp accepts, tried in
+// order; those without an offset are read as UTC
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.DateOnly,
+}
+
+// epochMillisThreshold separates epoch seconds from epoch milliseconds:
+// 1e11 seconds is the year 5138, 1e11 milliseconds is March 1973. Millisecond
+// values before then are read as seconds.
+const epochMillisThreshold = 1e11
+
+// NormalizeTimestamp reads a timestamp from upstream data in any of the forms
+// it tends to arrive in and returns it in UTC: a time.Time; an RFC3339,
+// "YYYY-MM-DD HH:MM:SS" or date-only string; or an epoch number (integers,
+// whole floats, json.Number and digit strings), taken as milliseconds or
+// seconds by its magnitude (see epochMillisThreshold).
+func NormalizeTimestamp(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC(), nil
+	case *time.Time:
+		if t != nil {
+			return t.UTC(), nil
+		}
+	case int:
+		return fromEpoch(int64(t)), nil
+	case int32:
+		return fromEpoch(int64(t)), nil
+	case int64:
+		return fromEpoch(t), nil
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < math.MaxInt64 {
+			return fromEpoch(int64(t)), nil
+		}
+		return time.Time{}, fmt.Errorf("timestamp %v is not a whole number of seconds or milliseconds", t)
+	case json.Number:
+		return NormalizeTimestamp(string(t))
+	case string:
+		s := strings.TrimSpace(t)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return fromEpoch(n), nil
+		}
+		for _, layout := range timestampLayouts {
+			if parsed, err := time.Parse(layout, s); err == nil {
+				return parsed.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognized timestamp %q", t)
+	}
+	return time.Time{}, fmt.Errorf("unsupported timestamp type %T", v)
+}
+
+// fromEpoch reads n as epoch milliseconds or seconds by its magnitude
+func fromEpoch(n int64) time.Time {
+	if n >= epochMillisThreshold || n <= -epochMillisThreshold {
+		return time.UnixMilli(n).UTC()
+	}
+	return time.Unix(n, 0).UTC()
+}
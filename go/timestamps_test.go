@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTimestamp(t *testing.T) {
+	want := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	paris := time.FixedZone("CET", 3600)
+	cases := []struct {
+		in   interface{}
+		want time.Time // zero for rejected
+	}{
+		{want, want},
+		{want.In(paris), want},
+		{&want, want},
+		{"2024-01-15T10:30:00Z", want},
+		{"2024-01-15T11:30:00+01:00", want},
+		{"2024-01-15T10:30:00.000000001Z", want.Add(time.Nanosecond)},
+		{"2024-01-15T10:30:00", want},
+		{"2024-01-15 10:30:00", want},
+		{"2024-01-15 11:30:00+01:00", want},
+		{"2024-01-15", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{" 2024-01-15T10:30:00Z ", want},
+		{int64(1705314600000), want},         // millis
+		{int64(1705314600), want},            // seconds
+		{1705314600, want},                   // int
+		{float64(1705314600000), want},       // a JSON number
+		{json.Number("1705314600000"), want}, // a precise JSON number
+		{"1705314600", want},                 // digits
+		{int64(0), time.Unix(0, 0).UTC()},    // the epoch
+		{int64(-86400), time.Unix(-86400, 0).UTC()},
+		// Either side of the threshold: the last value read as seconds and
+		// the first read as milliseconds
+		{int64(99999999999), time.Unix(99999999999, 0).UTC()},
+		{int64(100000000000), time.UnixMilli(100000000000).UTC()},
+		{int64(-100000000000), time.UnixMilli(-100000000000).UTC()},
+		// Millis before March 1973 can't be told from seconds
+		{int64(86400000), time.Unix(86400000, 0).UTC()},
+		{1705314600.5, time.Time{}},
+		{"15/01/2024", time.Time{}},
+		{"", time.Time{}},
+		{true, time.Time{}},
+		{nil, time.Time{}},
+		{(*time.Time)(nil), time.Time{}},
+	}
+	for _, c := range cases {
+		got, err := NormalizeTimestamp(c.in)
+		if c.want.IsZero() {
+			if err == nil {
+				t.Errorf("NormalizeTimestamp(%#v) = %v, want an error", c.in, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(c.want) || got.Location() != time.UTC {
+			t.Errorf("NormalizeTimestamp(%#v) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestCheckValidFromNormalizes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	c := insertConfig{validTime: &ValidTimeGuard{Now: func() time.Time { return now }}}
+
+	for _, raw := range []interface{}{int64(1705314600000), "2024-01-15 10:30:00", "2024-01-15T11:30:00+01:00"} {
+		got, err := c.checkValidFrom(map[string]interface{}{"_id": 1, "_valid_from": raw})
+		if err != nil || got["_valid_from"] != "2024-01-15T10:30:00Z" {
+			t.Errorf("Expected %#v written as 2024-01-15T10:30:00Z, got %v, %v", raw, got["_valid_from"], err)
+		}
+	}
+
+	// Values already in shape are left as they are; unreadable ones for XTDB to judge
+	for _, raw := range []interface{}{"2024-01-15T10:30:00Z", now, "next tuesday"} {
+		record := map[string]interface{}{"_id": 1, "_valid_from": raw}
+		if got, err := c.checkValidFrom(record); err != nil || got["_valid_from"] != raw {
+			t.Errorf("Expected %#v unchanged, got %v, %v", raw, got["_valid_from"], err)
+		}
+	}
+
+	// Epoch values still go through the guard
+	if _, err := c.checkValidFrom(map[string]interface{}{"_valid_from": int64(-3e12)}); !errors.Is(err, ErrValidTimeOutOfRange) {
+		t.Errorf("Expected an 1874 _valid_from rejected, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSFiles are the libpq-style certificate paths for mutual TLS
+type TLSFiles struct {
+	CertFile     string // sslcert: client certificate (PEM)
+	KeyFile      string // sslkey: client private key (PEM)
+	RootCertFile string // sslrootcert: CA that signed the server certificate (PEM)
+	// ServerName overrides the name checked against the server certificate;
+	// by default it's the host being connected to
+	ServerName string
+}
+
+// WithTLS connects over TLS, presenting a client certificate when CertFile
+// and KeyFile are set and verifying the server against RootCertFile (or the
+// system roots)
+func WithTLS(files TLSFiles) ConnectOption {
+	return func(c *connectConfig) { c.tls = &files }
+}
+
+// buildTLSConfig loads files into a tls.Config for host
+func buildTLSConfig(files TLSFiles, host string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if files.ServerName != "" {
+		cfg.ServerName = files.ServerName
+	}
+
+	if files.CertFile != "" || files.KeyFile != "" {
+		if files.CertFile == "" || files.KeyFile == "" {
+			return nil, fmt.Errorf("sslcert and sslkey must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if files.RootCertFile != "" {
+		pem, err := os.ReadFile(files.RootCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading sslrootcert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", files.RootCertFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
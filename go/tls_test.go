@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key, returning their paths
+func writeTestCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Writing cert failed: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Writing key failed: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir, "client")
+	caPath, _ := writeTestCert(t, dir, "ca")
+
+	cfg, err := buildTLSConfig(TLSFiles{CertFile: certPath, KeyFile: keyPath, RootCertFile: caPath}, "xtdb.internal")
+	if err != nil {
+		t.Fatalf("buildTLSConfig failed: %v", err)
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("Expected the client certificate to be loaded, got %d", len(cfg.Certificates))
+	}
+	if cfg.RootCAs == nil {
+		t.Error("Expected sslrootcert to populate RootCAs")
+	}
+	if cfg.ServerName != "xtdb.internal" {
+		t.Errorf("Expected ServerName to default to the host, got %q", cfg.ServerName)
+	}
+
+	if _, err := buildTLSConfig(TLSFiles{CertFile: certPath}, "xtdb"); err == nil {
+		t.Error("Expected sslcert without sslkey to be rejected")
+	}
+	if _, err := buildTLSConfig(TLSFiles{RootCertFile: filepath.Join(dir, "missing.crt")}, "xtdb"); err == nil {
+		t.Error("Expected a missing sslrootcert to be reported")
+	}
+}
+
+// TestConnectMutualTLS needs a TLS-enabled XTDB; set XTDB_TLS_CERT,
+// XTDB_TLS_KEY and XTDB_TLS_ROOT_CERT to run it
+func TestConnectMutualTLS(t *testing.T) {
+	files := TLSFiles{
+		CertFile:     os.Getenv("XTDB_TLS_CERT"),
+		KeyFile:      os.Getenv("XTDB_TLS_KEY"),
+		RootCertFile: os.Getenv("XTDB_TLS_ROOT_CERT"),
+	}
+	if files.CertFile == "" || files.KeyFile == "" {
+		t.Skip("XTDB_TLS_CERT/XTDB_TLS_KEY not set")
+	}
+
+	ctx := context.Background()
+	conn, err := Connect(ctx, fmt.Sprintf("postgres://%s:5432/xtdb?sslmode=verify-full", getXtdbHost()), WithTLS(files))
+	if err != nil {
+		t.Fatalf("Unable to connect with client certificate: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var n int
+	if err := conn.QueryRow(ctx, "SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Errorf("Query over mutual TLS failed: %d, %v", n, err)
+	}
+}
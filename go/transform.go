@@ -0,0 +1,29 @@
+package main
+
+import "maps"
+
+// Transform rewrites a record between reading it from the source and
+// inserting it, e.g. to enrich it or fix a field up. Returning false drops
+// the record. It's given a shallow copy of each record, so it may set or
+// delete fields and return it without touching the caller's map.
+type Transform func(record map[string]interface{}) (map[string]interface{}, bool)
+
+// WithTransform passes every record through fn before InsertRecords or
+// CopyRecords validates and writes it
+func WithTransform(fn Transform) InsertOption {
+	return func(c *insertConfig) { c.transform = fn }
+}
+
+// applyTransform returns the records fn keeps, as fn rewrote them
+func applyTransform(fn Transform, records []map[string]interface{}) []map[string]interface{} {
+	if fn == nil {
+		return records
+	}
+	kept := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		if record, ok := fn(maps.Clone(record)); ok {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
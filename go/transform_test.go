@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// keepActive drops inactive users and lower-cases the rest's emails, tagging
+// them with their source
+func keepActive(record map[string]interface{}) (map[string]interface{}, bool) {
+	if active, _ := record["active"].(bool); !active {
+		return nil, false
+	}
+	record["email"] = strings.ToLower(record["email"].(string))
+	record["source"] = "crm"
+	return record, true
+}
+
+func transformUsers() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"_id": "alice", "email": "Alice@Example.COM", "active": true},
+		{"_id": "bob", "email": "bob@example.com", "active": false},
+		{"_id": "carol", "email": "CAROL@example.com", "active": true},
+		{"_id": "dave", "email": "dave@example.com"},
+	}
+}
+
+func TestApplyTransform(t *testing.T) {
+	records := transformUsers()
+	if got := applyTransform(nil, records); !reflect.DeepEqual(got, records) {
+		t.Errorf("Expected no transform to keep every record, got %v", got)
+	}
+
+	records = transformUsers()
+	got := applyTransform(keepActive, records)
+	want := []map[string]interface{}{
+		{"_id": "alice", "email": "alice@example.com", "active": true, "source": "crm"},
+		{"_id": "carol", "email": "carol@example.com", "active": true, "source": "crm"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if !reflect.DeepEqual(records, transformUsers()) {
+		t.Errorf("Expected the input records to be left alone, got %v", records)
+	}
+}
+
+func TestInsertRecordsWithTransform(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
+
+	table := getCleanTable()
+	var result InsertResult
+	if err := InsertRecords(ctx, conn, table, transformUsers(), WithTransform(keepActive), WithResult(&result)); err != nil {
+		t.Fatalf("InsertRecords failed: %v", err)
+	}
+	if len(result.Tags) != 2 {
+		t.Errorf("Expected only the 2 kept records sent, got %v", result.Tags)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT _id, email, source FROM %s ORDER BY _id", table))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got, err := collectMaps(rows)
+	if err != nil {
+		t.Fatalf("Reading rows failed: %v", err)
+	}
+	want := []map[string]interface{}{
+		{"_id": "alice", "email": "alice@example.com", "source": "crm"},
+		{"_id": "carol", "email": "carol@example.com", "source": "crm"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
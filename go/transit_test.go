@@ -1,126 +1,89 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
-)
 
-// DecodeTransitValue attempts to decode a transit-encoded value (copied from json_test.go)
-func DecodeTransitValueTransit(val interface{}) interface{} {
-	// Handle if val is already a decoded array or object (not a JSON string)
-	if arr, ok := val.([]interface{}); ok {
-		return decodeTransitArray(arr)
-	}
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
-	// Handle if val is a JSON string that needs parsing
-	str, ok := val.(string)
-	if !ok {
-		return val
-	}
+	"github.com/xtdb/driver-examples/go/fixtures"
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
 
-	// Try to parse as JSON
-	var data interface{}
-	if err := json.Unmarshal([]byte(str), &data); err != nil {
-		return val
+func TestStreamTransitRecords(t *testing.T) {
+	encoder := &xtdb.Encoder{}
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(encoder.EncodeMap(map[string]interface{}{"_id": fmt.Sprintf("user-%d", i), "n": i}))
 	}
+	buf.WriteString("]")
 
-	// Check if it's a transit structure
-	arr, ok := data.([]interface{})
-	if !ok {
-		return data
+	count := 0
+	err := streamTransitRecords(&buf, func(record map[string]interface{}) error {
+		if record["_id"] != fmt.Sprintf("user-%d", count) || record["n"] != float64(count) {
+			return fmt.Errorf("unexpected record %v", record)
+		}
+		count++
+		return nil
+	})
+	if err != nil || count != 10000 {
+		t.Errorf("Expected 10000 callbacks, got %d, %v", count, err)
 	}
 
-	return decodeTransitArray(arr)
+	err = streamTransitRecords(strings.NewReader(`[["^ ","~:_id","a"],["a","b"]]`), func(map[string]interface{}) error { return nil })
+	if err == nil || !strings.HasPrefix(err.Error(), "element 1") {
+		t.Errorf("Expected the non-map element 1 reported, got %v", err)
+	}
 }
 
-func decodeTransitArray(arr []interface{}) interface{} {
-	if len(arr) == 0 {
-		return arr
-	}
+func TestNestManyStream(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+	ctx := context.Background()
 
-	// Transit tagged value: [tag, value]
-	if len(arr) == 2 {
-		if tag, ok := arr[0].(string); ok && len(tag) > 0 && tag[0:2] == "~#" {
-			// For nested tagged values, recursively decode
-			return DecodeTransitValueTransit(arr[1])
+	table := getCleanTable()
+	for i := 1; i <= 5; i++ {
+		_, err := conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS {_id: %d, name: 'user-%d', tags: ['a', 'b']}", table, i, i))
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
 		}
 	}
 
-	// Transit map: ["^ ", key1, val1, key2, val2, ...]
-	if len(arr) > 0 {
-		if firstElem, ok := arr[0].(string); ok && firstElem == "^ " {
-			result := make(map[string]interface{})
-			for i := 1; i < len(arr); i += 2 {
-				if i+1 >= len(arr) {
-					break
-				}
-				key := fmt.Sprintf("%v", arr[i])
-				// Recursively decode the value (handles nested maps)
-				value := DecodeTransitValueTransit(arr[i+1])
-
-				result[key] = value
-			}
-			return result
-		}
+	var ids []string
+	err := NestManyStream(ctx, conn, table, "_id > $1", func(record map[string]interface{}) error {
+		AssertShape(t, record, Shape{"_id": KindNumber, "name": KindString, "tags": ArrayOf(KindString)})
+		ids = append(ids, fmt.Sprint(record["_id"]))
+		return nil
+	}, 2)
+	if err != nil {
+		t.Fatalf("NestManyStream failed: %v", err)
 	}
-
-	// Regular array - recursively decode elements
-	result := make([]interface{}, len(arr))
-	for i, elem := range arr {
-		result[i] = DecodeTransitValueTransit(elem)
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[3 4 5]" {
+		t.Errorf("Expected one callback per matching record, got %v", ids)
 	}
-	return result
-}
 
-// MinimalTransitEncoder provides basic transit-JSON encoding
-type MinimalTransitEncoder struct{}
-
-// EncodeValue encodes a Go value to transit-JSON format
-func (e *MinimalTransitEncoder) EncodeValue(value interface{}) string {
-	switch v := value.(type) {
-	case map[string]interface{}:
-		return e.EncodeMap(v)
-	case []interface{}:
-		encoded := make([]string, len(v))
-		for i, item := range v {
-			encoded[i] = e.EncodeValue(item)
-		}
-		return "[" + strings.Join(encoded, ",") + "]"
-	case string:
-		data, _ := json.Marshal(v)
-		return string(data)
-	case bool:
-		if v {
-			return "true"
-		}
-		return "false"
-	case float64:
-		return fmt.Sprintf("%v", v)
-	case int:
-		return fmt.Sprintf("%d", v)
-	case time.Time:
-		return fmt.Sprintf(`"~t%s"`, v.Format(time.RFC3339))
-	case nil:
-		return "null"
-	default:
-		data, _ := json.Marshal(fmt.Sprintf("%v", v))
-		return string(data)
+	count := 0
+	if err := NestManyStream(ctx, conn, table, "", func(map[string]interface{}) error { count++; return nil }); err != nil || count != 5 {
+		t.Errorf("Expected 5 callbacks over the whole table, got %d, %v", count, err)
 	}
-}
 
-// EncodeMap encodes a map to transit-JSON map format
-func (e *MinimalTransitEncoder) EncodeMap(data map[string]interface{}) string {
-	pairs := []string{}
-	for key, value := range data {
-		pairs = append(pairs, fmt.Sprintf(`"~:%s"`, key))
-		pairs = append(pairs, e.EncodeValue(value))
+	err = NestManyStream(ctx, conn, table, "", func(map[string]interface{}) error { return fmt.Errorf("stop") })
+	if err == nil || !strings.Contains(err.Error(), "element 0") {
+		t.Errorf("Expected onRecord's error naming the record, got %v", err)
 	}
-	return `["^ ",` + strings.Join(pairs, ",") + `]`
 }
 
 func TestSimpleRecordsInsert(t *testing.T) {
@@ -174,7 +137,7 @@ func TestTransitJSONFormat(t *testing.T) {
 
 	table := getCleanTable()
 
-	encoder := &MinimalTransitEncoder{}
+	encoder := &xtdb.Encoder{}
 
 	// Create transit-JSON
 	data := map[string]interface{}{
@@ -224,46 +187,264 @@ func TestTransitJSONFormat(t *testing.T) {
 	}
 }
 
-func TestTransitJSONParsing(t *testing.T) {
+func TestTransitBigIntegerRoundTrip(t *testing.T) {
 	conn := getConnTransit(t)
 	defer conn.Close(context.Background())
 
 	table := getCleanTable()
+	const exact = int64(9007199254740993) // 2^53 + 1, not representable as float64
 
-	// Load sample-users-transit.json
-	content, err := os.ReadFile("../test-data/sample-users-transit.json")
+	encoder := &xtdb.Encoder{}
+	record := encoder.EncodeMap(map[string]interface{}{"_id": exact, "counter": exact})
+	_, err := conn.PgConn().ExecParams(context.Background(),
+		fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+		[][]byte{[]byte(record)}, []uint32{TransitOID}, []int16{0}, []int16{0}).Close()
 	if err != nil {
-		t.Fatalf("Failed to read transit file: %v", err)
+		t.Fatalf("Insert failed: %v", err)
 	}
 
-	lines := strings.Split(string(content), "\n")
-	sql := fmt.Sprintf("INSERT INTO %s RECORDS $1", table)
-
-	// Insert using transit OID (16384) with single parameter per record
-	// Use low-level ExecParams to specify OID explicitly
-	pgconn := conn.PgConn()
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	var raw interface{}
+	err = conn.QueryRow(context.Background(),
+		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = %d) AS r", table, exact)).Scan(&raw)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	decoded, ok := xtdb.DecodeValue(raw).(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map after decoding, got %T: %v", raw, raw)
+	}
+	for _, key := range []string{"_id", "counter"} {
+		value, found := decoded[key]
+		if !found {
+			value = decoded["~:"+key]
+		}
+		if value != exact {
+			t.Errorf("Expected %s=%d to round-trip exactly, got %T %v", key, exact, value, value)
 		}
+	}
+}
+
+func TestTransitUUIDRoundTrip(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	id := uuid.New()
+
+	encoder := &xtdb.Encoder{}
+	record := encoder.EncodeMap(map[string]interface{}{"_id": id, "name": "UUID keyed"})
+	_, err := conn.PgConn().ExecParams(context.Background(),
+		fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+		[][]byte{[]byte(record)}, []uint32{TransitOID}, []int16{0}, []int16{0}).Close()
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	var raw interface{}
+	err = conn.QueryRow(context.Background(),
+		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = CAST('%s' AS UUID)) AS r", table, id)).Scan(&raw)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	decoded, ok := xtdb.DecodeValue(raw).(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map after decoding, got %T: %v", raw, raw)
+	}
+	got, found := decoded["_id"]
+	if !found {
+		got = decoded["~:_id"]
+	}
+	if got != id {
+		t.Errorf("Expected _id to decode to uuid.UUID %v, got %T %v", id, got, got)
+	}
+}
+
+func TestTransitKeywordRoundTrip(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	encoder := &xtdb.Encoder{}
+	record := encoder.EncodeMap(map[string]interface{}{
+		"_id":    "keyword-holder",
+		"status": xtdb.Keyword("active"),
+		"label":  "active",
+	})
+	_, err := conn.PgConn().ExecParams(context.Background(),
+		fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+		[][]byte{[]byte(record)}, []uint32{TransitOID}, []int16{0}, []int16{0}).Close()
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	var raw interface{}
+	err = conn.QueryRow(context.Background(),
+		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = 'keyword-holder') AS r", table)).Scan(&raw)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	decoded, ok := xtdb.StripKeywordKeys(xtdb.DecodeValue(raw)).(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map after decoding, got %T: %v", raw, raw)
+	}
+	if got, ok := decoded["status"].(xtdb.Keyword); !ok || got != "active" {
+		t.Errorf("Expected status to decode to xtdb.Keyword(active), got %T %v", decoded["status"], decoded["status"])
+	}
+	if got, ok := decoded["label"].(string); !ok || got != "active" {
+		t.Errorf("Expected label to stay a string, got %T %v", decoded["label"], decoded["label"])
+	}
+}
+
+func TestTransitSetRoundTrip(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
 
-		// Encode parameter as bytes
-		buf := []byte(line)
+	table := getCleanTable()
+	encoder := &xtdb.Encoder{}
+	record := encoder.EncodeMap(map[string]interface{}{
+		"_id":   "set-holder",
+		"roles": xtdb.NewSet("admin", "beta", "ops"),
+	})
+	_, err := conn.PgConn().ExecParams(context.Background(),
+		fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+		[][]byte{[]byte(record)}, []uint32{TransitOID}, []int16{0}, []int16{0}).Close()
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
 
-		// Use ExecParams with explicit OID 16384 (transit-JSON)
-		result := pgconn.ExecParams(context.Background(), sql,
-			[][]byte{buf},            // parameter values
-			[]uint32{TransitOID},     // parameter OIDs - OID 16384
-			[]int16{0},               // parameter formats (0 = text)
-			[]int16{0})               // result formats (0 = text)
+	var raw interface{}
+	err = conn.QueryRow(context.Background(),
+		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = 'set-holder') AS r", table)).Scan(&raw)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	decoded, ok := xtdb.StripKeywordKeys(xtdb.DecodeValue(raw)).(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map after decoding, got %T: %v", raw, raw)
+	}
+	roles, ok := decoded["roles"].(xtdb.Set)
+	if !ok {
+		t.Fatalf("Expected roles to decode to a xtdb.Set, got %T %v", decoded["roles"], decoded["roles"])
+	}
+	if len(roles) != 3 || !roles.Contains("admin") || !roles.Contains("beta") || !roles.Contains("ops") {
+		t.Errorf("Unexpected members %v", roles)
+	}
+}
+
+func TestUnmarshalTransitNestOne(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+	users, err := fixtures.LoadSampleUsersTransit(context.Background(), conn, table)
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	want := users[0]
 
-		_, err = result.Close()
+	var raw string
+	err = conn.QueryRow(context.Background(),
+		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = '%s') AS r", table, want.ID)).Scan(&raw)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// The stored joined date comes back as a time, not the file's string
+	var got struct {
+		ID       string   `json:"_id"`
+		Name     string   `json:"name"`
+		Age      int64    `json:"age"`
+		Tags     []string `json:"tags"`
+		Metadata struct {
+			Department string    `json:"department"`
+			Level      int64     `json:"level"`
+			Joined     time.Time `json:"joined"`
+		} `json:"metadata"`
+	}
+	if err := xtdb.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatalf("xtdb.Unmarshal failed: %v", err)
+	}
+	if got.ID != want.ID || got.Name != want.Name || got.Age != want.Age || !reflect.DeepEqual(got.Tags, want.Tags) ||
+		got.Metadata.Department != want.Metadata.Department || got.Metadata.Level != want.Metadata.Level {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if joined := got.Metadata.Joined.Format("2006-01-02"); joined != want.Metadata.Joined {
+		t.Errorf("Expected joined %s, got %v", want.Metadata.Joined, got.Metadata.Joined)
+	}
+}
+
+// AssertJSONTransitParity inserts record into one table through the JSON OID
+// and into another through the transit OID, then checks both read back, via
+// NEST_ONE, to the same decoded document. conn needs the transit fallback
+// output format (getConnTransit).
+func AssertJSONTransitParity(t *testing.T, conn *pgx.Conn, record map[string]interface{}) {
+	t.Helper()
+	ctx := context.Background()
+
+	jsonData, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("Encoding record as JSON failed: %v", err)
+	}
+	encoder := &xtdb.Encoder{}
+	transitData := []byte(encoder.EncodeMap(record))
+
+	readBack := func(data []byte, oid uint32) map[string]interface{} {
+		table := getCleanTable()
+		_, err := conn.PgConn().ExecParams(ctx, fmt.Sprintf("INSERT INTO %s RECORDS $1", table),
+			[][]byte{data}, []uint32{oid}, []int16{0}, []int16{0}).Close()
 		if err != nil {
-			t.Fatalf("Insert failed: %v", err)
+			t.Fatalf("Insert with OID %d failed: %v\n%s", oid, err, data)
 		}
+		var raw interface{}
+		if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT NEST_ONE(FROM %s) AS r", table)).Scan(&raw); err != nil {
+			t.Fatalf("Reading back the OID %d insert failed: %v", oid, err)
+		}
+		doc, ok := xtdb.StripKeywordKeys(xtdb.DecodeValue(raw)).(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected the OID %d insert to read back as a map, got %T: %v", oid, raw, raw)
+		}
+		return doc
 	}
 
+	viaJSON := readBack(jsonData, JSONOID)
+	viaTransit := readBack(transitData, TransitOID)
+	if !reflect.DeepEqual(viaJSON, viaTransit) {
+		t.Errorf("JSON and transit inserts read back differently:\n  JSON:    %#v\n  transit: %#v", viaJSON, viaTransit)
+	}
+}
+
+func TestJSONTransitParity(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	AssertJSONTransitParity(t, conn, map[string]interface{}{
+		"_id":    "parity1",
+		"name":   "Parity User",
+		"age":    42,
+		"score":  97.5,
+		"active": true,
+		"address": map[string]interface{}{
+			"city": "London",
+			"geo":  map[string]interface{}{"lat": 51.5, "lon": -0.12},
+		},
+		"tags": []interface{}{"admin", "developer", 3, false},
+	})
+}
+
+func TestTransitJSONParsing(t *testing.T) {
+	conn := getConnTransit(t)
+	defer conn.Close(context.Background())
+
+	table := getCleanTable()
+
+	// Load the canonical sample users, one transit-JSON line per insert
+	// with explicit OID 16384 (transit-JSON)
+	users, err := fixtures.LoadSampleUsersTransit(context.Background(), conn, table)
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	want := users[0]
+
 	// Query back and verify - get ALL columns including nested data
 	rows, err := conn.Query(context.Background(),
 		fmt.Sprintf("SELECT * FROM %s ORDER BY _id", table))
@@ -296,11 +477,11 @@ func TestTransitJSONParsing(t *testing.T) {
 
 		// Verify first record (alice)
 		if count == 1 {
-			if rowMap["_id"] != "alice" {
-				t.Errorf("Expected _id='alice', got %v", rowMap["_id"])
+			if rowMap["_id"] != want.ID {
+				t.Errorf("Expected _id=%q, got %v", want.ID, rowMap["_id"])
 			}
-			if rowMap["name"] != "Alice Smith" {
-				t.Errorf("Expected name='Alice Smith', got %v", rowMap["name"])
+			if rowMap["name"] != want.Name {
+				t.Errorf("Expected name=%q, got %v", want.Name, rowMap["name"])
 			}
 			// Age might be int32, int64, or float64 depending on how pgx decodes it
 			ageVal := rowMap["age"]
@@ -315,30 +496,33 @@ func TestTransitJSONParsing(t *testing.T) {
 			default:
 				t.Errorf("Expected age to be numeric, got %T: %v", ageVal, ageVal)
 			}
-			if age != 30 {
-				t.Errorf("Expected age=30, got %d", age)
+			if age != want.Age {
+				t.Errorf("Expected age=%d, got %d", want.Age, age)
 			}
-			if active, ok := rowMap["active"].(bool); !ok || !active {
-				t.Errorf("Expected active=true, got %v", rowMap["active"])
+			if active, ok := rowMap["active"].(bool); !ok || active != want.Active {
+				t.Errorf("Expected active=%v, got %v", want.Active, rowMap["active"])
 			}
-			if rowMap["email"] != "alice@example.com" {
-				t.Errorf("Expected email='alice@example.com', got %v", rowMap["email"])
+			if rowMap["email"] != want.Email {
+				t.Errorf("Expected email=%q, got %v", want.Email, rowMap["email"])
 			}
 
 			// Verify salary (float field) - May be transit-encoded, decode if needed
-			salaryDecoded := DecodeTransitValueTransit(rowMap["salary"])
-			if salary, ok := salaryDecoded.(float64); !ok || salary != 125000.5 {
-				t.Errorf("Expected salary=125000.5 (float64), got %v (type %T)", salaryDecoded, salaryDecoded)
+			salaryDecoded := xtdb.DecodeValue(rowMap["salary"])
+			if salary, ok := salaryDecoded.(float64); !ok || salary != want.Salary {
+				t.Errorf("Expected salary=%v (float64), got %v (type %T)", want.Salary, salaryDecoded, salaryDecoded)
 			}
 
 			// Verify nested array (tags) - With transit output format, properly typed
 			if tags, ok := rowMap["tags"].([]interface{}); ok {
 				t.Logf("✅ Tags properly typed as []interface{}: %v", tags)
-				if len(tags) != 2 {
-					t.Errorf("Expected 2 tags, got %d", len(tags))
+				if len(tags) != len(want.Tags) {
+					t.Errorf("Expected %d tags, got %d", len(want.Tags), len(tags))
 				} else {
-					if tags[0] != "admin" || tags[1] != "developer" {
-						t.Errorf("Expected tags ['admin', 'developer'], got %v", tags)
+					for i, tag := range want.Tags {
+						if tags[i] != tag {
+							t.Errorf("Expected tags %v, got %v", want.Tags, tags)
+							break
+						}
 					}
 				}
 			} else {
@@ -346,13 +530,13 @@ func TestTransitJSONParsing(t *testing.T) {
 			}
 
 			// Verify nested object (metadata) - May be transit-encoded, decode if needed
-			metadataDecoded := DecodeTransitValueTransit(rowMap["metadata"])
+			metadataDecoded := xtdb.DecodeValue(rowMap["metadata"])
 			if metadata, ok := metadataDecoded.(map[string]interface{}); ok {
 				t.Logf("✅ Metadata properly typed as map[string]interface{}: %v", metadata)
 
 				// Validate metadata fields
-				if dept, ok := metadata["department"].(string); !ok || dept != "Engineering" {
-					t.Errorf("Expected department='Engineering', got %v (type %T)", metadata["department"], metadata["department"])
+				if dept, ok := metadata["department"].(string); !ok || dept != want.Metadata.Department {
+					t.Errorf("Expected department=%q, got %v (type %T)", want.Metadata.Department, metadata["department"], metadata["department"])
 				}
 
 				// Level might be float64 or int from JSON parsing
@@ -367,8 +551,8 @@ func TestTransitJSONParsing(t *testing.T) {
 				default:
 					t.Errorf("Expected level to be numeric, got %T: %v", metadata["level"], metadata["level"])
 				}
-				if level != 5 {
-					t.Errorf("Expected level=5, got %d", level)
+				if level != want.Metadata.Level {
+					t.Errorf("Expected level=%d, got %d", want.Metadata.Level, level)
 				}
 
 				// Joined date - should be present
@@ -383,8 +567,8 @@ func TestTransitJSONParsing(t *testing.T) {
 		}
 	}
 
-	if count != 3 {
-		t.Errorf("Expected 3 records, got %d", count)
+	if count != len(users) {
+		t.Errorf("Expected %d records, got %d", len(users), count)
 	}
 
 	t.Logf("✅ Transit-JSON OID approach working! Inserted and queried %d records with OID 16384", count)
@@ -396,7 +580,7 @@ func TestTransitJSONWithDate(t *testing.T) {
 
 	table := getCleanTable()
 
-	encoder := &MinimalTransitEncoder{}
+	encoder := &xtdb.Encoder{}
 
 	// Create data with date
 	now := time.Now()
@@ -449,21 +633,12 @@ func TestTransitMsgpackCopyFrom(t *testing.T) {
 
 	table := getCleanTable()
 
-	// Read the msgpack file as binary data
-	msgpackData, err := os.ReadFile("../test-data/sample-users-transit.msgpack")
-	if err != nil {
-		t.Fatalf("Failed to read msgpack file: %v", err)
-	}
-
 	// Use COPY FROM STDIN with transit-msgpack format
-	_, err = conn.PgConn().CopyFrom(
-		context.Background(),
-		strings.NewReader(string(msgpackData)),
-		fmt.Sprintf("COPY %s FROM STDIN WITH (FORMAT 'transit-msgpack')", table),
-	)
+	users, err := fixtures.CopySampleUsers(context.Background(), conn, table, "transit-msgpack")
 	if err != nil {
 		t.Fatalf("COPY FROM failed: %v", err)
 	}
+	want := users[0]
 
 	// Query back and verify - get ALL columns
 	rows, err := conn.Query(context.Background(),
@@ -489,14 +664,14 @@ func TestTransitMsgpackCopyFrom(t *testing.T) {
 				rowMap[string(fd.Name)] = values[i]
 			}
 
-			if rowMap["name"] != "Alice Smith" {
-				t.Errorf("Expected name='Alice Smith', got %v", rowMap["name"])
+			if rowMap["name"] != want.Name {
+				t.Errorf("Expected name=%q, got %v", want.Name, rowMap["name"])
 			}
 		}
 	}
 
-	if count != 3 {
-		t.Errorf("Expected 3 records, got %d", count)
+	if count != len(users) {
+		t.Errorf("Expected %d records, got %d", len(users), count)
 	}
 
 	t.Logf("✅ Successfully tested transit-msgpack with COPY FROM! Loaded %d records from msgpack binary format", count)
@@ -508,21 +683,12 @@ func TestTransitJsonCopyFrom(t *testing.T) {
 
 	table := getCleanTable()
 
-	// Read the transit-json file
-	jsonData, err := os.ReadFile("../test-data/sample-users-transit.json")
-	if err != nil {
-		t.Fatalf("Failed to read transit-json file: %v", err)
-	}
-
 	// Use COPY FROM STDIN with transit-json format
-	_, err = conn.PgConn().CopyFrom(
-		context.Background(),
-		strings.NewReader(string(jsonData)),
-		fmt.Sprintf("COPY %s FROM STDIN WITH (FORMAT 'transit-json')", table),
-	)
+	users, err := fixtures.CopySampleUsers(context.Background(), conn, table, "transit-json")
 	if err != nil {
 		t.Fatalf("COPY FROM failed: %v", err)
 	}
+	want := users[0]
 
 	// Query back and verify - get ALL columns
 	rows, err := conn.Query(context.Background(),
@@ -556,11 +722,11 @@ func TestTransitJsonCopyFrom(t *testing.T) {
 
 		// Verify first record (alice) - check all important fields
 		if count == 1 {
-			if rowMap["_id"] != "alice" {
-				t.Errorf("Expected _id='alice', got %v", rowMap["_id"])
+			if rowMap["_id"] != want.ID {
+				t.Errorf("Expected _id=%q, got %v", want.ID, rowMap["_id"])
 			}
-			if rowMap["name"] != "Alice Smith" {
-				t.Errorf("Expected name='Alice Smith', got %v", rowMap["name"])
+			if rowMap["name"] != want.Name {
+				t.Errorf("Expected name=%q, got %v", want.Name, rowMap["name"])
 			}
 
 			// Age might be int32, int64, or float64 depending on how pgx decodes it
@@ -576,32 +742,35 @@ func TestTransitJsonCopyFrom(t *testing.T) {
 			default:
 				t.Errorf("Expected age to be numeric, got %T: %v", ageVal, ageVal)
 			}
-			if age != 30 {
-				t.Errorf("Expected age=30, got %d", age)
+			if age != want.Age {
+				t.Errorf("Expected age=%d, got %d", want.Age, age)
 			}
 
-			if active, ok := rowMap["active"].(bool); !ok || !active {
-				t.Errorf("Expected active=true, got %v", rowMap["active"])
+			if active, ok := rowMap["active"].(bool); !ok || active != want.Active {
+				t.Errorf("Expected active=%v, got %v", want.Active, rowMap["active"])
 			}
 
-			if rowMap["email"] != "alice@example.com" {
-				t.Errorf("Expected email='alice@example.com', got %v", rowMap["email"])
+			if rowMap["email"] != want.Email {
+				t.Errorf("Expected email=%q, got %v", want.Email, rowMap["email"])
 			}
 
 			// Verify salary (float field) - May be transit-encoded, decode if needed
-			salaryDecoded := DecodeTransitValueTransit(rowMap["salary"])
-			if salary, ok := salaryDecoded.(float64); !ok || salary != 125000.5 {
-				t.Errorf("Expected salary=125000.5 (float64), got %v (type %T)", salaryDecoded, salaryDecoded)
+			salaryDecoded := xtdb.DecodeValue(rowMap["salary"])
+			if salary, ok := salaryDecoded.(float64); !ok || salary != want.Salary {
+				t.Errorf("Expected salary=%v (float64), got %v (type %T)", want.Salary, salaryDecoded, salaryDecoded)
 			}
 
 			// Verify nested array (tags)
 			if tags, ok := rowMap["tags"].([]interface{}); ok {
 				t.Logf("✅ Tags properly typed as []interface{}: %v", tags)
-				if len(tags) != 2 {
-					t.Errorf("Expected 2 tags, got %d", len(tags))
+				if len(tags) != len(want.Tags) {
+					t.Errorf("Expected %d tags, got %d", len(want.Tags), len(tags))
 				} else {
-					if tags[0] != "admin" || tags[1] != "developer" {
-						t.Errorf("Expected tags ['admin', 'developer'], got %v", tags)
+					for i, tag := range want.Tags {
+						if tags[i] != tag {
+							t.Errorf("Expected tags %v, got %v", want.Tags, tags)
+							break
+						}
 					}
 				}
 			} else {
@@ -609,13 +778,13 @@ func TestTransitJsonCopyFrom(t *testing.T) {
 			}
 
 			// Verify nested object (metadata) - May be transit-encoded, decode if needed
-			metadataDecoded := DecodeTransitValueTransit(rowMap["metadata"])
+			metadataDecoded := xtdb.DecodeValue(rowMap["metadata"])
 			if metadata, ok := metadataDecoded.(map[string]interface{}); ok {
 				t.Logf("✅ Metadata properly typed as map[string]interface{}: %v", metadata)
 
 				// Validate metadata fields
-				if dept, ok := metadata["department"].(string); !ok || dept != "Engineering" {
-					t.Errorf("Expected department='Engineering', got %v (type %T)", metadata["department"], metadata["department"])
+				if dept, ok := metadata["department"].(string); !ok || dept != want.Metadata.Department {
+					t.Errorf("Expected department=%q, got %v (type %T)", want.Metadata.Department, metadata["department"], metadata["department"])
 				}
 
 				// Level might be float64 or int from JSON parsing
@@ -630,8 +799,8 @@ func TestTransitJsonCopyFrom(t *testing.T) {
 				default:
 					t.Errorf("Expected level to be numeric, got %T: %v", metadata["level"], metadata["level"])
 				}
-				if level != 5 {
-					t.Errorf("Expected level=5, got %d", level)
+				if level != want.Metadata.Level {
+					t.Errorf("Expected level=%d, got %d", want.Metadata.Level, level)
 				}
 
 				// Joined date - should be present
@@ -646,11 +815,11 @@ func TestTransitJsonCopyFrom(t *testing.T) {
 		}
 	}
 
-	if count != 3 {
-		t.Errorf("Expected 3 records, got %d", count)
+	if count != len(users) {
+		t.Errorf("Expected %d records, got %d", len(users), count)
 	}
 
-	fmt.Println("✅ Successfully tested transit-json with COPY FROM! Loaded 3 records from JSON format")
+	fmt.Printf("✅ Successfully tested transit-json with COPY FROM! Loaded %d records from JSON format\n", count)
 	t.Logf("✅ Successfully tested transit-json with COPY FROM! Loaded %d records from JSON format", count)
 }
 
@@ -660,38 +829,16 @@ func TestTransitNestOneFullRecord(t *testing.T) {
 
 	table := getCleanTable()
 
-	// Load sample-users-transit.json
-	content, err := os.ReadFile("../test-data/sample-users-transit.json")
+	// Load the canonical sample users with the transit OID (16384)
+	users, err := fixtures.LoadSampleUsersTransit(context.Background(), conn, table)
 	if err != nil {
-		t.Fatalf("Failed to read transit file: %v", err)
-	}
-
-	lines := strings.Split(string(content), "\n")
-	sql := fmt.Sprintf("INSERT INTO %s RECORDS $1", table)
-
-	// Insert using transit OID (16384)
-	pgconn := conn.PgConn()
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		result := pgconn.ExecParams(context.Background(), sql,
-			[][]byte{[]byte(line)},
-			[]uint32{TransitOID},
-			[]int16{0},
-			[]int16{0})
-
-		_, err = result.Close()
-		if err != nil {
-			t.Fatalf("Insert failed: %v", err)
-		}
+		t.Fatalf("Insert failed: %v", err)
 	}
+	want := users[0]
 
 	// Query using NEST_ONE to get entire record as a single nested object
 	rows, err := conn.Query(context.Background(),
-		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = 'alice') AS r", table))
+		fmt.Sprintf("SELECT NEST_ONE(FROM %s WHERE _id = '%s') AS r", table, want.ID))
 	if err != nil {
 		t.Fatalf("Query failed: %v", err)
 	}
@@ -712,7 +859,7 @@ func TestTransitNestOneFullRecord(t *testing.T) {
 	t.Logf("   Raw record: %v", recordRaw)
 
 	// Decode the transit-JSON string
-	recordDecoded := DecodeTransitValueTransit(recordRaw)
+	recordDecoded := xtdb.DecodeValue(recordRaw)
 	record, ok := recordDecoded.(map[string]interface{})
 	if !ok {
 		t.Fatalf("Expected map[string]interface{} after decoding, got %T", recordDecoded)
@@ -721,11 +868,11 @@ func TestTransitNestOneFullRecord(t *testing.T) {
 	t.Logf("   Decoded record: %T", record)
 
 	// Verify all fields are accessible as native types
-	if record["_id"] != "alice" {
-		t.Errorf("Expected _id='alice', got %v", record["_id"])
+	if record["_id"] != want.ID {
+		t.Errorf("Expected _id=%q, got %v", want.ID, record["_id"])
 	}
-	if record["name"] != "Alice Smith" {
-		t.Errorf("Expected name='Alice Smith', got %v", record["name"])
+	if record["name"] != want.Name {
+		t.Errorf("Expected name=%q, got %v", want.Name, record["name"])
 	}
 
 	// Age might be different numeric types
@@ -740,12 +887,12 @@ func TestTransitNestOneFullRecord(t *testing.T) {
 	default:
 		t.Errorf("Expected age to be numeric, got %T: %v", record["age"], record["age"])
 	}
-	if age != 30 {
-		t.Errorf("Expected age=30, got %d", age)
+	if age != want.Age {
+		t.Errorf("Expected age=%d, got %d", want.Age, age)
 	}
 
-	if active, ok := record["active"].(bool); !ok || !active {
-		t.Errorf("Expected active=true, got %v", record["active"])
+	if active, ok := record["active"].(bool); !ok || active != want.Active {
+		t.Errorf("Expected active=%v, got %v", want.Active, record["active"])
 	}
 
 	// Nested array should be native []interface{}
@@ -766,43 +913,18 @@ func TestTransitNestOneFullRecord(t *testing.T) {
 			t.Errorf("Expected department='Engineering', got %v", metadata["department"])
 		}
 
-		// Verify joined date - after transit decoding, tagged values like ["~#time/zoned-date-time", "..."]
-		// are decoded to just the value string
+		// Tagged dates like ["~#time/zoned-date-time", "2020-01-15T00:00Z[UTC]"]
+		// decode to time.Time
 		joinedRaw := metadata["joined"]
 		t.Logf("   Joined raw value: %v (type: %T)", joinedRaw, joinedRaw)
 
-		if joinedStr, ok := joinedRaw.(string); ok {
-			// The transit decoder extracts the value from ["~#time/zoned-date-time", "2020-01-15T00:00Z[UTC]"]
-			// leaving us with just "2020-01-15T00:00Z[UTC]"
-			// Remove the [UTC] timezone annotation
-			dateStr := strings.Split(joinedStr, "[")[0]
-
-			// Parse the ISO datetime string - handle both RFC3339 and simplified Z format
-			var parsedDate time.Time
-			var err error
-			if strings.HasSuffix(dateStr, "Z") {
-				// Try parsing with custom format for simplified Z notation
-				parsedDate, err = time.Parse("2006-01-02T15:04:05Z", dateStr)
-				if err != nil {
-					// Try without seconds
-					parsedDate, err = time.Parse("2006-01-02T15:04Z", dateStr)
-				}
-			} else {
-				parsedDate, err = time.Parse(time.RFC3339, dateStr)
-			}
-
-			if err != nil {
-				t.Errorf("Failed to parse date %s: %v", dateStr, err)
-			} else {
-				t.Logf("   ✅ Decoded joined date to time.Time: %v", parsedDate)
-				// Verify it's the expected date
-				if parsedDate.Year() != 2020 || parsedDate.Month() != 1 || parsedDate.Day() != 15 {
-					t.Errorf("Expected date 2020-01-15, got %v", parsedDate)
-				}
-				t.Logf("   ✅ Transit tagged date successfully decoded and verified")
+		if joined, ok := joinedRaw.(time.Time); ok {
+			t.Logf("   ✅ Decoded joined date to time.Time: %v", joined)
+			if !joined.Equal(time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("Expected joined 2020-01-15T00:00Z, got %v", joined)
 			}
 		} else {
-			t.Errorf("Expected joined to be string, got %T: %v", joinedRaw, joinedRaw)
+			t.Errorf("Expected joined to be time.Time, got %T: %v", joinedRaw, joinedRaw)
 		}
 	} else {
 		t.Errorf("Expected metadata to be map[string]interface{}, got %T: %v", record["metadata"], record["metadata"])
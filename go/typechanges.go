@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TypeChange records a field whose Go type differs from its previous version
+type TypeChange struct {
+	ID    any
+	Field string
+	From  string // Go type name, e.g. int64
+	To    string
+	// At is the _valid_from of the version that changed type
+	At time.Time
+}
+
+// DetectTypeChanges scans every valid-time version in table and reports,
+// per id and field, each point where a value's type changed - usually an
+// upstream bug, as nothing in a schemaless store will stop it. A field that
+// is missing (NULL) in a version doesn't count as a change.
+func DetectTypeChanges(ctx context.Context, conn *pgx.Conn, table string) ([]TypeChange, error) {
+	if err := checkTable(table); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, tagSQL(ctx, fmt.Sprintf("SELECT *, _valid_from FROM %s FOR ALL VALID_TIME ORDER BY _valid_from", table)))
+	if err != nil {
+		return nil, fmt.Errorf("querying %s: %w", table, err)
+	}
+	versions, err := collectMaps(rows)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", table, err)
+	}
+	return typeChanges(versions), nil
+}
+
+// typeChanges works through versions ordered by _valid_from
+func typeChanges(versions []map[string]interface{}) []TypeChange {
+	// last type seen per id, per field
+	lastTypes := map[string]map[string]string{}
+	var changes []TypeChange
+
+	for _, version := range versions {
+		key := fmt.Sprint(version["_id"])
+		seen := lastTypes[key]
+		if seen == nil {
+			seen = map[string]string{}
+			lastTypes[key] = seen
+		}
+		at, _ := version["_valid_from"].(time.Time)
+
+		fields := make([]string, 0, len(version))
+		for field := range version {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			value := version[field]
+			if value == nil || field == "_valid_from" {
+				continue
+			}
+			typ := fmt.Sprintf("%T", value)
+			if prev, ok := seen[field]; ok && prev != typ {
+				changes = append(changes, TypeChange{ID: version["_id"], Field: field, From: prev, To: typ, At: at})
+			}
+			seen[field] = typ
+		}
+	}
+	return changes
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTypeChanges(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	changes := typeChanges([]map[string]interface{}{
+		{"_id": "alice", "age": int64(30), "name": "Alice", "_valid_from": t1},
+		{"_id": "bob", "age": int64(25), "_valid_from": t1},
+		{"_id": "alice", "age": "thirty", "name": nil, "_valid_from": t2},
+		{"_id": "alice", "age": "thirty-one", "name": "Alice", "_valid_from": t3},
+	})
+
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %+v", changes)
+	}
+	c := changes[0]
+	if c.ID != "alice" || c.Field != "age" || c.From != "int64" || c.To != "string" || !c.At.Equal(t2) {
+		t.Errorf("Unexpected change: %+v", c)
+	}
+}
+
+func TestDetectTypeChanges(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	for _, stmt := range []string{
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'alice', age: 30, _valid_from: TIMESTAMP '2024-01-01T00:00:00Z'}", table),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'alice', age: 'thirty', _valid_from: TIMESTAMP '2024-02-01T00:00:00Z'}", table),
+		fmt.Sprintf("INSERT INTO %s RECORDS {_id: 'bob', age: 25}", table),
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	changes, err := DetectTypeChanges(ctx, conn, table)
+	if err != nil {
+		t.Fatalf("DetectTypeChanges failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].ID != "alice" || changes[0].Field != "age" || changes[0].To != "string" {
+		t.Errorf("Expected alice's age to change to string, got %+v", changes)
+	}
+}
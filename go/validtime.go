@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ValidTimePolicy decides what happens to a _valid_from outside the guard's bounds
+type ValidTimePolicy int
+
+const (
+	// ValidTimeReject fails the insert
+	ValidTimeReject ValidTimePolicy = iota
+	// ValidTimeClamp moves the value to the nearest bound, or rescales it when
+	// it's a seconds/milliseconds mix-up
+	ValidTimeClamp
+	// ValidTimeWarn logs the value and inserts it unchanged
+	ValidTimeWarn
+)
+
+// ErrValidTimeOutOfRange is wrapped by every *ValidTimeError
+var ErrValidTimeOutOfRange = errors.New("valid time out of range")
+
+// ValidTimeError describes a rejected _valid_from
+type ValidTimeError struct {
+	Value time.Time
+	// Corrected is set when Value looks like a unit mistake
+	Corrected time.Time
+	Reason    string
+}
+
+func (e *ValidTimeError) Error() string {
+	return fmt.Sprintf("_valid_from %s: %s", e.Value.Format(time.RFC3339), e.Reason)
+}
+
+func (e *ValidTimeError) Unwrap() error { return ErrValidTimeOutOfRange }
+
+// ValidTimeGuard keeps mis-parsed timestamps from being written as valid
+// time. A single document valid from the year 56843 (epoch millis read as
+// seconds) silently shadows every current read of its entity.
+type ValidTimeGuard struct {
+	// Min and Max bound acceptable values; zero means 1900-01-01 and now+1d
+	Min, Max time.Time
+	Policy   ValidTimePolicy
+	// Now defaults to time.Now
+	Now func() time.Time
+	// Warnf defaults to log.Printf
+	Warnf func(format string, args ...any)
+}
+
+var defaultMinValidTime = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (g ValidTimeGuard) bounds() (time.Time, time.Time, time.Time) {
+	now := time.Now()
+	if g.Now != nil {
+		now = g.Now()
+	}
+	lo, hi := g.Min, g.Max
+	if lo.IsZero() {
+		lo = defaultMinValidTime
+	}
+	if hi.IsZero() {
+		hi = now.Add(24 * time.Hour)
+	}
+	return now, lo, hi
+}
+
+// Check applies the guard to t, returning the value to insert
+func (g ValidTimeGuard) Check(t time.Time) (time.Time, error) {
+	now, lo, hi := g.bounds()
+
+	var verr *ValidTimeError
+	if corrected, reason, ok := unitMistake(t, now); ok {
+		verr = &ValidTimeError{Value: t, Corrected: corrected, Reason: reason}
+	} else if t.Before(lo) {
+		verr = &ValidTimeError{Value: t, Corrected: lo,
+			Reason: fmt.Sprintf("before minimum %s", lo.Format(time.RFC3339))}
+	} else if t.After(hi) {
+		verr = &ValidTimeError{Value: t, Corrected: hi,
+			Reason: fmt.Sprintf("after maximum %s", hi.Format(time.RFC3339))}
+	} else {
+		return t, nil
+	}
+
+	switch g.Policy {
+	case ValidTimeClamp:
+		return verr.Corrected, nil
+	case ValidTimeWarn:
+		warnf := g.Warnf
+		if warnf == nil {
+			warnf = log.Printf
+		}
+		warnf("Warning: %v", verr)
+		return t, nil
+	default:
+		return time.Time{}, verr
+	}
+}
+
+// unitMistake spots timestamps ~1000x away from now: epoch milliseconds
+// parsed as seconds (tens of thousands of years ahead) or seconds parsed as
+// milliseconds (January 1970).
+func unitMistake(t, now time.Time) (time.Time, string, bool) {
+	secs, nowSecs := float64(t.Unix()), float64(now.Unix())
+	if nowSecs <= 0 || secs <= 0 {
+		return time.Time{}, "", false
+	}
+
+	ratio := secs / nowSecs
+	switch {
+	case ratio > 500 && ratio < 2000:
+		return time.UnixMilli(t.Unix()).UTC(), "looks like epoch milliseconds parsed as seconds", true
+	case ratio > 1.0/2000 && ratio < 1.0/500:
+		return time.Unix(t.UnixMilli(), 0).UTC(), "looks like epoch seconds parsed as milliseconds", true
+	}
+	return time.Time{}, "", false
+}
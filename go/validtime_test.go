@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var guardNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func fixedNow() time.Time { return guardNow }
+
+func TestValidTimeGuardPolicies(t *testing.T) {
+	future := guardNow.Add(30 * 24 * time.Hour)
+	ancient := time.Date(1850, 1, 1, 0, 0, 0, 0, time.UTC)
+	fine := guardNow.Add(-time.Hour)
+
+	reject := ValidTimeGuard{Policy: ValidTimeReject, Now: fixedNow}
+	if got, err := reject.Check(fine); err != nil || !got.Equal(fine) {
+		t.Errorf("In-range value should pass unchanged, got %v, %v", got, err)
+	}
+	if _, err := reject.Check(future); !errors.Is(err, ErrValidTimeOutOfRange) {
+		t.Errorf("Expected ErrValidTimeOutOfRange for future value, got %v", err)
+	}
+	if _, err := reject.Check(ancient); !errors.Is(err, ErrValidTimeOutOfRange) {
+		t.Errorf("Expected ErrValidTimeOutOfRange for pre-1900 value, got %v", err)
+	}
+
+	clamp := ValidTimeGuard{Policy: ValidTimeClamp, Now: fixedNow}
+	if got, err := clamp.Check(future); err != nil || !got.Equal(guardNow.Add(24*time.Hour)) {
+		t.Errorf("Expected future value clamped to now+1d, got %v, %v", got, err)
+	}
+	if got, err := clamp.Check(ancient); err != nil || !got.Equal(defaultMinValidTime) {
+		t.Errorf("Expected old value clamped to 1900-01-01, got %v, %v", got, err)
+	}
+
+	var warnings []string
+	warn := ValidTimeGuard{Policy: ValidTimeWarn, Now: fixedNow,
+		Warnf: func(format string, args ...any) { warnings = append(warnings, fmt.Sprintf(format, args...)) }}
+	if got, err := warn.Check(future); err != nil || !got.Equal(future) {
+		t.Errorf("Warn policy should keep the value, got %v, %v", got, err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected 1 warning, got %v", warnings)
+	}
+
+	custom := ValidTimeGuard{Policy: ValidTimeReject, Now: fixedNow,
+		Min: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Max: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := custom.Check(future); err != nil {
+		t.Errorf("Custom max should allow %v, got %v", future, err)
+	}
+	if _, err := custom.Check(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("Custom min should reject 2019")
+	}
+}
+
+func TestValidTimeGuardUnitMistakes(t *testing.T) {
+	guard := ValidTimeGuard{Policy: ValidTimeReject, Now: fixedNow}
+	intended := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Epoch millis read as seconds: year ~55970
+	millisAsSeconds := time.Unix(intended.UnixMilli(), 0)
+	_, err := guard.Check(millisAsSeconds)
+	var verr *ValidTimeError
+	if !errors.As(err, &verr) || !verr.Corrected.Equal(intended) {
+		t.Fatalf("Expected millis-as-seconds to be detected with correction %v, got %v", intended, err)
+	}
+
+	// Epoch seconds read as millis: January 1970, which is inside the default bounds
+	secondsAsMillis := time.UnixMilli(intended.Unix())
+	_, err = guard.Check(secondsAsMillis)
+	if !errors.As(err, &verr) || !verr.Corrected.Equal(intended) {
+		t.Fatalf("Expected seconds-as-millis to be detected with correction %v, got %v", intended, err)
+	}
+
+	clamp := ValidTimeGuard{Policy: ValidTimeClamp, Now: fixedNow}
+	if got, err := clamp.Check(millisAsSeconds); err != nil || !got.Equal(intended) {
+		t.Errorf("Clamp should rescale unit mistakes, got %v, %v", got, err)
+	}
+
+	// Genuine values a long way from now aren't mistaken for unit errors
+	if _, _, ok := unitMistake(time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC), guardNow); ok {
+		t.Error("1999 shouldn't look like a unit mistake")
+	}
+}
+
+func TestInsertRecordsValidTimeGuard(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	table := getCleanTable()
+
+	farFuture := time.Unix(time.Now().UnixMilli(), 0).UTC()
+	err := InsertRecords(ctx, conn, table, []map[string]interface{}{
+		{"_id": "bad", "_valid_from": farFuture},
+	})
+	if !errors.Is(err, ErrValidTimeOutOfRange) {
+		t.Fatalf("Expected insert to be rejected, got %v", err)
+	}
+
+	intended := time.Now().Add(-time.Minute).Truncate(time.Millisecond).UTC()
+	err = InsertRecords(ctx, conn, table, []map[string]interface{}{
+		{"_id": "fixed", "_valid_from": time.Unix(intended.UnixMilli(), 0)},
+	}, WithValidTimeGuard(ValidTimeGuard{Policy: ValidTimeClamp}))
+	if err != nil {
+		t.Fatalf("Clamped insert failed: %v", err)
+	}
+
+	var validFrom time.Time
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT _valid_from FROM %s WHERE _id = 'fixed'", table)).Scan(&validFrom)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !validFrom.Equal(intended) {
+		t.Errorf("Expected corrected _valid_from %v, got %v", intended, validFrom)
+	}
+}
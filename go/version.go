@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ServerVersion returns the server's version string, from SELECT version()
+// or, failing that, the server_version the server reported at connect
+func ServerVersion(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var version string
+	err := conn.QueryRow(ctx, tagSQL(ctx, "SELECT version()")).Scan(&version)
+	if err == nil && version != "" {
+		return version, nil
+	}
+	if reported := conn.PgConn().ParameterStatus("server_version"); reported != "" {
+		return reported, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("empty version")
+	}
+	return "", fmt.Errorf("reading server version: %w", err)
+}
+
+// Features that FeatureSupported knows about
+const (
+	FeatureNestOne      = "nest_one"
+	FeatureErase        = "erase"
+	FeaturePatch        = "patch"
+	FeatureTransitCopy  = "transit_copy"  // COPY ... FROM STDIN WITH (FORMAT 'transit-json')
+	FeatureOutputFormat = "output_format" // fallback_output_format connection parameter
+)
+
+// featureMinimums are the first XTDB release with each feature. XTDB 1.x
+// has no SQL over pgwire, so everything here needs at least 2.0.0.
+var featureMinimums = map[string][3]int{
+	FeatureNestOne:      {2, 0, 0},
+	FeatureErase:        {2, 0, 0},
+	FeatureOutputFormat: {2, 0, 0},
+	FeaturePatch:        {2, 1, 0},
+	FeatureTransitCopy:  {2, 1, 0},
+}
+
+var xtdbVersionPattern = regexp.MustCompile(`(?i)xtdb\D*?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseXTDBVersion finds the XTDB release in a version string such as
+// "PostgreSQL 16 XTDB @ 2.0.0". The PostgreSQL version XTDB emulates says
+// nothing about its own, so a string without an XTDB part is unreadable.
+func parseXTDBVersion(version string) ([3]int, bool) {
+	m := xtdbVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return [3]int{}, false
+	}
+	var v [3]int
+	for i, part := range m[1:] {
+		if part != "" {
+			v[i], _ = strconv.Atoi(part)
+		}
+	}
+	return v, true
+}
+
+// FeatureSupported reports whether an XTDB server reporting version (as
+// returned by ServerVersion) has feature. Unknown features and versions that
+// can't be read are reported as unsupported.
+func FeatureSupported(version, feature string) bool {
+	minimum, known := featureMinimums[feature]
+	if !known {
+		return false
+	}
+	v, ok := parseXTDBVersion(version)
+	if !ok {
+		return false
+	}
+	for i := range v {
+		if v[i] != minimum[i] {
+			return v[i] > minimum[i]
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFeatureSupported(t *testing.T) {
+	cases := []struct {
+		version, feature string
+		supported        bool
+	}{
+		{"PostgreSQL 16 XTDB @ 2.0.0", FeatureNestOne, true},
+		{"XTDB 2.1.3", FeatureErase, true},
+		{"xtdb 1.24.3", FeatureNestOne, false},
+		{"1.24", FeaturePatch, false},
+		{"PostgreSQL 16 XTDB @ 2.0.9", FeaturePatch, false},
+		{"PostgreSQL 16 XTDB @ 2.1.0", FeaturePatch, true},
+		{"XTDB 2.0.3", FeatureTransitCopy, false},
+		{"XTDB 2.2", FeatureTransitCopy, true},
+		{"XTDB 3.0.0", FeatureTransitCopy, true},
+		{"PostgreSQL 16.2", FeatureNestOne, false},
+		{"16", FeatureErase, false},
+		{"PostgreSQL 16 XTDB @ 2.0.0", "time_travel_to_the_future", false},
+		{"dev build", FeatureNestOne, false},
+	}
+	for _, c := range cases {
+		if got := FeatureSupported(c.version, c.feature); got != c.supported {
+			t.Errorf("FeatureSupported(%q, %q) = %v, want %v", c.version, c.feature, got, c.supported)
+		}
+	}
+
+	if v, ok := parseXTDBVersion("PostgreSQL 16 XTDB @ 2.0.0-beta7"); !ok || v != [3]int{2, 0, 0} {
+		t.Errorf("Expected 2.0.0 from the XTDB part of the string, got %v", v)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	version, err := ServerVersion(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("ServerVersion failed: %v", err)
+	}
+	if version == "" {
+		t.Fatal("Expected a non-empty version")
+	}
+	t.Logf("Server version: %s (NEST_ONE supported: %v)", version, FeatureSupported(version, FeatureNestOne))
+}
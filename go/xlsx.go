@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSX export/import for analysts who want typed spreadsheets rather than
+// CSV, on top of excelize: one typed value per cell, a bold frozen header
+// row, and dates as real date cells.
+
+// XLSXSheet is one query to export as a worksheet
+type XLSXSheet struct {
+	Name  string // at most 31 characters, none of []:*?/\
+	Query string
+	Args  []any
+}
+
+// ExportXLSX runs each sheet's query and writes the results to an .xlsx file
+// at path, one worksheet per query with the column names as a frozen
+// header. Numbers, booleans and timestamps become typed cells; nested
+// values are written as JSON strings. The workbook is written to a
+// temporary file next to path and renamed into place, so a failed export
+// leaves whatever was at path untouched.
+func ExportXLSX(ctx context.Context, conn *pgx.Conn, path string, sheets ...XLSXSheet) error {
+	if len(sheets) == 0 {
+		return fmt.Errorf("no sheets to export")
+	}
+	seen := map[string]bool{}
+	for _, s := range sheets {
+		if err := checkSheetName(s.Name); err != nil {
+			return err
+		}
+		if seen[strings.ToLower(s.Name)] {
+			return fmt.Errorf("duplicate sheet name %q", s.Name)
+		}
+		seen[strings.ToLower(s.Name)] = true
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		return err
+	}
+	for i, s := range sheets {
+		if i == 0 {
+			err = f.SetSheetName(f.GetSheetName(0), s.Name)
+		} else {
+			_, err = f.NewSheet(s.Name)
+		}
+		if err == nil {
+			err = exportSheet(ctx, conn, f, styles, s)
+		}
+		if err != nil {
+			return fmt.Errorf("sheet %q: %w", s.Name, err)
+		}
+	}
+	return saveXLSX(f, path)
+}
+
+func checkSheetName(name string) error {
+	if name == "" || len(name) > 31 || strings.ContainsAny(name, `[]:*?/\`) {
+		return fmt.Errorf("invalid sheet name %q", name)
+	}
+	return nil
+}
+
+func exportSheet(ctx context.Context, conn *pgx.Conn, f *excelize.File, styles xlsxStyles, s XLSXSheet) error {
+	rows, err := conn.Query(ctx, tagSQL(ctx, s.Query), s.Args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sw, err := f.NewStreamWriter(s.Name)
+	if err != nil {
+		return err
+	}
+	err = sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return err
+	}
+
+	header := make([]any, len(rows.FieldDescriptions()))
+	for i, fd := range rows.FieldDescriptions() {
+		header[i] = excelize.Cell{StyleID: styles.header, Value: fd.Name}
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	for r := 2; rows.Next(); r++ {
+		values, err := rows.Values()
+		if err != nil {
+			return err
+		}
+		if err := writeXLSXRow(sw, styles, r, values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return sw.Flush()
+}
+
+// xlsxStyles are the cell styles an export uses
+type xlsxStyles struct {
+	header, date int
+}
+
+func newXLSXStyles(f *excelize.File) (xlsxStyles, error) {
+	var styles xlsxStyles
+	var err error
+	if styles.header, err = f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}}); err != nil {
+		return styles, err
+	}
+	dateFormat := "yyyy-mm-dd hh:mm:ss"
+	styles.date, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	return styles, err
+}
+
+// writeXLSXRow writes values as row r (1-based) of sw
+func writeXLSXRow(sw *excelize.StreamWriter, styles xlsxStyles, r int, values []any) error {
+	cells := make([]any, len(values))
+	for c, v := range values {
+		cell, err := xlsxCell(v, styles)
+		if err != nil {
+			ref, _ := excelize.CoordinatesToCellName(c+1, r)
+			return fmt.Errorf("%s: %w", ref, err)
+		}
+		cells[c] = cell
+	}
+	ref, err := excelize.CoordinatesToCellName(1, r)
+	if err != nil {
+		return err
+	}
+	if err := sw.SetRow(ref, cells); err != nil {
+		return fmt.Errorf("row %d: %w", r, err)
+	}
+	return nil
+}
+
+// xlsxCell converts a query result value to what the stream writer should
+// put in its cell
+func xlsxCell(v any, styles xlsxStyles) (any, error) {
+	switch x := v.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		return x, nil
+	case float32, float64, pgtype.Numeric:
+		return toFloat64(x)
+	case time.Time:
+		serial, ok := excelSerial(x)
+		if !ok {
+			// Excel has no dates before 1900, so keep it as text
+			return x.Format(time.RFC3339Nano), nil
+		}
+		return excelize.Cell{StyleID: styles.date, Value: serial}, nil
+	case string:
+		return xlsxString(x)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		return xlsxString(string(data))
+	default:
+		return xlsxString(fmt.Sprint(x))
+	}
+}
+
+// xlsxString rejects text too long for a cell, which excelize would
+// otherwise cut short
+func xlsxString(s string) (string, error) {
+	if n := utf8.RuneCountInString(s); n > excelize.TotalCellChars {
+		return "", fmt.Errorf("%d characters is more than a cell holds (%d)", n, excelize.TotalCellChars)
+	}
+	return s, nil
+}
+
+// saveXLSX writes f to a temporary file in path's directory and renames it
+// to path
+func saveXLSX(f *excelize.File, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var (
+	// excelEpoch is day zero of Excel's 1900 date system from 1 March 1900
+	// on; Excel, like Lotus 1-2-3 before it, counts a 29 February 1900 that
+	// never was, so earlier dates are a day closer to it
+	excelEpoch     = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	excelLeapDay   = time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)
+	excelFirstDay  = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+	excel1904Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+const microsPerDay = float64(24 * time.Hour / time.Microsecond)
+
+// excelSerial is t as a date serial in the 1900 date system: 1 for
+// 1 January 1900, 61 for 1 March 1900. Times before 1900 have none.
+func excelSerial(t time.Time) (float64, bool) {
+	if t.Before(excelFirstDay) {
+		return 0, false
+	}
+	secs := t.Unix() - excelEpoch.Unix()
+	serial := (float64(secs) + float64(t.Nanosecond())/1e9) / 86400
+	if t.Before(excelLeapDay) {
+		serial--
+	}
+	return serial, true
+}
+
+// excelTime is the inverse of excelSerial, to the microsecond, or reads a
+// serial in the 1904 date system, which counts from 1 January 1904 with no
+// phantom leap day. Serial 60, that 29 February 1900, reads as 1 March.
+func excelTime(serial float64, date1904 bool) time.Time {
+	epoch := excelEpoch
+	switch {
+	case date1904:
+		epoch = excel1904Epoch
+	case serial < 61:
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	days := math.Floor(serial)
+	us := math.Round((serial - days) * microsPerDay)
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(us) * time.Microsecond)
+}
+
+// XLSXMapping says how ImportXLSX turns a sheet's rows into records
+type XLSXMapping struct {
+	// Columns maps header names to record fields; headers not listed are
+	// skipped. Nil imports every column under its header name.
+	Columns map[string]string
+	// IDColumn is the header whose values become _id
+	IDColumn string
+	// TimeColumns are headers whose cells are read with NormalizeTimestamp,
+	// so dates typed as text or epoch numbers become timestamps
+	TimeColumns []string
+	// Transform, if set, rewrites or drops each record before it's inserted
+	Transform Transform
+}
+
+// ImportXLSX inserts each row of the named sheet in the .xlsx file at path
+// as a record in table, reading the first row as headers. Typed cells keep
+// their types (date cells become timestamps); empty cells are left out of
+// the record, and empty rows are skipped. Rows are inserted as SQL
+// literals (see BuildRecordsLiteral), so timestamps stay timestamps,
+// xlsxInsertBatch to a statement. It returns the number of records
+// inserted, after any the mapping's Transform dropped; if a statement
+// fails, the batches before it stay inserted.
+func ImportXLSX(ctx context.Context, conn *pgx.Conn, path, sheet, table string, mapping XLSXMapping) (int, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	if mapping.IDColumn == "" {
+		return 0, fmt.Errorf("mapping has no IDColumn")
+	}
+
+	grid, err := ReadXLSXSheet(path, sheet)
+	if err != nil {
+		return 0, err
+	}
+	if len(grid) == 0 {
+		return 0, fmt.Errorf("sheet %q is empty", sheet)
+	}
+
+	timeColumns := map[string]bool{}
+	for _, h := range mapping.TimeColumns {
+		timeColumns[h] = true
+	}
+	headers := make([]string, len(grid[0]))
+	idCol := -1
+	for i, h := range grid[0] {
+		headers[i] = fmt.Sprint(h)
+		if headers[i] == mapping.IDColumn {
+			idCol = i
+		}
+	}
+	if idCol < 0 {
+		return 0, fmt.Errorf("sheet %q has no %q column", sheet, mapping.IDColumn)
+	}
+
+	var records []map[string]interface{}
+	for r, row := range grid[1:] {
+		if len(row) == 0 {
+			continue
+		}
+		if idCol >= len(row) || row[idCol] == nil {
+			return 0, fmt.Errorf("row %d: no %s", r+2, mapping.IDColumn)
+		}
+		record := map[string]interface{}{"_id": row[idCol]}
+		for c, v := range row {
+			if c == idCol || v == nil || c >= len(headers) {
+				continue
+			}
+			field := headers[c]
+			if mapping.Columns != nil {
+				var ok bool
+				if field, ok = mapping.Columns[headers[c]]; !ok {
+					continue
+				}
+			}
+			if !identifierPattern.MatchString(field) {
+				return 0, fmt.Errorf("row %d: invalid field name %q", r+2, field)
+			}
+			if timeColumns[headers[c]] {
+				t, err := NormalizeTimestamp(v)
+				if err != nil {
+					return 0, fmt.Errorf("row %d: %s: %w", r+2, headers[c], err)
+				}
+				v = t
+			}
+			record[field] = v
+		}
+		records = append(records, record)
+	}
+	records = applyTransform(mapping.Transform, records)
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	inserted := 0
+	for start := 0; start < len(records); start += xlsxInsertBatch {
+		batch := records[start:min(start+xlsxInsertBatch, len(records))]
+		lit, err := BuildRecordsLiteral(batch...)
+		if err != nil {
+			return inserted, err
+		}
+		if _, err := conn.Exec(ctx, tagSQL(ctx, fmt.Sprintf("INSERT INTO %s RECORDS %s", table, lit))); err != nil {
+			return inserted, fmt.Errorf("inserting into %s: %w", table, err)
+		}
+		inserted += len(batch)
+	}
+	return inserted, nil
+}
+
+// xlsxInsertBatch is the number of rows per INSERT in ImportXLSX
+const xlsxInsertBatch = 500
+
+// ReadXLSXSheet reads the named sheet of the .xlsx file at path as rows of
+// cell values: string, bool, int64 or float64, time.Time for date-formatted
+// cells, and nil for empty ones. Rows are as long as their last cell, and
+// empty rows are empty.
+func ReadXLSXSheet(path, sheet string) ([][]any, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if idx, err := f.GetSheetIndex(sheet); err != nil || idx < 0 {
+		return nil, fmt.Errorf("xlsx: no sheet %q (have %v)", sheet, f.GetSheetList())
+	}
+	props, err := f.GetWorkbookProps()
+	if err != nil {
+		return nil, err
+	}
+	date1904 := props.Date1904 != nil && *props.Date1904
+
+	raw, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	dateStyles := map[int]bool{}
+	grid := make([][]any, len(raw))
+	for r, row := range raw {
+		values := make([]any, len(row))
+		for c, text := range row {
+			if text == "" {
+				continue
+			}
+			ref, err := excelize.CoordinatesToCellName(c+1, r+1)
+			if err != nil {
+				return nil, err
+			}
+			if values[c], err = xlsxValue(f, sheet, ref, text, date1904, dateStyles); err != nil {
+				return nil, fmt.Errorf("%s: %w", ref, err)
+			}
+		}
+		grid[r] = values
+	}
+	return grid, nil
+}
+
+// xlsxValue types the raw text of the cell at ref by its cell type and,
+// for numbers, whether its style formats them as dates. dateStyles caches
+// the answer per style.
+func xlsxValue(f *excelize.File, sheet, ref, text string, date1904 bool, dateStyles map[int]bool) (any, error) {
+	cellType, err := f.GetCellType(sheet, ref)
+	if err != nil {
+		return nil, err
+	}
+	switch cellType {
+	case excelize.CellTypeSharedString, excelize.CellTypeInlineString, excelize.CellTypeFormula:
+		return text, nil
+	case excelize.CellTypeBool:
+		return text == "1" || strings.EqualFold(text, "true"), nil
+	case excelize.CellTypeError:
+		return nil, fmt.Errorf("error cell %s", text)
+	case excelize.CellTypeDate:
+		// ISO 8601 text rather than a serial
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, text); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("bad date %q", text)
+	}
+
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %q", text)
+	}
+	style, err := f.GetCellStyle(sheet, ref)
+	if err != nil {
+		return nil, err
+	}
+	isDate, seen := dateStyles[style]
+	if !seen {
+		if isDate, err = isDateStyle(f, style); err != nil {
+			return nil, err
+		}
+		dateStyles[style] = isDate
+	}
+	switch {
+	case isDate:
+		return excelTime(n, date1904), nil
+	case n == math.Trunc(n) && math.Abs(n) < 1<<53:
+		return int64(n), nil
+	default:
+		return n, nil
+	}
+}
+
+// builtinDateFormats are the built-in number formats that show dates or times
+var builtinDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	45: true, 46: true, 47: true,
+}
+
+// isDateStyle reports whether a cell style formats numbers as dates, going
+// by the built-in date formats and any custom format with date/time codes.
+// Style 0, the workbook default, is a general number format.
+func isDateStyle(f *excelize.File, id int) (bool, error) {
+	if id == 0 {
+		return false, nil
+	}
+	style, err := f.GetStyle(id)
+	if err != nil {
+		return false, err
+	}
+	if style.CustomNumFmt != nil {
+		return isDateFormat(*style.CustomNumFmt), nil
+	}
+	return builtinDateFormats[style.NumFmt], nil
+}
+
+// isDateFormat looks for date/time codes outside quoted literals and
+// bracketed sections (colours, locales)
+func isDateFormat(code string) bool {
+	inQuote, inBracket := false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case strings.ContainsRune("ymdhs", r):
+			return true
+		}
+	}
+	return false
+}
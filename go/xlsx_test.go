@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXCellsRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 15, 9, 30, 15, 250000000, time.UTC)
+	early := time.Date(1900, 2, 10, 6, 0, 0, 0, time.UTC)
+	ancient := time.Date(1899, 6, 1, 0, 0, 0, 0, time.UTC)
+	rows := [][]any{
+		{"id", "count", "ratio", "active", "seen_at", "tags", "note"},
+		{"a", int64(42), 0.5, true, at, []interface{}{"x", "y"}, "<&\"quoted\">"},
+		{"b", int64(-1), 1e-9, false, nil, map[string]interface{}{"k": "v"}},
+		{"c", nil, nil, nil, early},
+		{"d", nil, nil, nil, ancient},
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetSheetName(f.GetSheetName(0), "Data & more"); err != nil {
+		t.Fatal(err)
+	}
+	sw, err := f.NewStreamWriter("Data & more")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		if err := writeXLSXRow(sw, styles, i+1, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cells.xlsx")
+	if err := saveXLSX(f, path); err != nil {
+		t.Fatal(err)
+	}
+
+	grid, err := ReadXLSXSheet(path, "Data & more")
+	if err != nil {
+		t.Fatalf("ReadXLSXSheet failed: %v", err)
+	}
+	expected := [][]any{
+		rows[0],
+		{"a", int64(42), 0.5, true, at, `["x","y"]`, "<&\"quoted\">"},
+		{"b", int64(-1), 1e-9, false, nil, `{"k":"v"}`},
+		{"c", nil, nil, nil, early},
+		{"d", nil, nil, nil, "1899-06-01T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(grid, expected) {
+		t.Errorf("Round trip mismatch:\n got %#v\nwant %#v", grid, expected)
+	}
+
+	if _, err := ReadXLSXSheet(path, "Missing"); err == nil {
+		t.Error("Expected an error for a missing sheet")
+	}
+	if _, err := xlsxCell(strings.Repeat("x", excelize.TotalCellChars+1), styles); err == nil {
+		t.Error("Expected text too long for a cell to be rejected")
+	}
+}
+
+func TestXLSXHelpers(t *testing.T) {
+	// Serials Excel itself gives these dates, either side of its phantom
+	// 29 February 1900
+	for date, want := range map[string]float64{
+		"1900-01-01": 1, "1900-02-28": 59, "1900-03-01": 61, "2024-01-01": 45292,
+	} {
+		day, _ := time.Parse("2006-01-02", date)
+		got, ok := excelSerial(day)
+		if !ok || got != want {
+			t.Errorf("excelSerial(%s) = %v, want %v", date, got, want)
+		}
+		if back := excelTime(want, false); !back.Equal(day) {
+			t.Errorf("excelTime(%v) = %v, want %s", want, back, date)
+		}
+	}
+	if _, ok := excelSerial(time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("Expected no serial before 1900")
+	}
+	if got := excelTime(0.5, true); !got.Equal(time.Date(1904, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the 1904 date system to count from 1904-01-01, got %v", got)
+	}
+
+	for code, isDate := range map[string]bool{
+		"yyyy-mm-dd": true, "h:mm AM/PM": true, "0.00": false, `"days"0`: false, "[Red]0.0": false, "[$-409]d-mmm": true,
+	} {
+		if isDateFormat(code) != isDate {
+			t.Errorf("isDateFormat(%q) should be %v", code, isDate)
+		}
+	}
+
+	if err := checkSheetName("a/b"); err == nil {
+		t.Error("Expected sheet names with / to be rejected")
+	}
+}
+
+func TestSaveXLSXKeepsOldFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.xlsx")
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A directory where the file should be can't be replaced by a rename
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := saveXLSX(f, dir); err == nil {
+		t.Error("Expected saving over a directory to fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("Expected the existing file untouched, got %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %v", entries)
+	}
+}
+
+func TestXLSXExportImport(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	source, target := getCleanTable(), getCleanTable()
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s RECORDS
+		{_id: 1, name: 'Widget', price: 9.5, qty: 3, in_stock: TRUE, added_at: TIMESTAMP '2024-02-01T10:15:00Z', dims: {w: 2, h: 3}},
+		{_id: 2, name: 'Gadget', price: 20.25, qty: 0, in_stock: FALSE, added_at: TIMESTAMP '2024-02-03T08:00:30Z'}`, source))
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "products.xlsx")
+	err = ExportXLSX(ctx, conn, path,
+		XLSXSheet{Name: "Products", Query: fmt.Sprintf("SELECT _id, name, price, qty, in_stock, added_at, dims FROM %s ORDER BY _id", source)},
+		XLSXSheet{Name: "Summary", Query: fmt.Sprintf("SELECT COUNT(*) AS n FROM %s", source)})
+	if err != nil {
+		t.Fatalf("ExportXLSX failed: %v", err)
+	}
+
+	summary, err := ReadXLSXSheet(path, "Summary")
+	if err != nil || len(summary) != 2 || summary[1][0] != int64(2) {
+		t.Errorf("Expected a summary sheet with n=2, got %v, %v", summary, err)
+	}
+
+	n, err := ImportXLSX(ctx, conn, path, "Products", target, XLSXMapping{
+		IDColumn: "_id",
+		Columns:  map[string]string{"name": "product", "price": "price", "qty": "qty", "in_stock": "in_stock", "added_at": "added_at"},
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("ImportXLSX: expected 2 records, got %d, %v", n, err)
+	}
+
+	var (
+		product string
+		price   float64
+		qty     int64
+		inStock bool
+		addedAt time.Time
+		hasDims bool
+	)
+	err = conn.QueryRow(ctx, fmt.Sprintf("SELECT product, price, qty, in_stock, added_at, dims IS NOT NULL FROM %s WHERE _id = 1", target)).
+		Scan(&product, &price, &qty, &inStock, &addedAt, &hasDims)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if product != "Widget" || price != 9.5 || qty != 3 || !inStock || hasDims {
+		t.Errorf("Unexpected imported row: %s %v %d %v dims=%v", product, price, qty, inStock, hasDims)
+	}
+	if !addedAt.Equal(time.Date(2024, 2, 1, 10, 15, 0, 0, time.UTC)) {
+		t.Errorf("Expected added_at to survive as a timestamp, got %v", addedAt)
+	}
+}
@@ -0,0 +1,32 @@
+package xtdb_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+func ExampleEncoder_EncodeValue() {
+	enc := &xtdb.Encoder{}
+	fmt.Println(enc.EncodeValue([]interface{}{"admin", int64(9007199254740993), xtdb.Keyword("active")}))
+	fmt.Println(enc.EncodeValue(time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)))
+	fmt.Println(enc.EncodeValue(xtdb.NewSet("b", "a")))
+	// Output:
+	// ["admin","~i9007199254740993","~:active"]
+	// "~t2024-01-15T10:30:00Z"
+	// ["~#set",["a","b"]]
+}
+
+func ExampleDecodeValue() {
+	raw := `["^ ","~:_id","alice","~:joined","~t2024-01-15T10:30:00Z","~:roles",["~#set",["admin"]]]`
+	user := xtdb.StripKeywordKeys(xtdb.DecodeValue(raw)).(map[string]interface{})
+
+	fmt.Println(user["_id"])
+	fmt.Println(user["joined"].(time.Time).Year())
+	fmt.Println(user["roles"].(xtdb.Set).Contains("admin"))
+	// Output:
+	// alice
+	// 2024
+	// true
+}
@@ -0,0 +1,85 @@
+package xtdb
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Literal renders a Go value as an XTDB SQL literal, for statements that
+// can't take it as a parameter, such as an id list in WHERE _id IN (...):
+// strings quoted, times as TIMESTAMP literals, UUIDs cast, maps as structs
+// with sorted keys (which must be plain identifiers) and slices as arrays.
+func Literal(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case *big.Int:
+		return v.String(), nil
+	case time.Time:
+		return fmt.Sprintf("TIMESTAMP '%s'", v.Format(time.RFC3339Nano)), nil
+	case uuid.UUID:
+		return fmt.Sprintf("CAST('%s' AS UUID)", v), nil
+	case [16]byte:
+		return fmt.Sprintf("CAST('%s' AS UUID)", uuid.UUID(v)), nil
+	case map[string]interface{}:
+		return structLiteral(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			lit, err := Literal(item)
+			if err != nil {
+				return "", fmt.Errorf("[%d]: %w", i, err)
+			}
+			items[i] = lit
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	default:
+		return "", fmt.Errorf("unsupported literal type %T", value)
+	}
+}
+
+// structLiteral renders a map as an XTDB struct literal with sorted keys
+func structLiteral(m map[string]interface{}) (string, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if !identifierPattern.MatchString(k) {
+			return "", fmt.Errorf("invalid field name %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		lit, err := Literal(m[k])
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", k, err)
+		}
+		fields[i] = k + ": " + lit
+	}
+	return "{" + strings.Join(fields, ", ") + "}", nil
+}
@@ -0,0 +1,34 @@
+package xtdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLiteral(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{"o'brien", `'o''brien'`},
+		{int64(42), "42"},
+		{1.5, "1.5"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "TIMESTAMP '2024-01-02T03:04:05Z'"},
+		{uuid.MustParse("6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6"), "CAST('6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6' AS UUID)"},
+		{map[string]interface{}{"b": true, "a": []interface{}{1, nil}}, "{a: [1, NULL], b: TRUE}"},
+	}
+	for _, c := range cases {
+		if got, err := Literal(c.value); err != nil || got != c.want {
+			t.Errorf("Literal(%v) = %s, %v, want %s", c.value, got, err, c.want)
+		}
+	}
+
+	if _, err := Literal(map[string]interface{}{"bad key": 1}); err == nil {
+		t.Error("Expected a field name that isn't an identifier to be rejected")
+	}
+	if _, err := Literal(struct{}{}); err == nil {
+		t.Error("Expected an unsupported type to be rejected")
+	}
+}
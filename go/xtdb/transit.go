@@ -0,0 +1,831 @@
+package xtdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DecodeValue decodes a transit-encoded value: a value scanned from a
+// transit-fallback connection (a JSON string) or already parsed JSON.
+// Transit maps become map[string]interface{} with their keys still "~:"
+// keywords (see StripKeywordKeys).
+func DecodeValue(val interface{}) interface{} {
+	// Handle if val is already a decoded array or object (not a JSON string)
+	if arr, ok := val.([]interface{}); ok {
+		return decodeTransitArray(arr)
+	}
+
+	// Handle if val is a JSON string that needs parsing
+	str, ok := val.(string)
+	if !ok {
+		return val
+	}
+
+	// Try to parse as JSON
+	var data interface{}
+	if err := json.Unmarshal([]byte(str), &data); err != nil {
+		return decodeTransitScalar(str)
+	}
+
+	// Check if it's a transit structure
+	arr, ok := data.([]interface{})
+	if !ok {
+		if s, isString := data.(string); isString {
+			return decodeTransitScalar(s)
+		}
+		return data
+	}
+
+	return decodeTransitArray(arr)
+}
+
+// Keyword is a keyword value ("~:active"), without its "~:", kept
+// apart from plain strings so enum-like columns round-trip as keywords
+type Keyword string
+
+// decodeTransitScalar decodes a tagged scalar string such as "~i9007199254740993",
+// "~u<uuid>", "~t<timestamp>" or "~:keyword", unescapes "~~", "~^" and "~`",
+// and returns anything else unchanged
+func decodeTransitScalar(str string) interface{} {
+	switch {
+	case strings.HasPrefix(str, "~~"), strings.HasPrefix(str, "~^"), strings.HasPrefix(str, "~`"):
+		return str[1:]
+	case strings.HasPrefix(str, "~:"):
+		return Keyword(str[2:])
+	case strings.HasPrefix(str, "~t"):
+		if t, ok := parseTransitTime(str[2:]); ok {
+			return t
+		}
+	case strings.HasPrefix(str, "~i"):
+		if i, err := strconv.ParseInt(str[2:], 10, 64); err == nil {
+			return i
+		}
+		if i, ok := new(big.Int).SetString(str[2:], 10); ok {
+			return i
+		}
+	case strings.HasPrefix(str, "~u"):
+		if u, err := uuid.Parse(str[2:]); err == nil {
+			return u
+		}
+	}
+	return str
+}
+
+func decodeTransitArray(arr []interface{}) interface{} {
+	if len(arr) == 0 {
+		return arr
+	}
+
+	// Transit tagged value: [tag, value]
+	if len(arr) == 2 {
+		if tag, ok := arr[0].(string); ok && tag == "~#set" {
+			if items, ok := arr[1].([]interface{}); ok {
+				return decodeTransitSet(items)
+			}
+		}
+		if tag, ok := arr[0].(string); ok && transitTimeTags[tag] {
+			if str, ok := arr[1].(string); ok {
+				if t, ok := parseTransitTime(str); ok {
+					return t
+				}
+			}
+		}
+		if tag, ok := arr[0].(string); ok && strings.HasPrefix(tag, "~#") {
+			// For nested tagged values, recursively decode
+			return DecodeValue(arr[1])
+		}
+	}
+
+	// Transit map: ["^ ", key1, val1, key2, val2, ...]
+	if len(arr) > 0 {
+		if firstElem, ok := arr[0].(string); ok && firstElem == "^ " {
+			result := make(map[string]interface{})
+			for i := 1; i < len(arr); i += 2 {
+				if i+1 >= len(arr) {
+					break
+				}
+				key := fmt.Sprintf("%v", arr[i])
+				// Recursively decode the value (handles nested maps)
+				value := DecodeValue(arr[i+1])
+
+				result[key] = value
+			}
+			return result
+		}
+	}
+
+	// Regular array - recursively decode elements
+	result := make([]interface{}, len(arr))
+	for i, elem := range arr {
+		result[i] = DecodeValue(elem)
+	}
+	return result
+}
+
+// Set is a decoded ["~#set", [...]]: membership without order
+type Set map[interface{}]struct{}
+
+// NewSet builds a set of items, which must be comparable
+func NewSet(items ...interface{}) Set {
+	set := make(Set, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+	return set
+}
+
+// Contains reports whether item is a member of s
+func (s Set) Contains(item interface{}) bool {
+	_, ok := s[item]
+	return ok
+}
+
+// decodeTransitSet decodes a set's members. A set holding maps or vectors,
+// which can't be map keys, decodes as a plain slice instead.
+func decodeTransitSet(items []interface{}) interface{} {
+	decoded := make([]interface{}, len(items))
+	for i, item := range items {
+		decoded[i] = DecodeValue(item)
+		if decoded[i] != nil && !reflect.TypeOf(decoded[i]).Comparable() {
+			return DecodeValue(items)
+		}
+	}
+	return NewSet(decoded...)
+}
+
+// transitTimeTags are the tagged forms XTDB writes instants in
+var transitTimeTags = map[string]bool{
+	"~#time/instant":          true,
+	"~#time/zoned-date-time":  true,
+	"~#time/offset-date-time": true,
+}
+
+// parseTransitTime parses an ISO-8601 instant, with or without seconds,
+// and with an optional zone annotation such as "[Europe/London]", which
+// becomes the returned time's location
+func parseTransitTime(str string) (time.Time, bool) {
+	var loc *time.Location
+	if i := strings.IndexByte(str, '['); i > 0 && strings.HasSuffix(str, "]") {
+		zone, err := time.LoadLocation(str[i+1 : len(str)-1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		str, loc = str[:i], zone
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, str); err == nil {
+			if loc != nil {
+				t = t.In(loc)
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Unmarshal decodes transit-JSON data into the value v points to, the
+// way json.Unmarshal does for JSON. It reads data token by token, filling
+// structs, maps and slices as it goes rather than decoding a generic
+// document first; only interface{} destinations get one, as DecodeValue
+// would build. Struct fields are matched by their transit tag, then their
+// json tag, then their name case-insensitively. Numbers convert to any
+// numeric field they fit, "~t" instants, tagged times and dates to
+// time.Time, and "~u" or plain strings to uuid.UUID.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("transit: Unmarshal needs a non-nil pointer, got %T", v)
+	}
+	d := transitDecoder{json.NewDecoder(bytes.NewReader(data))}
+	d.dec.UseNumber()
+	if err := d.decode("$", rv.Elem()); err != nil {
+		return err
+	}
+	if _, err := d.dec.Token(); err != io.EOF {
+		return fmt.Errorf("transit: unexpected data after the value")
+	}
+	return nil
+}
+
+// transitDecoder reads transit-JSON values from dec straight into Go values
+type transitDecoder struct {
+	dec *json.Decoder
+}
+
+// token reads the next JSON token; running out of data is an error
+func (d transitDecoder) token() (json.Token, error) {
+	tok, err := d.dec.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transit: %w", err)
+	}
+	return tok, nil
+}
+
+// decode reads the next value into dst; path locates dst in errors
+func (d transitDecoder) decode(path string, dst reflect.Value) error {
+	tok, err := d.token()
+	if err != nil {
+		return err
+	}
+	return d.decodeToken(path, dst, tok)
+}
+
+// decodeToken reads the value starting with tok into dst
+func (d transitDecoder) decodeToken(path string, dst reflect.Value, tok json.Token) error {
+	if tok == nil {
+		return assignTransit(path, dst, nil)
+	}
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+	if dst.Kind() == reflect.Interface {
+		// Nothing says what to build, so decode as DecodeValue does
+		raw, err := d.raw(tok)
+		if err != nil {
+			return err
+		}
+		return assignTransit(path, dst, StripKeywordKeys(DecodeValue(raw)))
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return assignTransit(path, dst, transitScalar(tok))
+	}
+	if delim == '{' {
+		return d.entries(path, dst)
+	}
+	if !d.dec.More() {
+		if _, err := d.token(); err != nil {
+			return err
+		}
+		return assignTransit(path, dst, []interface{}{})
+	}
+	first, err := d.token()
+	if err != nil {
+		return err
+	}
+	if s, ok := first.(string); ok {
+		switch {
+		case s == "^ ":
+			return d.entries(path, dst)
+		case strings.HasPrefix(s, "~#"):
+			// A tagged value, e.g. ["~#set", [...]] or ["~#time/date",
+			// "2020-01-15"], decodes as its representation
+			if err := d.decode(path, dst); err != nil {
+				return err
+			}
+			if d.dec.More() {
+				return fmt.Errorf("transit: %s: tagged value %s has more than one element", path, s)
+			}
+			_, err := d.token()
+			return err
+		}
+	}
+	return d.elements(path, dst, first)
+}
+
+// entries reads the rest of a transit map (or JSON object) into dst, a
+// struct or a map with string keys. Keys lose their "~:".
+func (d transitDecoder) entries(path string, dst reflect.Value) error {
+	switch {
+	case dst.Kind() == reflect.Struct && dst.Type() != timeType:
+	case dst.Kind() == reflect.Map && dst.Type().Key().Kind() == reflect.String:
+		dst.Set(reflect.MakeMap(dst.Type()))
+	default:
+		return fmt.Errorf("transit: %s: cannot unmarshal a map into %s", path, dst.Type())
+	}
+
+	for d.dec.More() {
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("transit: %s: unexpected map key %v", path, tok)
+		}
+		key = strings.TrimPrefix(key, "~:")
+
+		if dst.Kind() == reflect.Map {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := d.decode(path+"."+key, elem); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+			continue
+		}
+		if i, ok := transitField(dst.Type(), key); ok {
+			err = d.decode(path+"."+key, dst.Field(i))
+		} else {
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := d.token()
+	return err
+}
+
+// elements reads the rest of an array, whose first element starts with
+// first, into dst, a slice
+func (d transitDecoder) elements(path string, dst reflect.Value, first json.Token) error {
+	if dst.Kind() != reflect.Slice {
+		return fmt.Errorf("transit: %s: cannot unmarshal an array into %s", path, dst.Type())
+	}
+	out := reflect.MakeSlice(dst.Type(), 0, 1)
+	for i, tok := 0, first; ; i++ {
+		out = reflect.Append(out, reflect.Zero(dst.Type().Elem()))
+		if err := d.decodeToken(fmt.Sprintf("%s[%d]", path, i), out.Index(i), tok); err != nil {
+			return err
+		}
+		if !d.dec.More() {
+			break
+		}
+		var err error
+		if tok, err = d.token(); err != nil {
+			return err
+		}
+	}
+	dst.Set(out)
+	_, err := d.token()
+	return err
+}
+
+// raw reads the value starting with tok as json.Unmarshal would into an
+// interface{}
+func (d transitDecoder) raw(tok json.Token) (interface{}, error) {
+	switch t := tok.(type) {
+	case json.Number:
+		return t.Float64()
+	case json.Delim:
+		var value interface{}
+		object := map[string]interface{}{}
+		array := []interface{}{}
+		for d.dec.More() {
+			var key string
+			if t == '{' {
+				k, err := d.token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ = k.(string)
+			}
+			next, err := d.token()
+			if err != nil {
+				return nil, err
+			}
+			if value, err = d.raw(next); err != nil {
+				return nil, err
+			}
+			if t == '{' {
+				object[key] = value
+			} else {
+				array = append(array, value)
+			}
+		}
+		if _, err := d.token(); err != nil {
+			return nil, err
+		}
+		if t == '{' {
+			return object, nil
+		}
+		return array, nil
+	}
+	return tok, nil
+}
+
+// skip reads past the next value
+func (d transitDecoder) skip() error {
+	depth := 0
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			if delim == '[' || delim == '{' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// transitScalar converts a scalar token as DecodeValue does, except that
+// integers keep their precision as int64 or *big.Int
+func transitScalar(tok json.Token) interface{} {
+	switch t := tok.(type) {
+	case string:
+		return decodeTransitScalar(t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if i, ok := new(big.Int).SetString(string(t), 10); ok {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return tok
+}
+
+// transitField finds the field of struct type t that key decodes into:
+// the one named key, else the first whose name matches it ignoring case
+func transitField(t reflect.Type, key string) (int, bool) {
+	fold := -1
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := transitFieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		if name == key {
+			return i, true
+		}
+		if fold < 0 && strings.EqualFold(name, key) {
+			fold = i
+		}
+	}
+	return fold, fold >= 0
+}
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// assignTransit stores a decoded transit scalar (or empty array) in dst,
+// converting it to dst's type, or any decoded value in an interface{};
+// path locates dst in errors
+func assignTransit(path string, dst reflect.Value, src interface{}) error {
+	mismatch := func() error {
+		return fmt.Errorf("transit: %s: cannot unmarshal %T into %s", path, src, dst.Type())
+	}
+	if src == nil {
+		dst.SetZero()
+		return nil
+	}
+
+	switch dst.Type() {
+	case timeType:
+		switch s := src.(type) {
+		case time.Time:
+			dst.Set(reflect.ValueOf(s))
+		case string:
+			t, ok := parseTransitTime(s)
+			if !ok {
+				// A date, e.g. from ["~#time/date", "2020-01-15"]
+				date, err := time.Parse("2006-01-02", s)
+				if err != nil {
+					return mismatch()
+				}
+				t = date
+			}
+			dst.Set(reflect.ValueOf(t))
+		default:
+			return mismatch()
+		}
+		return nil
+	case uuidType:
+		switch s := src.(type) {
+		case uuid.UUID:
+			dst.Set(reflect.ValueOf(s))
+		case string:
+			u, err := uuid.Parse(s)
+			if err != nil {
+				return mismatch()
+			}
+			dst.Set(reflect.ValueOf(u))
+		default:
+			return mismatch()
+		}
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignTransit(path, dst.Elem(), src)
+
+	case reflect.Interface:
+		if !reflect.TypeOf(src).AssignableTo(dst.Type()) {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(src))
+
+	case reflect.Slice:
+		// Only an empty array gets here; transitDecoder fills the rest
+		items, ok := src.([]interface{})
+		if !ok || len(items) > 0 {
+			return mismatch()
+		}
+		dst.Set(reflect.MakeSlice(dst.Type(), 0, 0))
+
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			dst.SetString(s)
+		case Keyword:
+			dst.SetString(string(s))
+		default:
+			return mismatch()
+		}
+
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := transitInteger(src)
+		if !ok || !n.IsInt64() || dst.OverflowInt(n.Int64()) {
+			return mismatch()
+		}
+		dst.SetInt(n.Int64())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := transitInteger(src)
+		if !ok || !n.IsUint64() || dst.OverflowUint(n.Uint64()) {
+			return mismatch()
+		}
+		dst.SetUint(n.Uint64())
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch s := src.(type) {
+		case float64:
+			f = s
+		case int64:
+			f = float64(s)
+		case *big.Int:
+			f, _ = new(big.Float).SetInt(s).Float64()
+		default:
+			return mismatch()
+		}
+		dst.SetFloat(f)
+
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// transitFieldName is the key a struct field is decoded from, false for
+// unexported fields and ones tagged "-"
+func transitFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	for _, key := range []string{"transit", "json"} {
+		if tag, ok := field.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				return "", false
+			}
+			if name != "" {
+				return name, true
+			}
+		}
+	}
+	return field.Name, true
+}
+
+// transitInteger reads a decoded number as an integer, rejecting floats
+// with a fractional part
+func transitInteger(src interface{}) (*big.Int, bool) {
+	switch s := src.(type) {
+	case int64:
+		return big.NewInt(s), true
+	case *big.Int:
+		return s, true
+	case float64:
+		if s != math.Trunc(s) || math.IsInf(s, 0) {
+			return nil, false
+		}
+		n, _ := big.NewFloat(s).Int(nil)
+		return n, true
+	}
+	return nil, false
+}
+
+// Encoder provides basic transit-JSON encoding
+type Encoder struct{}
+
+// Double is a float64 that's always written with a decimal point (1.0, not
+// 1), so a reader that tells integers from doubles, as XTDB does, keeps a
+// whole-number value a double
+type Double float64
+
+// maxSafeInteger is the largest integer a JSON reader holding numbers as
+// float64 reads back exactly (2^53 - 1); anything bigger is written as "~i..."
+const maxSafeInteger = 1<<53 - 1
+
+// encodeInteger writes i as a JSON number when it's in the safe range and
+// as a transit integer tag otherwise
+func encodeInteger(i *big.Int) string {
+	if i.IsInt64() && i.Int64() >= -maxSafeInteger && i.Int64() <= maxSafeInteger {
+		return i.String()
+	}
+	return `"~i` + i.String() + `"`
+}
+
+// EncodeValue encodes a Go value to transit-JSON format
+func (e *Encoder) EncodeValue(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return e.EncodeMap(v)
+	case []interface{}:
+		encoded := make([]string, len(v))
+		for i, item := range v {
+			encoded[i] = e.EncodeValue(item)
+		}
+		return "[" + strings.Join(encoded, ",") + "]"
+	case Set:
+		// Sorted so the same set always encodes the same way
+		encoded := make([]string, 0, len(v))
+		for item := range v {
+			encoded = append(encoded, e.EncodeValue(item))
+		}
+		sort.Strings(encoded)
+		return `["~#set",[` + strings.Join(encoded, ",") + `]]`
+	case string:
+		// Strings that look like transit tags are escaped with a leading ~
+		if strings.HasPrefix(v, "~") || strings.HasPrefix(v, "^") || strings.HasPrefix(v, "`") {
+			v = "~" + v
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	case Keyword:
+		data, _ := json.Marshal("~:" + string(v))
+		return string(data)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case Double:
+		encoded := e.EncodeValue(float64(v))
+		if !strings.ContainsAny(encoded, `."`) {
+			encoded += ".0"
+		}
+		return encoded
+	case float32:
+		// Formatted at 32 bits so 0.1 isn't written as 0.10000000149011612
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return e.EncodeValue(f)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 32)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return `"~zNaN"`
+		case math.IsInf(v, 1):
+			return `"~zINF"`
+		case math.IsInf(v, -1):
+			return `"~z-INF"`
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return encodeInteger(big.NewInt(int64(v)))
+	case int8:
+		return encodeInteger(big.NewInt(int64(v)))
+	case int16:
+		return encodeInteger(big.NewInt(int64(v)))
+	case int32:
+		return encodeInteger(big.NewInt(int64(v)))
+	case int64:
+		return encodeInteger(big.NewInt(v))
+	case uint:
+		return encodeInteger(new(big.Int).SetUint64(uint64(v)))
+	case uint8:
+		return encodeInteger(big.NewInt(int64(v)))
+	case uint16:
+		return encodeInteger(big.NewInt(int64(v)))
+	case uint32:
+		return encodeInteger(big.NewInt(int64(v)))
+	case uint64:
+		return encodeInteger(new(big.Int).SetUint64(v))
+	case *big.Int:
+		return encodeInteger(v)
+	case time.Time:
+		return fmt.Sprintf(`"~t%s"`, v.Format(time.RFC3339Nano))
+	case uuid.UUID:
+		return `"~u` + v.String() + `"`
+	case [16]byte:
+		return `"~u` + uuid.UUID(v).String() + `"`
+	case nil:
+		return "null"
+	default:
+		data, _ := json.Marshal(fmt.Sprintf("%v", v))
+		return string(data)
+	}
+}
+
+// EncodeMap encodes a map to transit-JSON map format
+func (e *Encoder) EncodeMap(data map[string]interface{}) string {
+	pairs := []string{}
+	for key, value := range data {
+		pairs = append(pairs, fmt.Sprintf(`"~:%s"`, key))
+		pairs = append(pairs, e.EncodeValue(value))
+	}
+	return `["^ ",` + strings.Join(pairs, ",") + `]`
+}
+
+// MaxLineSize bounds a single line StreamLines will read
+const MaxLineSize = 64 << 20
+
+// StreamLines decodes r one transit-JSON map per line, passing each
+// record (keys without their "~:") to fn as it's read, so files far larger
+// than memory can be inserted as they stream. Blank lines are skipped.
+// Errors, including fn's, carry the 1-based line number.
+func StreamLines(r io.Reader, fn func(map[string]interface{}) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		record, err := DecodeLine(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(record); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return nil
+}
+
+// DecodeLine decodes a single line of transit-JSON as StreamLines does: it
+// must be a transit map, and its keys lose their "~:"
+func DecodeLine(text []byte) (map[string]interface{}, error) {
+	var data interface{}
+	if err := json.Unmarshal(text, &data); err != nil {
+		return nil, err
+	}
+	arr, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a transit map, got %T", data)
+	}
+	record, ok := StripKeywordKeys(decodeTransitArray(arr)).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a transit map, got an array")
+	}
+	return record, nil
+}
+
+// StripKeywordKeys drops the "~:" keyword prefix from map keys at any depth
+func StripKeywordKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			result[strings.TrimPrefix(key, "~:")] = StripKeywordKeys(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = StripKeywordKeys(val)
+		}
+		return result
+	default:
+		return value
+	}
+}
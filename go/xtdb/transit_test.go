@@ -0,0 +1,374 @@
+package xtdb
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/xtdb/driver-examples/go/fixtures"
+)
+
+func TestStreamLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.transit.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Creating file failed: %v", err)
+	}
+	encoder := &Encoder{}
+	w := bufio.NewWriter(f)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintln(w, encoder.EncodeMap(map[string]interface{}{
+			"_id": fmt.Sprintf("user-%d", i), "n": i, "tags": []interface{}{"a", "b"},
+		}))
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Writing file failed: %v", err)
+	}
+	f.Close()
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("Opening file failed: %v", err)
+	}
+	defer f.Close()
+	count := 0
+	err = StreamLines(f, func(record map[string]interface{}) error {
+		if record["_id"] != fmt.Sprintf("user-%d", count) || record["n"] != float64(count) {
+			return fmt.Errorf("unexpected record %v", record)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamLines failed: %v", err)
+	}
+	if count != 10000 {
+		t.Errorf("Expected 10000 callbacks, got %d", count)
+	}
+
+	// The sample file streams too, with its unprefixed keys
+	sample, err := os.Open(filepath.Join(fixtures.DataDir, "sample-users-transit.json"))
+	if err != nil {
+		t.Fatalf("Opening sample failed: %v", err)
+	}
+	defer sample.Close()
+	var ids []string
+	if err := StreamLines(sample, func(record map[string]interface{}) error {
+		ids = append(ids, fmt.Sprint(record["_id"]))
+		return nil
+	}); err != nil || len(ids) == 0 || ids[0] != "alice" {
+		t.Errorf("Expected the sample users starting with alice, got %v, %v", ids, err)
+	}
+}
+
+func TestStreamLinesErrors(t *testing.T) {
+	noop := func(map[string]interface{}) error { return nil }
+
+	input := `["^ ","~:_id","a"]` + "\n\n" + `["^ ","~:_id","b"]` + "\n" + `["^ ","~:_id",` + "\n"
+	err := StreamLines(strings.NewReader(input), noop)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Errorf("Expected the truncated line 4 reported, got %v", err)
+	}
+
+	err = StreamLines(strings.NewReader(`["a","b"]`), noop)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 1: expected a transit map") {
+		t.Errorf("Expected a non-map line rejected, got %v", err)
+	}
+
+	err = StreamLines(strings.NewReader(`["^ ","~:_id","a"]`+"\n"+`["^ ","~:_id","b"]`),
+		func(record map[string]interface{}) error {
+			if record["_id"] == "b" {
+				return fmt.Errorf("insert failed")
+			}
+			return nil
+		})
+	if err == nil || err.Error() != "line 2: insert failed" {
+		t.Errorf("Expected fn's error with its line, got %v", err)
+	}
+}
+
+func TestTransitEncodeNumbers(t *testing.T) {
+	encoder := &Encoder{}
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{42, "42"},
+		{int64(maxSafeInteger), "9007199254740991"},
+		{int32(5), "5"},
+		{int16(-7), "-7"},
+		{uint(8), "8"},
+		{uint32(math.MaxUint32), "4294967295"},
+		{float32(1.5), "1.5"},
+		{float32(0.1), "0.1"},
+		{int64(9007199254740993), `"~i9007199254740993"`},
+		{int64(-9007199254740993), `"~i-9007199254740993"`},
+		{uint64(math.MaxUint64), `"~i18446744073709551615"`},
+		{huge, `"~i123456789012345678901234567890"`},
+		{float64(1000000), "1000000"},
+		{1.5, "1.5"},
+		{1e-7, "0.0000001"},
+		{Double(2), "2.0"},
+		{Double(1.5), "1.5"},
+		{math.NaN(), `"~zNaN"`},
+	}
+	for _, c := range cases {
+		if got := encoder.EncodeValue(c.value); got != c.want {
+			t.Errorf("EncodeValue(%v) = %s, want %s", c.value, got, c.want)
+		}
+	}
+
+	if got := DecodeValue(`"~i9007199254740993"`); got != int64(9007199254740993) {
+		t.Errorf("Expected ~i tag to decode to int64 9007199254740993, got %T %v", got, got)
+	}
+	if got, ok := DecodeValue(`"~i123456789012345678901234567890"`).(*big.Int); !ok || got.Cmp(huge) != 0 {
+		t.Errorf("Expected an out-of-range ~i tag to decode to *big.Int, got %v", got)
+	}
+}
+
+func TestTransitEncodeUUID(t *testing.T) {
+	encoder := &Encoder{}
+	id := uuid.MustParse("6f1c8d4e-2b7a-4c1e-9f3d-0a5b6c7d8e9f")
+	want := `"~u6f1c8d4e-2b7a-4c1e-9f3d-0a5b6c7d8e9f"`
+	if got := encoder.EncodeValue(id); got != want {
+		t.Errorf("EncodeValue(uuid.UUID) = %s, want %s", got, want)
+	}
+	if got := encoder.EncodeValue([16]byte(id)); got != want {
+		t.Errorf("EncodeValue([16]byte) = %s, want %s", got, want)
+	}
+	if got := DecodeValue(want); got != id {
+		t.Errorf("Expected ~u tag to decode to uuid.UUID %v, got %T %v", id, got, got)
+	}
+	if got := DecodeValue(`"~unot-a-uuid"`); got != "~unot-a-uuid" {
+		t.Errorf("Expected a malformed ~u value to stay a string, got %T %v", got, got)
+	}
+}
+
+func TestTransitEncodeTimes(t *testing.T) {
+	encoder := &Encoder{}
+	cases := []struct {
+		value time.Time
+		want  string
+	}{
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), `"~t2024-01-02T03:04:05Z"`},
+		// XTDB's system and valid times have microseconds
+		{time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC), `"~t2024-01-02T03:04:05.123456Z"`},
+	}
+	for _, c := range cases {
+		got := encoder.EncodeValue(c.value)
+		if got != c.want {
+			t.Errorf("EncodeValue(%v) = %s, want %s", c.value, got, c.want)
+		}
+		if back, ok := DecodeValue(got).(time.Time); !ok || !back.Equal(c.value) {
+			t.Errorf("Expected %s to decode back to %v, got %v", got, c.value, back)
+		}
+	}
+}
+
+func TestTransitDecodeTimes(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Loading Europe/London failed: %v", err)
+	}
+	cases := []struct {
+		name     string
+		encoded  string
+		instant  time.Time
+		location string
+	}{
+		{"instant", `["~#time/instant", "2024-03-10T12:30:45.123Z"]`,
+			time.Date(2024, 3, 10, 12, 30, 45, 123000000, time.UTC), "UTC"},
+		{"zoned with a named zone", `["~#time/zoned-date-time", "2024-07-01T09:00+01:00[Europe/London]"]`,
+			time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC), "Europe/London"},
+		{"zoned in UTC", `["~#time/zoned-date-time", "2020-01-15T00:00Z[UTC]"]`,
+			time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), "UTC"},
+		{"scalar ~t", `"~t2024-01-02T03:04:05Z"`,
+			time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "UTC"},
+	}
+	for _, c := range cases {
+		got, ok := DecodeValue(c.encoded).(time.Time)
+		if !ok {
+			t.Errorf("%s: expected time.Time, got %T", c.name, DecodeValue(c.encoded))
+			continue
+		}
+		if !got.Equal(c.instant) || got.Location().String() != c.location {
+			t.Errorf("%s: got %v in %v, want %v in %s", c.name, got, got.Location(), c.instant, c.location)
+		}
+	}
+
+	// A value in a map decodes too
+	doc := DecodeValue(`["^ ", "~:at", ["~#time/zoned-date-time", "2024-01-15T10:00Z[Europe/London]"]]`).(map[string]interface{})
+	if at, ok := doc["~:at"].(time.Time); !ok || !at.Equal(time.Date(2024, 1, 15, 10, 0, 0, 0, london)) {
+		t.Errorf("Expected 10:00 in Europe/London, got %T %v", doc["~:at"], doc["~:at"])
+	}
+
+	if got := DecodeValue(`["~#time/instant", "not a time"]`); got != "not a time" {
+		t.Errorf("Expected an unparseable instant to stay a string, got %T %v", got, got)
+	}
+}
+
+func TestTransitSets(t *testing.T) {
+	set := NewSet("admin", int64(2), "beta")
+
+	encoder := &Encoder{}
+	if got := encoder.EncodeValue(set); got != `["~#set",["admin","beta",2]]` {
+		t.Errorf("Unexpected encoding %s", got)
+	}
+
+	// Membership survives any element order
+	for _, encoded := range []string{`["~#set",["beta",2,"admin"]]`, `["~#set",[2,"admin","beta"]]`} {
+		got := DecodeValue(encoded)
+		if !reflect.DeepEqual(got, NewSet("admin", float64(2), "beta")) {
+			t.Errorf("%s decoded to %T %v", encoded, got, got)
+		}
+	}
+	if got := DecodeValue(`["~#set",[]]`); !reflect.DeepEqual(got, Set{}) {
+		t.Errorf("Expected an empty set, got %T %v", got, got)
+	}
+
+	// Members are decoded too, and unhashable ones leave a slice
+	got := DecodeValue(`["~#set",["~u6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6"]]`).(Set)
+	if !got.Contains(uuid.MustParse("6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6")) {
+		t.Errorf("Expected a UUID member, got %v", got)
+	}
+	if got := DecodeValue(`["~#set",[["^ ","~:a",1]]]`); !reflect.DeepEqual(got, []interface{}{map[string]interface{}{"~:a": float64(1)}}) {
+		t.Errorf("Expected a set of maps as a slice, got %T %v", got, got)
+	}
+}
+
+func TestTransitKeywords(t *testing.T) {
+	encoder := &Encoder{}
+	if got := encoder.EncodeValue(Keyword("active")); got != `"~:active"` {
+		t.Errorf("Unexpected encoding %s", got)
+	}
+
+	doc := DecodeValue(`["^ ","~:status","~:active","~:label","active"]`).(map[string]interface{})
+	if got, ok := doc["~:status"].(Keyword); !ok || got != "active" {
+		t.Errorf("Expected status to decode to Keyword(active), got %T %v", doc["~:status"], doc["~:status"])
+	}
+	if got, ok := doc["~:label"].(string); !ok || got != "active" {
+		t.Errorf("Expected label to stay a string, got %T %v", doc["~:label"], doc["~:label"])
+	}
+}
+
+func TestTransitEscapedStrings(t *testing.T) {
+	encoder := &Encoder{}
+	for _, s := range []string{"~:x", "~i1", "~u6f1c8d4e-2b7a-4c1e-9f3d-0a5b6c7d8e9f", "~t2024-01-02T03:04:05Z", "~~", "^ ", "`x", "plain"} {
+		encoded := encoder.EncodeValue(s)
+		if got := DecodeValue(encoded); got != s {
+			t.Errorf("Expected %q to round-trip via %s, got %T %v", s, encoded, got, got)
+		}
+	}
+	if got := encoder.EncodeValue("~:x"); got != `"~~:x"` {
+		t.Errorf("Expected a leading ~ to be escaped, got %s", got)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	encoder := &Encoder{}
+	data := encoder.EncodeMap(map[string]interface{}{
+		"_id":    "alice",
+		"name":   "Alice",
+		"age":    30,
+		"email":  "alice@example.com",
+		"active": true,
+		"salary": 85000.5,
+		"tags":   []interface{}{"admin", "dev"},
+		"metadata": map[string]interface{}{
+			"department": "Engineering",
+			"level":      int64(3),
+			"joined":     "2020-01-15",
+		},
+	})
+
+	var user fixtures.User
+	if err := Unmarshal([]byte(data), &user); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := fixtures.User{
+		ID: "alice", Name: "Alice", Age: 30, Email: "alice@example.com", Active: true, Salary: 85000.5,
+		Tags:     []string{"admin", "dev"},
+		Metadata: fixtures.UserMetadata{Department: "Engineering", Level: 3, Joined: "2020-01-15"},
+	}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("Expected %+v, got %+v", want, user)
+	}
+
+	// transit tags win over json tags; times, UUIDs, keywords and big integers convert
+	type event struct {
+		ID      uuid.UUID          `json:"_id"`
+		At      time.Time          `transit:"at" json:"ignored"`
+		Day     time.Time          `json:"day"`
+		Kind    string             `json:"kind"`
+		Count   uint64             `json:"count"`
+		Note    *string            `json:"note"`
+		Missing *string            `json:"missing"`
+		Roles   []string           `json:"roles"`
+		Extra   map[string]float64 `json:"extra"`
+		Any     interface{}        `json:"any"`
+		skipped string
+	}
+	id := uuid.MustParse("6f1c2e9a-3b4d-4c5e-8f70-91a2b3c4d5e6")
+	data = encoder.EncodeMap(map[string]interface{}{
+		"_id":   id,
+		"at":    time.Date(2024, 3, 10, 12, 30, 45, 0, time.UTC),
+		"kind":  Keyword("created"),
+		"count": uint64(math.MaxUint64),
+		"note":  "hello",
+		"roles": NewSet("ops"),
+		"extra": map[string]interface{}{"score": 1.5},
+		"any":   []interface{}{"x"},
+	})
+	// The encoder escapes tag-like strings, so a tagged date is spliced in
+	data = strings.TrimSuffix(data, "]") + `,"~:day",["~#time/date","2020-01-15"]]`
+	var ev event
+	if err := Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if ev.ID != id || !ev.At.Equal(time.Date(2024, 3, 10, 12, 30, 45, 0, time.UTC)) ||
+		!ev.Day.Equal(time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)) || ev.Kind != "created" ||
+		ev.Count != math.MaxUint64 || ev.Note == nil || *ev.Note != "hello" || ev.Missing != nil ||
+		!reflect.DeepEqual(ev.Roles, []string{"ops"}) || ev.Extra["score"] != 1.5 || !reflect.DeepEqual(ev.Any, []interface{}{"x"}) {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+
+	// Mismatches name the field, like json.Unmarshal's errors
+	var small struct {
+		Level int8 `json:"level"`
+	}
+	for _, bad := range []string{`["^ ","~:level",300]`, `["^ ","~:level",1.5]`, `["^ ","~:level","high"]`} {
+		if err := Unmarshal([]byte(bad), &small); err == nil || !strings.Contains(err.Error(), "$.level") {
+			t.Errorf("%s: expected an error naming $.level, got %v", bad, err)
+		}
+	}
+	if err := Unmarshal([]byte(`["^ "]`), small); err == nil {
+		t.Error("Expected a non-pointer to be rejected")
+	}
+
+	// Unknown keys are skipped, however nested; sets of maps fill slices of structs
+	var doc struct {
+		Items []struct {
+			N int `json:"n"`
+		} `json:"items"`
+	}
+	data = `["^ ","~:skip",["^ ","~:a",[1,["^ ","~:b",2]]],"~:items",["~#set",[["^ ","~:n",1]]]]`
+	if err := Unmarshal([]byte(data), &doc); err != nil || len(doc.Items) != 1 || doc.Items[0].N != 1 {
+		t.Errorf("Expected one item with n 1, got %+v (%v)", doc, err)
+	}
+	if err := Unmarshal([]byte(`["^ ","~:level",["^ ","~:x",1]]`), &small); err == nil || !strings.Contains(err.Error(), "$.level") {
+		t.Errorf("Expected a map into an int8 to name $.level, got %v", err)
+	}
+	if err := Unmarshal([]byte(`["^ ","~:level",1] ["^ "]`), &small); err == nil {
+		t.Error("Expected trailing data to be rejected")
+	}
+}
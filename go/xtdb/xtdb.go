@@ -0,0 +1,86 @@
+// Package xtdb is the glue the examples in this module share for talking to
+// XTDB over the PostgreSQL wire protocol with pgx: the parameter OIDs XTDB
+// reads records in, connecting with or without the transit fallback output
+// format, and a minimal transit-JSON encoder and decoder.
+//
+// Records are inserted with INSERT ... RECORDS $1 and an explicit OID, which
+// needs the low-level PgConn().ExecParams:
+//
+//	enc := &xtdb.Encoder{}
+//	data := enc.EncodeMap(map[string]interface{}{"_id": "alice", "name": "Alice"})
+//	conn.PgConn().ExecParams(ctx, "INSERT INTO users RECORDS $1",
+//		[][]byte{[]byte(data)}, []uint32{xtdb.TransitOID}, []int16{0}, nil)
+package xtdb
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// XTDB PostgreSQL wire protocol OIDs
+const (
+	TransitOID = 16384 // transit-JSON type OID
+	JSONOID    = 114   // JSON type OID
+)
+
+// Options locates an XTDB server. Zero values take the defaults the
+// examples run with: the host from XTDB_HOST, or "xtdb" (the docker-compose
+// service), port 5432 and database xtdb.
+type Options struct {
+	Host     string
+	Port     int
+	Database string
+	User     string
+	Password string
+}
+
+// ConnString is the postgres:// URL for the options
+func (o Options) ConnString() string {
+	return o.url(nil)
+}
+
+func (o Options) url(params url.Values) string {
+	host := o.Host
+	if host == "" {
+		host = os.Getenv("XTDB_HOST")
+	}
+	if host == "" {
+		host = "xtdb"
+	}
+	port := o.Port
+	if port == 0 {
+		port = 5432
+	}
+	database := o.Database
+	if database == "" {
+		database = "xtdb"
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawQuery: params.Encode(),
+	}
+	if o.User != "" {
+		u.User = url.UserPassword(o.User, o.Password)
+	}
+	return u.String()
+}
+
+// Connect opens a standard connection, for JSON and plain SQL
+func Connect(ctx context.Context, opts Options) (*pgx.Conn, error) {
+	return pgx.Connect(ctx, opts.ConnString())
+}
+
+// ConnectTransit opens a connection with fallback_output_format=transit, so
+// values without a PostgreSQL type (nested records, sets, keywords) come
+// back as transit-JSON for DecodeValue rather than as JSON
+func ConnectTransit(ctx context.Context, opts Options) (*pgx.Conn, error) {
+	return pgx.Connect(ctx, opts.url(url.Values{"fallback_output_format": {"transit"}}))
+}
@@ -0,0 +1,28 @@
+package xtdb
+
+import "testing"
+
+func TestOptionsConnString(t *testing.T) {
+	t.Setenv("XTDB_HOST", "")
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "postgres://xtdb:5432/xtdb"},
+		{Options{Host: "localhost", Port: 5433, Database: "other"}, "postgres://localhost:5433/other"},
+		{Options{Host: "::1", User: "xtdb", Password: "p@ss"}, "postgres://xtdb:p%40ss@[::1]:5432/xtdb"},
+	}
+	for _, c := range cases {
+		if got := c.opts.ConnString(); got != c.want {
+			t.Errorf("%+v: got %s, want %s", c.opts, got, c.want)
+		}
+	}
+
+	t.Setenv("XTDB_HOST", "db.internal")
+	if got := (Options{}).ConnString(); got != "postgres://db.internal:5432/xtdb" {
+		t.Errorf("Expected XTDB_HOST used, got %s", got)
+	}
+	if got := (Options{}).url(map[string][]string{"fallback_output_format": {"transit"}}); got != "postgres://db.internal:5432/xtdb?fallback_output_format=transit" {
+		t.Errorf("Unexpected transit URL %s", got)
+	}
+}
@@ -1,15 +1,85 @@
 package main
 
-// XTDB PostgreSQL wire protocol OIDs
+import (
+	"database/sql/driver"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+// XTDB PostgreSQL wire protocol OIDs, from the xtdb package
 const (
-	TransitOID = 16384 // transit-JSON type OID
-	JSONOID    = 114   // JSON type OID
+	TransitOID = xtdb.TransitOID // transit-JSON type OID
+	JSONOID    = xtdb.JSONOID    // JSON type OID
 )
 
-// Note: Go pgx driver requires using the low-level PgConn.ExecParams API
-// to specify parameter OIDs explicitly. See json_test.go and transit_test.go
-// for working examples.
+// Note: out of the box the Go pgx driver requires using the low-level
+// PgConn.ExecParams API to specify parameter OIDs explicitly. See
+// json_test.go and transit_test.go for working examples.
 //
 // The high-level Exec() method tries to use statement preparation with DESCRIBE,
-// which doesn't work with XTDB's INSERT...RECORDS syntax. Using ExecParams
-// bypasses statement preparation and sends parameters with explicit OIDs.
+// which doesn't work with XTDB's INSERT...RECORDS syntax: pgx has no codec for
+// the parameter type the server describes. RegisterXTDBTypes installs one, so
+// Exec() can be passed the encoded record directly.
+
+// RegisterXTDBTypes installs codecs for the transit-JSON and JSON OIDs into
+// conn's type map, so that
+//
+//	conn.Exec(ctx, "INSERT INTO t RECORDS $1", transitBytes)
+//
+// sends transitBytes through unchanged. Register once per connection; with a
+// pool, call it from AfterConnect.
+func RegisterXTDBTypes(conn *pgx.Conn) {
+	registerXTDBTypes(conn.TypeMap())
+}
+
+func registerXTDBTypes(m *pgtype.Map) {
+	m.RegisterType(&pgtype.Type{Name: "transit", OID: TransitOID, Codec: transitCodec{}})
+	m.RegisterType(&pgtype.Type{Name: "json", OID: JSONOID, Codec: pgtype.JSONCodec{}})
+}
+
+// transitCodec is a text-only codec for transit-JSON. Strings, byte slices
+// and json.RawMessage are sent as they are, anything else as JSON, which is
+// transit's verbose form. Values decode to the raw transit string, as they
+// do without the codec, for xtdb.DecodeValue.
+type transitCodec struct {
+	pgtype.JSONCodec
+}
+
+func (transitCodec) FormatSupported(format int16) bool {
+	return format == pgtype.TextFormatCode
+}
+
+func (c transitCodec) PlanScan(m *pgtype.Map, oid uint32, format int16, target any) pgtype.ScanPlan {
+	if _, ok := target.(*any); ok {
+		return scanPlanTransitToAny{}
+	}
+	return c.JSONCodec.PlanScan(m, oid, format, target)
+}
+
+func (transitCodec) DecodeDatabaseSQLValue(m *pgtype.Map, oid uint32, format int16, src []byte) (driver.Value, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return string(src), nil
+}
+
+func (transitCodec) DecodeValue(m *pgtype.Map, oid uint32, format int16, src []byte) (any, error) {
+	if src == nil {
+		return nil, nil
+	}
+	return string(src), nil
+}
+
+type scanPlanTransitToAny struct{}
+
+func (scanPlanTransitToAny) Scan(src []byte, target any) error {
+	if src == nil {
+		*target.(*any) = nil
+		return nil
+	}
+	*target.(*any) = string(src)
+	return nil
+}
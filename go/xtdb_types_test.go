@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/xtdb/driver-examples/go/xtdb"
+)
+
+func TestRegisterXTDBTypes(t *testing.T) {
+	m := pgtype.NewMap()
+	registerXTDBTypes(m)
+
+	transit := `["^ ","~:_id","a","~:tags",["~#set",["x"]]]`
+	for _, value := range []any{transit, []byte(transit)} {
+		buf, err := m.Encode(TransitOID, pgtype.TextFormatCode, value, nil)
+		if err != nil || string(buf) != transit {
+			t.Errorf("Expected %T passed through, got %q, %v", value, buf, err)
+		}
+	}
+	if m.FormatCodeForOID(TransitOID) != pgtype.TextFormatCode {
+		t.Errorf("Expected transit to use the text format")
+	}
+
+	var raw any
+	if err := m.Scan(TransitOID, pgtype.TextFormatCode, []byte(transit), &raw); err != nil || raw != transit {
+		t.Errorf("Expected the raw transit string back, got %#v, %v", raw, err)
+	}
+}
+
+func TestExecWithTransitParameter(t *testing.T) {
+	conn := getConn(t)
+	defer conn.Close(context.Background())
+	RegisterXTDBTypes(conn)
+
+	ctx := context.Background()
+	table := getCleanTable()
+	encoder := &xtdb.Encoder{}
+	record := encoder.EncodeMap(map[string]interface{}{"_id": "alice", "name": "Alice", "age": 30})
+
+	tag, err := conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s RECORDS $1", table), []byte(record))
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if !tag.Insert() {
+		t.Errorf("Expected an INSERT command tag, got %q", tag)
+	}
+
+	var name string
+	var age int64
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT name, age FROM %s WHERE _id = 'alice'", table)).Scan(&name, &age); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if name != "Alice" || age != 30 {
+		t.Errorf("Expected (Alice, 30), got (%s, %d)", name, age)
+	}
+}